@@ -26,6 +26,11 @@ func (c *CmdDebug) Run(ctx *Context) error {
 		return err
 	}
 
+	secretKey, err := c.useSecretKey()
+	if err != nil {
+		return err
+	}
+
 	hub := bus.NewHub(ctx)
 
 	dahua.Init(dahua.App{
@@ -34,6 +39,7 @@ func (c *CmdDebug) Run(ctx *Context) error {
 		AFS:        nil,
 		Store:      nil,
 		ScanLocker: dahua.ScanLocker{},
+		SecretKey:  secretKey,
 	})
 
 	hub.OnDahuaFileCreated("DEBUG", func(ctx context.Context, event bus.DahuaFileCreated) error {
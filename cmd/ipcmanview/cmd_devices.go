@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/dahua"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+)
+
+type CmdDevices struct {
+	Import CmdDevicesImport `cmd:"" help:"Create or update devices from a CSV or YAML file."`
+	Export CmdDevicesExport `cmd:"" help:"Write devices to a CSV or YAML file."`
+}
+
+type CmdDevicesImport struct {
+	Shared
+	File   string `arg:"" help:"File to import, - for stdin."`
+	Format string `enum:",csv,yaml" default:"" help:"File format, detected from the file extension when empty."`
+	DryRun bool   `help:"Validate the file without changing any devices."`
+}
+
+func (c *CmdDevicesImport) Run(ctx *Context) error {
+	format, err := deviceFileFormat(c.File, c.Format)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if c.File != "-" {
+		file, err := os.Open(c.File)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	records, err := dahua.ReadDeviceRecords(r, format)
+	if err != nil {
+		return err
+	}
+
+	store, err := c.initDevices(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	results, err := dahua.ImportDevices(core.WithSystemActor(ctx), dahua.ImportDevicesParams{
+		Records: records,
+		DryRun:  c.DryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, v := range results {
+		if v.Err != nil {
+			failed++
+			fmt.Printf("row %d: %s: %s\n", v.Row, v.Name, strings.ReplaceAll(v.Err.Error(), "\n", "; "))
+			continue
+		}
+		fmt.Printf("row %d: %s: %s\n", v.Row, v.Name, v.Action)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d rows failed", failed, len(results))
+	}
+
+	return nil
+}
+
+type CmdDevicesExport struct {
+	Shared
+	File             string `arg:"" help:"File to export to, - for stdout."`
+	Format           string `enum:",csv,yaml" default:"" help:"File format, detected from the file extension when empty."`
+	IncludePasswords bool   `help:"Include device passwords in plain text."`
+}
+
+func (c *CmdDevicesExport) Run(ctx *Context) error {
+	format, err := deviceFileFormat(c.File, c.Format)
+	if err != nil {
+		return err
+	}
+
+	store, err := c.initDevices(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	records, err := dahua.ExportDevices(core.WithSystemActor(ctx), dahua.ExportDevicesParams{
+		IncludePasswords: c.IncludePasswords,
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.File == "-" {
+		return dahua.WriteDeviceRecords(os.Stdout, format, records)
+	}
+
+	perm := os.FileMode(0644)
+	if c.IncludePasswords {
+		perm = 0600
+	}
+	file, err := os.OpenFile(c.File, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := dahua.WriteDeviceRecords(file, format, records); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+func (c *Shared) initDevices(ctx *Context) (*dahua.Store, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+
+	db, err := c.useDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	configProvider, err := system.NewConfigProvider(c.useConfigFilePath())
+	if err != nil {
+		return nil, err
+	}
+
+	secretKey, err := c.useSecretKey()
+	if err != nil {
+		return nil, err
+	}
+
+	store := dahua.NewStore()
+
+	system.Init(system.App{
+		DB: db,
+		CP: configProvider,
+	})
+	dahua.Init(dahua.App{
+		DB:         db,
+		Hub:        bus.NewHub(ctx),
+		Store:      store,
+		ScanLocker: dahua.NewScanLocker(),
+		SecretKey:  secretKey,
+	})
+
+	if err := dahua.EncryptCredentials(ctx); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func deviceFileFormat(file, format string) (string, error) {
+	if format != "" {
+		return format, nil
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		return dahua.DeviceFormatCSV, nil
+	case ".yaml", ".yml":
+		return dahua.DeviceFormatYAML, nil
+	default:
+		return "", fmt.Errorf("cannot detect format of %s, use --format", file)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/dahua"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/envelope"
+)
+
+type CmdSecretKey struct {
+	Rotate CmdSecretKeyRotate `cmd:"" help:"Encrypt device credentials with a new secret key, the server must be stopped."`
+}
+
+type CmdSecretKeyRotate struct {
+	Shared
+	NewSecretKey string `env:"NEW_SECRET_KEY" help:"Base64 encoded 32 byte key to rotate to, generated when empty."`
+}
+
+func (c *CmdSecretKeyRotate) Run(ctx *Context) error {
+	if err := c.init(); err != nil {
+		return err
+	}
+
+	// The server would keep using the old key and fail to decrypt the rotated credentials
+	if err := c.assertServerStopped(); err != nil {
+		return err
+	}
+
+	db, err := c.useDB(ctx)
+	if err != nil {
+		return err
+	}
+
+	secretKey, err := c.useSecretKey()
+	if err != nil {
+		return err
+	}
+
+	var newKey envelope.Key
+	if c.NewSecretKey != "" {
+		newKey, err = envelope.ParseKey(c.NewSecretKey)
+	} else {
+		newKey, err = envelope.NewKey()
+	}
+	if err != nil {
+		return err
+	}
+
+	dahua.Init(dahua.App{
+		DB:        db,
+		SecretKey: secretKey,
+	})
+
+	if c.SecretKey != "" {
+		if err := dahua.RotateSecretKey(ctx, newKey); err != nil {
+			return err
+		}
+
+		fmt.Println("Credentials are encrypted with the new secret key, replace SECRET_KEY with it:")
+		fmt.Println(newKey.String())
+		return nil
+	}
+
+	// Write the new key next to the old one first so it is not lost when the rotation succeeds but replacing the file fails
+	filePath := c.useSecretKeyFilePath()
+	newFilePath := filePath + ".new"
+	if err := os.WriteFile(newFilePath, []byte(newKey.String()+"\n"), 0600); err != nil {
+		return err
+	}
+
+	if err := dahua.RotateSecretKey(ctx, newKey); err != nil {
+		os.Remove(newFilePath)
+		return err
+	}
+
+	if err := os.Rename(newFilePath, filePath); err != nil {
+		return fmt.Errorf("credentials are encrypted with the key in %s but it could not replace %s: %w", newFilePath, filePath, err)
+	}
+
+	fmt.Printf("Credentials are encrypted with the new secret key %s in %s.\n", newKey.ID(), filePath)
+	return nil
+}
@@ -23,9 +23,11 @@ var mainCmd struct {
 	LoggingLevel string `env:"LOGGING_LEVEL" enum:"debug,info,warn,error" default:"info"`
 	LoggingType  string `env:"LOGGING_TYPE" enum:"json,console" default:"console"`
 
-	Debug_  CmdDebug   `name:"debug" cmd:""`
-	Serve   CmdServe   `cmd:"" help:"Start application." default:"1"`
-	Version CmdVersion `cmd:"" help:"Show version."`
+	Debug_    CmdDebug     `name:"debug" cmd:""`
+	Devices   CmdDevices   `cmd:"" help:"Import or export devices."`
+	SecretKey CmdSecretKey `cmd:"" help:"Manage the key that encrypts device credentials."`
+	Serve     CmdServe     `cmd:"" help:"Start application." default:"1"`
+	Version   CmdVersion   `cmd:"" help:"Show version."`
 }
 
 func main() {
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
 	"github.com/ItsNotGoodName/ipcmanview/internal/server"
 	"github.com/ItsNotGoodName/ipcmanview/internal/sqlite"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/envelope"
 	"github.com/spf13/afero"
 )
 
@@ -15,7 +19,9 @@ func mkdir(dir string) error {
 }
 
 type Shared struct {
-	Dir string `default:"ipcmanview_data" env:"DIR" help:"Directory path for storing data."`
+	Dir           string `default:"ipcmanview_data" env:"DIR" help:"Directory path for storing data."`
+	SecretKey     string `env:"SECRET_KEY" help:"Base64 encoded 32 byte key for encrypting device credentials, takes precedence over the secret key file."`
+	SecretKeyFile string `env:"SECRET_KEY_FILE" help:"File path of the key for encrypting device credentials, created when it does not exist (default: secret.key in the data directory)."`
 }
 
 func (c *Shared) init() error {
@@ -35,6 +41,18 @@ func (c Shared) useDahuaAFS() (afero.Fs, error) {
 	return afero.NewBasePathFs(afero.NewOsFs(), dir), nil
 }
 
+// useDahuaLiveDir returns an empty directory for live stream files, which do not survive restarts.
+func (c Shared) useDahuaLiveDir() (string, error) {
+	dir := filepath.Join(c.Dir, "dahua-live")
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	if err := mkdir(dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
 func (c Shared) useDB(ctx *Context) (sqlite.DB, error) {
 	sqlDB, err := sqlite.New(filepath.Join(c.Dir, "sqlite.db"))
 	if err != nil {
@@ -48,6 +66,64 @@ func (c Shared) useDB(ctx *Context) (sqlite.DB, error) {
 	return sqlite.NewDB(sqlDB), nil
 }
 
+func (c Shared) useSecretKeyFilePath() string {
+	if c.SecretKeyFile != "" {
+		return c.SecretKeyFile
+	}
+	return filepath.Join(c.Dir, "secret.key")
+}
+
+func (c Shared) useSecretKey() (envelope.Key, error) {
+	if c.SecretKey != "" {
+		return envelope.ParseKey(c.SecretKey)
+	}
+
+	filePath := c.useSecretKeyFilePath()
+	b, err := os.ReadFile(filePath)
+	if err == nil {
+		return envelope.ParseKey(string(b))
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return envelope.Key{}, err
+	}
+
+	key, err := envelope.NewKey()
+	if err != nil {
+		return envelope.Key{}, err
+	}
+	if err := os.WriteFile(filePath, []byte(key.String()+"\n"), 0600); err != nil {
+		return envelope.Key{}, err
+	}
+
+	return key, nil
+}
+
+func (c Shared) useServerLockFilePath() string {
+	return filepath.Join(c.Dir, "server.lock")
+}
+
+// useServerLock marks the server as running until the returned function is called.
+func (c Shared) useServerLock() (func(), error) {
+	filePath := c.useServerLockFilePath()
+	if err := os.WriteFile(filePath, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return nil, err
+	}
+	return func() { os.Remove(filePath) }, nil
+}
+
+// assertServerStopped returns an error if the server is running on the data directory.
+func (c Shared) assertServerStopped() error {
+	filePath := c.useServerLockFilePath()
+	_, err := os.Stat(filePath)
+	if err == nil {
+		return fmt.Errorf("server is running, stop it first or remove %s if it is not running", filePath)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
 func (c Shared) useConfigFilePath() string {
 	return filepath.Join(c.Dir, "config.toml")
 }
@@ -1,29 +1,45 @@
 package api
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"path"
 	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
 	"github.com/ItsNotGoodName/ipcmanview/internal/dahua"
 	"github.com/ItsNotGoodName/ipcmanview/internal/models"
 	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
 	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuacgi"
-	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc"
 	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc/modules/mediafilefind"
 	echo "github.com/labstack/echo/v4"
 	"github.com/spf13/afero"
 )
 
 func (s *Server) DahuaAfero(prefix string) echo.HandlerFunc {
-	return echo.WrapHandler(http.StripPrefix(prefix, http.FileServer(afero.NewHttpFs(s.dahuaAFS))))
+	handler := echo.WrapHandler(http.StripPrefix(prefix, http.FileServer(afero.NewHttpFs(s.dahuaAFS))))
+	return func(c echo.Context) error {
+		name := strings.TrimPrefix(c.Param("*"), "/")
+
+		ok, err := dahua.AferoFileLevel(c.Request().Context(), name, models.DahuaPermissionLevel_User)
+		if err != nil {
+			if core.IsNotFound(err) {
+				return echo.ErrNotFound.WithInternal(err)
+			}
+			return err
+		}
+		if !ok {
+			return echo.ErrForbidden
+		}
+
+		return handler(c)
+	}
 }
 
 func (s *Server) DahuaDevices(c echo.Context) error {
@@ -50,7 +66,7 @@ func (s *Server) DahuaDevicesIDRPCPOST(c echo.Context) error {
 		return err
 	}
 
-	if err := assertDahuaLevel(c, s, id, models.DahuaPermissionLevel_Admin); err != nil {
+	if err := assertDahuaLevel(c, s, id, models.DahuaPermissionLevel_User); err != nil {
 		return err
 	}
 
@@ -68,13 +84,19 @@ func (s *Server) DahuaDevicesIDRPCPOST(c echo.Context) error {
 		return echo.ErrBadRequest.WithInternal(err)
 	}
 
-	res, err := dahuarpc.SendRaw[json.RawMessage](ctx, client.RPC, dahuarpc.New(req.Method).
-		Params(req.Params).
-		Object(req.Object))
+	cfg, err := system.GetConfig()
 	if err != nil {
 		return err
 	}
 
+	res, err := dahua.SendRPC(ctx, cfg.RPC, client, req.Method, req.Params, req.Object)
+	if err != nil {
+		if core.IsForbidden(err) {
+			return echo.NewHTTPError(http.StatusForbidden, err.Error()).WithInternal(err)
+		}
+		return err
+	}
+
 	return c.JSON(http.StatusOK, res)
 }
 
@@ -215,7 +237,7 @@ func (s *Server) DahuaDevicesIDEvents(c echo.Context) error {
 
 	for e := range eventsC {
 		evt, ok := e.(bus.DahuaEvent)
-		if !ok || evt.Event.DeviceID != id {
+		if !ok || evt.Event.DeviceID != id || evt.Event.Maintenance {
 			continue
 		}
 
@@ -240,6 +262,8 @@ func (s *Server) DahuaEvents(c echo.Context) error {
 		return err
 	}
 
+	tags := c.QueryParams()["tag"]
+
 	sub, eventsC, err := s.pub.
 		Subscribe().
 		Middleware(dahua.PubSubMiddleware(ctx)).
@@ -253,9 +277,19 @@ func (s *Server) DahuaEvents(c echo.Context) error {
 
 	for event := range eventsC {
 		e, ok := event.(bus.DahuaEvent)
-		if !ok || !slices.Contains(ids, e.Event.DeviceID) {
+		if !ok || e.Event.Maintenance {
 			continue
 		}
+		if !slices.Contains(ids, e.Event.DeviceID) {
+			// Tags are checked on every event so that tag changes apply without resubscribing
+			tagged, err := dahua.DeviceHasTags(ctx, e.Event.DeviceID, tags)
+			if err != nil {
+				return writeStreamError(c, stream, err)
+			}
+			if !tagged {
+				continue
+			}
+		}
 		if err := writeStream(c, stream, dahua.NewDahuaEvent(e.Event)); err != nil {
 			return writeStreamError(c, stream, err)
 		}
@@ -348,55 +382,54 @@ func (s *Server) DahuaDevicesIDFilesPath(c echo.Context) error {
 
 	c.Response().Header().Set(echo.HeaderContentLength, strconv.FormatInt(dbFile.Length, 10))
 
-	rd, err := func() (io.ReadCloser, error) {
-		aferoFileFound := true
-		aferoFile, err := s.db.C().DahuaGetAferoFileByFileID(ctx, sql.NullInt64{Int64: dbFile.ID, Valid: true})
-		if core.IsNotFound(err) {
-			aferoFileFound = false
-		} else if err != nil {
-			return nil, err
-		}
+	rd, err := dahua.FileReadCloser(ctx, client, dbFile)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
 
-		if aferoFileFound {
-			// File from cache
-			rd, err := s.dahuaAFS.Open(aferoFile.Name)
-			if err != nil {
-				if os.IsNotExist(err) {
-					// File from device
-					return dahua.FileLocalReadCloser(ctx, client, dbFile.FilePath)
-				}
+	_, err = io.Copy(c.Response().Writer, rd)
+	if err != nil {
+		return err
+	}
 
-				return nil, err
-			}
+	return nil
+}
 
-			return rd, nil
-		}
+func (s *Server) DahuaDevicesIDFilesIDMP4(c echo.Context) error {
+	ctx := c.Request().Context()
 
-		switch dbFile.Storage {
-		case models.StorageLocal:
-			// File from device
-			return dahua.FileLocalReadCloser(ctx, client, dbFile.FilePath)
-		case models.StorageFTP:
-			// File from FTP
-			return dahua.FileFTPReadCloser(ctx, dbFile.FilePath)
-		case models.StorageSFTP:
-			// File from SFTP
-			return dahua.FileSFTPReadCloser(ctx, dbFile.FilePath)
-		}
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
 
-		return nil, echo.ErrInternalServerError.WithInternal(fmt.Errorf("storage not supported: %s", dbFile.FilePath))
-	}()
+	fileID, err := paramInt64(c, "fileID")
 	if err != nil {
 		return err
 	}
-	defer rd.Close()
 
-	_, err = io.Copy(c.Response().Writer, rd)
+	client, err := useDahuaClient(c, s, id)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	dbFile, err := s.db.C().DahuaGetFile(ctx, fileID)
+	if err != nil {
+		if core.IsNotFound(err) {
+			return echo.ErrNotFound.WithInternal(err)
+		}
+		return err
+	}
+	if dbFile.DeviceID != client.Conn.ID || dbFile.Type != models.DahuaFileType_DAV {
+		return echo.ErrNotFound
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "video/mp4")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("inline; filename=%q", strings.TrimSuffix(path.Base(dbFile.FilePath), path.Ext(dbFile.FilePath))+".mp4"))
+	c.Response().WriteHeader(http.StatusOK)
+
+	return dahua.RemuxFile(ctx, c.Response().Writer, client, dbFile)
 }
 
 func (s *Server) DahuaDevicesIDAudio(c echo.Context) error {
@@ -412,6 +445,14 @@ func (s *Server) DahuaDevicesIDAudio(c echo.Context) error {
 		return err
 	}
 
+	caps, err := useDahuaCapabilities(c, client)
+	if err != nil {
+		return err
+	}
+	if !caps.AudioInput {
+		return newDahuaNotSupportedError("audio input")
+	}
+
 	channel, err := queryIntOptional(c, "channel")
 	if err != nil {
 		return err
@@ -445,11 +486,20 @@ func (s *Server) DahuaDevicesIDCoaxialStatus(c echo.Context) error {
 		return err
 	}
 
+	// Channel capabilities are stored when the device is probed
+	if _, err := useDahuaCapabilities(c, client); err != nil {
+		return err
+	}
+
 	channel, err := queryIntOptional(c, "channel")
 	if err != nil {
 		return err
 	}
 
+	if err := assertDahuaCoaxial(c, id, channel); err != nil {
+		return err
+	}
+
 	status, err := dahua.GetCoaxialStatus(ctx, client.RPC, channel)
 	if err != nil {
 		return err
@@ -471,11 +521,20 @@ func (s *Server) DahuaDevicesIDCoaxialCaps(c echo.Context) error {
 		return err
 	}
 
+	// Channel capabilities are stored when the device is probed
+	if _, err := useDahuaCapabilities(c, client); err != nil {
+		return err
+	}
+
 	channel, err := queryIntOptional(c, "channel")
 	if err != nil {
 		return err
 	}
 
+	if err := assertDahuaCoaxial(c, id, channel); err != nil {
+		return err
+	}
+
 	status, err := dahua.GetCoaxialCaps(ctx, client.RPC, channel)
 	if err != nil {
 		return err
@@ -501,6 +560,14 @@ func (s *Server) DahuaDevicesIDPTZPresetGET(c echo.Context) error {
 		return err
 	}
 
+	caps, err := useDahuaCapabilities(c, client)
+	if err != nil {
+		return err
+	}
+	if !caps.Ptz {
+		return newDahuaNotSupportedError("PTZ")
+	}
+
 	channel, err := queryIntOptional(c, "channel")
 	if err != nil {
 		return err
@@ -531,6 +598,14 @@ func (s *Server) DahuaDevicesIDPTZPresetPOST(c echo.Context) error {
 		return err
 	}
 
+	caps, err := useDahuaCapabilities(c, client)
+	if err != nil {
+		return err
+	}
+	if !caps.Ptz {
+		return newDahuaNotSupportedError("PTZ")
+	}
+
 	channel, err := queryIntOptional(c, "channel")
 	if err != nil {
 		return err
@@ -541,7 +616,7 @@ func (s *Server) DahuaDevicesIDPTZPresetPOST(c echo.Context) error {
 		return err
 	}
 
-	err = dahua.SetPreset(ctx, client.PTZ, channel, index)
+	err = dahua.SetPreset(ctx, client, channel, index)
 	if err != nil {
 		return err
 	}
@@ -562,6 +637,14 @@ func (s *Server) DahuaDevicesIDStorage(c echo.Context) error {
 		return err
 	}
 
+	caps, err := useDahuaCapabilities(c, client)
+	if err != nil {
+		return err
+	}
+	if !caps.Storage {
+		return newDahuaNotSupportedError("storage")
+	}
+
 	storage, err := dahua.GetStorage(ctx, client.RPC)
 	if err != nil {
 		return err
@@ -611,3 +694,22 @@ func (s *Server) DahuaDevicesIDUptime(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, res)
 }
+
+func (s *Server) DahuaDevicesIDCapabilities(c echo.Context) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	client, err := useDahuaClient(c, s, id)
+	if err != nil {
+		return err
+	}
+
+	res, err := useDahuaCapabilities(c, client)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dahua.NewDahuaCapabilities(res))
+}
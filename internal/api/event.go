@@ -0,0 +1,45 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/labstack/echo/v4"
+)
+
+// EventsCSV exports the audit log as CSV.
+func (s *Server) EventsCSV(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return echo.ErrForbidden.WithInternal(err)
+	}
+
+	userIDs, err := queryInts(c, "user-id")
+	if err != nil {
+		return err
+	}
+
+	timeRange, err := queryTimeRange(c)
+	if err != nil {
+		return err
+	}
+
+	filter := system.EventFilter{
+		FilterActions: c.QueryParams()["action"],
+		FilterUserIDs: userIDs,
+		FilterTarget:  c.QueryParam("target"),
+		FilterStart:   timeRange.Start,
+		FilterEnd:     timeRange.End,
+	}
+
+	fileName := fmt.Sprintf("events-%s.csv", time.Now().Format("20060102-150405"))
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Response().WriteHeader(http.StatusOK)
+
+	return system.WriteEventsCSV(ctx, c.Response(), filter)
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httputil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/dahua"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	echo "github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+func GuestURI(token string) string {
+	return fmt.Sprintf("%s/guest/%s", Route, token)
+}
+
+// dahuaGuestPage is the page guests see when they open a guest link.
+var dahuaGuestPage = template.Must(template.New("guest").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}}</title>
+<style>body { font-family: sans-serif; margin: 0 auto; padding: 1rem; max-width: 60rem; } iframe { width: 100%; aspect-ratio: 16 / 9; border: 0; background: black; } li { padding: 0.25rem 0; }</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<p>{{.DeviceName}} &middot; Channel {{.Channel}} &middot; Expires {{.ExpiredAt}}</p>
+{{if .LiveURL}}<h2>Live</h2>
+<iframe src="{{.LiveURL}}" allow="autoplay; fullscreen"></iframe>
+{{end}}{{if .Files}}<h2>Recordings</h2>
+<ul>
+{{range .Files}}<li><a href="{{.URL}}">{{.StartTime}} &ndash; {{.EndTime}}</a></li>
+{{end}}</ul>
+{{end}}</body>
+</html>
+`))
+
+type dahuaGuestPageData struct {
+	Name       string
+	DeviceName string
+	Channel    int64
+	ExpiredAt  string
+	LiveURL    string
+	Files      []dahuaGuestPageFile
+}
+
+type dahuaGuestPageFile struct {
+	URL       string
+	StartTime string
+	EndTime   string
+}
+
+func (s *Server) RegisterGuest(e *echo.Group) *Server {
+	e.GET("", s.Guest, guestAccessMiddleware())
+	e.GET("/live/hls", s.DahuaHLSPlayer, guestAccessMiddleware())
+	e.GET("/live/hls/*", s.GuestLiveHLSPath)
+	e.GET("/files/:fileID/mp4", s.GuestFilesIDMP4, guestAccessMiddleware())
+	e.Any("/mediamtx/*", s.GuestMediamtx)
+	return s
+}
+
+// RequireGuestMiddleware allows only if actor is from a guest link.
+func RequireGuestMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if core.UseActor(c.Request().Context()).Guest == nil {
+				return echo.NewHTTPError(http.StatusNotFound, "Invalid or expired guest link.")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// guestAccessMiddleware records the request in the audit log.
+func guestAccessMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			createGuestAccessEvent(c, err)
+			return err
+		}
+	}
+}
+
+func createGuestAccessEvent(c echo.Context, err error) {
+	var httpErr *echo.HTTPError
+	denied := core.IsForbidden(err) || (errors.As(err, &httpErr) && httpErr.Code == http.StatusForbidden)
+
+	r := c.Request()
+	if err := dahua.CreateGuestAccessEvent(r.Context(), r.Method, r.URL.Path, denied); err != nil {
+		log.Err(err).Str("package", "api").Msg("Failed to create guest access event")
+	}
+}
+
+func guestError(err error) error {
+	if errors.Is(err, dahua.ErrGuestLinkViewsExceeded) {
+		return echo.NewHTTPError(http.StatusForbidden, "Guest link has no views left.").WithInternal(err)
+	}
+	return hlsError(err)
+}
+
+// Guest shows what the guest link shares and counts as a view.
+func (s *Server) Guest(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := dahua.ViewGuestLink(ctx); err != nil {
+		return guestError(err)
+	}
+
+	link, err := dahua.GetGuestLink(ctx)
+	if err != nil {
+		return guestError(err)
+	}
+
+	token := c.Param("guest")
+	data := dahuaGuestPageData{
+		Name:       link.Name,
+		DeviceName: link.DeviceName,
+		Channel:    link.Channel,
+		ExpiredAt:  link.ExpiredAt.Local().Format(time.DateTime),
+		Files:      make([]dahuaGuestPageFile, 0, len(link.Files)),
+	}
+	if link.Stream != nil {
+		if dahua.EmbeddedStreaming() {
+			data.LiveURL = GuestURI(token) + "/live/hls"
+		} else if path, err := dahua.GetGuestLiveStreamPath(ctx); err == nil {
+			data.LiveURL = GuestURI(token) + "/mediamtx/" + path + "/"
+		}
+	}
+	for _, file := range link.Files {
+		if file.Type != models.DahuaFileType_DAV {
+			continue
+		}
+		data.Files = append(data.Files, dahuaGuestPageFile{
+			URL:       fmt.Sprintf("%s/files/%d/mp4", GuestURI(token), file.ID),
+			StartTime: file.StartTime.Local().Format(time.DateTime),
+			EndTime:   file.EndTime.Local().Format(time.DateTime),
+		})
+	}
+
+	var b strings.Builder
+	if err := dahuaGuestPage.Execute(&b, data); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store, must-revalidate")
+	return c.HTML(http.StatusOK, b.String())
+}
+
+func (s *Server) GuestLiveHLSPath(c echo.Context) error {
+	dir, err := dahua.OpenGuestLiveStream(c.Request().Context())
+	if err != nil {
+		return guestError(err)
+	}
+
+	return serveHLSFile(c, dir)
+}
+
+func (s *Server) GuestFilesIDMP4(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	fileID, err := paramInt64(c, "fileID")
+	if err != nil {
+		return err
+	}
+
+	client, dbFile, err := dahua.GetGuestFile(ctx, fileID)
+	if err != nil {
+		return guestError(err)
+	}
+	if dbFile.Type != models.DahuaFileType_DAV {
+		return echo.ErrNotFound
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "video/mp4")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("inline; filename=%q", strings.TrimSuffix(path.Base(dbFile.FilePath), path.Ext(dbFile.FilePath))+".mp4"))
+	c.Response().WriteHeader(http.StatusOK)
+
+	return dahua.RemuxFile(ctx, c.Response().Writer, client, dbFile)
+}
+
+// GuestMediamtx proxies MediaMTX for the live view shared by the guest link.
+// Only opening the live view is recorded in the audit log, not the requests made by its player.
+func (s *Server) GuestMediamtx(c echo.Context) error {
+	if s.mediamtxURL == nil {
+		// Live streams are served by the embedded streamer
+		return echo.ErrNotFound
+	}
+
+	r := c.Request()
+
+	streamPath, err := dahua.GetGuestLiveStreamPath(r.Context())
+	if err != nil {
+		return guestError(err)
+	}
+
+	name := c.Param("*")
+	if strings.Contains(name, "..") {
+		err := echo.ErrForbidden
+		createGuestAccessEvent(c, err)
+		return err
+	}
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if strings.HasSuffix(c.Param("*"), "/") && name != "" {
+		// Keep the trailing slash because MediaMTX redirects to it
+		name += "/"
+	}
+
+	rest, found := strings.CutPrefix(name, streamPath)
+	if !found || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		err := echo.ErrForbidden
+		createGuestAccessEvent(c, err)
+		return err
+	}
+	if rest == "" || rest == "/" {
+		createGuestAccessEvent(c, nil)
+	}
+
+	r.URL.Path = "/" + name
+	r.URL.RawPath = ""
+	httputil.NewSingleHostReverseProxy(s.mediamtxURL).ServeHTTP(c.Response(), r)
+	return nil
+}
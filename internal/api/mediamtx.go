@@ -8,5 +8,11 @@ import (
 )
 
 func (s *Server) Mediamtx(prefix string) echo.HandlerFunc {
+	if s.mediamtxURL == nil {
+		// Live streams are served by the embedded streamer
+		return func(c echo.Context) error {
+			return echo.ErrNotFound
+		}
+	}
 	return echo.WrapHandler(http.StripPrefix(prefix, httputil.NewSingleHostReverseProxy(s.mediamtxURL)))
 }
@@ -1,12 +1,14 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 
 	"github.com/ItsNotGoodName/ipcmanview/internal/auth"
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/dahua"
 	"github.com/ItsNotGoodName/ipcmanview/internal/sqlite"
 	"github.com/ItsNotGoodName/ipcmanview/pkg/pubsub"
 	echo "github.com/labstack/echo/v4"
@@ -28,9 +30,10 @@ func NewServer(
 }
 
 type Server struct {
-	pub         *pubsub.Pub
-	db          sqlite.DB
-	dahuaAFS    afero.Fs
+	pub      *pubsub.Pub
+	db       sqlite.DB
+	dahuaAFS afero.Fs
+	// mediamtxURL is nil when live streams are served by the embedded streamer.
 	mediamtxURL *url.URL
 }
 
@@ -40,6 +43,14 @@ func MediamtxURI(path string) string {
 	return fmt.Sprintf("%s/mediamtx/%s", Route, path)
 }
 
+func DahuaStreamHLSURI(streamID int64) string {
+	return fmt.Sprintf("%s/dahua/streams/%d/hls", Route, streamID)
+}
+
+func DahuaFileHLSURI(deviceID, fileID int64) string {
+	return fmt.Sprintf("%s/dahua/devices/%d/files/%d/hls", Route, deviceID, fileID)
+}
+
 func DahuaAferoFileURI(name string) string {
 	return Route + "/dahua/afs/" + name
 }
@@ -52,6 +63,9 @@ func (s *Server) RegisterSession(e *echo.Group) *Server {
 	e.GET("/session", s.Session)
 	e.POST("/session", s.SessionPOST)
 	e.DELETE("/session", s.SessionDELETE)
+	e.POST("/session/two-factor", s.SessionTwoFactorPOST)
+	e.GET("/oidc/login", s.OIDCLogin)
+	e.GET("/oidc/callback", s.OIDCCallback)
 	return s
 }
 
@@ -60,11 +74,14 @@ func (s *Server) Register(e *echo.Group) *Server {
 
 	e.Any("/mediamtx/*", s.Mediamtx(Route+"/mediamtx"))
 
+	e.GET("/events/csv", s.EventsCSV)
+
 	e.GET("/dahua/afs/*", s.DahuaAfero(Route+"/dahua/afs"))
 	e.GET("/dahua/events", s.DahuaEvents)
 
 	e.GET("/dahua/devices", s.DahuaDevices)
 	e.GET("/dahua/devices/:id/audio", s.DahuaDevicesIDAudio)
+	e.GET("/dahua/devices/:id/capabilities", s.DahuaDevicesIDCapabilities)
 	e.GET("/dahua/devices/:id/coaxial/caps", s.DahuaDevicesIDCoaxialCaps)
 	e.GET("/dahua/devices/:id/coaxial/status", s.DahuaDevicesIDCoaxialStatus)
 	e.GET("/dahua/devices/:id/detail", s.DahuaDevicesIDDetail)
@@ -72,6 +89,10 @@ func (s *Server) Register(e *echo.Group) *Server {
 	e.GET("/dahua/devices/:id/events", s.DahuaDevicesIDEvents)
 	e.GET("/dahua/devices/:id/files", s.DahuaDevicesIDFiles)
 	e.GET("/dahua/devices/:id/files/*", s.DahuaDevicesIDFilesPath)
+	e.GET("/dahua/devices/:id/files/:fileID/mp4", s.DahuaDevicesIDFilesIDMP4)
+	e.GET("/dahua/devices/:id/files/:fileID/hls", s.DahuaHLSPlayer)
+	e.GET("/dahua/devices/:id/files/:fileID/hls/*", s.DahuaDevicesIDFilesIDHLSPath)
+	e.GET("/dahua/devices/:id/files/:fileID/play", s.DahuaDevicesIDFilesIDPlay)
 	e.GET("/dahua/devices/:id/licenses", s.DahuaDevicesIDLicenses)
 	e.GET("/dahua/devices/:id/ptz/preset", s.DahuaDevicesIDPTZPresetGET)
 	e.GET("/dahua/devices/:id/snapshot", s.DahuaDevicesIDSnapshot)
@@ -80,6 +101,9 @@ func (s *Server) Register(e *echo.Group) *Server {
 	e.GET("/dahua/devices/:id/users", s.DahuaDevicesIDUsers)
 	e.GET("/dahua/devices/:id/uptime", s.DahuaDevicesIDUptime)
 
+	e.GET("/dahua/streams/:id/hls", s.DahuaHLSPlayer)
+	e.GET("/dahua/streams/:id/hls/*", s.DahuaStreamsIDHLSPath)
+
 	e.POST("/dahua/devices/:id/ptz/preset", s.DahuaDevicesIDPTZPresetPOST)
 	e.POST("/dahua/devices/:id/rpc", s.DahuaDevicesIDRPCPOST)
 
@@ -88,18 +112,42 @@ func (s *Server) Register(e *echo.Group) *Server {
 
 // ---------- Middleware
 
-// ActorMiddleware sets the actor context from session context or token.
+// ActorMiddleware sets the actor context from guest link, session context, or token along with the request info.
 func ActorMiddleware() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			r := c.Request()
-			ctx := r.Context()
+			ctx := core.WithRequestInfo(r.Context(), core.RequestInfo{
+				IP:        c.RealIP(),
+				UserAgent: r.UserAgent(),
+			})
+			r = r.WithContext(ctx)
+			c.SetRequest(r)
 
 			if token := c.QueryParam("token"); token == core.RuntimeToken {
 				// System
+			} else if token := c.Param("guest"); token != "" {
+				// Guest
+				guest, err := dahua.GetGuestLinkForContext(ctx, token)
+				if errors.Is(err, dahua.ErrGuestLinkViewsExceeded) {
+					return guestError(err)
+				}
+				if err != nil && !core.IsNotFound(err) {
+					return err
+				}
+				if err == nil {
+					c.SetRequest(r.WithContext(core.WithGuestActor(ctx, guest)))
+				} else {
+					c.SetRequest(r.WithContext(core.WithPublicActor(ctx)))
+				}
 			} else if session, ok := auth.UseSession(ctx); ok {
-				// User
-				c.SetRequest(r.WithContext(core.WithUserActor(ctx, session.UserID, session.Admin)))
+				if session.Scope != nil {
+					// Token
+					c.SetRequest(r.WithContext(core.WithTokenActor(ctx, session.UserID, session.Admin, *session.Scope)))
+				} else {
+					// User
+					c.SetRequest(r.WithContext(core.WithUserActor(ctx, session.UserID, session.Admin)))
+				}
 			} else {
 				// Public
 				c.SetRequest(r.WithContext(core.WithPublicActor(ctx)))
@@ -130,6 +178,20 @@ func RequireAuthMiddleware() echo.MiddlewareFunc {
 				return echo.NewHTTPError(http.StatusUnauthorized, "Account disabled.")
 			}
 
+			// Deny until two-factor authentication is enabled
+			if session.TwoFactorRequired {
+				return echo.NewHTTPError(http.StatusForbidden, "Two-factor authentication must be enabled.")
+			}
+
+			// Deny changes from read-only tokens
+			if session.Scope != nil && session.Scope.ReadOnly {
+				switch c.Request().Method {
+				case http.MethodGet, http.MethodHead, http.MethodOptions:
+				default:
+					return echo.NewHTTPError(http.StatusForbidden, "Token is read-only.")
+				}
+			}
+
 			return next(c)
 		}
 	}
@@ -1,10 +1,22 @@
 package api
 
 import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ItsNotGoodName/ipcmanview/internal/auth"
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/oidc"
 	echo "github.com/labstack/echo/v4"
 )
 
@@ -17,6 +29,10 @@ func SessionMiddleware() echo.MiddlewareFunc {
 			r := c.Request()
 			ctx := r.Context()
 
+			if token, ok := bearerToken(r); ok {
+				return tokenSession(c, next, token)
+			}
+
 			cookie, err := c.Cookie(cookieKey)
 			if err != nil {
 				return next(c)
@@ -44,25 +60,105 @@ func SessionMiddleware() echo.MiddlewareFunc {
 				return err
 			}
 
+			// Check if two-factor authentication must be enabled
+			twoFactorRequired, err := sessionTwoFactorRequired(session.Admin, session.TwoFactorEnabled, session.TwoFactorGroupRequired)
+			if err != nil {
+				return err
+			}
+
 			// Set session context
 			c.SetRequest(r.WithContext(auth.WithSession(ctx, auth.Session{
-				SessionID: session.ID,
-				UserID:    session.UserID,
-				Username:  session.Username.String,
-				Admin:     session.Admin,
-				Disabled:  session.UsersDisabledAt.Valid,
+				SessionID:         session.ID,
+				UserID:            session.UserID,
+				Username:          session.Username.String,
+				Admin:             session.Admin,
+				Disabled:          session.UsersDisabledAt.Valid,
+				TwoFactorRequired: twoFactorRequired,
 			})))
 			return next(c)
 		}
 	}
 }
 
+// sessionTwoFactorRequired returns true if the user must enable two-factor authentication before doing anything else.
+func sessionTwoFactorRequired(admin, twoFactorEnabled, twoFactorGroupRequired bool) (bool, error) {
+	if twoFactorEnabled {
+		return false, nil
+	}
+	if twoFactorGroupRequired {
+		return true, nil
+	}
+	if !admin {
+		return false, nil
+	}
+
+	cfg, err := system.GetConfig()
+	if err != nil {
+		return false, err
+	}
+	return auth.TwoFactorRequired(cfg, admin, false), nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	token, found := strings.CutPrefix(r.Header.Get(echo.HeaderAuthorization), "Bearer ")
+	if !found || !auth.IsToken(token) {
+		return "", false
+	}
+	return token, true
+}
+
+// tokenSession sets the session context from an API token.
+func tokenSession(c echo.Context, next echo.HandlerFunc, token string) error {
+	r := c.Request()
+	ctx := r.Context()
+
+	// Get token
+	userToken, err := auth.GetUserTokenForContext(ctx, token)
+	if err != nil {
+		if core.IsNotFound(err) {
+			return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or expired token.")
+		}
+		return err
+	}
+
+	// Touch token
+	if err := auth.TouchUserToken(ctx, auth.TouchUserTokenParams{
+		TokenID:    userToken.ID,
+		LastUsedAt: userToken.LastUsedAt.Time.Time,
+		LastIP:     userToken.LastIp,
+		IP:         c.RealIP(),
+	}); err != nil {
+		return err
+	}
+
+	// Check if two-factor authentication must be enabled
+	twoFactorRequired, err := sessionTwoFactorRequired(userToken.Admin, userToken.TwoFactorEnabled, userToken.TwoFactorGroupRequired)
+	if err != nil {
+		return err
+	}
+
+	// Set session context
+	c.SetRequest(r.WithContext(auth.WithSession(ctx, auth.Session{
+		UserID:            userToken.UserID,
+		Username:          userToken.Username.String,
+		Admin:             userToken.Admin,
+		Disabled:          userToken.UsersDisabledAt.Valid,
+		TwoFactorRequired: twoFactorRequired,
+		Scope: &core.ActorScope{
+			Level:    userToken.Level,
+			ReadOnly: userToken.ReadOnly,
+		},
+	})))
+	return next(c)
+}
+
 type SesionResp struct {
-	Admin    bool   `json:"admin"`
-	Disabled bool   `json:"disabled"`
-	UserID   int64  `json:"user_id"`
-	Username string `json:"username"`
-	Valid    bool   `json:"valid"`
+	Admin             bool   `json:"admin"`
+	Disabled          bool   `json:"disabled"`
+	UserID            int64  `json:"user_id"`
+	Username          string `json:"username"`
+	Valid             bool   `json:"valid"`
+	TwoFactorRequired bool   `json:"two_factor_required"`
 }
 
 func (s *Server) Session(c echo.Context) error {
@@ -74,11 +170,12 @@ func (s *Server) Session(c echo.Context) error {
 	}
 
 	return c.JSON(http.StatusOK, SesionResp{
-		Admin:    session.Admin,
-		Disabled: session.Disabled,
-		UserID:   session.UserID,
-		Username: session.Username,
-		Valid:    true,
+		Admin:             session.Admin,
+		Disabled:          session.Disabled,
+		UserID:            session.UserID,
+		Username:          session.Username,
+		Valid:             true,
+		TwoFactorRequired: session.TwoFactorRequired,
 	})
 }
 
@@ -95,28 +192,142 @@ func (s *Server) SessionPOST(c echo.Context) error {
 		return err
 	}
 
-	// Get user
-	user, err := auth.GetUserByUsernameOrEmail(ctx, req.UsernameOrEmail)
+	cfg, err := system.GetConfig()
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "Incorrect credentials.").WithInternal(err)
+		return err
+	}
+	if cfg.OIDC.PasswordLoginDisabled() {
+		return echo.NewHTTPError(http.StatusForbidden, "Password login is disabled.")
 	}
 
-	// Check password
+	// Get user
+	user, userErr := auth.GetUserByUsernameOrEmail(ctx, req.UsernameOrEmail)
+	if userErr != nil && !core.IsNotFound(userErr) {
+		return userErr
+	}
+	attempt := auth.LoginAttemptParams{
+		IP:              c.RealIP(),
+		UsernameOrEmail: req.UsernameOrEmail,
+		UserID:          user.ID,
+	}
+
+	// Deny locked IP or account
+	if err := auth.CheckLoginLockout(ctx, attempt); err != nil {
+		return loginError(c, err)
+	}
+
+	// Check user and password
+	if userErr != nil {
+		auth.CheckDummyPassword(req.Password)
+		return loginFailed(c, attempt, userErr)
+	}
 	if err := auth.CheckUserPassword(user.Password, req.Password); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "Incorrect credentials.").WithInternal(err)
+		return loginFailed(c, attempt, err)
+	}
+
+	// Require second step
+	twoFactorEnabled, err := auth.UserTwoFactorEnabled(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if twoFactorEnabled {
+		challenge, err := auth.CreateLoginChallenge(auth.CreateLoginChallengeParams{
+			UserID:     user.ID,
+			RememberMe: req.RememberMe,
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, SessionPOSTResp{
+			TwoFactor: true,
+			Challenge: challenge,
+		})
+	}
+
+	// Failures are only cleared after the second step when it is required
+	if err := auth.ClearLoginFailures(ctx, attempt); err != nil {
+		return err
+	}
+
+	if err := createSession(c, user.ID, req.RememberMe); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, SessionPOSTResp{})
+}
+
+// loginFailed records the failed login.
+func loginFailed(c echo.Context, attempt auth.LoginAttemptParams, err error) error {
+	if err := auth.RecordLoginFailure(c.Request().Context(), attempt); err != nil {
+		return err
+	}
+	return echo.NewHTTPError(http.StatusBadRequest, "Incorrect credentials.").WithInternal(err)
+}
+
+func loginError(c echo.Context, err error) error {
+	var lockedErr auth.LoginLockedError
+	if errors.As(err, &lockedErr) {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(time.Until(lockedErr.LockedUntil).Seconds())+1))
+		return echo.NewHTTPError(http.StatusTooManyRequests, "Too many failed logins, try again later.").WithInternal(err)
+	}
+	return err
+}
+
+type SessionPOSTResp struct {
+	// TwoFactor is true when the challenge must be sent with a code to SessionTwoFactorPOST.
+	TwoFactor bool   `json:"two_factor"`
+	Challenge string `json:"challenge"`
+}
+
+func (s *Server) SessionTwoFactorPOST(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	// Parse
+	var req struct {
+		Challenge string
+		Code      string
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
 	}
 
+	// Check code
+	res, err := auth.CompleteLoginChallenge(ctx, auth.CompleteLoginChallengeParams{
+		Challenge: req.Challenge,
+		Code:      req.Code,
+		IP:        c.RealIP(),
+	})
+	if err != nil {
+		if errors.Is(err, auth.ErrLoginChallenge) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Login expired.").WithInternal(err)
+		}
+		if _, ok := core.AsFieldErrors(err); ok {
+			return echo.NewHTTPError(http.StatusBadRequest, "Incorrect code.").WithInternal(err)
+		}
+		return loginError(c, err)
+	}
+
+	if err := createSession(c, res.UserID, res.RememberMe); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, SessionPOSTResp{})
+}
+
+// createSession creates a session for the user and sets the session cookie.
+func createSession(c echo.Context, userID int64, rememberMe bool) error {
 	previousSession := ""
 	if cookie, err := c.Cookie(cookieKey); err == nil {
 		previousSession = cookie.Value
 	}
 
 	// Create session
-	session, err := auth.CreateUserSession(ctx, auth.CreateUserSessionParams{
+	session, err := auth.CreateUserSession(c.Request().Context(), auth.CreateUserSessionParams{
 		UserAgent:       c.Request().UserAgent(),
 		IP:              c.RealIP(),
-		UserID:          user.ID,
-		RememberMe:      req.RememberMe,
+		UserID:          userID,
+		RememberMe:      rememberMe,
 		PreviousSession: previousSession,
 	})
 	if err != nil {
@@ -132,7 +343,7 @@ func (s *Server) SessionPOST(c echo.Context) error {
 		SameSite: http.SameSiteStrictMode,
 	})
 
-	return c.JSON(http.StatusOK, nil)
+	return nil
 }
 
 func (s *Server) SessionDELETE(c echo.Context) error {
@@ -159,3 +370,120 @@ func (s *Server) SessionDELETE(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, nil)
 }
+
+const oidcCookieKey = "oidc"
+
+// oidcRedirectPage sends the user to the web UI after login.
+// A redirect would keep the navigation cross-site and the strict session cookie would not be sent.
+func oidcRedirectPage(to string) string {
+	return `<!DOCTYPE html><html><head><meta http-equiv="refresh" content="0;url=` + html.EscapeString(to) + `"></head></html>`
+}
+
+func (s *Server) OIDCLogin(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	cfg, err := system.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	url, flow, err := auth.OIDCAuthCodeURL(ctx, cfg.OIDC)
+	if err != nil {
+		if errors.Is(err, auth.ErrOIDCDisabled) {
+			return echo.ErrNotFound.WithInternal(err)
+		}
+		return err
+	}
+
+	b, err := json.Marshal(flow)
+	if err != nil {
+		return err
+	}
+
+	// Lax so that the cookie is sent when the provider redirects back
+	c.SetCookie(&http.Cookie{
+		Name:     oidcCookieKey,
+		Value:    base64.RawURLEncoding.EncodeToString(b),
+		Path:     Route + "/oidc",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return c.Redirect(http.StatusFound, url)
+}
+
+func (s *Server) OIDCCallback(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	cfg, err := system.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	if errString := c.QueryParam("error"); errString != "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, c.QueryParam("error_description")).WithInternal(fmt.Errorf("oidc: %s", errString))
+	}
+
+	cookie, err := c.Cookie(oidcCookieKey)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Login expired.").WithInternal(err)
+	}
+
+	// Delete cookie
+	c.SetCookie(&http.Cookie{
+		Name:     oidcCookieKey,
+		Path:     Route + "/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	var flow oidc.Flow
+	b, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return echo.ErrBadRequest.WithInternal(err)
+	}
+	if err := json.Unmarshal(b, &flow); err != nil {
+		return echo.ErrBadRequest.WithInternal(err)
+	}
+	if flow.State == "" || subtle.ConstantTimeCompare([]byte(flow.State), []byte(c.QueryParam("state"))) != 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid state.")
+	}
+
+	userID, err := auth.OIDCLogin(ctx, cfg.OIDC, flow, c.QueryParam("code"))
+	if err != nil {
+		if errors.Is(err, auth.ErrOIDCDisabled) {
+			return echo.ErrNotFound.WithInternal(err)
+		}
+		if errors.Is(err, auth.ErrOIDCMissingEmail) || errors.Is(err, auth.ErrOIDCEmailConflict) {
+			return echo.NewHTTPError(http.StatusForbidden, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, "Login failed.").WithInternal(err)
+	}
+
+	// Require second step
+	if !cfg.OIDC.TrustProviderTwoFactor {
+		twoFactorEnabled, err := auth.UserTwoFactorEnabled(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if twoFactorEnabled {
+			challenge, err := auth.CreateLoginChallenge(auth.CreateLoginChallengeParams{
+				UserID: userID,
+			})
+			if err != nil {
+				return err
+			}
+
+			// The fragment keeps the challenge out of server logs
+			return c.HTML(http.StatusOK, oidcRedirectPage("/signin#challenge="+url.QueryEscape(challenge)))
+		}
+	}
+
+	if err := createSession(c, userID, false); err != nil {
+		return err
+	}
+
+	return c.HTML(http.StatusOK, oidcRedirectPage("/"))
+}
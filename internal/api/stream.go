@@ -0,0 +1,141 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/dahua"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/ItsNotGoodName/ipcmanview/internal/web"
+	echo "github.com/labstack/echo/v4"
+)
+
+// dahuaStreamPlayer is the page embedded by the web UI for the built-in live streamer and file playback.
+// The player script is bundled with the web UI as web.RoutePlayer.
+//
+// The built-in streamer produces regular HLS with 1 second segments, so expect a few seconds of latency.
+// Use MediaMTX with WebRTC for low latency.
+const dahuaStreamPlayer = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<style>html, body { margin: 0; padding: 0; height: 100%; overflow: hidden; background: black; } video { width: 100%; height: 100%; }</style>
+</head>
+<body>
+<video id="video" data-src="hls/` + dahua.LiveStreamPlaylist + `" muted autoplay playsinline controls></video>
+<script type="module" src="` + web.RoutePlayer + `"></script>
+</body>
+</html>
+`
+
+func (s *Server) DahuaHLSPlayer(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store, must-revalidate")
+	return c.HTML(http.StatusOK, dahuaStreamPlayer)
+}
+
+func (s *Server) DahuaStreamsIDHLSPath(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	dir, err := dahua.OpenLiveStream(ctx, id)
+	if err != nil {
+		return hlsError(err)
+	}
+
+	return serveHLSFile(c, dir)
+}
+
+func (s *Server) DahuaDevicesIDFilesIDHLSPath(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	fileID, err := paramInt64(c, "fileID")
+	if err != nil {
+		return err
+	}
+
+	dir, err := dahua.OpenFilePlayback(ctx, id, fileID)
+	if err != nil {
+		return hlsError(err)
+	}
+
+	return serveHLSFile(c, dir)
+}
+
+type DahuaFilePlay struct {
+	URL string `json:"url"`
+}
+
+func (s *Server) DahuaDevicesIDFilesIDPlay(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	fileID, err := paramInt64(c, "fileID")
+	if err != nil {
+		return err
+	}
+
+	if dahua.EmbeddedStreaming() {
+		// Check access now instead of when the player loads
+		if err := assertDahuaLevel(c, s, id, models.DahuaPermissionLevel_User); err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, DahuaFilePlay{
+			URL: DahuaFileHLSURI(id, fileID),
+		})
+	}
+
+	path, err := dahua.PushFilePlayback(ctx, id, fileID)
+	if err != nil {
+		return hlsError(err)
+	}
+
+	return c.JSON(http.StatusOK, DahuaFilePlay{
+		URL: MediamtxURI(path),
+	})
+}
+
+func hlsError(err error) error {
+	if core.IsNotFound(err) {
+		return echo.ErrNotFound.WithInternal(err)
+	}
+	if core.IsForbidden(err) {
+		return echo.ErrForbidden.WithInternal(err)
+	}
+	if errors.Is(err, dahua.ErrLiveStreamerDisabled) {
+		return echo.ErrNotFound.WithInternal(err)
+	}
+	return err
+}
+
+func serveHLSFile(c echo.Context, dir string) error {
+	// HLS files are flat, so only the base name is needed
+	name := filepath.Base(c.Param("*"))
+	switch filepath.Ext(name) {
+	case ".m3u8":
+		c.Response().Header().Set(echo.HeaderContentType, "application/vnd.apple.mpegurl")
+		c.Response().Header().Set(echo.HeaderCacheControl, "no-store, must-revalidate")
+	case ".ts":
+		c.Response().Header().Set(echo.HeaderContentType, "video/mp2t")
+	default:
+		return echo.ErrNotFound
+	}
+
+	return c.File(filepath.Join(dir, name))
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
 	"github.com/ItsNotGoodName/ipcmanview/internal/dahua"
 	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
 	"github.com/labstack/echo/v4"
 )
 
@@ -21,6 +22,14 @@ func paramID(c echo.Context) (int64, error) {
 	return number, nil
 }
 
+func paramInt64(c echo.Context, key string) (int64, error) {
+	number, err := strconv.ParseInt(c.Param(key), 10, 64)
+	if err != nil {
+		return 0, echo.ErrBadRequest.WithInternal(err)
+	}
+	return number, nil
+}
+
 func assertDahuaLevel(c echo.Context, s *Server, deviceID int64, level models.DahuaPermissionLevel) error {
 	ok, err := dahua.Level(c.Request().Context(), deviceID, level)
 	if err != nil {
@@ -46,6 +55,27 @@ func useDahuaClient(c echo.Context, s *Server, deviceID int64) (dahua.Client, er
 	return client, nil
 }
 
+func useDahuaCapabilities(c echo.Context, client dahua.Client) (repo.DahuaCapability, error) {
+	return dahua.GetCapabilities(c.Request().Context(), client)
+}
+
+// assertDahuaCoaxial returns an error if the channel does not support coaxial control.
+// Requests without a channel are for the first channel.
+func assertDahuaCoaxial(c echo.Context, deviceID int64, channel int) error {
+	ok, err := dahua.ChannelSupportsCoaxial(c.Request().Context(), deviceID, max(channel, 1))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return newDahuaNotSupportedError("coaxial control")
+	}
+	return nil
+}
+
+func newDahuaNotSupportedError(capability string) error {
+	return echo.NewHTTPError(http.StatusNotImplemented, "Device does not support "+capability+".")
+}
+
 // ---------- Stream
 
 func newStream(c echo.Context) *json.Encoder {
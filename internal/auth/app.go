@@ -2,6 +2,7 @@ package auth
 
 import (
 	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
+	"github.com/ItsNotGoodName/ipcmanview/internal/mail"
 	"github.com/ItsNotGoodName/ipcmanview/internal/sqlite"
 )
 
@@ -11,6 +12,12 @@ type App struct {
 	DB                   sqlite.DB
 	Hub                  *bus.Hub
 	TouchSessionThrottle TouchSessionThrottle
+	TouchTokenThrottle   TouchSessionThrottle
+	LoginChallenges      *LoginChallengeStore
+	// Mailer is nil when password reset emails are disabled.
+	Mailer mail.Sender
+	// PublicURL is the URL users use to reach the web UI, it is used in emails.
+	PublicURL string
 }
 
 func Init(_app App) {
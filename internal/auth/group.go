@@ -7,9 +7,22 @@ import (
 
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
 	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/sqlite"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system/action"
 	"github.com/ItsNotGoodName/ipcmanview/internal/types"
 )
 
+// groupAudit returns the state of the group recorded in the audit log.
+func groupAudit(v repo.Group) action.Group {
+	return action.Group{
+		Name:             v.Name,
+		Description:      v.Description,
+		Disabled:         v.DisabledAt.Valid,
+		RequireTwoFactor: v.RequireTwoFactor,
+	}
+}
+
 func groupFrom(v repo.Group) _Group {
 	return _Group{
 		Name:        v.Name,
@@ -47,13 +60,37 @@ func CreateGroup(ctx context.Context, arg CreateGroupParams) (int64, error) {
 		return 0, err
 	}
 
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	now := types.NewTime(time.Now())
-	return app.DB.C().AuthCreateGroup(ctx, repo.AuthCreateGroupParams{
+	id, err := tx.C().AuthCreateGroup(ctx, repo.AuthCreateGroupParams{
 		Name:        arg.Name,
 		Description: arg.Description,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	})
+	if err != nil {
+		return 0, err
+	}
+
+	after, err := tx.C().AuthGetGroup(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.GroupCreated.Create(id).WithDiff(nil, groupAudit(after))); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
 }
 
 type UpdateGroupParams struct {
@@ -82,20 +119,85 @@ func UpdateGroup(ctx context.Context, arg UpdateGroupParams) error {
 		return err
 	}
 
-	_, err = app.DB.C().AuthUpdateGroup(ctx, repo.AuthUpdateGroupParams{
-		Name:        arg.Name,
-		Description: arg.Description,
-		UpdatedAt:   types.NewTime(time.Now()),
-		ID:          dbModel.ID,
+	return updateGroup(ctx, dbModel.ID, func(tx sqlite.Tx) error {
+		_, err := tx.C().AuthUpdateGroup(ctx, repo.AuthUpdateGroupParams{
+			Name:        arg.Name,
+			Description: arg.Description,
+			UpdatedAt:   types.NewTime(time.Now()),
+			ID:          dbModel.ID,
+		})
+		return err
 	})
-	return err
+}
+
+// updateGroup runs fn in a transaction and records the change to the group in the audit log.
+func updateGroup(ctx context.Context, id int64, fn func(tx sqlite.Tx) error) error {
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := tx.C().AuthGetGroup(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	after, err := tx.C().AuthGetGroup(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.GroupUpdated.Create(id).WithDiff(groupAudit(before), groupAudit(after))); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func DeleteGroup(ctx context.Context, id int64) error {
 	if _, err := core.AssertAdmin(ctx); err != nil {
 		return err
 	}
-	return app.DB.C().AuthDeleteGroup(ctx, id)
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := tx.C().AuthGetGroup(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.C().AuthDeleteGroup(ctx, id); err != nil {
+		return err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.GroupDeleted.Create(id).WithDiff(groupAudit(before), nil)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func UpdateGroupRequireTwoFactor(ctx context.Context, id int64, require bool) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	return updateGroup(ctx, id, func(tx sqlite.Tx) error {
+		_, err := tx.C().AuthUpdateGroupRequireTwoFactor(ctx, repo.AuthUpdateGroupRequireTwoFactorParams{
+			RequireTwoFactor: require,
+			ID:               id,
+		})
+		return err
+	})
 }
 
 func UpdateGroupDisable(ctx context.Context, userID int64, disable bool) error {
@@ -103,12 +205,14 @@ func UpdateGroupDisable(ctx context.Context, userID int64, disable bool) error {
 		return err
 	}
 
-	_, err := app.DB.C().AuthUpdateGroupDisabledAt(ctx, repo.AuthUpdateGroupDisabledAtParams{
-		DisabledAt: types.NullTime{
-			Time:  types.NewTime(time.Now()),
-			Valid: disable,
-		},
-		ID: userID,
+	return updateGroup(ctx, userID, func(tx sqlite.Tx) error {
+		_, err := tx.C().AuthUpdateGroupDisabledAt(ctx, repo.AuthUpdateGroupDisabledAtParams{
+			DisabledAt: types.NullTime{
+				Time:  types.NewTime(time.Now()),
+				Valid: disable,
+			},
+			ID: userID,
+		})
+		return err
 	})
-	return err
 }
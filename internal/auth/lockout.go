@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system/action"
+	"github.com/ItsNotGoodName/ipcmanview/internal/types"
+)
+
+const (
+	lockoutKindIP      = "ip"
+	lockoutKindAccount = "account"
+)
+
+const (
+	// lockoutIPFreeFailures is higher than the account one because many users can share an IP.
+	lockoutIPFreeFailures      = 10
+	lockoutAccountFreeFailures = 3
+	lockoutMaxDuration         = 15 * time.Minute
+	// lockoutResetDuration is how long without failures before failures are forgotten.
+	lockoutResetDuration = 24 * time.Hour
+)
+
+type LoginLockedError struct {
+	LockedUntil time.Time
+}
+
+func (e LoginLockedError) Error() string {
+	return fmt.Sprintf("login locked until %s", e.LockedUntil.Format(time.RFC3339))
+}
+
+// lockoutDuration doubles for every failure after the free failures.
+func lockoutDuration(failures, freeFailures int64) time.Duration {
+	if failures <= freeFailures {
+		return 0
+	}
+	exp := failures - freeFailures - 1
+	if exp >= 10 {
+		return lockoutMaxDuration
+	}
+	return min(time.Second<<exp, lockoutMaxDuration)
+}
+
+// lockoutAccountValue identifies the account by ID when the user exists.
+func lockoutAccountValue(userID int64, usernameOrEmail string) string {
+	if userID != 0 {
+		return strconv.FormatInt(userID, 10)
+	}
+	return strings.ToLower(strings.TrimSpace(usernameOrEmail))
+}
+
+type LoginAttemptParams struct {
+	IP              string
+	UsernameOrEmail string
+	// UserID is 0 when the user does not exist.
+	UserID int64
+}
+
+type lockoutKey struct {
+	kind         string
+	value        string
+	freeFailures int64
+}
+
+// lockoutKeys returns the IP and account keys that failures of the attempt count against.
+func lockoutKeys(arg LoginAttemptParams) []lockoutKey {
+	return []lockoutKey{
+		{lockoutKindIP, arg.IP, lockoutIPFreeFailures},
+		lockoutAccountKey(arg),
+	}
+}
+
+func lockoutAccountKey(arg LoginAttemptParams) lockoutKey {
+	return lockoutKey{lockoutKindAccount, lockoutAccountValue(arg.UserID, arg.UsernameOrEmail), lockoutAccountFreeFailures}
+}
+
+// CheckLoginLockout returns LoginLockedError when the IP or account is locked.
+func CheckLoginLockout(ctx context.Context, arg LoginAttemptParams) error {
+	now := time.Now()
+	for _, key := range lockoutKeys(arg) {
+		lockout, err := app.DB.C().AuthGetLoginLockout(ctx, repo.AuthGetLoginLockoutParams{
+			Kind:  key.kind,
+			Value: key.value,
+		})
+		if err != nil {
+			if core.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+
+		if lockout.LockedUntil.After(now) {
+			return LoginLockedError{LockedUntil: lockout.LockedUntil.Time}
+		}
+	}
+
+	return nil
+}
+
+// RecordLoginFailure counts the failure against the IP and account, locks them if needed, and records the failure.
+func RecordLoginFailure(ctx context.Context, arg LoginAttemptParams) error {
+	now := time.Now()
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Forget old failures so the table does not grow forever
+	if err := tx.C().AuthDeleteLoginLockoutByExpired(ctx, types.NewTime(now.Add(-lockoutResetDuration))); err != nil {
+		return err
+	}
+
+	var (
+		failures    int64
+		lockedUntil time.Time
+	)
+	for _, key := range lockoutKeys(arg) {
+		var keyFailures int64 = 1
+		lockout, err := tx.C().AuthGetLoginLockout(ctx, repo.AuthGetLoginLockoutParams{
+			Kind:  key.kind,
+			Value: key.value,
+		})
+		if err != nil && !core.IsNotFound(err) {
+			return err
+		}
+		if err == nil {
+			keyFailures = lockout.Failures + 1
+		}
+
+		keyLockedUntil := now.Add(lockoutDuration(keyFailures, key.freeFailures))
+		if err := tx.C().AuthUpsertLoginLockout(ctx, repo.AuthUpsertLoginLockoutParams{
+			Kind:         key.kind,
+			Value:        key.value,
+			Failures:     keyFailures,
+			LastFailedAt: types.NewTime(now),
+			LockedUntil:  types.NewTime(keyLockedUntil),
+		}); err != nil {
+			return err
+		}
+
+		failures = max(failures, keyFailures)
+		if keyLockedUntil.After(lockedUntil) {
+			lockedUntil = keyLockedUntil
+		}
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.AuthLoginFailed.Create(action.LoginFailed{
+		UserID:          arg.UserID,
+		UsernameOrEmail: arg.UsernameOrEmail,
+		IP:              arg.IP,
+	})); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	app.Hub.AuthLoginFailed(bus.AuthLoginFailed{
+		UserID:          arg.UserID,
+		UsernameOrEmail: arg.UsernameOrEmail,
+		IP:              arg.IP,
+		Failures:        failures,
+		LockedUntil:     lockedUntil,
+	})
+
+	return nil
+}
+
+// ClearLoginFailures forgets the failures of the account after a successful login, which includes the second factor.
+// Failures of the IP are kept because other accounts could be attacked from it.
+func ClearLoginFailures(ctx context.Context, arg LoginAttemptParams) error {
+	key := lockoutAccountKey(arg)
+	return app.DB.C().AuthDeleteLoginLockout(ctx, repo.AuthDeleteLoginLockoutParams{
+		Kind:  key.kind,
+		Value: key.value,
+	})
+}
+
+func ListLoginLockouts(ctx context.Context) ([]repo.LoginLockout, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	return app.DB.C().AuthListLoginLockouts(ctx)
+}
+
+func DeleteLoginLockout(ctx context.Context, id int64) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	return app.DB.C().AuthDeleteLoginLockoutByID(ctx, id)
+}
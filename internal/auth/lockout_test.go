@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		failures int64
+		duration time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{8, 16 * time.Second},
+		{13, 512 * time.Second},
+		{14, lockoutMaxDuration},
+		{100, lockoutMaxDuration},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.duration, lockoutDuration(tt.failures, 3), tt.failures)
+	}
+}
+
+func TestLockoutKeys(t *testing.T) {
+	password := LoginAttemptParams{IP: "192.168.1.2", UsernameOrEmail: " Admin ", UserID: 1}
+	twoFactor := LoginAttemptParams{IP: "192.168.1.2", UserID: 1}
+	unknown := LoginAttemptParams{IP: "192.168.1.2", UsernameOrEmail: " Admin "}
+
+	// Failed codes count against the same lockout as failed passwords
+	assert.Equal(t, lockoutKeys(password), lockoutKeys(twoFactor))
+	assert.Equal(t, []lockoutKey{
+		{lockoutKindIP, "192.168.1.2", lockoutIPFreeFailures},
+		{lockoutKindAccount, "1", lockoutAccountFreeFailures},
+	}, lockoutKeys(password))
+
+	assert.Equal(t, lockoutKey{lockoutKindAccount, "admin", lockoutAccountFreeFailures}, lockoutAccountKey(unknown))
+}
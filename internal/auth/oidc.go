@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/sqlite"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/types"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/oidc"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrOIDCDisabled      = errors.New("oidc is disabled")
+	ErrOIDCMissingEmail  = errors.New("oidc provider did not return an email")
+	ErrOIDCEmailConflict = errors.New("user with email already exists and email is not verified by oidc provider")
+)
+
+var oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+func oidcConfig(cfg system.OIDCConfig) oidc.Config {
+	return oidc.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Scopes:       cfg.Scopes,
+	}
+}
+
+// OIDCAuthCodeURL starts an OpenID Connect login.
+// The returned flow must be passed to OIDCLogin.
+func OIDCAuthCodeURL(ctx context.Context, cfg system.OIDCConfig) (string, oidc.Flow, error) {
+	if !cfg.Enable {
+		return "", oidc.Flow{}, ErrOIDCDisabled
+	}
+
+	provider, err := oidc.Discover(ctx, oidcHTTPClient, cfg.Issuer)
+	if err != nil {
+		return "", oidc.Flow{}, err
+	}
+
+	flow, err := oidc.NewFlow()
+	if err != nil {
+		return "", oidc.Flow{}, err
+	}
+
+	return oidc.AuthCodeURL(provider, oidcConfig(cfg), flow), flow, nil
+}
+
+// OIDCLogin finishes an OpenID Connect login and returns the user's ID.
+// Users are provisioned on first login and their groups are synced from the groups claim.
+func OIDCLogin(ctx context.Context, cfg system.OIDCConfig, flow oidc.Flow, code string) (int64, error) {
+	if !cfg.Enable {
+		return 0, ErrOIDCDisabled
+	}
+
+	provider, err := oidc.Discover(ctx, oidcHTTPClient, cfg.Issuer)
+	if err != nil {
+		return 0, err
+	}
+
+	claims, err := oidc.Exchange(ctx, oidcHTTPClient, provider, oidcConfig(cfg), flow, code)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	userID, err := tx.C().AuthGetUserOIDCIdentity(ctx, repo.AuthGetUserOIDCIdentityParams{
+		Issuer:  provider.Issuer,
+		Subject: claims.Subject(),
+	})
+	if err != nil {
+		if !core.IsNotFound(err) {
+			return 0, err
+		}
+
+		userID, err = provisionOIDCUser(ctx, tx, provider.Issuer, claims)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if cfg.GroupsClaim != "" {
+		if err := syncOIDCGroups(ctx, tx, userID, claims.Strings(cfg.GroupsClaim)); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func provisionOIDCUser(ctx context.Context, tx sqlite.Tx, issuer string, claims oidc.Claims) (int64, error) {
+	now := types.NewTime(time.Now())
+
+	email := strings.ToLower(claims.String("email"))
+	if email == "" {
+		return 0, ErrOIDCMissingEmail
+	}
+
+	// Link to existing user with the same email
+	user, err := tx.C().AuthGetUserByUsernameOrEmail(ctx, email)
+	if err == nil {
+		if !claims.Bool("email_verified") {
+			return 0, ErrOIDCEmailConflict
+		}
+
+		return user.ID, tx.C().AuthCreateUserOIDCIdentity(ctx, repo.AuthCreateUserOIDCIdentityParams{
+			UserID:    user.ID,
+			Issuer:    issuer,
+			Subject:   claims.Subject(),
+			CreatedAt: now,
+		})
+	}
+	if !core.IsNotFound(err) {
+		return 0, err
+	}
+
+	username, err := oidcUsername(ctx, tx, claims)
+	if err != nil {
+		return 0, err
+	}
+
+	model := _User{
+		Email:    email,
+		Username: username,
+	}
+	model.normalizeEmailAndUsername()
+
+	if err := core.ValidateStructPartial(ctx, model, "Email", "Username"); err != nil {
+		return 0, err
+	}
+
+	// Users can only login with OIDC until they reset their password
+	password, err := randomPasswordHash()
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := tx.C().AuthCreateUser(ctx, repo.AuthCreateUserParams{
+		Email:     model.Email,
+		Username:  model.Username,
+		Password:  password,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.C().AuthCreateUserOIDCIdentity(ctx, repo.AuthCreateUserOIDCIdentityParams{
+		UserID:    id,
+		Issuer:    issuer,
+		Subject:   claims.Subject(),
+		CreatedAt: now,
+	})
+}
+
+// oidcUsername picks a username from the claims that is not taken.
+func oidcUsername(ctx context.Context, tx sqlite.Tx, claims oidc.Claims) (string, error) {
+	username := claims.String("preferred_username")
+	if username == "" {
+		username, _, _ = strings.Cut(claims.String("email"), "@")
+	}
+	username = strings.ToLower(strings.NewReplacer("@", "", " ", "").Replace(username))
+	for len(username) < 3 {
+		username += "_"
+	}
+	if len(username) > 57 {
+		username = username[:57]
+	}
+
+	_, err := tx.C().AuthGetUserByUsernameOrEmail(ctx, username)
+	if core.IsNotFound(err) {
+		return username, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Disambiguate with the subject
+	hash := sha256.Sum256([]byte(claims.Subject()))
+	return username + "-" + hex.EncodeToString(hash[:3]), nil
+}
+
+func randomPasswordHash() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(base64.RawURLEncoding.EncodeToString(b)), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// syncOIDCGroups makes the user's group membership match the existing groups named in the claim.
+func syncOIDCGroups(ctx context.Context, tx sqlite.Tx, userID int64, names []string) error {
+	groupIDs := []int64{}
+	if len(names) > 0 {
+		var err error
+		groupIDs, err = tx.C().AuthListGroupIDsByName(ctx, names)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(groupIDs) == 0 {
+		return tx.C().AuthDeleteGroupUsersForUser(ctx, userID)
+	}
+
+	if err := tx.C().AuthDeleteGroupUsersForUserAndNotGroups(ctx, repo.AuthDeleteGroupUsersForUserAndNotGroupsParams{
+		UserID:   userID,
+		GroupIds: groupIDs,
+	}); err != nil {
+		return err
+	}
+
+	now := types.NewTime(time.Now())
+	for _, groupID := range groupIDs {
+		if err := tx.C().AuthCreateGroupUser(ctx, repo.AuthCreateGroupUserParams{
+			UserID:    userID,
+			GroupID:   groupID,
+			CreatedAt: now,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
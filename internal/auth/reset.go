@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/mail"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system/action"
+	"github.com/ItsNotGoodName/ipcmanview/internal/types"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrPasswordResetDisabled = errors.New("password reset is disabled")
+	ErrPasswordResetInvalid  = errors.New("invalid or expired password reset token")
+)
+
+const (
+	passwordResetDuration = time.Hour
+	// passwordResetThrottle limits how often a reset email can be sent to the same user.
+	passwordResetThrottle = time.Minute
+	passwordResetTimeout  = 30 * time.Second
+)
+
+func generatePasswordResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ForgotPassword emails a password reset link to the user with the email.
+// It does not return an error when the user does not exist so that emails cannot be enumerated.
+func ForgotPassword(ctx context.Context, cfg system.Config, email string) error {
+	if app.Mailer == nil || cfg.OIDC.PasswordLoginDisabled() {
+		return ErrPasswordResetDisabled
+	}
+
+	user, err := app.DB.C().AuthGetUserByUsernameOrEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		if core.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	// Only match by email
+	if user.Email != strings.ToLower(strings.TrimSpace(email)) || user.DisabledAt.Valid {
+		return nil
+	}
+
+	now := time.Now()
+
+	count, err := app.DB.C().AuthCountUserPasswordResetsSince(ctx, repo.AuthCountUserPasswordResetsSinceParams{
+		UserID:    user.ID,
+		CreatedAt: types.NewTime(now.Add(-passwordResetThrottle)),
+	})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	token, err := generatePasswordResetToken()
+	if err != nil {
+		return err
+	}
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := tx.C().AuthDeleteUserPasswordResetByExpired(ctx, types.NewTime(now)); err != nil {
+		return err
+	}
+
+	if err := tx.C().AuthCreateUserPasswordReset(ctx, repo.AuthCreateUserPasswordResetParams{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		CreatedAt: types.NewTime(now),
+		ExpiredAt: types.NewTime(now.Add(passwordResetDuration)),
+	}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	msg := passwordResetMessage(cfg, user, token)
+
+	// Send in the background so the response time does not reveal whether the email exists
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), passwordResetTimeout)
+		defer cancel()
+
+		if err := app.Mailer.Send(ctx, msg); err != nil {
+			log.Err(err).Str("package", "auth").Int64("user-id", user.ID).Msg("Failed to send password reset email")
+		}
+	}()
+
+	return nil
+}
+
+func passwordResetMessage(cfg system.Config, user repo.User, token string) mail.Message {
+	siteName := core.First(cfg.SiteName, "IPCManView")
+	link := strings.TrimSuffix(app.PublicURL, "/") + "/reset?token=" + token
+
+	return mail.Message{
+		To:      []string{user.Email},
+		Subject: fmt.Sprintf("%s password reset", siteName),
+		Body: fmt.Sprintf(`Hello %s,
+
+Someone requested a password reset for your %s account.
+Open the link below to choose a new password, it expires in %s.
+
+%s
+
+If you did not request this, you can ignore this email.
+`, user.Username, siteName, passwordResetDuration, link),
+	}
+}
+
+type ResetPasswordParams struct {
+	Token       string
+	NewPassword string
+}
+
+// ResetPassword consumes the reset token, changes the password, and signs the user out everywhere.
+func ResetPassword(ctx context.Context, arg ResetPasswordParams) error {
+	now := time.Now()
+
+	reset, err := app.DB.C().AuthGetUserPasswordResetByTokenHash(ctx, repo.AuthGetUserPasswordResetByTokenHashParams{
+		TokenHash: hashToken(arg.Token),
+		Now:       types.NewTime(now),
+	})
+	if err != nil {
+		if core.IsNotFound(err) {
+			return ErrPasswordResetInvalid
+		}
+		return err
+	}
+
+	model := _User{
+		Password: arg.NewPassword,
+	}
+
+	if err := core.ValidateStructPartial(ctx, model, "Password"); err != nil {
+		return err
+	}
+
+	password, err := model.passwordHash()
+	if err != nil {
+		return err
+	}
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Tokens are single use
+	rows, err := tx.C().AuthUpdateUserPasswordResetUsedAt(ctx, repo.AuthUpdateUserPasswordResetUsedAtParams{
+		UsedAt: types.NullTime{Time: types.NewTime(now), Valid: true},
+		ID:     reset.ID,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrPasswordResetInvalid
+	}
+
+	if err := tx.C().AuthDeleteUserPasswordResetForUserAndUnused(ctx, reset.UserID); err != nil {
+		return err
+	}
+
+	if _, err := tx.C().AuthPatchUser(ctx, repo.AuthPatchUserParams{
+		Password:  core.NewNullString(password),
+		UpdatedAt: types.NewTime(now),
+		ID:        reset.UserID,
+	}); err != nil {
+		return err
+	}
+
+	if err := tx.C().AuthDeleteUserSessionByUser(ctx, reset.UserID); err != nil {
+		return err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.UserPasswordUpdated.Create(reset.UserID)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	app.Hub.UserSecurityUpdated(bus.UserSecurityUpdated{
+		UserID: reset.UserID,
+	})
+
+	return nil
+}
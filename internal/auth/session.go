@@ -9,6 +9,8 @@ import (
 	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
 	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system/action"
 	"github.com/ItsNotGoodName/ipcmanview/internal/types"
 )
 
@@ -27,6 +29,10 @@ type Session struct {
 	Username  string
 	Admin     bool
 	Disabled  bool
+	// Scope is set when the session is from an API token.
+	Scope *core.ActorScope
+	// TwoFactorRequired is set when the user must enable two-factor authentication before doing anything else.
+	TwoFactorRequired bool
 }
 
 type sessionCtxKey struct{}
@@ -118,7 +124,13 @@ func DeleteUserSession(ctx context.Context, userID int64, sessionID int64) error
 		return err
 	}
 
-	err := app.DB.C().AuthDeleteUserSessionForUser(ctx, repo.AuthDeleteUserSessionForUserParams{
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.C().AuthDeleteUserSessionForUser(ctx, repo.AuthDeleteUserSessionForUserParams{
 		UserID: userID,
 		ID:     sessionID,
 	})
@@ -126,6 +138,17 @@ func DeleteUserSession(ctx context.Context, userID int64, sessionID int64) error
 		return err
 	}
 
+	if err := system.CreateEvent(ctx, tx.C(), action.UserSessionDeleted.Create(action.UserSession{
+		UserID:    userID,
+		SessionID: sessionID,
+	})); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
 	app.Hub.UserSecurityUpdated(bus.UserSecurityUpdated{
 		UserID: userID,
 	})
@@ -138,7 +161,13 @@ func DeleteOtherUserSessions(ctx context.Context, userID int64, currentSessionID
 		return err
 	}
 
-	err := app.DB.C().AuthDeleteUserSessionForUserAndNotSession(ctx, repo.AuthDeleteUserSessionForUserAndNotSessionParams{
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.C().AuthDeleteUserSessionForUserAndNotSession(ctx, repo.AuthDeleteUserSessionForUserAndNotSessionParams{
 		UserID: userID,
 		ID:     currentSessionID,
 	})
@@ -146,6 +175,16 @@ func DeleteOtherUserSessions(ctx context.Context, userID int64, currentSessionID
 		return err
 	}
 
+	if err := system.CreateEvent(ctx, tx.C(), action.UserSessionDeleted.Create(action.UserSession{
+		UserID: userID,
+	})); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
 	app.Hub.UserSecurityUpdated(bus.UserSecurityUpdated{
 		UserID: userID,
 	})
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/types"
+)
+
+// TokenPrefix makes API tokens recognizable, e.g. by secret scanners.
+const TokenPrefix = "ipcm_"
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return TokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken hashes the token for storage.
+// Tokens are random enough that a fast hash is sufficient.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// IsToken returns true if the value looks like an API token.
+func IsToken(value string) bool {
+	return strings.HasPrefix(value, TokenPrefix)
+}
+
+type _UserToken struct {
+	Name  string                      `validate:"gte=1,lte=64"`
+	Level models.DahuaPermissionLevel `validate:"gte=0,lte=2"`
+}
+
+type CreateUserTokenParams struct {
+	Name      string
+	Level     models.DahuaPermissionLevel
+	ReadOnly  bool
+	ExpiredAt time.Time
+}
+
+// CreateUserToken creates an API token for the current user and returns the token.
+// The token is only returned here because only its hash is stored.
+func CreateUserToken(ctx context.Context, arg CreateUserTokenParams) (int64, string, error) {
+	actor := core.UseActor(ctx)
+	if actor.Type != core.ActorTypeUser {
+		return 0, "", core.ErrForbidden
+	}
+	if actor.Scope != nil {
+		return 0, "", core.NewFieldError("Name", "API tokens cannot create API tokens.")
+	}
+
+	model := _UserToken{
+		Name:  strings.TrimSpace(arg.Name),
+		Level: arg.Level,
+	}
+
+	if err := core.ValidateStruct(ctx, model); err != nil {
+		return 0, "", err
+	}
+
+	now := time.Now()
+	if !arg.ExpiredAt.IsZero() && !arg.ExpiredAt.After(now) {
+		return 0, "", core.NewFieldError("ExpiredAt", "Expiration must be in the future.")
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return 0, "", err
+	}
+
+	id, err := app.DB.C().AuthCreateUserToken(ctx, repo.AuthCreateUserTokenParams{
+		UserID:    actor.UserID,
+		Name:      model.Name,
+		TokenHash: hashToken(token),
+		Level:     model.Level,
+		ReadOnly:  arg.ReadOnly,
+		CreatedAt: types.NewTime(now),
+		ExpiredAt: types.NullTime{
+			Time:  types.NewTime(arg.ExpiredAt),
+			Valid: !arg.ExpiredAt.IsZero(),
+		},
+	})
+	if err != nil {
+		return 0, "", err
+	}
+
+	app.Hub.UserSecurityUpdated(bus.UserSecurityUpdated{
+		UserID: actor.UserID,
+	})
+
+	return id, token, nil
+}
+
+func ListUserTokens(ctx context.Context, userID int64) ([]repo.UserToken, error) {
+	if _, err := core.AssertAdminOrUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return app.DB.C().AuthListUserTokensForUser(ctx, userID)
+}
+
+func DeleteUserToken(ctx context.Context, userID int64, tokenID int64) error {
+	if _, err := core.AssertAdminOrUser(ctx, userID); err != nil {
+		return err
+	}
+
+	err := app.DB.C().AuthDeleteUserTokenForUser(ctx, repo.AuthDeleteUserTokenForUserParams{
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	app.Hub.UserSecurityUpdated(bus.UserSecurityUpdated{
+		UserID: userID,
+	})
+
+	return nil
+}
+
+func GetUserTokenForContext(ctx context.Context, token string) (repo.AuthGetUserTokenForContextRow, error) {
+	return app.DB.C().AuthGetUserTokenForContext(ctx, repo.AuthGetUserTokenForContextParams{
+		TokenHash: hashToken(token),
+		Now:       types.NewTime(time.Now()),
+	})
+}
+
+type TouchUserTokenParams struct {
+	TokenID    int64
+	LastUsedAt time.Time
+	LastIP     string
+	IP         string
+}
+
+func TouchUserToken(ctx context.Context, arg TouchUserTokenParams) error {
+	now := time.Now()
+	if arg.LastIP == arg.IP && arg.LastUsedAt.After(now.Add(-app.TouchTokenThrottle.Duration)) {
+		return nil
+	}
+
+	unlock, err := app.TouchTokenThrottle.TryLock(arg.TokenID)
+	if err != nil {
+		return nil
+	}
+	defer unlock()
+
+	return app.DB.C().AuthUpdateUserToken(ctx, repo.AuthUpdateUserTokenParams{
+		LastIp:     arg.IP,
+		LastUsedAt: types.NullTime{Time: types.NewTime(now), Valid: true},
+		ID:         arg.TokenID,
+	})
+}
@@ -0,0 +1,419 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/types"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/totp"
+)
+
+var (
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	ErrLoginChallenge      = errors.New("invalid or expired login challenge")
+)
+
+const recoveryCodeCount = 10
+
+// TwoFactorRequired returns true if the user must have two-factor authentication enabled.
+func TwoFactorRequired(cfg system.Config, admin, groupRequired bool) bool {
+	return groupRequired || (admin && cfg.RequireTwoFactorForAdmins)
+}
+
+type TwoFactorStatus struct {
+	Enabled       bool
+	Required      bool
+	RecoveryCodes int64
+}
+
+func GetTwoFactorStatus(ctx context.Context, cfg system.Config, userID int64) (TwoFactorStatus, error) {
+	if _, err := core.AssertAdminOrUser(ctx, userID); err != nil {
+		return TwoFactorStatus{}, err
+	}
+
+	policy, err := app.DB.C().AuthGetUserTwoFactorPolicy(ctx, userID)
+	if err != nil {
+		return TwoFactorStatus{}, err
+	}
+
+	recoveryCodes, err := app.DB.C().AuthCountUserRecoveryCodesUnused(ctx, userID)
+	if err != nil {
+		return TwoFactorStatus{}, err
+	}
+
+	return TwoFactorStatus{
+		Enabled:       policy.Enabled,
+		Required:      TwoFactorRequired(cfg, policy.Admin, policy.GroupRequired),
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+// UserTwoFactorEnabled returns true if login requires a second step.
+func UserTwoFactorEnabled(ctx context.Context, userID int64) (bool, error) {
+	policy, err := app.DB.C().AuthGetUserTwoFactorPolicy(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return policy.Enabled, nil
+}
+
+type EnrollTwoFactorResult struct {
+	Secret string
+	URL    string
+}
+
+// EnrollTwoFactor generates a new TOTP secret for the current user.
+// Two-factor authentication is enabled after the first code is verified by VerifyTwoFactor.
+func EnrollTwoFactor(ctx context.Context, cfg system.Config) (EnrollTwoFactorResult, error) {
+	actor := core.UseActor(ctx)
+	if actor.Type != core.ActorTypeUser || actor.Scope != nil {
+		return EnrollTwoFactorResult{}, core.ErrForbidden
+	}
+
+	user, err := app.DB.C().AuthGetUser(ctx, actor.UserID)
+	if err != nil {
+		return EnrollTwoFactorResult{}, err
+	}
+
+	enabled, err := UserTwoFactorEnabled(ctx, user.ID)
+	if err != nil {
+		return EnrollTwoFactorResult{}, err
+	}
+	if enabled {
+		return EnrollTwoFactorResult{}, ErrTwoFactorEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return EnrollTwoFactorResult{}, err
+	}
+
+	if err := app.DB.C().AuthUpsertUserTotp(ctx, repo.AuthUpsertUserTotpParams{
+		UserID:    user.ID,
+		Secret:    secret,
+		CreatedAt: types.NewTime(time.Now()),
+	}); err != nil {
+		return EnrollTwoFactorResult{}, err
+	}
+
+	issuer := cfg.SiteName
+	if issuer == "" {
+		issuer = "IPCManView"
+	}
+
+	return EnrollTwoFactorResult{
+		Secret: secret,
+		URL:    totp.URL(issuer, user.Username, secret),
+	}, nil
+}
+
+// VerifyTwoFactor enables two-factor authentication for the current user and returns the recovery codes.
+func VerifyTwoFactor(ctx context.Context, code string) ([]string, error) {
+	actor := core.UseActor(ctx)
+	if actor.Type != core.ActorTypeUser || actor.Scope != nil {
+		return nil, core.ErrForbidden
+	}
+
+	dbTotp, err := app.DB.C().AuthGetUserTotp(ctx, actor.UserID)
+	if err != nil {
+		if core.IsNotFound(err) {
+			return nil, ErrTwoFactorNotEnabled
+		}
+		return nil, err
+	}
+	if dbTotp.EnabledAt.Valid {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	step, ok := totp.Validate(dbTotp.Secret, code, time.Now())
+	if !ok {
+		return nil, core.NewFieldError("Code", "Invalid code.")
+	}
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.C().AuthUpdateUserTotpLastStep(ctx, repo.AuthUpdateUserTotpLastStepParams{
+		LastStep: step,
+		UserID:   actor.UserID,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.C().AuthUpdateUserTotpEnabledAt(ctx, repo.AuthUpdateUserTotpEnabledAtParams{
+		EnabledAt: types.NullTime{Time: types.NewTime(time.Now()), Valid: true},
+		UserID:    actor.UserID,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.C().AuthDeleteUserRecoveryCodes(ctx, actor.UserID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := tx.C().AuthCreateUserRecoveryCode(ctx, repo.AuthCreateUserRecoveryCodeParams{
+			UserID:   actor.UserID,
+			CodeHash: hashToken(normalizeRecoveryCode(code)),
+		}); err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	app.Hub.UserSecurityUpdated(bus.UserSecurityUpdated{
+		UserID: actor.UserID,
+	})
+
+	return codes, nil
+}
+
+// DisableTwoFactor disables two-factor authentication for the current user after checking a code.
+func DisableTwoFactor(ctx context.Context, code string) error {
+	actor := core.UseActor(ctx)
+	if actor.Type != core.ActorTypeUser || actor.Scope != nil {
+		return core.ErrForbidden
+	}
+
+	if err := checkTwoFactorCode(ctx, actor.UserID, code); err != nil {
+		return err
+	}
+
+	return deleteTwoFactor(ctx, actor.UserID)
+}
+
+// ResetTwoFactor disables two-factor authentication for a user that lost their authenticator.
+func ResetTwoFactor(ctx context.Context, userID int64) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	return deleteTwoFactor(ctx, userID)
+}
+
+func deleteTwoFactor(ctx context.Context, userID int64) error {
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := tx.C().AuthDeleteUserTotp(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := tx.C().AuthDeleteUserRecoveryCodes(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	app.Hub.UserSecurityUpdated(bus.UserSecurityUpdated{
+		UserID: userID,
+	})
+
+	return nil
+}
+
+// checkTwoFactorCode accepts a TOTP code or an unused recovery code.
+// Each code can only be used once.
+func checkTwoFactorCode(ctx context.Context, userID int64, code string) error {
+	dbTotp, err := app.DB.C().AuthGetUserTotp(ctx, userID)
+	if err != nil {
+		if core.IsNotFound(err) {
+			return ErrTwoFactorNotEnabled
+		}
+		return err
+	}
+	if !dbTotp.EnabledAt.Valid {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if step, ok := totp.Validate(dbTotp.Secret, code, time.Now()); ok {
+		count, err := app.DB.C().AuthUpdateUserTotpLastStep(ctx, repo.AuthUpdateUserTotpLastStepParams{
+			LastStep: step,
+			UserID:   userID,
+		})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return core.NewFieldError("Code", "Code has already been used.")
+		}
+		return nil
+	}
+
+	count, err := app.DB.C().AuthUpdateUserRecoveryCodeUsedAt(ctx, repo.AuthUpdateUserRecoveryCodeUsedAtParams{
+		UsedAt:   types.NullTime{Time: types.NewTime(time.Now()), Valid: true},
+		UserID:   userID,
+		CodeHash: hashToken(normalizeRecoveryCode(code)),
+	})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return core.NewFieldError("Code", "Invalid code.")
+	}
+
+	return nil
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCode returns a code formatted as xxxxx-xxxxx.
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// ---------- Login challenge
+
+const (
+	loginChallengeDuration = 5 * time.Minute
+	loginChallengeAttempts = 5
+)
+
+type loginChallenge struct {
+	UserID     int64
+	RememberMe bool
+	ExpiredAt  time.Time
+	Attempts   int
+}
+
+func NewLoginChallengeStore() *LoginChallengeStore {
+	return &LoginChallengeStore{
+		challenges: make(map[string]loginChallenge),
+	}
+}
+
+// LoginChallengeStore holds logins that passed the password check and are waiting for a second factor.
+type LoginChallengeStore struct {
+	mu         sync.Mutex
+	challenges map[string]loginChallenge
+}
+
+type CreateLoginChallengeParams struct {
+	UserID     int64
+	RememberMe bool
+}
+
+// CreateLoginChallenge returns a challenge that is exchanged with a code by CompleteLoginChallenge.
+func CreateLoginChallenge(arg CreateLoginChallengeParams) (string, error) {
+	challenge, err := generateSession()
+	if err != nil {
+		return "", err
+	}
+
+	s := app.LoginChallenges
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, v := range s.challenges {
+		if now.After(v.ExpiredAt) {
+			delete(s.challenges, k)
+		}
+	}
+
+	s.challenges[challenge] = loginChallenge{
+		UserID:     arg.UserID,
+		RememberMe: arg.RememberMe,
+		ExpiredAt:  now.Add(loginChallengeDuration),
+	}
+
+	return challenge, nil
+}
+
+type CompleteLoginChallengeResult struct {
+	UserID     int64
+	RememberMe bool
+}
+
+type CompleteLoginChallengeParams struct {
+	Challenge string
+	Code      string
+	IP        string
+}
+
+// CompleteLoginChallenge checks the code for the challenge.
+// The challenge is removed on success or after too many attempts.
+// Invalid codes count as failed logins against the same lockout as passwords, and the account's failures are cleared on success.
+func CompleteLoginChallenge(ctx context.Context, arg CompleteLoginChallengeParams) (CompleteLoginChallengeResult, error) {
+	s := app.LoginChallenges
+
+	s.mu.Lock()
+	v, ok := s.challenges[arg.Challenge]
+	if !ok || time.Now().After(v.ExpiredAt) || v.Attempts >= loginChallengeAttempts {
+		delete(s.challenges, arg.Challenge)
+		s.mu.Unlock()
+		return CompleteLoginChallengeResult{}, ErrLoginChallenge
+	}
+	v.Attempts++
+	s.challenges[arg.Challenge] = v
+	s.mu.Unlock()
+
+	attempt := LoginAttemptParams{
+		IP:     arg.IP,
+		UserID: v.UserID,
+	}
+
+	if err := CheckLoginLockout(ctx, attempt); err != nil {
+		return CompleteLoginChallengeResult{}, err
+	}
+
+	if err := checkTwoFactorCode(ctx, v.UserID, arg.Code); err != nil {
+		if _, ok := core.AsFieldErrors(err); ok {
+			if err := RecordLoginFailure(ctx, attempt); err != nil {
+				return CompleteLoginChallengeResult{}, err
+			}
+		}
+		return CompleteLoginChallengeResult{}, err
+	}
+
+	s.mu.Lock()
+	delete(s.challenges, arg.Challenge)
+	s.mu.Unlock()
+
+	if err := ClearLoginFailures(ctx, attempt); err != nil {
+		return CompleteLoginChallengeResult{}, err
+	}
+
+	return CompleteLoginChallengeResult{
+		UserID:     v.UserID,
+		RememberMe: v.RememberMe,
+	}, nil
+}
@@ -8,11 +8,33 @@ import (
 	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
 	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/sqlite"
 	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system/action"
 	"github.com/ItsNotGoodName/ipcmanview/internal/types"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// userAudit returns the state of the user recorded in the audit log.
+func userAudit(ctx context.Context, db sqlite.DBTx, id int64) (action.User, error) {
+	v, err := db.AuthGetUser(ctx, id)
+	if err != nil {
+		return action.User{}, err
+	}
+
+	count, err := db.AuthCountAdminForUser(ctx, id)
+	if err != nil {
+		return action.User{}, err
+	}
+
+	return action.User{
+		Email:    v.Email,
+		Username: v.Username,
+		Admin:    count > 0,
+		Disabled: v.DisabledAt.Valid,
+	}, nil
+}
+
 func userFrom(v repo.User) _User {
 	return _User{
 		Email:    v.Email,
@@ -49,7 +71,7 @@ type CreateUserParams struct {
 
 func CreateUser(ctx context.Context, cfg system.Config, arg CreateUserParams) (int64, error) {
 	actor := core.UseActor(ctx)
-	if !actor.Admin && !cfg.EnableSignUp {
+	if !actor.Admin && (!cfg.EnableSignUp || cfg.OIDC.PasswordLoginDisabled()) {
 		return 0, core.ErrForbidden
 	}
 
@@ -107,6 +129,15 @@ func CreateUser(ctx context.Context, cfg system.Config, arg CreateUserParams) (i
 		})
 	}
 
+	after, err := userAudit(ctx, tx.C(), id)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.UserCreated.Create(id).WithDiff(nil, after)); err != nil {
+		return 0, err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return 0, err
 	}
@@ -141,13 +172,48 @@ func UpdateUser(ctx context.Context, arg UpdateUserParams) error {
 		return err
 	}
 
-	_, err = app.DB.C().AuthPatchUser(ctx, repo.AuthPatchUserParams{
+	return patchUser(ctx, repo.AuthPatchUserParams{
 		Username:  core.NewNullString(model.Username),
 		Email:     core.NewNullString(model.Email),
 		UpdatedAt: types.NewTime(time.Now()),
 		ID:        dbModel.ID,
 	})
-	return err
+}
+
+func patchUser(ctx context.Context, arg repo.AuthPatchUserParams) error {
+	return updateUser(ctx, arg.ID, func(tx sqlite.Tx) error {
+		_, err := tx.C().AuthPatchUser(ctx, arg)
+		return err
+	})
+}
+
+// updateUser runs fn in a transaction and records the change to the user in the audit log.
+func updateUser(ctx context.Context, id int64, fn func(tx sqlite.Tx) error) error {
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := userAudit(ctx, tx.C(), id)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	after, err := userAudit(ctx, tx.C(), id)
+	if err != nil {
+		return err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.UserUpdated.Create(id).WithDiff(before, after)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func DeleteUser(ctx context.Context, id int64) error {
@@ -158,7 +224,27 @@ func DeleteUser(ctx context.Context, id int64) error {
 	if actor.Admin && actor.UserID == id {
 		return core.ErrForbidden
 	}
-	return app.DB.C().DeleteUser(ctx, id)
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := userAudit(ctx, tx.C(), id)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.C().DeleteUser(ctx, id); err != nil {
+		return err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.UserDeleted.Create(id).WithDiff(before, nil)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 type UpdateUserPasswordParams struct {
@@ -221,6 +307,10 @@ func UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error
 		return err
 	}
 
+	if err := system.CreateEvent(ctx, tx.C(), action.UserPasswordUpdated.Create(dbModel.ID)); err != nil {
+		return err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return err
 	}
@@ -251,12 +341,11 @@ func UpdateUserUsername(ctx context.Context, userID int64, newUsername string) e
 		return err
 	}
 
-	_, err = app.DB.C().AuthPatchUser(ctx, repo.AuthPatchUserParams{
+	return patchUser(ctx, repo.AuthPatchUserParams{
 		Username:  core.NewNullString(model.Username),
 		UpdatedAt: types.NewTime(time.Now()),
 		ID:        dbModel.ID,
 	})
-	return err
 }
 
 func UpdateUserDisabled(ctx context.Context, id int64, disable bool) error {
@@ -268,12 +357,15 @@ func UpdateUserDisabled(ctx context.Context, id int64, disable bool) error {
 		return core.ErrForbidden
 	}
 
-	_, err = app.DB.C().AuthUpdateUserDisabledAt(ctx, repo.AuthUpdateUserDisabledAtParams{
-		DisabledAt: types.NullTime{
-			Time:  types.NewTime(time.Now()),
-			Valid: disable,
-		},
-		ID: id,
+	err = updateUser(ctx, id, func(tx sqlite.Tx) error {
+		_, err := tx.C().AuthUpdateUserDisabledAt(ctx, repo.AuthUpdateUserDisabledAtParams{
+			DisabledAt: types.NullTime{
+				Time:  types.NewTime(time.Now()),
+				Valid: disable,
+			},
+			ID: id,
+		})
+		return err
 	})
 	if err != nil {
 		return err
@@ -295,19 +387,21 @@ func UpdateUserAdmin(ctx context.Context, id int64, admin bool) error {
 		return core.ErrForbidden
 	}
 
-	if admin {
-		_, err := app.DB.C().AuthUpsertAdmin(ctx, repo.AuthUpsertAdminParams{
-			UserID:    id,
-			CreatedAt: types.NewTime(time.Now()),
-		})
-		if err != nil {
-			return err
-		}
-	} else {
-		err := app.DB.C().AuthDeleteAdmin(ctx, id)
-		if err != nil {
-			return err
+	err = updateUser(ctx, id, func(tx sqlite.Tx) error {
+		if admin {
+			_, err := tx.C().AuthUpsertAdmin(ctx, repo.AuthUpsertAdminParams{
+				UserID:    id,
+				CreatedAt: types.NewTime(time.Now()),
+			})
+			if err != nil && !core.IsNotFound(err) {
+				return err
+			}
+			return nil
 		}
+		return tx.C().AuthDeleteAdmin(ctx, id)
+	})
+	if err != nil {
+		return err
 	}
 
 	app.Hub.UserSecurityUpdated(bus.UserSecurityUpdated{
@@ -320,3 +414,11 @@ func UpdateUserAdmin(ctx context.Context, id int64, admin bool) error {
 func CheckUserPassword(hash, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
+
+// dummyPasswordHash has the same cost as the hashes of users' passwords.
+const dummyPasswordHash = "$2a$10$hV8NCvKMZRuvwWRacT08y.UdwH/ysq5.aDvAPCjEn93beHQ5v.tgO"
+
+// CheckDummyPassword takes as long as CheckUserPassword so logging in as a user that does not exist cannot be told apart by timing.
+func CheckDummyPassword(password string) {
+	_ = bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password))
+}
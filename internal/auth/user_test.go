@@ -0,0 +1,14 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestDummyPasswordHash(t *testing.T) {
+	cost, err := bcrypt.Cost([]byte(dummyPasswordHash))
+	assert.NoError(t, err)
+	assert.Equal(t, bcrypt.DefaultCost, cost)
+}
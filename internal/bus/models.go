@@ -1,6 +1,8 @@
 package bus
 
 import (
+	"time"
+
 	"github.com/ItsNotGoodName/ipcmanview/internal/models"
 	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
 )
@@ -13,11 +15,23 @@ type UserSecurityUpdated struct {
 	UserID int64
 }
 
+type AuthLoginFailed struct {
+	// UserID is 0 when the user does not exist.
+	UserID          int64
+	UsernameOrEmail string
+	IP              string
+	Failures        int64
+	LockedUntil     time.Time
+}
+
 type DahuaEvent struct {
 	Event     repo.DahuaEvent
 	EventRule repo.DahuaEventRule
 }
 
+type DahuaEventRulesUpdated struct {
+}
+
 type DahuaDeviceCreated struct {
 	DeviceID int64
 }
@@ -59,6 +73,8 @@ type DahuaWorkerDisconnected struct {
 	DeviceID int64
 	Type     models.DahuaWorkerType
 	Error    error
+	// Maintenance is true when the device was in maintenance, so the disconnect is expected.
+	Maintenance bool
 }
 
 type DahuaCoaxialStatus struct {
@@ -66,3 +82,33 @@ type DahuaCoaxialStatus struct {
 	Channel       int
 	CoaxialStatus models.DahuaCoaxialStatus
 }
+
+type DahuaSnapshotScheduleUpdated struct {
+	DeviceID int64
+}
+
+type DahuaCapabilitiesUpdated struct {
+	DeviceID int64
+}
+
+type DahuaChannelsUpdated struct {
+	DeviceID int64
+}
+
+type DahuaTimelapseCreated struct {
+	DeviceID    int64
+	TimelapseID int64
+}
+
+type DahuaExportProgress struct {
+	DeviceID int64
+	ExportID int64
+	// Progress is between 0 and 1.
+	Progress float64
+}
+
+type DahuaExportCompleted struct {
+	DeviceID int64
+	ExportID int64
+	Error    error
+}
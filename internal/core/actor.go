@@ -3,6 +3,9 @@ package core
 import (
 	"context"
 	"fmt"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
 )
 
 var actorCtxKey contextKey = contextKey("actor")
@@ -27,6 +30,29 @@ type Actor struct {
 	Type   ActorType
 	UserID int64
 	Admin  bool
+	// Scope limits the actor when it is authenticated with an API token.
+	Scope *ActorScope
+	// Guest limits a public actor to what a guest link shares.
+	Guest *ActorGuest
+}
+
+type ActorScope struct {
+	// Level is the highest device permission level the actor can use.
+	Level models.DahuaPermissionLevel
+	// ReadOnly denies the actor from making changes.
+	ReadOnly bool
+}
+
+type ActorGuest struct {
+	LinkID   int64
+	DeviceID int64
+	// Channel is the channel of the shared live view and recordings.
+	Channel int64
+	Live    bool
+	FileIDs []int64
+	// Start and End are zero when recordings are not shared by time range.
+	Start time.Time
+	End   time.Time
 }
 
 // WithSystemActor sets actor to system.
@@ -43,6 +69,16 @@ func WithPublicActor(ctx context.Context) context.Context {
 	})
 }
 
+// WithGuestActor sets actor to public limited by a guest link.
+func WithGuestActor(ctx context.Context, guest ActorGuest) context.Context {
+	return context.WithValue(ctx, actorCtxKey, Actor{
+		Type:   ActorTypePublic,
+		UserID: 0,
+		Admin:  false,
+		Guest:  &guest,
+	})
+}
+
 // WithUserActor sets actor to user.
 func WithUserActor(ctx context.Context, userID int64, admin bool) context.Context {
 	return context.WithValue(ctx, actorCtxKey, Actor{
@@ -52,6 +88,17 @@ func WithUserActor(ctx context.Context, userID int64, admin bool) context.Contex
 	})
 }
 
+// WithTokenActor sets actor to user limited by the scope of an API token.
+// Admin is only kept when the token has the admin level.
+func WithTokenActor(ctx context.Context, userID int64, admin bool, scope ActorScope) context.Context {
+	return context.WithValue(ctx, actorCtxKey, Actor{
+		Type:   ActorTypeUser,
+		UserID: userID,
+		Admin:  admin && scope.Level == models.DahuaPermissionLevel_Admin,
+		Scope:  &scope,
+	})
+}
+
 func UseActor(ctx context.Context) Actor {
 	actor, ok := ctx.Value(actorCtxKey).(Actor)
 	if !ok {
@@ -75,3 +122,22 @@ func AssertAdmin(ctx context.Context) (Actor, error) {
 	}
 	return actor, fmt.Errorf("%w: not admin", ErrForbidden)
 }
+
+var requestInfoCtxKey contextKey = contextKey("request-info")
+
+// RequestInfo describes where the actor's request came from.
+type RequestInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// WithRequestInfo sets the request info.
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoCtxKey, info)
+}
+
+// UseRequestInfo returns the request info or an empty one when the actor did not make a request.
+func UseRequestInfo(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(requestInfoCtxKey).(RequestInfo)
+	return info
+}
@@ -24,7 +24,7 @@ func SplitAddress(address string) (host string, port string) {
 }
 
 func Address(host string, port int) string {
-	return host + ":" + strconv.Itoa(port)
+	return net.JoinHostPort(host, strconv.Itoa(port))
 }
 
 func NewTimeRange(start, end time.Time) (models.TimeRange, error) {
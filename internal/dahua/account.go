@@ -0,0 +1,413 @@
+package dahua
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system/action"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc/modules/usermanager"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrDeviceAccountInUse is returned when changing the account that is used to connect to the device in a way that would disconnect it.
+var ErrDeviceAccountInUse = errors.New("account is used to connect to the device")
+
+const (
+	accountOperationCreate   = "create"
+	accountOperationUpdate   = "update"
+	accountOperationDelete   = "delete"
+	accountOperationPassword = "password"
+)
+
+// createAccountEvent records the change to the device's account in the audit log and returns the error of the change.
+func createAccountEvent(ctx context.Context, event action.DahuaAccount, accountErr error) error {
+	if err := recordAccountEvent(ctx, event, accountErr); err != nil {
+		return err
+	}
+	return accountErr
+}
+
+// recordAccountEvent only returns the error from recording the event, not accountErr.
+func recordAccountEvent(ctx context.Context, event action.DahuaAccount, accountErr error) error {
+	if accountErr != nil {
+		event.Error = accountErr.Error()
+	}
+	return system.CreateEvent(ctx, app.DB.C(), action.DahuaDeviceAccount.Create(event))
+}
+
+type DeviceAccounts struct {
+	// Username is the user that is used to connect to the device.
+	Username    string
+	Users       []usermanager.UserInfo
+	Groups      []usermanager.GroupInfo
+	Authorities []string
+}
+
+// ListDeviceAccounts lists the users and groups on the device.
+// Password hashes are not returned.
+func ListDeviceAccounts(ctx context.Context, deviceID int64) (DeviceAccounts, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return DeviceAccounts{}, err
+	}
+
+	client, err := GetClient(ctx, deviceID)
+	if err != nil {
+		return DeviceAccounts{}, err
+	}
+
+	users, err := usermanager.GetUserInfoAll(ctx, client.RPC)
+	if err != nil {
+		return DeviceAccounts{}, err
+	}
+	for i := range users {
+		users[i].Password = ""
+	}
+
+	groups, err := usermanager.GetGroupInfoAll(ctx, client.RPC)
+	if err != nil {
+		return DeviceAccounts{}, err
+	}
+
+	authorities, err := usermanager.GetAuthorityList(ctx, client.RPC)
+	if err != nil {
+		return DeviceAccounts{}, err
+	}
+
+	return DeviceAccounts{
+		Username:    client.Conn.Username,
+		Users:       users,
+		Groups:      groups,
+		Authorities: authorities,
+	}, nil
+}
+
+type _DeviceAccount struct {
+	Name  string `validate:"required,lte=32"`
+	Group string `validate:"required"`
+}
+
+type DeviceAccountParams struct {
+	Name string
+	// Password is only used when creating an account.
+	Password      string
+	Group         string
+	AuthorityList []string
+	Memo          string
+	Sharable      bool
+}
+
+func (arg DeviceAccountParams) validate(ctx context.Context) (usermanager.UserParams, error) {
+	model := _DeviceAccount{
+		Name:  strings.TrimSpace(arg.Name),
+		Group: strings.TrimSpace(arg.Group),
+	}
+	if err := core.ValidateStruct(ctx, model); err != nil {
+		return usermanager.UserParams{}, err
+	}
+
+	return usermanager.UserParams{
+		Name:          model.Name,
+		Password:      arg.Password,
+		Group:         model.Group,
+		AuthorityList: arg.AuthorityList,
+		Memo:          arg.Memo,
+		Sharable:      arg.Sharable,
+	}, nil
+}
+
+func CreateDeviceAccount(ctx context.Context, deviceID int64, arg DeviceAccountParams) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	user, err := arg.validate(ctx)
+	if err != nil {
+		return err
+	}
+	if user.Password == "" {
+		return core.NewFieldError("Password", "Password is required.")
+	}
+
+	client, err := GetClient(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+
+	return createAccountEvent(ctx, action.DahuaAccount{
+		DeviceID:  deviceID,
+		Operation: accountOperationCreate,
+		Name:      user.Name,
+	}, usermanager.AddUser(ctx, client.RPC, user))
+}
+
+// UpdateDeviceAccount updates the account with the name.
+// The account used to connect to the device cannot be renamed.
+func UpdateDeviceAccount(ctx context.Context, deviceID int64, name string, arg DeviceAccountParams) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	user, err := arg.validate(ctx)
+	if err != nil {
+		return err
+	}
+
+	client, err := GetClient(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	if name == client.Conn.Username && user.Name != name {
+		return ErrDeviceAccountInUse
+	}
+
+	event := action.DahuaAccount{
+		DeviceID:  deviceID,
+		Operation: accountOperationUpdate,
+		Name:      name,
+	}
+	if user.Name != name {
+		event.NewName = user.Name
+	}
+
+	return createAccountEvent(ctx, event, usermanager.ModifyUser(ctx, client.RPC, name, user))
+}
+
+// DeleteDeviceAccount deletes the account with the name.
+// The account used to connect to the device cannot be deleted.
+func DeleteDeviceAccount(ctx context.Context, deviceID int64, name string) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	client, err := GetClient(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	if name == client.Conn.Username {
+		return ErrDeviceAccountInUse
+	}
+
+	return createAccountEvent(ctx, action.DahuaAccount{
+		DeviceID:  deviceID,
+		Operation: accountOperationDelete,
+		Name:      name,
+	}, usermanager.DeleteUser(ctx, client.RPC, name))
+}
+
+// UpdateDeviceAccountPassword changes the password of the account with the name.
+// Changing the password of the account used to connect to the device also updates the stored password, so the old password is not needed.
+func UpdateDeviceAccountPassword(ctx context.Context, deviceID int64, name, oldPassword, newPassword string) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	if newPassword == "" {
+		return core.NewFieldError("NewPassword", "Password is required.")
+	}
+
+	client, err := GetClient(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	if name == client.Conn.Username {
+		return rotateDevicePassword(ctx, client, newPassword).Err
+	}
+
+	return createAccountEvent(ctx, action.DahuaAccount{
+		DeviceID:  deviceID,
+		Operation: accountOperationPassword,
+		Name:      name,
+	}, usermanager.ModifyPassword(ctx, client.RPC, name, oldPassword, newPassword))
+}
+
+type RotateDevicePasswordsParams struct {
+	DeviceIDs []int64
+	// Password is the new password, a random one is generated for each device when it is empty.
+	Password string
+}
+
+type RotateDevicePasswordResult struct {
+	DeviceID int64
+	Username string
+	// Rotated is true when both the device and the stored password were changed.
+	Rotated bool
+	Err     error
+	// RolledBack is true when the device's password was changed back because the stored password could not be changed.
+	RolledBack  bool
+	RollbackErr error
+}
+
+// RotateDevicePasswords changes the password of the account used to connect to each device.
+// The stored password is only changed after the device confirms the new password.
+// A device that fails does not stop the others from being rotated.
+func RotateDevicePasswords(ctx context.Context, arg RotateDevicePasswordsParams) ([]RotateDevicePasswordResult, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	res := make([]RotateDevicePasswordResult, 0, len(arg.DeviceIDs))
+	for _, id := range arg.DeviceIDs {
+		password := arg.Password
+		if password == "" {
+			var err error
+			password, err = newDevicePassword()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		client, err := GetClient(ctx, id)
+		if err != nil {
+			res = append(res, RotateDevicePasswordResult{
+				DeviceID: id,
+				Err:      err,
+			})
+			continue
+		}
+
+		res = append(res, rotateDevicePassword(ctx, client, password))
+	}
+
+	return res, nil
+}
+
+func rotateDevicePassword(ctx context.Context, client Client, newPassword string) RotateDevicePasswordResult {
+	rollback := func(ctx context.Context) error {
+		conn := client.Conn
+		password, err := encryptPassword(newPassword)
+		if err != nil {
+			return err
+		}
+		conn.Password = password
+
+		// The device might end the current session after the password changes
+		rollbackClient := NewClient(conn)
+		defer rollbackClient.Close(context.WithoutCancel(ctx))
+
+		return modifyDevicePassword(ctx, conn, rollbackClient.RPC, newPassword, client.password)
+	}
+
+	return changeDevicePassword(ctx, client.Conn, client.RPC, client.password, newPassword, rollback)
+}
+
+// changeDevicePassword changes the password on the device and then the stored password.
+// The device's password is changed back with rollback when the stored password could not be changed.
+func changeDevicePassword(ctx context.Context, conn Conn, rpc dahuarpc.Conn, oldPassword, newPassword string, rollback func(ctx context.Context) error) RotateDevicePasswordResult {
+	res := RotateDevicePasswordResult{
+		DeviceID: conn.ID,
+		Username: conn.Username,
+	}
+
+	if err := modifyDevicePassword(ctx, conn, rpc, oldPassword, newPassword); err != nil {
+		res.Err = err
+		return res
+	}
+
+	// The device now only accepts the new password
+	if err := updateDevicePassword(ctx, conn.ID, newPassword); err != nil {
+		res.Err = err
+		res.RollbackErr = rollback(ctx)
+		res.RolledBack = res.RollbackErr == nil
+		if res.RollbackErr != nil {
+			log.Err(res.RollbackErr).Int64("id", conn.ID).Msg("Failed to roll back device password")
+		}
+		return res
+	}
+
+	res.Rotated = true
+	return res
+}
+
+// modifyDevicePassword changes the password of the account used to connect to the device.
+// Failing to record the change in the audit log is only logged because the device's password has already changed.
+func modifyDevicePassword(ctx context.Context, conn Conn, rpc dahuarpc.Conn, oldPassword, newPassword string) error {
+	err := usermanager.ModifyPassword(ctx, rpc, conn.Username, oldPassword, newPassword)
+	if auditErr := recordAccountEvent(ctx, action.DahuaAccount{
+		DeviceID:  conn.ID,
+		Operation: accountOperationPassword,
+		Name:      conn.Username,
+	}, err); auditErr != nil {
+		log.Err(auditErr).Int64("id", conn.ID).Msg("Failed to record device password change")
+	}
+	return err
+}
+
+func updateDevicePassword(ctx context.Context, id int64, password string) error {
+	password, err := encryptPassword(password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := deviceAudit(ctx, tx.C(), id)
+	if err != nil {
+		return err
+	}
+
+	err = tx.C().DahuaUpdateDevicePassword(ctx, repo.DahuaUpdateDevicePasswordParams{
+		Password: password,
+		ID:       id,
+	})
+	if err != nil {
+		return err
+	}
+
+	after, err := deviceAudit(ctx, tx.C(), id)
+	if err != nil {
+		return err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.DahuaDeviceUpdated.Create(id).WithDiff(before, after)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	app.Hub.DahuaDeviceUpdated(bus.DahuaDeviceUpdated{
+		DeviceID: id,
+	})
+
+	return nil
+}
+
+const devicePasswordLength = 20
+
+const (
+	devicePasswordLetters = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+	devicePasswordDigits  = "23456789"
+)
+
+// newDevicePassword returns a random password that has both letters and digits because devices reject passwords without both.
+func newDevicePassword() (string, error) {
+	chars := devicePasswordLetters + devicePasswordDigits
+	for {
+		b := make([]byte, devicePasswordLength)
+		for i := range b {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+			if err != nil {
+				return "", err
+			}
+			b[i] = chars[n.Int64()]
+		}
+
+		password := string(b)
+		if strings.ContainsAny(password, devicePasswordLetters) && strings.ContainsAny(password, devicePasswordDigits) {
+			return password, nil
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package dahua
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ItsNotGoodName/ipcmanview/pkg/envelope"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeDevicePassword(t *testing.T) {
+	const (
+		oldPassword = "old-password"
+		newPassword = "new-password"
+	)
+	seedUser := `INSERT INTO users (id, email, username, password, created_at, updated_at) VALUES (1, 'admin@example.com', 'admin', '', 0, 0)`
+	errRollback := errors.New("rollback failed")
+
+	tests := []struct {
+		name string
+		seed []string
+		// confirm is true when the device accepts the new password.
+		confirm     bool
+		rollbackErr error
+		want        RotateDevicePasswordResult
+		// rollback is true when the device's password should be changed back.
+		rollback bool
+		// stored is the stored password after the change.
+		stored string
+	}{
+		{
+			name:    "rotated",
+			seed:    []string{seedUser, seedDevices(1)},
+			confirm: true,
+			want:    RotateDevicePasswordResult{Rotated: true},
+			stored:  newPassword,
+		},
+		{
+			name:   "device refused",
+			seed:   []string{seedUser, seedDevices(1)},
+			stored: oldPassword,
+		},
+		{
+			name:     "update failed",
+			seed:     []string{seedUser},
+			confirm:  true,
+			want:     RotateDevicePasswordResult{RolledBack: true},
+			rollback: true,
+		},
+		{
+			name:        "rollback failed",
+			seed:        []string{seedUser},
+			confirm:     true,
+			rollbackErr: errRollback,
+			want:        RotateDevicePasswordResult{RollbackErr: errRollback},
+			rollback:    true,
+		},
+		{
+			// Events can't be recorded without the user so updating the stored password fails too
+			name:     "audit failed",
+			seed:     []string{seedDevices(1)},
+			confirm:  true,
+			want:     RotateDevicePasswordResult{RolledBack: true},
+			rollback: true,
+			stored:   oldPassword,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := envelope.NewKey()
+			require.NoError(t, err)
+			useTestApp(t, App{DB: newTestDB(t, tt.seed...), SecretKey: key})
+			ctx := testAdminContext()
+
+			stored, err := encryptPassword(oldPassword)
+			require.NoError(t, err)
+			_, err = app.DB.ExecContext(ctx, "UPDATE dahua_devices SET username = 'admin', password = ? WHERE id = 1", stored)
+			require.NoError(t, err)
+
+			conn := testRPCConn{}
+			if tt.confirm {
+				conn["userManager.modifyPassword"] = func(params json.RawMessage) any {
+					var v struct {
+						Name   string `json:"name"`
+						Pwd    string `json:"pwd"`
+						PwdOld string `json:"pwdOld"`
+					}
+					require.NoError(t, json.Unmarshal(params, &v))
+					assert.Equal(t, "admin", v.Name)
+					assert.Equal(t, oldPassword, v.PwdOld)
+					assert.Equal(t, newPassword, v.Pwd)
+					return nil
+				}
+			}
+
+			var rolledBack bool
+			rollback := func(ctx context.Context) error {
+				rolledBack = true
+				return tt.rollbackErr
+			}
+
+			res := changeDevicePassword(ctx, Conn{ID: 1, Username: "admin"}, conn, oldPassword, newPassword, rollback)
+
+			assert.Equal(t, int64(1), res.DeviceID)
+			assert.Equal(t, "admin", res.Username)
+			assert.Equal(t, tt.want.Rotated, res.Rotated)
+			assert.Equal(t, tt.want.RolledBack, res.RolledBack)
+			assert.Equal(t, tt.want.RollbackErr, res.RollbackErr)
+			assert.Equal(t, !tt.want.Rotated, res.Err != nil)
+			assert.Equal(t, tt.rollback, rolledBack)
+
+			if tt.stored == "" {
+				return
+			}
+			err = app.DB.QueryRowContext(ctx, "SELECT password FROM dahua_devices WHERE id = 1").Scan(&stored)
+			require.NoError(t, err)
+			password, err := app.SecretKey.Decrypt(stored)
+			require.NoError(t, err)
+			assert.Equal(t, tt.stored, password)
+		})
+	}
+}
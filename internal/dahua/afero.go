@@ -2,12 +2,14 @@ package dahua
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
 	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
 	"github.com/ItsNotGoodName/ipcmanview/internal/types"
 	"github.com/google/uuid"
@@ -76,6 +78,14 @@ func deleteOrphanAferoFiles(ctx context.Context) (int, error) {
 	}
 }
 
+// aferoRealPath returns the path of the afero file on the OS file system.
+func aferoRealPath(name string) (string, error) {
+	if fs, ok := app.AFS.(*afero.BasePathFs); ok {
+		return fs.RealPath(name)
+	}
+	return name, nil
+}
+
 type aferoFile struct {
 	afero.File
 	ID   int64
@@ -86,6 +96,9 @@ type aferoForeignKeys struct {
 	FileID            int64
 	ThumbnailID       int64
 	EmailAttachmentID int64
+	SnapshotID        int64
+	TimelapseID       int64
+	ExportID          int64
 }
 
 // createAferoFile creates an afero file in the database and in the file system.
@@ -94,6 +107,9 @@ func createAferoFile(ctx context.Context, key aferoForeignKeys, fileName string)
 		FileID:            core.Int64ToNullInt64(key.FileID),
 		ThumbnailID:       core.Int64ToNullInt64(key.ThumbnailID),
 		EmailAttachmentID: core.Int64ToNullInt64(key.EmailAttachmentID),
+		SnapshotID:        core.Int64ToNullInt64(key.SnapshotID),
+		TimelapseID:       core.Int64ToNullInt64(key.TimelapseID),
+		ExportID:          core.Int64ToNullInt64(key.ExportID),
 		Name:              fileName,
 		CreatedAt:         types.NewTime(time.Now()),
 	})
@@ -103,7 +119,7 @@ func createAferoFile(ctx context.Context, key aferoForeignKeys, fileName string)
 
 	file, err := app.AFS.Create(fileName)
 	if err != nil {
-		return aferoFile{}, err
+		return aferoFile{}, errors.Join(err, app.DB.C().DahuaDeleteAferoFile(context.WithoutCancel(ctx), id))
 	}
 
 	return aferoFile{
@@ -131,3 +147,29 @@ func (f aferoFile) Ready(ctx context.Context) error {
 
 	return nil
 }
+
+// Delete closes the afero file and deletes it from the file system and the database.
+// It is used to clean up files that failed to be written.
+func (f aferoFile) Delete(ctx context.Context) error {
+	f.File.Close()
+
+	if err := app.AFS.Remove(f.Name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return app.DB.C().DahuaDeleteAferoFile(ctx, f.ID)
+}
+
+// AferoFileLevel returns true if the actor has at least the level on the device that owns the afero file.
+func AferoFileLevel(ctx context.Context, name string, level models.DahuaPermissionLevel) (bool, error) {
+	if core.UseActor(ctx).Admin {
+		return Level(ctx, 0, level)
+	}
+
+	deviceID, err := app.DB.C().DahuaGetAferoFileDeviceID(ctx, name)
+	if err != nil {
+		return false, err
+	}
+
+	return Level(ctx, deviceID, level)
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
 	"github.com/ItsNotGoodName/ipcmanview/internal/mediamtx"
 	"github.com/ItsNotGoodName/ipcmanview/internal/sqlite"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/envelope"
 	"github.com/spf13/afero"
 )
 
@@ -17,6 +18,11 @@ type App struct {
 	ScanLocker     ScanLocker
 	MediamtxClient *mediamtx.Client
 	MediamtxConfig mediamtx.Config
+	LiveStreamer   *LiveStreamer
+	// PlaybackJanitor is nil when the live streamer is used instead of MediaMTX.
+	PlaybackJanitor *PlaybackJanitor
+	// SecretKey encrypts device and storage destination passwords.
+	SecretKey envelope.Key
 }
 
 func Init(_app App) {
@@ -0,0 +1,349 @@
+package dahua
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system/action"
+	"github.com/ItsNotGoodName/ipcmanview/internal/types"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuacgi"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc/modules/magicbox"
+	"github.com/rs/zerolog/log"
+)
+
+func NewDahuaCapabilities(v repo.DahuaCapability) models.DahuaCapabilities {
+	return models.DahuaCapabilities{
+		Methods:     v.Methods.Slice,
+		PTZ:         v.Ptz,
+		Coaxial:     v.Coaxial,
+		AudioInput:  v.AudioInput,
+		AudioOutput: v.AudioOutput,
+		Storage:     v.Storage,
+		SmartEvent:  v.SmartEvent,
+		ProbedAt:    v.ProbedAt.Time,
+	}
+}
+
+// capabilityLocker prevents workers that start together from probing the same device at the same time.
+var capabilityLocker = core.NewLockStore[int64]()
+
+// GetCapabilities returns the device's stored capabilities and probes the device when there are none.
+func GetCapabilities(ctx context.Context, client Client) (repo.DahuaCapability, error) {
+	unlock, err := capabilityLocker.Lock(ctx, client.Conn.ID)
+	if err != nil {
+		return repo.DahuaCapability{}, err
+	}
+	defer unlock()
+
+	v, err := app.DB.C().DahuaGetCapability(ctx, client.Conn.ID)
+	if err == nil {
+		return v, nil
+	}
+	if !core.IsNotFound(err) {
+		return repo.DahuaCapability{}, err
+	}
+
+	return probeCapabilities(ctx, client)
+}
+
+// ProbeCapabilities asks the device what it supports and stores the result.
+// Devices without a feature also have their feature detected.
+func ProbeCapabilities(ctx context.Context, deviceID int64) (repo.DahuaCapability, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return repo.DahuaCapability{}, err
+	}
+
+	client, err := GetClient(ctx, deviceID)
+	if err != nil {
+		return repo.DahuaCapability{}, err
+	}
+
+	unlock, err := capabilityLocker.Lock(ctx, deviceID)
+	if err != nil {
+		return repo.DahuaCapability{}, err
+	}
+	defer unlock()
+
+	v, err := probeCapabilities(ctx, client)
+	if err != nil {
+		return repo.DahuaCapability{}, err
+	}
+
+	// Detect the feature of devices that were added without one
+	if client.Conn.Feature == 0 {
+		deviceClass, err := magicbox.GetDeviceClass(ctx, client.RPC)
+		if err != nil && isFatalError(err) {
+			return repo.DahuaCapability{}, err
+		}
+		if feature := detectFeature(deviceClass); feature != 0 {
+			if err := updateDeviceFeature(ctx, deviceID, feature); err != nil {
+				return repo.DahuaCapability{}, err
+			}
+		}
+	}
+
+	app.Hub.DahuaCapabilitiesUpdated(bus.DahuaCapabilitiesUpdated{
+		DeviceID: deviceID,
+	})
+
+	return v, nil
+}
+
+func probeCapabilities(ctx context.Context, client Client) (repo.DahuaCapability, error) {
+	methods, err := magicbox.ListMethod(ctx, client.RPC)
+	if err != nil && isFatalError(err) {
+		return repo.DahuaCapability{}, err
+	}
+	if methods == nil {
+		methods = []string{}
+	}
+
+	// Serial is stored so that emails can match the device by serial number
+	if err := probeSerial(ctx, client.Conn.ID, client.RPC); err != nil {
+		return repo.DahuaCapability{}, err
+	}
+
+	var channels []repo.DahuaChannelCapability
+	if supportsModule(methods, "CoaxialControlIO") {
+		count, err := GetChannelCount(ctx, client.RPC, client.Conn.Feature)
+		if err != nil {
+			return repo.DahuaCapability{}, err
+		}
+
+		channels, err = probeChannelCapabilities(ctx, client.Conn.ID, client.RPC, count)
+		if err != nil {
+			return repo.DahuaCapability{}, err
+		}
+	}
+	coaxial := slices.ContainsFunc(channels, func(v repo.DahuaChannelCapability) bool { return v.Coaxial })
+
+	audioInput, err := probeAudioChannelCount(ctx, client.CGI, dahuacgi.AudioInputChannelCount)
+	if err != nil {
+		return repo.DahuaCapability{}, err
+	}
+
+	audioOutput, err := probeAudioChannelCount(ctx, client.CGI, dahuacgi.AudioOutputChannelCount)
+	if err != nil {
+		return repo.DahuaCapability{}, err
+	}
+
+	v := repo.DahuaCapability{
+		DeviceID:    client.Conn.ID,
+		Methods:     types.NewStringSlice(methods),
+		Ptz:         supportsModule(methods, "ptz"),
+		Coaxial:     coaxial,
+		AudioInput:  audioInput > 0,
+		AudioOutput: audioOutput > 0,
+		Storage:     supportsModule(methods, "storage"),
+		SmartEvent:  supportsModule(methods, "devVideoAnalyse"),
+		ProbedAt:    types.NewTime(time.Now()),
+	}
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return repo.DahuaCapability{}, err
+	}
+	defer tx.Rollback()
+
+	err = tx.C().DahuaUpsertCapability(ctx, repo.DahuaUpsertCapabilityParams{
+		DeviceID:    v.DeviceID,
+		Methods:     v.Methods,
+		Ptz:         v.Ptz,
+		Coaxial:     v.Coaxial,
+		AudioInput:  v.AudioInput,
+		AudioOutput: v.AudioOutput,
+		Storage:     v.Storage,
+		SmartEvent:  v.SmartEvent,
+		ProbedAt:    v.ProbedAt,
+	})
+	if err != nil {
+		return repo.DahuaCapability{}, err
+	}
+
+	if err := tx.C().DahuaDeleteChannelCapabilities(ctx, v.DeviceID); err != nil {
+		return repo.DahuaCapability{}, err
+	}
+	for _, channel := range channels {
+		err := tx.C().DahuaCreateChannelCapability(ctx, repo.DahuaCreateChannelCapabilityParams{
+			DeviceID: channel.DeviceID,
+			Channel:  channel.Channel,
+			Coaxial:  channel.Coaxial,
+		})
+		if err != nil {
+			return repo.DahuaCapability{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return repo.DahuaCapability{}, err
+	}
+
+	log.Info().Int64("id", v.DeviceID).Int("methods", len(methods)).Msg("Probed device capabilities")
+
+	return v, nil
+}
+
+// probeSerial stores the device's serial number unless another device has it.
+func probeSerial(ctx context.Context, deviceID int64, conn dahuarpc.Conn) error {
+	serial, err := magicbox.GetSerialNo(ctx, conn)
+	if err != nil {
+		return checkFatalError(err)
+	}
+	serial = strings.TrimSpace(serial)
+	if serial == "" {
+		return nil
+	}
+
+	device, err := app.DB.C().DahuaGetDeviceBySerial(ctx, core.NewNullString(serial))
+	if err == nil {
+		if device.ID != deviceID {
+			log.Warn().Int64("id", deviceID).Int64("other-id", device.ID).Str("serial", serial).Msg("Device has the same serial number as another device")
+		}
+		return nil
+	}
+	if !core.IsNotFound(err) {
+		return err
+	}
+
+	return setDeviceSerial(ctx, deviceID, serial)
+}
+
+// probeChannelCapabilities asks each channel of the device what it supports.
+func probeChannelCapabilities(ctx context.Context, deviceID int64, conn dahuarpc.Conn, count int) ([]repo.DahuaChannelCapability, error) {
+	res := make([]repo.DahuaChannelCapability, 0, count)
+	for channel := 1; channel <= count; channel++ {
+		caps, err := GetCoaxialCaps(ctx, conn, channel)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, repo.DahuaChannelCapability{
+			DeviceID: deviceID,
+			Channel:  int64(channel),
+			Coaxial:  caps.SupportControlSpeaker || caps.SupportControlLight || caps.SupportControlFullcolorLight,
+		})
+	}
+	return res, nil
+}
+
+// ChannelSupportsCoaxial returns true if the device's channel supports coaxial control.
+// Channels that were not probed do not support it.
+func ChannelSupportsCoaxial(ctx context.Context, deviceID int64, channel int) (bool, error) {
+	v, err := app.DB.C().DahuaGetChannelCapability(ctx, repo.DahuaGetChannelCapabilityParams{
+		DeviceID: deviceID,
+		Channel:  int64(channel),
+	})
+	if err != nil {
+		if core.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return v.Coaxial, nil
+}
+
+// ListCoaxialChannels lists the device's enabled channels that support coaxial control.
+func ListCoaxialChannels(ctx context.Context, deviceID int64) ([]repo.DahuaChannel, error) {
+	channels, err := ListEnabledChannels(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	caps, err := app.DB.C().DahuaListChannelCapabilities(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return coaxialChannels(channels, caps), nil
+}
+
+// coaxialChannels returns the channels whose capabilities support coaxial control.
+func coaxialChannels(channels []repo.DahuaChannel, caps []repo.DahuaChannelCapability) []repo.DahuaChannel {
+	var res []repo.DahuaChannel
+	for _, channel := range channels {
+		if slices.ContainsFunc(caps, func(v repo.DahuaChannelCapability) bool {
+			return v.Channel == channel.Channel && v.Coaxial
+		}) {
+			res = append(res, channel)
+		}
+	}
+	return res
+}
+
+// probeAudioChannelCount returns 0 when the device rejects the request or returns an invalid count because it does not have audio.
+func probeAudioChannelCount(ctx context.Context, conn dahuacgi.Conn, fn func(context.Context, dahuacgi.Conn) (int, error)) (int, error) {
+	count, err := fn(ctx, conn)
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, err
+		}
+		var httpErr dahuacgi.HTTPError
+		var numErr *strconv.NumError
+		if errors.As(err, &httpErr) || errors.As(err, &numErr) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return count, nil
+}
+
+// supportsModule returns true when one of the methods belongs to the module.
+// Devices that cannot list their methods are assumed to support every module.
+func supportsModule(methods []string, module string) bool {
+	if len(methods) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(methods, func(method string) bool {
+		return strings.HasPrefix(method, module+".")
+	})
+}
+
+func updateDeviceFeature(ctx context.Context, id int64, feature models.DahuaFeature) error {
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := deviceAudit(ctx, tx.C(), id)
+	if err != nil {
+		return err
+	}
+
+	err = tx.C().DahuaUpdateDeviceFeature(ctx, repo.DahuaUpdateDeviceFeatureParams{
+		Feature: feature,
+		ID:      id,
+	})
+	if err != nil {
+		return err
+	}
+
+	after, err := deviceAudit(ctx, tx.C(), id)
+	if err != nil {
+		return err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.DahuaDeviceUpdated.Create(id).WithDiff(before, after)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	app.Hub.DahuaDeviceUpdated(bus.DahuaDeviceUpdated{
+		DeviceID: id,
+	})
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package dahua
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupportsModule(t *testing.T) {
+	methods := []string{"ptz.start", "magicBox.getSerialNo", "CoaxialControlIO.getCaps"}
+
+	assert.True(t, supportsModule(methods, "ptz"))
+	assert.True(t, supportsModule(methods, "CoaxialControlIO"))
+	assert.False(t, supportsModule(methods, "storage"))
+	assert.False(t, supportsModule(methods, "magic"))
+	assert.True(t, supportsModule(nil, "storage"))
+}
+
+func TestProbeChannelCapabilities(t *testing.T) {
+	// caps are the coaxial capabilities of each channel
+	caps := map[int]map[string]int{
+		1: {"SupportControlSpeaker": 1},
+		2: {},
+		3: {"SupportControlLight": 1},
+		4: {"SupportControlFullcolorLight": 1},
+	}
+	conn := testRPCConn{
+		"CoaxialControlIO.getCaps": func(params json.RawMessage) any {
+			return map[string]any{"caps": caps[testRPCChannel(t, params)]}
+		},
+	}
+
+	tests := []struct {
+		name  string
+		conn  testRPCConn
+		count int
+		want  []bool
+	}{
+		{name: "camera", conn: conn, count: 1, want: []bool{true}},
+		{name: "nvr", conn: conn, count: 4, want: []bool{true, false, true, true}},
+		{name: "not supported", conn: testRPCConn{}, count: 2, want: []bool{false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := probeChannelCapabilities(context.Background(), 1, tt.conn, tt.count)
+			require.NoError(t, err)
+
+			var got []bool
+			for i, v := range res {
+				assert.Equal(t, int64(1), v.DeviceID)
+				assert.Equal(t, int64(i+1), v.Channel)
+				got = append(got, v.Coaxial)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCoaxialChannels(t *testing.T) {
+	channels := []repo.DahuaChannel{{Channel: 1}, {Channel: 2}, {Channel: 3}}
+
+	tests := []struct {
+		name string
+		caps []repo.DahuaChannelCapability
+		want []int64
+	}{
+		{name: "not probed", caps: nil, want: nil},
+		{
+			name: "some channels",
+			caps: []repo.DahuaChannelCapability{{Channel: 1, Coaxial: false}, {Channel: 2, Coaxial: true}, {Channel: 3, Coaxial: true}},
+			want: []int64{2, 3},
+		},
+		{
+			name: "disabled channel",
+			caps: []repo.DahuaChannelCapability{{Channel: 1, Coaxial: true}, {Channel: 4, Coaxial: true}},
+			want: []int64{1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int64
+			for _, v := range coaxialChannels(channels, tt.caps) {
+				got = append(got, v.Channel)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestChannelSupportsCoaxial(t *testing.T) {
+	ctx := testAdminContext()
+	useTestApp(t, App{DB: newTestDB(t, seedDevices(1))})
+
+	for _, v := range []repo.DahuaChannelCapability{
+		{DeviceID: 1, Channel: 1, Coaxial: false},
+		{DeviceID: 1, Channel: 2, Coaxial: true},
+	} {
+		require.NoError(t, app.DB.C().DahuaCreateChannelCapability(ctx, repo.DahuaCreateChannelCapabilityParams{
+			DeviceID: v.DeviceID,
+			Channel:  v.Channel,
+			Coaxial:  v.Coaxial,
+		}))
+	}
+
+	tests := []struct {
+		name    string
+		channel int
+		want    bool
+	}{
+		{name: "not supported", channel: 1, want: false},
+		{name: "supported", channel: 2, want: true},
+		{name: "not probed", channel: 3, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := ChannelSupportsCoaxial(ctx, 1, tt.channel)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ok)
+		})
+	}
+
+	channels, err := ListCoaxialChannels(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, channels, "channel 1 of devices that were not synced does not support coaxial")
+}
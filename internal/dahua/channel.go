@@ -0,0 +1,241 @@
+package dahua
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system/action"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc/modules/configmanager/config"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc/modules/encode"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc/modules/magicbox"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/ssq"
+	sq "github.com/Masterminds/squirrel"
+)
+
+// GetChannelCount returns the number of video channels on the device.
+// Only NVRs are asked because cameras have a single channel.
+func GetChannelCount(ctx context.Context, conn dahuarpc.Conn, feature models.DahuaFeature) (int, error) {
+	if !feature.EQ(models.DahuaFeature_NVR) {
+		return 1, nil
+	}
+
+	count, err := magicbox.GetProductDefinition[int](ctx, conn, "MaxRemoteInputChannels")
+	if err != nil && isFatalError(err) {
+		return 0, err
+	}
+	if count > 0 {
+		return count, nil
+	}
+
+	caps, err := encode.GetCaps(ctx, conn, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	return max(len(caps.VideoEncodeDevices), 1), nil
+}
+
+// channelNames returns the name of each channel from the device's channel titles.
+// Channels without a title are named after their number.
+func channelNames(count int, titles []string) []string {
+	names := make([]string, count)
+	for i := range names {
+		if i < len(titles) {
+			names[i] = strings.TrimSpace(titles[i])
+		}
+		if names[i] == "" {
+			names[i] = "Channel " + strconv.Itoa(i+1)
+		}
+	}
+	return names
+}
+
+// SyncChannels fetches the device's channels and syncs them with the database.
+// Channels that already exist keep their name and enabled flag.
+func SyncChannels(ctx context.Context, deviceID int64, conn dahuarpc.Conn, feature models.DahuaFeature) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	count, err := GetChannelCount(ctx, conn, feature)
+	if err != nil {
+		return err
+	}
+
+	channelTitle, err := config.GetChannelTitle(ctx, conn)
+	if err != nil && isFatalError(err) {
+		return err
+	}
+	var titles []string
+	for _, table := range channelTitle.Tables {
+		titles = append(titles, table.Data.Name)
+	}
+	names := channelNames(count, titles)
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := tx.C().DahuaListChannelsByDevice(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+
+	for i, name := range names {
+		err := tx.C().DahuaCreateChannel(ctx, repo.DahuaCreateChannelParams{
+			DeviceID: deviceID,
+			Channel:  int64(i + 1),
+			Name:     name,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.C().DahuaDeleteChannelsAfter(ctx, repo.DahuaDeleteChannelsAfterParams{
+		DeviceID: deviceID,
+		Channel:  int64(count),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if len(before) != count {
+		app.Hub.DahuaChannelsUpdated(bus.DahuaChannelsUpdated{
+			DeviceID: deviceID,
+		})
+	}
+
+	return nil
+}
+
+// ListChannels lists the device's channels.
+func ListChannels(ctx context.Context, deviceID int64) ([]repo.DahuaChannel, error) {
+	sb := sq.
+		Select("*").
+		From("dahua_channels").
+		Where("device_id = ?", deviceID).
+		OrderBy("channel")
+
+	var res []repo.DahuaChannel
+	err := ssq.Query(ctx, app.DB, &res, authFilter(ctx, sb, "dahua_channels.device_id", levelDefault))
+	return res, err
+}
+
+// ListEnabledChannels lists the device's enabled channels.
+// Devices that have not been synced yet are assumed to have a single channel.
+func ListEnabledChannels(ctx context.Context, deviceID int64) ([]repo.DahuaChannel, error) {
+	channels, err := ListChannels(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return []repo.DahuaChannel{{DeviceID: deviceID, Channel: 1, Enabled: true}}, nil
+	}
+
+	res := make([]repo.DahuaChannel, 0, len(channels))
+	for _, v := range channels {
+		if v.Enabled {
+			res = append(res, v)
+		}
+	}
+
+	return res, nil
+}
+
+// channelEnabled returns false if the channel was disabled.
+// Unknown channels are enabled because the device may not have been synced yet.
+func channelEnabled(ctx context.Context, deviceID int64, channel int) (bool, error) {
+	v, err := app.DB.C().DahuaGetChannel(ctx, repo.DahuaGetChannelParams{
+		DeviceID: deviceID,
+		Channel:  int64(channel),
+	})
+	if err != nil {
+		if core.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return v.Enabled, nil
+}
+
+type _Channel struct {
+	Name string `validate:"required,lte=64"`
+}
+
+type UpdateChannelParams struct {
+	DeviceID int64
+	Channel  int
+	Name     string
+	Enabled  bool
+}
+
+func UpdateChannel(ctx context.Context, arg UpdateChannelParams) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	model := _Channel{
+		Name: strings.TrimSpace(arg.Name),
+	}
+	if err := core.ValidateStruct(ctx, model); err != nil {
+		return err
+	}
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := tx.C().DahuaGetChannel(ctx, repo.DahuaGetChannelParams{
+		DeviceID: arg.DeviceID,
+		Channel:  int64(arg.Channel),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.C().DahuaUpdateChannel(ctx, repo.DahuaUpdateChannelParams{
+		Name:     model.Name,
+		Enabled:  arg.Enabled,
+		DeviceID: arg.DeviceID,
+		Channel:  int64(arg.Channel),
+	})
+	if err != nil {
+		return err
+	}
+
+	event := action.DahuaChannelUpdated.
+		Create(action.DahuaChannel{DeviceID: arg.DeviceID, Channel: arg.Channel}).
+		WithDiff(
+			action.DahuaChannelState{Name: before.Name, Enabled: before.Enabled},
+			action.DahuaChannelState{Name: model.Name, Enabled: arg.Enabled},
+		)
+	if err := system.CreateEvent(ctx, tx.C(), event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	app.Hub.DahuaChannelsUpdated(bus.DahuaChannelsUpdated{
+		DeviceID: arg.DeviceID,
+	})
+
+	return nil
+}
@@ -0,0 +1,298 @@
+package dahua
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRPCConn answers each RPC method with its handler's params.
+// Methods without a handler are not found.
+type testRPCConn map[string]func(params json.RawMessage) any
+
+func (c testRPCConn) Do(ctx context.Context, rb dahuarpc.RequestBuilder) (io.ReadCloser, error) {
+	res := map[string]any{"id": rb.Request.ID, "result": true}
+	if fn, ok := c[rb.Request.Method]; ok {
+		params, err := json.Marshal(rb.Request.Params)
+		if err != nil {
+			return nil, err
+		}
+		res["params"] = fn(params)
+	} else {
+		res["result"] = false
+		res["error"] = map[string]any{"code": 268894210, "message": "Method not found"}
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+// testRPCChannel returns the channel of the request's params.
+func testRPCChannel(t *testing.T, params json.RawMessage) int {
+	var v struct {
+		Channel int `json:"channel"`
+	}
+	require.NoError(t, json.Unmarshal(params, &v))
+	return v.Channel
+}
+
+func TestChannelNames(t *testing.T) {
+	tests := []struct {
+		name   string
+		count  int
+		titles []string
+		want   []string
+	}{
+		{name: "titles", count: 2, titles: []string{"Front", "Back"}, want: []string{"Front", "Back"}},
+		{name: "no titles", count: 2, titles: nil, want: []string{"Channel 1", "Channel 2"}},
+		{name: "fewer titles", count: 3, titles: []string{"Front"}, want: []string{"Front", "Channel 2", "Channel 3"}},
+		{name: "more titles", count: 1, titles: []string{"Front", "Back"}, want: []string{"Front"}},
+		{name: "blank title", count: 2, titles: []string{" Front ", "  "}, want: []string{"Front", "Channel 2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, channelNames(tt.count, tt.titles))
+		})
+	}
+}
+
+type testChannel struct {
+	name    string
+	enabled bool
+}
+
+func listTestChannels(t *testing.T, ctx context.Context, deviceID int64) []testChannel {
+	channels, err := app.DB.C().DahuaListChannelsByDevice(ctx, deviceID)
+	require.NoError(t, err)
+
+	var res []testChannel
+	for _, v := range channels {
+		res = append(res, testChannel{name: v.Name, enabled: v.Enabled})
+	}
+	return res
+}
+
+func TestSyncChannels(t *testing.T) {
+	ctx := testAdminContext()
+	hub := bus.NewHub(ctx)
+	useTestApp(t, App{DB: newTestDB(t, seedDevices(1)), Hub: hub})
+
+	var updated int
+	hub.OnDahuaChannelsUpdated("test", func(ctx context.Context, event bus.DahuaChannelsUpdated) error {
+		updated++
+		return nil
+	})
+
+	// conn returns a device with the channel count and titles, devices without titles do not support them
+	conn := func(count int, titles ...string) testRPCConn {
+		conn := testRPCConn{
+			"magicBox.getProductDefinition": func(json.RawMessage) any {
+				return map[string]any{"definition": count}
+			},
+		}
+		if len(titles) > 0 {
+			conn["configManager.getConfig"] = func(json.RawMessage) any {
+				var table []map[string]any
+				for _, title := range titles {
+					table = append(table, map[string]any{"Name": title})
+				}
+				return map[string]any{"table": table}
+			}
+		}
+		return conn
+	}
+
+	// Each step runs on the channels left by the previous step
+	tests := []struct {
+		name string
+		// before changes the channels before syncing.
+		before  func(t *testing.T)
+		conn    testRPCConn
+		feature models.DahuaFeature
+		want    []testChannel
+		updated bool
+	}{
+		{
+			name:    "create",
+			conn:    conn(3, "Front", "", "Back"),
+			feature: models.DahuaFeature_NVR,
+			want:    []testChannel{{"Front", true}, {"Channel 2", true}, {"Back", true}},
+			updated: true,
+		},
+		{
+			name: "keep name and enabled",
+			before: func(t *testing.T) {
+				_, err := app.DB.C().DahuaUpdateChannel(ctx, repo.DahuaUpdateChannelParams{
+					Name:     "Driveway",
+					Enabled:  false,
+					DeviceID: 1,
+					Channel:  1,
+				})
+				require.NoError(t, err)
+			},
+			conn:    conn(3, "Front", "Side", "Back"),
+			feature: models.DahuaFeature_NVR,
+			want:    []testChannel{{"Driveway", false}, {"Channel 2", true}, {"Back", true}},
+			updated: false,
+		},
+		{
+			name:    "grow",
+			conn:    conn(4, "Front", "Side", "Back", "Garage"),
+			feature: models.DahuaFeature_NVR,
+			want:    []testChannel{{"Driveway", false}, {"Channel 2", true}, {"Back", true}, {"Garage", true}},
+			updated: true,
+		},
+		{
+			name:    "shrink",
+			conn:    conn(2),
+			feature: models.DahuaFeature_NVR,
+			want:    []testChannel{{"Driveway", false}, {"Channel 2", true}},
+			updated: true,
+		},
+		{
+			name:    "camera",
+			conn:    conn(4),
+			feature: 0,
+			want:    []testChannel{{"Driveway", false}},
+			updated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.before != nil {
+				tt.before(t)
+			}
+			updated = 0
+
+			require.NoError(t, SyncChannels(ctx, 1, tt.conn, tt.feature))
+
+			assert.Equal(t, tt.want, listTestChannels(t, ctx, 1))
+			assert.Equal(t, tt.updated, updated > 0)
+		})
+	}
+
+	t.Run("not admin", func(t *testing.T) {
+		ctx := core.WithUserActor(context.Background(), 1, false)
+		assert.ErrorIs(t, SyncChannels(ctx, 1, conn(1), 0), core.ErrForbidden)
+	})
+}
+
+func TestListEnabledChannels(t *testing.T) {
+	ctx := testAdminContext()
+	useTestApp(t, App{DB: newTestDB(t, seedDevices(1, 2))})
+
+	for i, enabled := range []bool{true, false, true} {
+		require.NoError(t, app.DB.C().DahuaCreateChannel(ctx, repo.DahuaCreateChannelParams{
+			DeviceID: 1,
+			Channel:  int64(i + 1),
+			Name:     "Channel",
+		}))
+		_, err := app.DB.C().DahuaUpdateChannel(ctx, repo.DahuaUpdateChannelParams{
+			Name:     "Channel",
+			Enabled:  enabled,
+			DeviceID: 1,
+			Channel:  int64(i + 1),
+		})
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		name     string
+		deviceID int64
+		channels []int64
+	}{
+		{name: "synced", deviceID: 1, channels: []int64{1, 3}},
+		{name: "not synced", deviceID: 2, channels: []int64{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channels, err := ListEnabledChannels(ctx, tt.deviceID)
+			require.NoError(t, err)
+
+			var got []int64
+			for _, v := range channels {
+				assert.True(t, v.Enabled)
+				got = append(got, v.Channel)
+			}
+			assert.Equal(t, tt.channels, got)
+		})
+	}
+
+	for _, tt := range []struct {
+		channel int
+		enabled bool
+	}{
+		{channel: 1, enabled: true},
+		{channel: 2, enabled: false},
+		{channel: 4, enabled: true},
+	} {
+		enabled, err := channelEnabled(ctx, 1, tt.channel)
+		require.NoError(t, err)
+		assert.Equal(t, tt.enabled, enabled, tt.channel)
+	}
+}
+
+func TestLoadCoaxialChannels(t *testing.T) {
+	ctx := context.Background()
+	hub := bus.NewHub(ctx)
+	useTestApp(t, App{Hub: hub})
+
+	published := map[int]bool{}
+	hub.OnDahuaCoaxialStatus("test", func(ctx context.Context, event bus.DahuaCoaxialStatus) error {
+		assert.Equal(t, int64(1), event.DeviceID)
+		published[event.Channel] = event.CoaxialStatus.Speaker
+		return nil
+	})
+
+	// speakers are the speaker status of each channel
+	speakers := map[int]string{1: "On", 2: "Off", 3: "On"}
+	conn := testRPCConn{
+		"CoaxialControlIO.getStatus": func(params json.RawMessage) any {
+			return map[string]any{"status": map[string]any{"Speaker": speakers[testRPCChannel(t, params)]}}
+		},
+	}
+
+	tests := []struct {
+		name     string
+		channels []int64
+		want     map[int]bool
+	}{
+		{name: "every channel", channels: []int64{1, 2, 3}, want: map[int]bool{1: true, 2: false, 3: true}},
+		{name: "some channels", channels: []int64{2, 3}, want: map[int]bool{2: false, 3: true}},
+		{name: "no channels", channels: nil, want: map[int]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clear(published)
+
+			var channels []repo.DahuaChannel
+			for _, channel := range tt.channels {
+				channels = append(channels, repo.DahuaChannel{DeviceID: 1, Channel: channel, Enabled: true})
+			}
+
+			states, err := loadCoaxialChannels(ctx, 1, conn, channels)
+			require.NoError(t, err)
+
+			got := map[int]bool{}
+			for _, state := range states {
+				got[state.channel] = state.status.Speaker
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.want, published)
+		})
+	}
+}
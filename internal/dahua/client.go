@@ -2,6 +2,7 @@ package dahua
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"net/http"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuacgi"
 	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc"
 	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc/modules/ptz"
+	"github.com/rs/zerolog/log"
 )
 
 func clientDialTimeout(duration time.Duration) func(network, addr string) (net.Conn, error) {
@@ -17,24 +19,48 @@ func clientDialTimeout(duration time.Duration) func(network, addr string) (net.C
 	}
 }
 
+// errorTransport fails every request without connecting.
+type errorTransport struct {
+	err error
+}
+
+func (t errorTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, t.err
+}
+
+// NewClient creates a client for the device.
+// A client whose password cannot be decrypted never connects and reports the error as its RPC error.
 func NewClient(conn Conn) Client {
+	var rpcConfig []dahuarpc.ConfigFunc
+	var transport http.RoundTripper = &http.Transport{
+		Dial:            clientDialTimeout(5 * time.Second),
+		TLSClientConfig: newTLSConfig(conn),
+	}
+
+	password, err := app.SecretKey.Decrypt(conn.Password)
+	if err != nil {
+		log.Err(err).Int64("id", conn.ID).Msg("Failed to decrypt device password")
+		err = fmt.Errorf("failed to decrypt password: %w", err)
+		rpcConfig = append(rpcConfig, dahuarpc.WithError(err))
+		transport = errorTransport{err: err}
+	}
+
 	httpClient := http.Client{
-		Transport: &http.Transport{
-			Dial: clientDialTimeout(5 * time.Second),
-		},
+		Transport: transport,
 	}
 
-	clientRPC := dahuarpc.NewClient(&httpClient, conn.URL, conn.Username, conn.Password)
+	clientRPC := dahuarpc.NewClient(&httpClient, conn.URL, conn.Username, password, rpcConfig...)
 	clientPTZ := ptz.NewClient(clientRPC)
-	clientCGI := dahuacgi.NewClient(httpClient, conn.URL, conn.Username, conn.Password)
+	clientCGI := dahuacgi.NewClient(httpClient, conn.URL, conn.Username, password)
 	clientFile := dahuarpc.NewFileClient(&httpClient, 10)
 
 	return Client{
-		Conn: conn,
-		RPC:  clientRPC,
-		PTZ:  clientPTZ,
-		CGI:  clientCGI,
-		File: clientFile,
+		Conn:     conn,
+		RPC:      clientRPC,
+		PTZ:      clientPTZ,
+		CGI:      clientCGI,
+		File:     clientFile,
+		password: password,
 	}
 }
 
@@ -44,6 +70,8 @@ type Client struct {
 	PTZ  ptz.Client
 	CGI  dahuacgi.Client
 	File dahuarpc.FileClient
+	// password is the decrypted password for RTSP URLs.
+	password string
 }
 
 func (c Client) Close(ctx context.Context) error {
@@ -12,10 +12,15 @@ type Conn struct {
 	ID       int64
 	URL      *url.URL
 	Username string
+	// Password is encrypted, see NewClient.
 	Password string
 	Location *time.Location
 	Feature  models.DahuaFeature
 	Seed     int
+	// TLSMode is one of TLSModes.
+	TLSMode        string
+	TLSCA          string
+	TLSFingerprint string
 }
 
 func (lhs Conn) EQ(rhs Conn) bool {
@@ -24,5 +29,8 @@ func (lhs Conn) EQ(rhs Conn) bool {
 		lhs.Password == rhs.Password &&
 		lhs.Location.String() == rhs.Location.String() &&
 		lhs.Feature == rhs.Feature &&
-		lhs.Seed == rhs.Seed
+		lhs.Seed == rhs.Seed &&
+		lhs.TLSMode == rhs.TLSMode &&
+		lhs.TLSCA == rhs.TLSCA &&
+		lhs.TLSFingerprint == rhs.TLSFingerprint
 }
@@ -0,0 +1,225 @@
+package dahua
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuacgi"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc/modules/magicbox"
+)
+
+const testConnectionTimeout = 15 * time.Second
+
+type TestConnectionParams struct {
+	// ID is the device whose stored password and TLS settings are used when they are not given.
+	ID       int64
+	URL      *url.URL
+	Username string
+	Password string
+	TLSMode  string
+	TLSCA    string
+}
+
+type TestConnectionResult struct {
+	IP string
+	// RPC is true when logging in with RPC worked.
+	RPC      bool
+	RPCError string
+	// CGI is true when digest authentication with CGI worked.
+	CGI          bool
+	CGIError     string
+	DeviceType   string
+	DeviceClass  string
+	SerialNumber string
+	Firmware     string
+	ChannelCount int
+	// Feature is the detected feature of the device.
+	Feature models.DahuaFeature
+	// Modules are the RPC modules supported by the device (e.g. "ptz").
+	Modules []string
+
+	rpcErr error
+}
+
+// OK returns true when the device can be used.
+func (r TestConnectionResult) OK() bool {
+	return r.RPC && r.CGI
+}
+
+// TestConnection logs in to the device without saving it and reports what the device is.
+func TestConnection(ctx context.Context, arg TestConnectionParams) (TestConnectionResult, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return TestConnectionResult{}, err
+	}
+
+	model := _Device{
+		URL:      arg.URL,
+		Username: arg.Username,
+	}
+	model.normalize(true)
+
+	ip, err := model.getIP()
+	if err != nil {
+		return TestConnectionResult{}, err
+	}
+
+	conn := Conn{
+		ID:       arg.ID,
+		URL:      model.URL,
+		Username: model.Username,
+		TLSMode:  normalizeTLSMode(arg.TLSMode),
+		TLSCA:    normalizeTLSCA(arg.TLSCA),
+	}
+
+	if arg.ID != 0 {
+		dbModel, err := GetDevice(ctx, arg.ID)
+		if err != nil {
+			return TestConnectionResult{}, err
+		}
+
+		conn.Password = dbModel.Password
+		if arg.TLSMode == "" {
+			conn.TLSMode, conn.TLSCA = dbModel.TlsMode, dbModel.TlsCa.String
+		}
+		// The pinned certificate only belongs to the same address and mode
+		if conn.TLSMode == TLSModePin && model.URL.Host == dbModel.Url.Host {
+			conn.TLSFingerprint = dbModel.TlsFingerprint.String
+		}
+		// Tests must not pin certificates of saved devices
+		conn.ID = 0
+	}
+
+	if err := validateTLS(conn.TLSMode, conn.TLSCA); err != nil {
+		return TestConnectionResult{}, err
+	}
+
+	if arg.Password != "" || arg.ID == 0 {
+		conn.Password, err = encryptPassword(arg.Password)
+		if err != nil {
+			return TestConnectionResult{}, err
+		}
+	}
+
+	res := testConnection(ctx, conn)
+	res.IP = ip
+	return res, nil
+}
+
+// validateConnection tests the connection to the device before it is saved.
+// The returned feature is the detected feature when the given feature is empty.
+func validateConnection(ctx context.Context, conn Conn) (models.DahuaFeature, error) {
+	res := testConnection(ctx, conn)
+	if !res.RPC {
+		var loginErr *dahuarpc.LoginError
+		if errors.As(res.rpcErr, &loginErr) {
+			return 0, core.NewFieldError("Password", res.RPCError)
+		}
+		return 0, core.NewFieldError("URL", res.RPCError)
+	}
+	if !res.CGI {
+		return 0, core.NewFieldError("URL", res.CGIError)
+	}
+
+	if conn.Feature != 0 {
+		return conn.Feature, nil
+	}
+	return res.Feature, nil
+}
+
+func testConnection(ctx context.Context, conn Conn) TestConnectionResult {
+	ctx, cancel := context.WithTimeout(ctx, testConnectionTimeout)
+	defer cancel()
+
+	client := NewClient(conn)
+	defer client.Close(context.WithoutCancel(ctx))
+
+	var res TestConnectionResult
+
+	// RPC
+	if err := testRPC(ctx, client.RPC, &res); err != nil {
+		res.RPCError = err.Error()
+		res.rpcErr = err
+	} else {
+		res.RPC = true
+	}
+
+	// CGI
+	if _, err := dahuacgi.MagicBoxGetDeviceType(ctx, client.CGI); err != nil {
+		res.CGIError = err.Error()
+	} else {
+		res.CGI = true
+	}
+
+	return res
+}
+
+func testRPC(ctx context.Context, conn dahuarpc.Conn, res *TestConnectionResult) error {
+	// The first request logs in
+	detail, err := GetDahuaDetail(ctx, conn)
+	if err != nil {
+		return err
+	}
+	res.DeviceType = detail.DeviceType
+	res.DeviceClass = detail.DeviceClass
+	res.SerialNumber = detail.SN
+
+	sw, err := GetSoftwareVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	res.Firmware = sw.Version
+
+	methods, err := magicbox.ListMethod(ctx, conn)
+	if err != nil && isFatalError(err) {
+		return err
+	}
+	res.Modules = methodModules(methods)
+
+	res.Feature = detectFeature(detail.DeviceClass)
+
+	count, err := GetChannelCount(ctx, conn, res.Feature)
+	if err != nil && isFatalError(err) {
+		return err
+	}
+	res.ChannelCount = max(count, 1)
+
+	return nil
+}
+
+// recorderDeviceClasses are the device classes of recorders.
+var recorderDeviceClasses = []string{"NVR", "DVR", "XVR", "HCVR"}
+
+// detectFeature returns the feature of the device from its device class (e.g. "IPC" or "NVR").
+func detectFeature(deviceClass string) models.DahuaFeature {
+	deviceClass = strings.ToUpper(deviceClass)
+	if deviceClass == "" {
+		return 0
+	}
+	for _, v := range recorderDeviceClasses {
+		if strings.Contains(deviceClass, v) {
+			return models.DahuaFeature_NVR
+		}
+	}
+	return models.DahuaFeature_Camera
+}
+
+// methodModules returns the sorted modules of the RPC methods (e.g. "ptz" for "ptz.start").
+func methodModules(methods []string) []string {
+	modules := []string{}
+	for _, method := range methods {
+		module, _, ok := strings.Cut(method, ".")
+		if !ok || module == "" || slices.Contains(modules, module) {
+			continue
+		}
+		modules = append(modules, module)
+	}
+	slices.Sort(modules)
+	return modules
+}
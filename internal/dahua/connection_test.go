@@ -0,0 +1,21 @@
+package dahua
+
+import (
+	"testing"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectFeature(t *testing.T) {
+	assert.Equal(t, models.DahuaFeature_Camera, detectFeature("IPC"))
+	assert.Equal(t, models.DahuaFeature_Camera, detectFeature("SD"))
+	assert.Equal(t, models.DahuaFeature_NVR, detectFeature("NVR"))
+	assert.Equal(t, models.DahuaFeature_NVR, detectFeature("hcvr"))
+	assert.Equal(t, models.DahuaFeature(0), detectFeature(""))
+}
+
+func TestMethodModules(t *testing.T) {
+	got := methodModules([]string{"ptz.start", "magicBox.getSerialNo", "ptz.stop", "system.listService", "invalid"})
+	assert.Equal(t, []string{"magicBox", "ptz", "system"}, got)
+}
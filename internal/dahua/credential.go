@@ -0,0 +1,97 @@
+package dahua
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/envelope"
+)
+
+// encryptPassword encrypts a device or storage destination password before it is stored.
+// Only NewClient, device exports, and the FTP/SFTP readers decrypt them.
+func encryptPassword(password string) (string, error) {
+	return app.SecretKey.Encrypt(password)
+}
+
+// EncryptCredentials encrypts passwords that are still stored in plain text.
+// It fails when a password was encrypted with a different secret key.
+func EncryptCredentials(ctx context.Context) error {
+	return updateCredentials(ctx, func(password string) (string, error) {
+		if !envelope.IsEncrypted(password) {
+			return app.SecretKey.Encrypt(password)
+		}
+
+		keyID, ok := envelope.KeyID(password)
+		if !ok {
+			return "", envelope.ErrInvalidValue
+		}
+		if keyID != app.SecretKey.ID() {
+			return "", envelope.KeyMismatchError{KeyID: app.SecretKey.ID(), ValueKeyID: keyID}
+		}
+
+		return password, nil
+	})
+}
+
+// RotateSecretKey rewraps every password with the new secret key.
+// The new key must replace the current one after this returns.
+func RotateSecretKey(ctx context.Context, newKey envelope.Key) error {
+	return updateCredentials(ctx, func(password string) (string, error) {
+		return app.SecretKey.Rewrap(password, newKey)
+	})
+}
+
+func updateCredentials(ctx context.Context, fn func(password string) (string, error)) error {
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	devices, err := tx.C().DahuaListDevicePasswords(ctx)
+	if err != nil {
+		return err
+	}
+	for _, v := range devices {
+		password, err := fn(v.Password)
+		if err != nil {
+			return fmt.Errorf("device %d: %w", v.ID, err)
+		}
+		if password == v.Password {
+			continue
+		}
+
+		err = tx.C().DahuaUpdateDevicePassword(ctx, repo.DahuaUpdateDevicePasswordParams{
+			Password: password,
+			ID:       v.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	dests, err := tx.C().DahuaListStorageDestinationPasswords(ctx)
+	if err != nil {
+		return err
+	}
+	for _, v := range dests {
+		password, err := fn(v.Password)
+		if err != nil {
+			return fmt.Errorf("storage destination %d: %w", v.ID, err)
+		}
+		if password == v.Password {
+			continue
+		}
+
+		err = tx.C().DahuaUpdateStorageDestinationPassword(ctx, repo.DahuaUpdateStorageDestinationPasswordParams{
+			Password: password,
+			ID:       v.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
 	"github.com/ItsNotGoodName/ipcmanview/internal/models"
 	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system/action"
 	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc"
 	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc/modules/coaxialcontrolio"
 	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc/modules/configmanager"
@@ -247,13 +249,14 @@ func GetUsers(ctx context.Context, rpcClient dahuarpc.Conn, location *time.Locat
 
 func NewDahuaEvent(v repo.DahuaEvent) models.DahuaEvent {
 	return models.DahuaEvent{
-		ID:        v.ID,
-		DeviceID:  v.DeviceID,
-		Code:      v.Code,
-		Action:    v.Action,
-		Index:     v.Index,
-		Data:      v.Data.RawMessage,
-		CreatedAt: v.CreatedAt.Time,
+		ID:          v.ID,
+		DeviceID:    v.DeviceID,
+		Code:        v.Code,
+		Action:      v.Action,
+		Index:       v.Index,
+		Data:        v.Data.RawMessage,
+		CreatedAt:   v.CreatedAt.Time,
+		Maintenance: v.Maintenance,
 	}
 }
 
@@ -327,11 +330,22 @@ func ListPresets(ctx context.Context, clientPTZ ptz.Client, channel int) ([]mode
 	return res, nil
 }
 
-func SetPreset(ctx context.Context, clientPTZ ptz.Client, channel, index int) error {
-	return ptz.Start(ctx, clientPTZ, channel, ptz.Params{
+func SetPreset(ctx context.Context, client Client, channel, index int) error {
+	params := ptz.Params{
 		Code: "GotoPreset",
 		Arg1: index,
-	})
+	}
+
+	if err := ptz.Start(ctx, client.PTZ, channel, params); err != nil {
+		return err
+	}
+
+	return system.CreateEvent(ctx, app.DB.C(), action.DahuaDevicePTZ.Create(action.DahuaPTZ{
+		DeviceID: client.Conn.ID,
+		Channel:  channel,
+		Code:     params.Code,
+		Arg1:     params.Arg1,
+	}))
 }
 
 func GetUptime(ctx context.Context, c dahuarpc.Conn) (models.DahuaUptime, error) {
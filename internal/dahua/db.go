@@ -18,6 +18,9 @@ import (
 func authFilter(ctx context.Context, sb sq.SelectBuilder, deviceIDField string, level models.DahuaPermissionLevel) sq.SelectBuilder {
 	actor := core.UseActor(ctx)
 
+	if actor.Scope != nil && actor.Scope.Level < level {
+		return sb.Where("false")
+	}
 	if actor.Admin {
 		return sb
 	}
@@ -29,20 +32,43 @@ func authFilter(ctx context.Context, sb sq.SelectBuilder, deviceIDField string,
 			FROM
 				dahua_permissions
 			WHERE
-				dahua_permissions.level > ?
+				dahua_permissions.level >= ?
 				AND (
 					dahua_permissions.user_id = ?
 					OR dahua_permissions.group_id IN (
 						SELECT
-							group_id
+							group_users.group_id
+						FROM
+							group_users
+							JOIN groups ON groups.id = group_users.group_id
+						WHERE
+							group_users.user_id = ?
+							AND groups.disabled_at IS NULL
+					)
+				)
+			UNION
+			SELECT
+				dahua_device_tags.device_id
+			FROM
+				dahua_device_tags
+				JOIN dahua_tag_permissions ON dahua_tag_permissions.tag = dahua_device_tags.tag
+			WHERE
+				dahua_tag_permissions.level >= ?
+				AND (
+					dahua_tag_permissions.user_id = ?
+					OR dahua_tag_permissions.group_id IN (
+						SELECT
+							group_users.group_id
 						FROM
 							group_users
+							JOIN groups ON groups.id = group_users.group_id
 						WHERE
 							group_users.user_id = ?
+							AND groups.disabled_at IS NULL
 					)
 				)
 			)
-		`, level, actor.UserID, actor.UserID))
+		`, level, actor.UserID, actor.UserID, level, actor.UserID, actor.UserID))
 }
 
 func GetConn(ctx context.Context, id int64) (Conn, error) {
@@ -57,13 +83,16 @@ func GetConn(ctx context.Context, id int64) (Conn, error) {
 	}
 
 	return Conn{
-		ID:       v.ID,
-		URL:      v.Url.URL,
-		Username: v.Username,
-		Password: v.Password,
-		Location: v.Location.Location,
-		Feature:  v.Feature,
-		Seed:     int(v.Seed),
+		ID:             v.ID,
+		URL:            v.Url.URL,
+		Username:       v.Username,
+		Password:       v.Password,
+		Location:       v.Location.Location,
+		Feature:        v.Feature,
+		Seed:           int(v.Seed),
+		TLSMode:        v.TlsMode,
+		TLSCA:          v.TlsCa.String,
+		TLSFingerprint: v.TlsFingerprint.String,
 	}, nil
 }
 
@@ -80,13 +109,16 @@ func ListConn(ctx context.Context) ([]Conn, error) {
 	conns := make([]Conn, 0, len(vv))
 	for _, v := range vv {
 		conns = append(conns, Conn{
-			ID:       v.ID,
-			URL:      v.Url.URL,
-			Username: v.Username,
-			Password: v.Password,
-			Location: v.Location.Location,
-			Feature:  v.Feature,
-			Seed:     int(v.Seed),
+			ID:             v.ID,
+			URL:            v.Url.URL,
+			Username:       v.Username,
+			Password:       v.Password,
+			Location:       v.Location.Location,
+			Feature:        v.Feature,
+			Seed:           int(v.Seed),
+			TLSMode:        v.TlsMode,
+			TLSCA:          v.TlsCa.String,
+			TLSFingerprint: v.TlsFingerprint.String,
 		})
 	}
 
@@ -171,10 +203,17 @@ func GetDevice(ctx context.Context, id int64) (repo.DahuaDevice, error) {
 	return res, err
 }
 
-func ListDevices(ctx context.Context) ([]repo.DahuaDevice, error) {
+type DeviceFilter struct {
+	FilterTags []string
+}
+
+func ListDevices(ctx context.Context, arg DeviceFilter) ([]repo.DahuaDevice, error) {
 	sb := sq.
 		Select("*").
 		From("dahua_devices")
+	if len(arg.FilterTags) != 0 {
+		sb = sb.Where(tagFilter("dahua_devices.id", arg.FilterTags))
+	}
 
 	var res []repo.DahuaDevice
 	err := ssq.Query(ctx, app.DB, &res, authFilter(ctx, sb, "dahua_devices.id", levelDefault))
@@ -366,9 +405,10 @@ type EventFilter struct {
 	FilterDeviceIDs []int64
 	FilterCodes     []string
 	FilterActions   []string
+	FilterTags      []string
 }
 
-func (arg EventFilter) where() sq.Eq {
+func (arg EventFilter) where() sq.And {
 	where := sq.Eq{}
 	if len(arg.FilterDeviceIDs) != 0 {
 		where["dahua_events.device_id"] = arg.FilterDeviceIDs
@@ -379,7 +419,10 @@ func (arg EventFilter) where() sq.Eq {
 	if len(arg.FilterActions) != 0 {
 		where["dahua_events.action"] = arg.FilterActions
 	}
-	return where
+	if len(arg.FilterTags) != 0 {
+		return sq.And{where, tagFilter("dahua_events.device_id", arg.FilterTags)}
+	}
+	return sq.And{where}
 }
 
 type ListEventsParams struct {
@@ -608,3 +651,34 @@ func ListFiles(ctx context.Context, arg ListFilesParams) (ListFilesResult, error
 		Items:      items,
 	}, nil
 }
+
+type EventSnapshot struct {
+	ID            int64
+	EventID       int64
+	Name          string
+	ThumbnailName sql.NullString
+}
+
+func ListEventSnapshots(ctx context.Context, eventIDs []int64) ([]EventSnapshot, error) {
+	if len(eventIDs) == 0 {
+		return nil, nil
+	}
+
+	sb := sq.
+		Select(
+			"dahua_snapshots.id",
+			"dahua_snapshots.event_id",
+			"snapshot_afero_files.name AS name",
+			"thumbnail_afero_files.name AS thumbnail_name",
+		).
+		From("dahua_snapshots").
+		Join("dahua_afero_files AS snapshot_afero_files ON snapshot_afero_files.snapshot_id = dahua_snapshots.id AND snapshot_afero_files.ready = true").
+		LeftJoin("dahua_thumbnails ON dahua_thumbnails.snapshot_id = dahua_snapshots.id").
+		LeftJoin("dahua_afero_files AS thumbnail_afero_files ON thumbnail_afero_files.thumbnail_id = dahua_thumbnails.id AND thumbnail_afero_files.ready = true").
+		Where(sq.Eq{"dahua_snapshots.event_id": eventIDs}).
+		OrderBy("dahua_snapshots.created_at")
+
+	var res []EventSnapshot
+	err := ssq.Query(ctx, app.DB, &res, authFilter(ctx, sb, "dahua_snapshots.device_id", levelDefault))
+	return res, err
+}
@@ -0,0 +1,50 @@
+package dahua
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDB creates a migrated database with the rows inserted by the seed queries.
+func newTestDB(t *testing.T, seed ...string) sqlite.DB {
+	sqlDB, err := sqlite.New(filepath.Join(t.TempDir(), "sqlite.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+	require.NoError(t, sqlite.Migrate(sqlDB))
+
+	db := sqlite.NewDB(sqlDB)
+	for _, query := range seed {
+		_, err := db.ExecContext(context.Background(), query)
+		require.NoError(t, err)
+	}
+
+	return db
+}
+
+// seedDevices returns a query that inserts devices with the IDs.
+// Device N is named device-N and has the IP 192.168.1.N.
+func seedDevices(ids ...int64) string {
+	values := make([]string, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, fmt.Sprintf("(%d, 'device-%d', '192.168.1.%d', 'http://192.168.1.%d', '', '', '', 0, 0, 0)", id, id, id, id))
+	}
+	return "INSERT INTO dahua_devices (id, name, ip, url, username, password, location, feature, created_at, updated_at) VALUES " + strings.Join(values, ", ")
+}
+
+func useTestApp(t *testing.T, a App) {
+	old := app
+	app = a
+	t.Cleanup(func() { app = old })
+}
+
+// testAdminContext returns the context of an admin that does not need to exist in the database.
+func testAdminContext() context.Context {
+	return core.WithUserActor(context.Background(), 1, true)
+}
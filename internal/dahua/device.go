@@ -2,7 +2,7 @@ package dahua
 
 import (
 	"context"
-	"net"
+	"database/sql"
 	"net/url"
 	"slices"
 	"strings"
@@ -12,6 +12,7 @@ import (
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
 	"github.com/ItsNotGoodName/ipcmanview/internal/models"
 	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/sqlite"
 	"github.com/ItsNotGoodName/ipcmanview/internal/system"
 	"github.com/ItsNotGoodName/ipcmanview/internal/system/action"
 	"github.com/ItsNotGoodName/ipcmanview/internal/types"
@@ -66,20 +67,11 @@ func (d *_Device) normalize(create bool) {
 }
 
 func (d *_Device) getIP() (string, error) {
-	ip := d.URL.Hostname()
-
-	ips, err := net.LookupIP(ip)
+	ip, err := resolveIP(context.Background(), d.URL.Hostname())
 	if err != nil {
 		return "", core.NewFieldError("URL", err.Error())
 	}
 
-	for _, v := range ips {
-		if v.To4() != nil {
-			ip = v.String()
-			break
-		}
-	}
-
 	return ip, nil
 }
 
@@ -91,6 +83,13 @@ type CreateDeviceParams struct {
 	Location *time.Location
 	Feature  models.DahuaFeature
 	Email    string
+	Tags     []string
+	// TLSMode defaults to TLSModeVerify.
+	TLSMode string
+	// TLSCA is a PEM bundle of CAs that are trusted by TLSModeVerify instead of the system's CAs.
+	TLSCA string
+	// TestConnection logs in to the device before it is created and detects the feature when it is empty.
+	TestConnection bool
 }
 
 func CreateDevice(ctx context.Context, arg CreateDeviceParams) (int64, error) {
@@ -111,24 +110,56 @@ func CreateDevice(ctx context.Context, arg CreateDeviceParams) (int64, error) {
 		return 0, err
 	}
 
+	tags := normalizeTags(arg.Tags)
+	if err := validateTags(ctx, tags); err != nil {
+		return 0, err
+	}
+
+	tlsMode, tlsCA := normalizeTLSMode(arg.TLSMode), normalizeTLSCA(arg.TLSCA)
+	if err := validateTLS(tlsMode, tlsCA); err != nil {
+		return 0, err
+	}
+
 	ip, err := model.getIP()
 	if err != nil {
 		return 0, err
 	}
 
+	password, err := encryptPassword(arg.Password)
+	if err != nil {
+		return 0, err
+	}
+
+	feature := arg.Feature
+	if arg.TestConnection {
+		feature, err = validateConnection(ctx, Conn{
+			URL:      model.URL,
+			Username: model.Username,
+			Password: password,
+			Feature:  arg.Feature,
+			TLSMode:  tlsMode,
+			TLSCA:    tlsCA,
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
 	now := types.NewTime(time.Now())
 	id, err := createDahuaDevice(ctx, repo.DahuaCreateDeviceParams{
 		Name:      model.Name,
 		Url:       types.NewURL(model.URL),
 		Ip:        ip,
 		Username:  model.Username,
-		Password:  arg.Password,
+		Password:  password,
 		Location:  types.NewLocation(arg.Location),
-		Feature:   arg.Feature,
+		Feature:   feature,
 		Email:     core.StringToNullString(model.Email),
+		TlsMode:   tlsMode,
+		TlsCa:     core.StringToNullString(tlsCA),
 		CreatedAt: now,
 		UpdatedAt: now,
-	})
+	}, tags)
 	if err != nil {
 		return 0, err
 	}
@@ -136,7 +167,36 @@ func CreateDevice(ctx context.Context, arg CreateDeviceParams) (int64, error) {
 	return id, err
 }
 
-func createDahuaDevice(ctx context.Context, arg repo.DahuaCreateDeviceParams) (int64, error) {
+// deviceAudit returns the state of the device recorded in the audit log.
+func deviceAudit(ctx context.Context, db sqlite.DBTx, id int64) (action.DahuaDevice, error) {
+	v, err := db.DahuaGetDevice(ctx, id)
+	if err != nil {
+		return action.DahuaDevice{}, err
+	}
+
+	tags, err := db.DahuaListDeviceTags(ctx, id)
+	if err != nil {
+		return action.DahuaDevice{}, err
+	}
+
+	return action.DahuaDevice{
+		Name:           v.Name,
+		URL:            v.Url.String(),
+		IP:             v.Ip,
+		Username:       v.Username,
+		Password:       v.Password,
+		Location:       v.Location.String(),
+		Features:       FeatureToStrings(v.Feature),
+		Email:          v.Email.String,
+		Disabled:       v.DisabledAt.Valid,
+		Tags:           tags,
+		TLSMode:        v.TlsMode,
+		TLSCA:          v.TlsCa.String,
+		TLSFingerprint: v.TlsFingerprint.String,
+	}, nil
+}
+
+func createDahuaDevice(ctx context.Context, arg repo.DahuaCreateDeviceParams, tags []string) (int64, error) {
 	tx, err := app.DB.BeginTx(ctx, true)
 	if err != nil {
 		return 0, err
@@ -158,7 +218,16 @@ func createDahuaDevice(ctx context.Context, arg repo.DahuaCreateDeviceParams) (i
 		return 0, err
 	}
 
-	if err := system.CreateEvent(ctx, tx.C(), action.DahuaDeviceCreated.Create(id)); err != nil {
+	if err := setDeviceTags(ctx, tx, id, tags); err != nil {
+		return 0, err
+	}
+
+	after, err := deviceAudit(ctx, tx.C(), id)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.DahuaDeviceCreated.Create(id).WithDiff(nil, after)); err != nil {
 		return 0, err
 	}
 
@@ -182,6 +251,12 @@ type UpdateDeviceParams struct {
 	Location    *time.Location
 	Feature     models.DahuaFeature
 	Email       string
+	Tags        []string
+	// TLSMode keeps the current TLS settings when it is empty.
+	TLSMode string
+	TLSCA   string
+	// TestConnection logs in to the device before it is updated and detects the feature when it is empty.
+	TestConnection bool
 }
 
 func UpdateDevice(ctx context.Context, arg UpdateDeviceParams) error {
@@ -206,6 +281,25 @@ func UpdateDevice(ctx context.Context, arg UpdateDeviceParams) error {
 		return err
 	}
 
+	tags := normalizeTags(arg.Tags)
+	if err := validateTags(ctx, tags); err != nil {
+		return err
+	}
+
+	tlsMode, tlsCA := dbModel.TlsMode, dbModel.TlsCa.String
+	if arg.TLSMode != "" {
+		tlsMode, tlsCA = arg.TLSMode, normalizeTLSCA(arg.TLSCA)
+		if err := validateTLS(tlsMode, tlsCA); err != nil {
+			return err
+		}
+	}
+
+	// The pinned certificate belongs to the old address
+	tlsFingerprint := dbModel.TlsFingerprint
+	if tlsMode != TLSModePin || model.URL.Host != dbModel.Url.Host {
+		tlsFingerprint = sql.NullString{}
+	}
+
 	ip, err := model.getIP()
 	if err != nil {
 		return err
@@ -213,35 +307,81 @@ func UpdateDevice(ctx context.Context, arg UpdateDeviceParams) error {
 
 	password := dbModel.Password
 	if arg.NewPassword != "" {
-		password = arg.NewPassword
+		password, err = encryptPassword(arg.NewPassword)
+		if err != nil {
+			return err
+		}
+	}
+
+	feature := arg.Feature
+	if arg.TestConnection {
+		feature, err = validateConnection(ctx, Conn{
+			URL:            model.URL,
+			Username:       model.Username,
+			Password:       password,
+			Feature:        arg.Feature,
+			TLSMode:        tlsMode,
+			TLSCA:          tlsCA,
+			TLSFingerprint: tlsFingerprint.String,
+		})
+		if err != nil {
+			return err
+		}
 	}
 
 	return updateDevice(ctx, repo.DahuaUpdateDeviceParams{
-		Name:      model.Name,
-		Url:       types.NewURL(model.URL),
-		Ip:        ip,
-		Username:  model.Username,
-		Password:  password,
-		Location:  types.NewLocation(arg.Location),
-		Feature:   arg.Feature,
-		Email:     core.StringToNullString(model.Email),
-		UpdatedAt: types.NewTime(time.Now()),
-		ID:        dbModel.ID,
-	})
+		Name:           model.Name,
+		Url:            types.NewURL(model.URL),
+		Ip:             ip,
+		Username:       model.Username,
+		Password:       password,
+		Location:       types.NewLocation(arg.Location),
+		Feature:        feature,
+		Email:          core.StringToNullString(model.Email),
+		TlsMode:        tlsMode,
+		TlsCa:          core.StringToNullString(tlsCA),
+		TlsFingerprint: tlsFingerprint,
+		UpdatedAt:      types.NewTime(time.Now()),
+		ID:             dbModel.ID,
+	}, tags)
 }
 
-func updateDevice(ctx context.Context, arg repo.DahuaUpdateDeviceParams) error {
+func updateDevice(ctx context.Context, arg repo.DahuaUpdateDeviceParams, tags []string) error {
 	tx, err := app.DB.BeginTx(ctx, true)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
+	before, err := deviceAudit(ctx, tx.C(), arg.ID)
+	if err != nil {
+		return err
+	}
+
 	if _, err := tx.C().DahuaUpdateDevice(ctx, arg); err != nil {
 		return err
 	}
 
-	if err := system.CreateEvent(ctx, tx.C(), action.DahuaDeviceUpdated.Create(arg.ID)); err != nil {
+	if err := setDeviceTags(ctx, tx, arg.ID, tags); err != nil {
+		return err
+	}
+
+	after, err := deviceAudit(ctx, tx.C(), arg.ID)
+	if err != nil {
+		return err
+	}
+
+	// A different address can be a different device
+	if before.URL != after.URL {
+		if err := tx.C().DahuaDeleteCapability(ctx, arg.ID); err != nil {
+			return err
+		}
+		if err := tx.C().DahuaDeleteChannelCapabilities(ctx, arg.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.DahuaDeviceUpdated.Create(arg.ID).WithDiff(before, after)); err != nil {
 		return err
 	}
 
@@ -271,11 +411,16 @@ func deleteDevice(ctx context.Context, id int64) error {
 	}
 	defer tx.Rollback()
 
+	before, err := deviceAudit(ctx, tx.C(), id)
+	if err != nil {
+		return err
+	}
+
 	if err := tx.C().DahuaDeleteDevice(ctx, id); err != nil {
 		return err
 	}
 
-	if err := system.CreateEvent(ctx, tx.C(), action.DahuaDeviceDeleted.Create(id)); err != nil {
+	if err := system.CreateEvent(ctx, tx.C(), action.DahuaDeviceDeleted.Create(id).WithDiff(before, nil)); err != nil {
 		return err
 	}
 
@@ -311,11 +456,21 @@ func updateDeviceDisabled(ctx context.Context, arg repo.DahuaUpdateDeviceDisable
 	}
 	defer tx.Rollback()
 
+	before, err := deviceAudit(ctx, tx.C(), arg.ID)
+	if err != nil {
+		return err
+	}
+
 	if _, err := tx.C().DahuaUpdateDeviceDisabledAt(ctx, arg); err != nil {
 		return err
 	}
 
-	if err := system.CreateEvent(ctx, tx.C(), action.DahuaDeviceUpdated.Create(arg.ID)); err != nil {
+	after, err := deviceAudit(ctx, tx.C(), arg.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.DahuaDeviceUpdated.Create(arg.ID).WithDiff(before, after)); err != nil {
 		return err
 	}
 
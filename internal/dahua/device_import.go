@@ -0,0 +1,505 @@
+package dahua
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DeviceFormatCSV  = "csv"
+	DeviceFormatYAML = "yaml"
+)
+
+var DeviceFormats = []string{DeviceFormatCSV, DeviceFormatYAML}
+
+// DeviceRecord is a device in an import or export file.
+type DeviceRecord struct {
+	Name     string   `yaml:"name"`
+	URL      string   `yaml:"url"`
+	Username string   `yaml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty"`
+	Location string   `yaml:"location,omitempty"`
+	Features []string `yaml:"features,omitempty"`
+	Email    string   `yaml:"email,omitempty"`
+	Tags     []string `yaml:"tags,omitempty"`
+	Serial   string   `yaml:"serial,omitempty"`
+}
+
+var deviceRecordColumns = []string{"name", "url", "username", "password", "location", "features", "email", "tags", "serial"}
+
+// ReadDeviceRecords reads device records in the format.
+// CSV files must start with a header row, and features and tags are separated by commas.
+func ReadDeviceRecords(r io.Reader, format string) ([]DeviceRecord, error) {
+	switch format {
+	case DeviceFormatCSV:
+		return readDeviceRecordsCSV(r)
+	case DeviceFormatYAML:
+		return readDeviceRecordsYAML(r)
+	default:
+		return nil, fmt.Errorf("invalid format: %s", format)
+	}
+}
+
+func readDeviceRecordsCSV(r io.Reader) ([]DeviceRecord, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	columns := make([]string, 0, len(header))
+	for i, column := range header {
+		if i == 0 {
+			// Spreadsheet programs like to start CSV files with a byte order mark
+			column = strings.TrimPrefix(column, "\ufeff")
+		}
+		column = strings.ToLower(strings.TrimSpace(column))
+		if !slices.Contains(deviceRecordColumns, column) {
+			return nil, fmt.Errorf("unknown column: %s", column)
+		}
+		if slices.Contains(columns, column) {
+			return nil, fmt.Errorf("duplicate column: %s", column)
+		}
+		columns = append(columns, column)
+	}
+
+	var records []DeviceRecord
+	for {
+		row, err := cr.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+			return nil, err
+		}
+
+		var record DeviceRecord
+		for i, value := range row {
+			value = strings.TrimSpace(value)
+			switch columns[i] {
+			case "name":
+				record.Name = value
+			case "url":
+				record.URL = value
+			case "username":
+				record.Username = value
+			case "password":
+				record.Password = value
+			case "location":
+				record.Location = value
+			case "features":
+				record.Features = splitDeviceRecordList(value)
+			case "email":
+				record.Email = value
+			case "tags":
+				record.Tags = splitDeviceRecordList(value)
+			case "serial":
+				record.Serial = value
+			}
+		}
+		records = append(records, record)
+	}
+}
+
+func splitDeviceRecordList(value string) []string {
+	var list []string
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		list = append(list, v)
+	}
+	return list
+}
+
+func readDeviceRecordsYAML(r io.Reader) ([]DeviceRecord, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+
+	var records []DeviceRecord
+	if err := dec.Decode(&records); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return records, nil
+}
+
+// WriteDeviceRecords writes device records in the format.
+func WriteDeviceRecords(w io.Writer, format string, records []DeviceRecord) error {
+	switch format {
+	case DeviceFormatCSV:
+		return writeDeviceRecordsCSV(w, records)
+	case DeviceFormatYAML:
+		return writeDeviceRecordsYAML(w, records)
+	default:
+		return fmt.Errorf("invalid format: %s", format)
+	}
+}
+
+func writeDeviceRecordsCSV(w io.Writer, records []DeviceRecord) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(deviceRecordColumns); err != nil {
+		return err
+	}
+	for _, record := range records {
+		err := cw.Write([]string{
+			record.Name,
+			record.URL,
+			record.Username,
+			record.Password,
+			record.Location,
+			strings.Join(record.Features, ","),
+			record.Email,
+			strings.Join(record.Tags, ","),
+			record.Serial,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeDeviceRecordsYAML(w io.Writer, records []DeviceRecord) error {
+	if records == nil {
+		records = []DeviceRecord{}
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(records); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// parseDeviceURL parses the URL of a device record.
+// The scheme can be left out, e.g. "192.168.1.108" or "camera.lan:8080".
+func parseDeviceURL(rawURL string) (*url.URL, error) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "//" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("missing host")
+	}
+	return u, nil
+}
+
+type ExportDevicesParams struct {
+	// IncludePasswords exports device passwords in plain text.
+	IncludePasswords bool
+}
+
+// ExportDevices returns every device as a record that can be imported with ImportDevices.
+func ExportDevices(ctx context.Context, arg ExportDevicesParams) ([]DeviceRecord, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	devices, err := ListDevices(ctx, DeviceFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]DeviceRecord, 0, len(devices))
+	for _, v := range devices {
+		tags, err := app.DB.C().DahuaListDeviceTags(ctx, v.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		record := DeviceRecord{
+			Name:     v.Name,
+			URL:      v.Url.String(),
+			Username: v.Username,
+			Location: v.Location.String(),
+			Features: FeatureToStrings(v.Feature),
+			Email:    v.Email.String,
+			Tags:     tags,
+			Serial:   v.Serial.String,
+		}
+		if arg.IncludePasswords {
+			// Disabled devices do not have clients so the password is decrypted here
+			password, err := app.SecretKey.Decrypt(v.Password)
+			if err != nil {
+				return nil, fmt.Errorf("device %d: %w", v.ID, err)
+			}
+			record.Password = password
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+const (
+	ImportActionCreate = "create"
+	ImportActionUpdate = "update"
+)
+
+type ImportDevicesParams struct {
+	Records []DeviceRecord
+	// DryRun validates the records without creating or updating any devices.
+	DryRun bool
+}
+
+type ImportDevicesResult struct {
+	// Row is the position of the record starting at 1.
+	Row  int
+	Name string
+	// Action is either create or update.
+	Action string
+	// DeviceID is the ID of the updated or created device.
+	// It is 0 when a device is not created because of a dry run or an error.
+	DeviceID int64
+	Err      error
+}
+
+// ImportDevices creates or updates devices from records.
+// A record updates the device with the same serial number or IP, otherwise it creates a new device.
+// An empty password keeps the password of the updated device.
+// A record that fails does not stop the others from being imported.
+func ImportDevices(ctx context.Context, arg ImportDevicesParams) ([]ImportDevicesResult, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	devices, err := ListDevices(ctx, DeviceFilter{})
+	if err != nil {
+		return nil, err
+	}
+	index := deviceImportIndex{
+		byIP:     make(map[string]repo.DahuaDevice, len(devices)),
+		bySerial: make(map[string]repo.DahuaDevice, len(devices)),
+		byName:   make(map[string]repo.DahuaDevice, len(devices)),
+		rows:     make(map[string]int),
+	}
+	for _, v := range devices {
+		index.byIP[v.Ip] = v
+		index.byName[v.Name] = v
+		if v.Serial.Valid {
+			index.bySerial[v.Serial.String] = v
+		}
+	}
+
+	res := make([]ImportDevicesResult, 0, len(arg.Records))
+	for i, record := range arg.Records {
+		row := i + 1
+		result := ImportDevicesResult{
+			Row:  row,
+			Name: record.Name,
+		}
+
+		v, err := index.prepare(ctx, row, record)
+		if err != nil {
+			result.Err = err
+			res = append(res, result)
+			continue
+		}
+		result.Name = v.model.Name
+		result.Action = ImportActionCreate
+		if v.match != nil {
+			result.Action = ImportActionUpdate
+			result.DeviceID = v.match.ID
+		}
+
+		if !arg.DryRun {
+			result.DeviceID, result.Err = v.apply(ctx)
+		}
+
+		res = append(res, result)
+	}
+
+	return res, nil
+}
+
+type deviceImportIndex struct {
+	byIP     map[string]repo.DahuaDevice
+	bySerial map[string]repo.DahuaDevice
+	byName   map[string]repo.DahuaDevice
+	// rows has the row of the IPs, serial numbers, and names that have already been imported.
+	rows map[string]int
+}
+
+type deviceImport struct {
+	match    *repo.DahuaDevice
+	model    _Device
+	password string
+	location *time.Location
+	feature  models.DahuaFeature
+	tags     []string
+	serial   string
+}
+
+// prepare validates the record and finds the device it updates.
+func (index deviceImportIndex) prepare(ctx context.Context, row int, record DeviceRecord) (deviceImport, error) {
+	var errs core.FieldErrors
+
+	urL, err := parseDeviceURL(record.URL)
+	if err != nil {
+		return deviceImport{}, core.NewFieldError("URL", err.Error())
+	}
+
+	location, err := time.LoadLocation(record.Location)
+	if err != nil {
+		errs = append(errs, core.NewFieldError("Location", err.Error()))
+	}
+
+	for _, feature := range record.Features {
+		if _, ok := featureMap[feature]; !ok {
+			errs = append(errs, core.NewFieldError("Features", fmt.Sprintf("unknown feature: %s", feature)))
+		}
+	}
+
+	model := _Device{
+		Name:     record.Name,
+		URL:      urL,
+		Username: record.Username,
+		Email:    record.Email,
+	}
+	model.normalize(false)
+
+	ip, err := model.getIP()
+	if err != nil {
+		fieldErrs, _ := core.AsFieldErrors(err)
+		return deviceImport{}, append(errs, fieldErrs...)
+	}
+
+	serial := strings.TrimSpace(record.Serial)
+
+	var match *repo.DahuaDevice
+	if v, ok := index.bySerial[serial]; ok && serial != "" {
+		match = &v
+		if other, ok := index.byIP[ip]; ok && other.ID != v.ID {
+			errs = append(errs, core.NewFieldError("URL", fmt.Sprintf("IP is used by device %s", other.Name)))
+		}
+	} else if v, ok := index.byIP[ip]; ok {
+		match = &v
+	}
+
+	if match == nil {
+		model.normalize(true)
+	} else if serial == "" {
+		serial = match.Serial.String
+	}
+
+	if err := core.ValidateStruct(ctx, model); err != nil {
+		fieldErrs, ok := core.AsFieldErrors(err)
+		if !ok {
+			return deviceImport{}, err
+		}
+		errs = append(errs, fieldErrs...)
+	}
+
+	if v, ok := index.byName[model.Name]; ok && (match == nil || v.ID != match.ID) {
+		errs = append(errs, core.NewFieldError("Name", fmt.Sprintf("name is used by device %d", v.ID)))
+	}
+
+	tags := normalizeTags(record.Tags)
+	if err := validateTags(ctx, tags); err != nil {
+		fieldErrs, ok := core.AsFieldErrors(err)
+		if !ok {
+			return deviceImport{}, err
+		}
+		errs = append(errs, fieldErrs...)
+	}
+
+	keys := [][2]string{{"URL", "ip:" + ip}, {"Name", "name:" + model.Name}}
+	if serial != "" {
+		keys = append(keys, [2]string{"Serial", "serial:" + serial})
+	}
+	for _, key := range keys {
+		if prev, ok := index.rows[key[1]]; ok {
+			errs = append(errs, core.NewFieldError(key[0], fmt.Sprintf("same as row %d", prev)))
+			continue
+		}
+		index.rows[key[1]] = row
+	}
+
+	if len(errs) > 0 {
+		return deviceImport{}, errs
+	}
+
+	return deviceImport{
+		match:    match,
+		model:    model,
+		password: record.Password,
+		location: location,
+		feature:  FeatureFromStrings(record.Features),
+		tags:     tags,
+		serial:   serial,
+	}, nil
+}
+
+// apply creates or updates the device.
+func (v deviceImport) apply(ctx context.Context) (int64, error) {
+	var id int64
+	if v.match == nil {
+		var err error
+		id, err = CreateDevice(ctx, CreateDeviceParams{
+			Name:     v.model.Name,
+			URL:      v.model.URL,
+			Username: v.model.Username,
+			Password: v.password,
+			Location: v.location,
+			Feature:  v.feature,
+			Email:    v.model.Email,
+			Tags:     v.tags,
+		})
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		id = v.match.ID
+		err := UpdateDevice(ctx, UpdateDeviceParams{
+			ID:          id,
+			Name:        v.model.Name,
+			URL:         v.model.URL,
+			Username:    v.model.Username,
+			NewPassword: v.password,
+			Location:    v.location,
+			Feature:     v.feature,
+			Email:       v.model.Email,
+			Tags:        v.tags,
+		})
+		if err != nil {
+			return id, err
+		}
+	}
+
+	if v.serial != "" && (v.match == nil || v.serial != v.match.Serial.String) {
+		if err := setDeviceSerial(ctx, id, v.serial); err != nil {
+			return id, err
+		}
+	}
+
+	return id, nil
+}
+
+func setDeviceSerial(ctx context.Context, id int64, serial string) error {
+	return app.DB.C().DahuaUpdateDeviceSerial(ctx, repo.DahuaUpdateDeviceSerialParams{
+		Serial: core.StringToNullString(serial),
+		ID:     id,
+	})
+}
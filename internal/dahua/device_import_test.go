@@ -0,0 +1,128 @@
+package dahua
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ItsNotGoodName/ipcmanview/pkg/envelope"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadDeviceRecordsCSV(t *testing.T) {
+	data := "\ufeffName,URL,Password,Features,Tags\n" +
+		"Front,192.168.1.108,secret,camera,\"outdoor, Lobby\"\n" +
+		"Back,https://192.168.1.109,,,\n"
+
+	records, err := ReadDeviceRecords(strings.NewReader(data), DeviceFormatCSV)
+	require.NoError(t, err)
+	assert.Equal(t, []DeviceRecord{
+		{Name: "Front", URL: "192.168.1.108", Password: "secret", Features: []string{"camera"}, Tags: []string{"outdoor", "Lobby"}},
+		{Name: "Back", URL: "https://192.168.1.109"},
+	}, records)
+
+	_, err = ReadDeviceRecords(strings.NewReader("name,address\n"), DeviceFormatCSV)
+	assert.Error(t, err)
+}
+
+func TestReadDeviceRecordsYAML(t *testing.T) {
+	data := `
+- name: Front
+  url: 192.168.1.108
+  features: [camera]
+  tags:
+    - outdoor
+  serial: 7L0000000000000
+`
+
+	records, err := ReadDeviceRecords(strings.NewReader(data), DeviceFormatYAML)
+	require.NoError(t, err)
+	assert.Equal(t, []DeviceRecord{
+		{Name: "Front", URL: "192.168.1.108", Features: []string{"camera"}, Tags: []string{"outdoor"}, Serial: "7L0000000000000"},
+	}, records)
+
+	_, err = ReadDeviceRecords(strings.NewReader("- name: Front\n  address: 192.168.1.108\n"), DeviceFormatYAML)
+	assert.Error(t, err)
+}
+
+func TestWriteDeviceRecords(t *testing.T) {
+	records := []DeviceRecord{
+		{Name: "Front", URL: "http://192.168.1.108", Username: "admin", Password: "a,b", Location: "UTC", Features: []string{"camera"}, Tags: []string{"lobby", "outdoor"}},
+		{Name: "Back", URL: "http://192.168.1.109", Username: "admin", Location: "UTC"},
+	}
+
+	for _, format := range DeviceFormats {
+		var buf bytes.Buffer
+		require.NoError(t, WriteDeviceRecords(&buf, format, records))
+
+		got, err := ReadDeviceRecords(&buf, format)
+		require.NoError(t, err, format)
+		assert.Equal(t, records, got, format)
+	}
+}
+
+func TestExportDevicesPasswords(t *testing.T) {
+	ctx := testAdminContext()
+	key, err := envelope.NewKey()
+	require.NoError(t, err)
+	useTestApp(t, App{DB: newTestDB(t), SecretKey: key})
+
+	devices := []struct {
+		name     string
+		password string
+		disabled bool
+	}{
+		{name: "enabled", password: "enabled-password"},
+		{name: "disabled", password: "disabled-password", disabled: true},
+	}
+	for i, v := range devices {
+		password, err := encryptPassword(v.password)
+		require.NoError(t, err)
+
+		var disabledAt any
+		if v.disabled {
+			disabledAt = 0
+		}
+		_, err = app.DB.ExecContext(ctx, `INSERT INTO dahua_devices
+			(id, name, ip, url, username, password, location, feature, created_at, updated_at, disabled_at)
+			VALUES (?, ?, ?, ?, 'admin', ?, 'UTC', 0, 0, 0, ?)`,
+			i+1, v.name, "192.168.1."+v.name, "http://"+v.name, password, disabledAt)
+		require.NoError(t, err)
+	}
+
+	records, err := ExportDevices(ctx, ExportDevicesParams{IncludePasswords: true})
+	require.NoError(t, err)
+	require.Len(t, records, len(devices))
+	passwords := make(map[string]string)
+	for _, record := range records {
+		passwords[record.Name] = record.Password
+	}
+	for _, v := range devices {
+		assert.Equal(t, v.password, passwords[v.name], v.name)
+	}
+
+	records, err = ExportDevices(ctx, ExportDevicesParams{})
+	require.NoError(t, err)
+	for _, record := range records {
+		assert.Empty(t, record.Password)
+	}
+}
+
+func TestParseDeviceURL(t *testing.T) {
+	for _, tt := range []struct {
+		url  string
+		host string
+	}{
+		{"192.168.1.108", "192.168.1.108"},
+		{"camera.lan:8080", "camera.lan:8080"},
+		{"https://192.168.1.108", "192.168.1.108"},
+	} {
+		u, err := parseDeviceURL(tt.url)
+		require.NoError(t, err, tt.url)
+		assert.Equal(t, tt.host, u.Host, tt.url)
+	}
+
+	_, err := parseDeviceURL("")
+	assert.Error(t, err)
+}
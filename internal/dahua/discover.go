@@ -0,0 +1,156 @@
+package dahua
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/discovery"
+	"github.com/rs/zerolog/log"
+)
+
+type DiscoveredDevice struct {
+	discovery.Device
+	// DeviceID is the ID of the device with the same IP or 0 when it has not been adopted.
+	DeviceID int64
+}
+
+// Discover finds devices on the local network with DHIP and WS-Discovery.
+// Replies from both protocols are merged by IP, preferring DHIP because it reports more.
+func Discover(ctx context.Context) ([]DiscoveredDevice, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, discovery.DefaultTimeout)
+	defer cancel()
+
+	var (
+		wg                        sync.WaitGroup
+		dhipDevices, onvifDevices []discovery.Device
+		dhipErr, onvifErr         error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		dhipDevices, dhipErr = discovery.DHIP(probeCtx, discovery.DHIPAddress)
+	}()
+	go func() {
+		defer wg.Done()
+		onvifDevices, onvifErr = discovery.WSDiscovery(probeCtx, discovery.WSDiscoveryAddress)
+	}()
+	wg.Wait()
+	if dhipErr != nil && onvifErr != nil {
+		return nil, errors.Join(dhipErr, onvifErr)
+	}
+	if err := errors.Join(dhipErr, onvifErr); err != nil {
+		log.Err(err).Str("package", "dahua").Msg("Discovery probe failed")
+	}
+
+	merged := make(map[string]discovery.Device)
+	for _, device := range append(dhipDevices, onvifDevices...) {
+		device.MAC = discovery.NormalizeMAC(device.MAC)
+		if v, ok := merged[device.IP]; ok {
+			device = v.Merge(device)
+		}
+		merged[device.IP] = device
+	}
+
+	devices, err := ListDevices(ctx, DeviceFilter{})
+	if err != nil {
+		return nil, err
+	}
+	deviceIDs := make(map[string]int64, len(devices))
+	for _, v := range devices {
+		deviceIDs[v.Ip] = v.ID
+	}
+
+	res := make([]DiscoveredDevice, 0, len(merged))
+	for _, device := range merged {
+		res = append(res, DiscoveredDevice{
+			Device:   device,
+			DeviceID: deviceIDs[device.IP],
+		})
+	}
+	slices.SortFunc(res, func(a, b DiscoveredDevice) int {
+		return cmp.Compare(ipSortKey(a.IP), ipSortKey(b.IP))
+	})
+
+	return res, nil
+}
+
+func ipSortKey(ip string) string {
+	if v := net.ParseIP(ip).To4(); v != nil {
+		return string(v)
+	}
+	return ip
+}
+
+type AdoptDeviceParams struct {
+	IP       string
+	HTTPPort int
+	// Name defaults to the IP when it is empty.
+	Name string
+	// Serial is stored so that imports can match the device by serial number.
+	Serial string
+}
+
+type AdoptDevicesParams struct {
+	Devices  []AdoptDeviceParams
+	Username string
+	Password string
+	Location *time.Location
+	Feature  models.DahuaFeature
+	Tags     []string
+}
+
+type AdoptDevicesResult struct {
+	IP string
+	// ID is 0 when Err is set.
+	ID  int64
+	Err error
+}
+
+// AdoptDevices creates discovered devices with shared credentials.
+// A device that fails to be created does not stop the others from being created.
+func AdoptDevices(ctx context.Context, arg AdoptDevicesParams) ([]AdoptDevicesResult, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	res := make([]AdoptDevicesResult, 0, len(arg.Devices))
+	for _, device := range arg.Devices {
+		host := device.IP
+		if device.HTTPPort != 0 && device.HTTPPort != 80 {
+			host = net.JoinHostPort(device.IP, strconv.Itoa(device.HTTPPort))
+		}
+
+		id, err := CreateDevice(ctx, CreateDeviceParams{
+			Name:     device.Name,
+			URL:      &url.URL{Host: host},
+			Username: arg.Username,
+			Password: arg.Password,
+			Location: arg.Location,
+			Feature:  arg.Feature,
+			Tags:     arg.Tags,
+		})
+		if err == nil && device.Serial != "" {
+			err = setDeviceSerial(ctx, id, device.Serial)
+		}
+		res = append(res, AdoptDevicesResult{
+			IP:  device.IP,
+			ID:  id,
+			Err: err,
+		})
+	}
+
+	return res, nil
+}
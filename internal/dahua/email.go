@@ -3,6 +3,7 @@ package dahua
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -23,6 +24,7 @@ type EmailContent struct {
 	AlarmDeviceName   string
 	AlarmName         string
 	IPAddress         string
+	SerialNo          string
 }
 
 func ParseEmailContent(text string) EmailContent {
@@ -48,6 +50,8 @@ func ParseEmailContent(text string) EmailContent {
 			content.AlarmName = value
 		case "IP Address":
 			content.IPAddress = value
+		case "Serial No.", "Serial Number", "SN":
+			content.SerialNo = value
 		default:
 		}
 	}
@@ -213,17 +217,54 @@ func createEmailAttachmentFile(ctx context.Context, arg createEmailAttachmentFil
 }
 
 type LoginSMTPParams struct {
+	// IP is the remote address of the SMTP connection.
 	IP   string
 	From string
+	// Serial is the serial number found in the email.
+	Serial string
+	// ContentIP is the IP address found in the email.
+	ContentIP string
 }
 
+// LoginSMTP finds the device that sent the email.
+// Devices are matched by the connection's IP first because the email can say anything,
+// then by serial number, then email, and then the IP in the email.
 func LoginSMTP(ctx context.Context, arg LoginSMTPParams) (repo.DahuaDevice, error) {
 	if _, err := core.AssertAdmin(ctx); err != nil {
 		return repo.DahuaDevice{}, err
 	}
 
-	return app.DB.C().DahuaGetDeviceForSMTP(ctx, repo.DahuaGetDeviceForSMTPParams{
-		Ip:    arg.IP,
-		Email: core.NewNullString(arg.From),
-	})
+	getDeviceByIP := func(v string) (repo.DahuaDevice, error) {
+		ip := net.ParseIP(v)
+		if ip == nil {
+			return repo.DahuaDevice{}, core.ErrNotFound
+		}
+		return app.DB.C().DahuaGetDeviceByIP(ctx, normalizeIP(ip))
+	}
+
+	device, err := getDeviceByIP(arg.IP)
+	if err == nil || !core.IsNotFound(err) {
+		return device, err
+	}
+
+	if arg.Serial != "" {
+		device, err := app.DB.C().DahuaGetDeviceBySerial(ctx, core.NewNullString(arg.Serial))
+		if err == nil || !core.IsNotFound(err) {
+			return device, err
+		}
+	}
+
+	if arg.From != "" {
+		device, err := app.DB.C().DahuaGetDeviceByEmail(ctx, core.NewNullString(arg.From))
+		if err == nil || !core.IsNotFound(err) {
+			return device, err
+		}
+	}
+
+	device, err = getDeviceByIP(arg.ContentIP)
+	if err == nil || !core.IsNotFound(err) {
+		return device, err
+	}
+
+	return repo.DahuaDevice{}, core.ErrNotFound
 }
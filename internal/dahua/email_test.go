@@ -1,9 +1,13 @@
 package dahua
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
 
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParseEmailContent(t *testing.T) {
@@ -31,6 +35,21 @@ func TestParseEmailContent(t *testing.T) {
 				IPAddress:         "192.168.60.15",
 			},
 		},
+		{
+			name: "serial",
+			args: args{`Alarm Event: Motion Detection
+		Alarm Input Channel: 2
+		Alarm Device Name: NVR
+		IP Address: fe80::1
+		Serial No.: 5J0A2B3PAZ12345`},
+			want: EmailContent{
+				AlarmEvent:        "Motion Detection",
+				AlarmInputChannel: 2,
+				AlarmDeviceName:   "NVR",
+				IPAddress:         "fe80::1",
+				SerialNo:          "5J0A2B3PAZ12345",
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -39,3 +58,103 @@ func TestParseEmailContent(t *testing.T) {
 		})
 	}
 }
+
+func TestLoginSMTP(t *testing.T) {
+	ctx := testAdminContext()
+	useTestApp(t, App{DB: newTestDB(t,
+		`INSERT INTO dahua_devices (id, name, ip, url, username, password, location, feature, email, serial, created_at, updated_at) VALUES
+			(1, 'ip', '192.168.1.1', 'http://192.168.1.1', '', '', '', 0, NULL, NULL, 0, 0),
+			(2, 'serial', '192.168.1.2', 'http://192.168.1.2', '', '', '', 0, NULL, 'SN2', 0, 0),
+			(3, 'email', '192.168.1.3', 'http://192.168.1.3', '', '', '', 0, 'cam3@example.com', NULL, 0, 0),
+			(4, 'content-ip', '192.168.1.4', 'http://192.168.1.4', '', '', '', 0, NULL, NULL, 0, 0)`,
+	)})
+
+	tests := []struct {
+		name     string
+		arg      LoginSMTPParams
+		deviceID int64
+	}{
+		{
+			name:     "connection ip before email content",
+			arg:      LoginSMTPParams{IP: "192.168.1.1", From: "cam3@example.com", Serial: "SN2", ContentIP: "192.168.1.4"},
+			deviceID: 1,
+		},
+		{
+			name:     "ipv4 mapped connection ip",
+			arg:      LoginSMTPParams{IP: "::ffff:192.168.1.1"},
+			deviceID: 1,
+		},
+		{
+			name:     "serial",
+			arg:      LoginSMTPParams{IP: "10.0.0.1", From: "cam3@example.com", Serial: "SN2", ContentIP: "192.168.1.4"},
+			deviceID: 2,
+		},
+		{
+			name:     "email",
+			arg:      LoginSMTPParams{IP: "10.0.0.1", From: "cam3@example.com", Serial: "SN9", ContentIP: "192.168.1.4"},
+			deviceID: 3,
+		},
+		{
+			name:     "content ip",
+			arg:      LoginSMTPParams{IP: "10.0.0.1", From: "other@example.com", ContentIP: "192.168.1.4"},
+			deviceID: 4,
+		},
+		{
+			name:     "not found",
+			arg:      LoginSMTPParams{IP: "10.0.0.1", From: "other@example.com", ContentIP: "invalid"},
+			deviceID: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device, err := LoginSMTP(ctx, tt.arg)
+			if tt.deviceID == 0 {
+				assert.True(t, core.IsNotFound(err), err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.deviceID, device.ID)
+		})
+	}
+
+	_, err := LoginSMTP(core.WithUserActor(context.Background(), 1, false), LoginSMTPParams{IP: "192.168.1.1"})
+	assert.ErrorIs(t, err, core.ErrForbidden)
+}
+
+func TestProbeSerial(t *testing.T) {
+	ctx := context.Background()
+	useTestApp(t, App{DB: newTestDB(t, seedDevices(1, 2))})
+
+	conn := func(serial string) testRPCConn {
+		return testRPCConn{
+			"magicBox.getSerialNo": func(json.RawMessage) any {
+				return map[string]any{"sn": serial}
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		deviceID int64
+		conn     testRPCConn
+		// serials are the serial numbers of devices 1 and 2 after probing.
+		serials [2]string
+	}{
+		{name: "store", deviceID: 1, conn: conn(" SN1 "), serials: [2]string{"SN1", ""}},
+		{name: "taken by other device", deviceID: 2, conn: conn("SN1"), serials: [2]string{"SN1", ""}},
+		{name: "empty", deviceID: 2, conn: conn(""), serials: [2]string{"SN1", ""}},
+		{name: "not supported", deviceID: 2, conn: testRPCConn{}, serials: [2]string{"SN1", ""}},
+		{name: "changed", deviceID: 1, conn: conn("SN3"), serials: [2]string{"SN3", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, probeSerial(ctx, tt.deviceID, tt.conn))
+
+			for i, want := range tt.serials {
+				device, err := app.DB.C().DahuaGetDevice(ctx, int64(i+1))
+				require.NoError(t, err)
+				assert.Equal(t, want, device.Serial.String)
+			}
+		})
+	}
+}
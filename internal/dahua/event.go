@@ -3,6 +3,7 @@ package dahua
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"strings"
 	"time"
 
@@ -22,6 +23,19 @@ func DeleteEvents(ctx context.Context) error {
 
 const eventRuleCodeErrorMessage = "Code cannot be empty."
 
+// maxEventSnapshotCount is the maximum number of snapshots captured for a single event.
+const maxEventSnapshotCount = 10
+
+func checkEventRuleSnapshotCount(snapshotCount, preSnapshotCount int64) error {
+	if snapshotCount < 0 || snapshotCount > maxEventSnapshotCount {
+		return core.NewFieldError("SnapshotCount", fmt.Sprintf("Snapshot count must be between 0 and %d.", maxEventSnapshotCount))
+	}
+	if preSnapshotCount < 0 || preSnapshotCount > maxEventSnapshotCount {
+		return core.NewFieldError("PreSnapshotCount", fmt.Sprintf("Pre-event snapshot count must be between 0 and %d.", maxEventSnapshotCount))
+	}
+	return nil
+}
+
 func CreateEventRule(ctx context.Context, arg repo.DahuaCreateEventRuleParams) (int64, error) {
 	if _, err := core.AssertAdmin(ctx); err != nil {
 		return 0, err
@@ -34,7 +48,18 @@ func CreateEventRule(ctx context.Context, arg repo.DahuaCreateEventRuleParams) (
 		return 0, core.NewFieldError("Code", eventRuleCodeErrorMessage)
 	}
 
-	return app.DB.C().DahuaCreateEventRule(ctx, arg)
+	if err := checkEventRuleSnapshotCount(arg.SnapshotCount, arg.PreSnapshotCount); err != nil {
+		return 0, err
+	}
+
+	id, err := app.DB.C().DahuaCreateEventRule(ctx, arg)
+	if err != nil {
+		return 0, err
+	}
+
+	app.Hub.DahuaEventRulesUpdated(bus.DahuaEventRulesUpdated{})
+
+	return id, nil
 }
 
 func UpdateEventRule(ctx context.Context, arg repo.DahuaUpdateEventRuleParams) error {
@@ -54,7 +79,17 @@ func UpdateEventRule(ctx context.Context, arg repo.DahuaUpdateEventRuleParams) e
 		return core.NewFieldError("Code", eventRuleCodeErrorMessage)
 	}
 
-	return app.DB.C().DahuaUpdateEventRule(ctx, arg)
+	if err := checkEventRuleSnapshotCount(arg.SnapshotCount, arg.PreSnapshotCount); err != nil {
+		return err
+	}
+
+	if err := app.DB.C().DahuaUpdateEventRule(ctx, arg); err != nil {
+		return err
+	}
+
+	app.Hub.DahuaEventRulesUpdated(bus.DahuaEventRulesUpdated{})
+
+	return nil
 }
 
 func DeleteEventRule(ctx context.Context, id int64) error {
@@ -70,7 +105,13 @@ func DeleteEventRule(ctx context.Context, id int64) error {
 		return core.ErrForbidden
 	}
 
-	return app.DB.C().DahuaDeleteEventRule(ctx, model.ID)
+	if err := app.DB.C().DahuaDeleteEventRule(ctx, model.ID); err != nil {
+		return err
+	}
+
+	app.Hub.DahuaEventRulesUpdated(bus.DahuaEventRulesUpdated{})
+
+	return nil
 }
 
 func getEventRuleByEvent(ctx context.Context, deviceID int64, code string) (repo.DahuaEventRule, error) {
@@ -86,37 +127,57 @@ func getEventRuleByEvent(ctx context.Context, deviceID int64, code string) (repo
 	}
 
 	return repo.DahuaEventRule{
-		ID:         0,
-		Code:       code,
-		IgnoreDb:   res[0].IgnoreDb,
-		IgnoreLive: res[0].IgnoreLive,
-		IgnoreMqtt: res[0].IgnoreMqtt,
+		ID:               0,
+		Code:             code,
+		IgnoreDb:         res[0].IgnoreDb,
+		IgnoreLive:       res[0].IgnoreLive,
+		IgnoreMqtt:       res[0].IgnoreMqtt,
+		SnapshotCount:    res[0].SnapshotCount,
+		PreSnapshotCount: res[0].PreSnapshotCount,
 	}, nil
 }
 
+// suppressEventRule stops an event of a device in maintenance from being published to MQTT and live viewers.
+func suppressEventRule(rule repo.DahuaEventRule) repo.DahuaEventRule {
+	rule.IgnoreLive = true
+	rule.IgnoreMqtt = true
+	return rule
+}
+
 func publishEvent(ctx context.Context, deviceID int64, event dahuacgi.Event) error {
 	eventRule, err := getEventRuleByEvent(ctx, deviceID, event.Code)
 	if err != nil {
 		return err
 	}
 
+	now := time.Now()
+	maintenance, err := inMaintenance(ctx, deviceID, now)
+	if err != nil {
+		return err
+	}
+	if maintenance {
+		eventRule = suppressEventRule(eventRule)
+	}
+
 	v := repo.DahuaEvent{
-		ID:        0,
-		DeviceID:  deviceID,
-		Code:      event.Code,
-		Action:    event.Action,
-		Index:     int64(event.Index),
-		Data:      types.NewJSON(core.IgnoreError(json.MarshalIndent(event.Data, "", "  "))),
-		CreatedAt: types.NewTime(time.Now()),
+		ID:          0,
+		DeviceID:    deviceID,
+		Code:        event.Code,
+		Action:      event.Action,
+		Index:       int64(event.Index),
+		Data:        types.NewJSON(core.IgnoreError(json.MarshalIndent(event.Data, "", "  "))),
+		CreatedAt:   types.NewTime(now),
+		Maintenance: maintenance,
 	}
 	if !eventRule.IgnoreDb {
 		id, err := app.DB.C().DahuaCreateEvent(ctx, repo.DahuaCreateEventParams{
-			DeviceID:  v.DeviceID,
-			Code:      v.Code,
-			Action:    v.Action,
-			Index:     v.Index,
-			Data:      v.Data,
-			CreatedAt: v.CreatedAt,
+			DeviceID:    v.DeviceID,
+			Code:        v.Code,
+			Action:      v.Action,
+			Index:       v.Index,
+			Data:        v.Data,
+			CreatedAt:   v.CreatedAt,
+			Maintenance: v.Maintenance,
 		})
 		if err != nil {
 			return err
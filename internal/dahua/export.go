@@ -0,0 +1,255 @@
+package dahua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/ffmpeg"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/sqlite"
+	"github.com/ItsNotGoodName/ipcmanview/internal/types"
+)
+
+var ErrNoFiles = fmt.Errorf("no files")
+
+// ErrExportGap is returned when the recordings of an export have gaps between them.
+var ErrExportGap = errors.New("recordings have gaps")
+
+const (
+	maxExportDuration     = 24 * time.Hour
+	exportProgressDelay   = 1 * time.Second
+	exportFileInputFormat = "dhav"
+	// exportMaxFileGap is the largest gap between recordings that are still remuxed as one.
+	exportMaxFileGap = 2 * time.Second
+)
+
+type CreateExportParams struct {
+	DeviceID int64
+	Channel  int64
+	Start    time.Time
+	End      time.Time
+}
+
+// CreateExport records a clip of the device's recordings between start and end that will be exported by RunExport.
+// It is created in the transaction so the task that runs it can be enqueued with it.
+func CreateExport(ctx context.Context, tx sqlite.Tx, arg CreateExportParams) (int64, error) {
+	ok, err := Level(ctx, arg.DeviceID, levelDefault)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, core.ErrForbidden
+	}
+
+	if !arg.Start.Before(arg.End) {
+		return 0, core.NewFieldError("End", "End must be after start.")
+	}
+	if arg.End.Sub(arg.Start) > maxExportDuration {
+		return 0, core.NewFieldError("End", fmt.Sprintf("Clip must be shorter than %s.", maxExportDuration))
+	}
+
+	return tx.C().DahuaCreateExport(ctx, repo.DahuaCreateExportParams{
+		DeviceID:  arg.DeviceID,
+		Channel:   arg.Channel,
+		StartTime: types.NewTime(arg.Start),
+		EndTime:   types.NewTime(arg.End),
+		CreatedAt: types.NewTime(time.Now()),
+	})
+}
+
+// RunExport remuxes the recordings of the export into an MP4 saved to the afero file system.
+// Progress is published on the bus while it runs.
+func RunExport(ctx context.Context, id int64) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	export, err := app.DB.C().DahuaGetExport(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	exportErr := runExport(ctx, export)
+
+	var errString string
+	if exportErr != nil {
+		errString = exportErr.Error()
+	}
+	if err := app.DB.C().DahuaUpdateExportCompleted(ctx, repo.DahuaUpdateExportCompletedParams{
+		Error:       errString,
+		CompletedAt: types.NullTime{Time: types.NewTime(time.Now()), Valid: true},
+		ID:          id,
+	}); err != nil {
+		return err
+	}
+
+	app.Hub.DahuaExportCompleted(bus.DahuaExportCompleted{
+		DeviceID: export.DeviceID,
+		ExportID: export.ID,
+		Error:    exportErr,
+	})
+
+	return exportErr
+}
+
+func runExport(ctx context.Context, export repo.DahuaExport) error {
+	files, err := app.DB.C().DahuaListFilesForExport(ctx, repo.DahuaListFilesForExportParams{
+		DeviceID: export.DeviceID,
+		Channel:  export.Channel,
+		Start:    export.StartTime,
+		End:      export.EndTime,
+	})
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return ErrNoFiles
+	}
+
+	offset, duration, err := exportRange(export.StartTime.Time, export.EndTime.Time, files)
+	if err != nil {
+		return err
+	}
+
+	client, err := GetClient(ctx, export.DeviceID)
+	if err != nil {
+		return err
+	}
+
+	// A previous attempt that was interrupted leaves its file behind
+	if err := deleteExportFile(ctx, export.ID); err != nil {
+		return err
+	}
+
+	aferoFile, err := createAferoFile(ctx, aferoForeignKeys{ExportID: export.ID}, newAferoFileName("mp4"))
+	if err != nil {
+		return err
+	}
+
+	if err := remuxExport(ctx, export, files, offset, duration, client, aferoFile); err != nil {
+		return errors.Join(err, aferoFile.Delete(context.WithoutCancel(ctx)))
+	}
+
+	return aferoFile.Close()
+}
+
+// exportRange returns where the clip starts in the recordings and how long it is.
+// The recordings are remuxed as one stream so they must be sorted and not have gaps between them.
+func exportRange(start, end time.Time, files []repo.DahuaFile) (offset, duration time.Duration, err error) {
+	for i := 1; i < len(files); i++ {
+		if files[i].StartTime.Sub(files[i-1].EndTime.Time) > exportMaxFileGap {
+			return 0, 0, fmt.Errorf("%w: %s to %s", ErrExportGap, files[i-1].EndTime.Format(time.RFC3339), files[i].StartTime.Format(time.RFC3339))
+		}
+	}
+
+	// Trim the clip to the recordings
+	first, last := files[0].StartTime.Time, files[len(files)-1].EndTime.Time
+	if start.After(first) {
+		offset = start.Sub(first)
+	} else {
+		start = first
+	}
+	if end.After(last) {
+		end = last
+	}
+
+	return offset, end.Sub(start), nil
+}
+
+func remuxExport(ctx context.Context, export repo.DahuaExport, files []repo.DahuaFile, offset, duration time.Duration, client Client, aferoFile aferoFile) error {
+	rd, wr := io.Pipe()
+	go func() {
+		wr.CloseWithError(copyFiles(ctx, wr, client, files))
+	}()
+	defer rd.Close()
+
+	var lastProgress time.Time
+	if err := ffmpeg.Remux(ctx, rd, aferoFile, ffmpeg.RemuxConfig{
+		InputFormat: exportFileInputFormat,
+		Offset:      offset,
+		Duration:    duration,
+		Progress: func(position time.Duration) {
+			if time.Since(lastProgress) < exportProgressDelay {
+				return
+			}
+			lastProgress = time.Now()
+
+			app.Hub.DahuaExportProgress(bus.DahuaExportProgress{
+				DeviceID: export.DeviceID,
+				ExportID: export.ID,
+				Progress: min(float64(position)/float64(duration), 1),
+			})
+		},
+	}); err != nil {
+		return err
+	}
+
+	return aferoFile.Ready(ctx)
+}
+
+func copyFiles(ctx context.Context, w io.Writer, client Client, files []repo.DahuaFile) error {
+	for _, file := range files {
+		err := func() error {
+			rd, err := FileReadCloser(ctx, client, file)
+			if err != nil {
+				return err
+			}
+			defer rd.Close()
+
+			_, err = io.Copy(w, rd)
+			return err
+		}()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemuxFile writes the recorded file as an MP4 without re-encoding its video.
+func RemuxFile(ctx context.Context, w io.Writer, client Client, file repo.DahuaFile) error {
+	rd, err := FileReadCloser(ctx, client, file)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	return ffmpeg.Remux(ctx, rd, w, ffmpeg.RemuxConfig{
+		InputFormat: exportFileInputFormat,
+	})
+}
+
+func ListExports(ctx context.Context, deviceID int64) ([]repo.DahuaListExportsByDeviceRow, error) {
+	ok, err := Level(ctx, deviceID, levelDefault)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, core.ErrForbidden
+	}
+
+	return app.DB.C().DahuaListExportsByDevice(ctx, deviceID)
+}
+
+// deleteExportFile deletes the export's file if it has one.
+func deleteExportFile(ctx context.Context, exportID int64) error {
+	v, err := app.DB.C().DahuaGetAferoFileByExport(ctx, core.NewNullInt64(exportID))
+	if err != nil {
+		if core.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if err := app.AFS.Remove(v.Name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return app.DB.C().DahuaDeleteAferoFile(ctx, v.ID)
+}
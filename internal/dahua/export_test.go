@@ -0,0 +1,48 @@
+package dahua
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportRange(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time {
+		return base.Add(time.Duration(minutes) * time.Minute)
+	}
+	file := func(start, end int) repo.DahuaFile {
+		return repo.DahuaFile{StartTime: types.NewTime(at(start)), EndTime: types.NewTime(at(end))}
+	}
+
+	tests := []struct {
+		name     string
+		start    int
+		end      int
+		files    []repo.DahuaFile
+		offset   time.Duration
+		duration time.Duration
+		gap      bool
+	}{
+		{name: "inside one file", start: 5, end: 10, files: []repo.DahuaFile{file(0, 30)}, offset: 5 * time.Minute, duration: 5 * time.Minute},
+		{name: "across files", start: 20, end: 40, files: []repo.DahuaFile{file(0, 30), file(30, 60)}, offset: 20 * time.Minute, duration: 20 * time.Minute},
+		{name: "before first file", start: 0, end: 20, files: []repo.DahuaFile{file(10, 30)}, offset: 0, duration: 10 * time.Minute},
+		{name: "after last file", start: 20, end: 60, files: []repo.DahuaFile{file(10, 30)}, offset: 10 * time.Minute, duration: 10 * time.Minute},
+		{name: "gap", start: 0, end: 60, files: []repo.DahuaFile{file(0, 20), file(30, 60)}, gap: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, duration, err := exportRange(at(tt.start), at(tt.end), tt.files)
+			if tt.gap {
+				assert.ErrorIs(t, err, ErrExportGap)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.offset, offset)
+			assert.Equal(t, tt.duration, duration)
+		})
+	}
+}
@@ -17,6 +17,7 @@ func init() {
 
 var FeatureList []Feature = []Feature{
 	{models.DahuaFeature_Camera, "camera", "Camera", "The device has a camera."},
+	{models.DahuaFeature_NVR, "nvr", "NVR", "The device is a network video recorder with multiple channels."},
 }
 
 type Feature struct {
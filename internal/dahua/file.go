@@ -2,9 +2,11 @@ package dahua
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"net"
 	"net/url"
+	"os"
 	"strings"
 
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
@@ -31,12 +33,17 @@ func FileFTPReadCloser(ctx context.Context, filePath string) (io.ReadCloser, err
 		return nil, err
 	}
 
+	password, err := app.SecretKey.Decrypt(dest.Password)
+	if err != nil {
+		return nil, err
+	}
+
 	c, err := ftp.Dial(core.Address(dest.ServerAddress, int(dest.Port)), ftp.DialWithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
 
-	err = c.Login(dest.Username, dest.Password)
+	err = c.Login(dest.Username, password)
 	if err != nil {
 		return nil, err
 	}
@@ -70,9 +77,14 @@ func FileSFTPReadCloser(ctx context.Context, filePath string) (io.ReadCloser, er
 		return nil, err
 	}
 
+	password, err := app.SecretKey.Decrypt(dest.Password)
+	if err != nil {
+		return nil, err
+	}
+
 	conn, err := ssh.Dial("tcp", core.Address(dest.ServerAddress, int(dest.Port)), &ssh.ClientConfig{
 		User: dest.Username,
-		Auth: []ssh.AuthMethod{ssh.Password(dest.Password)},
+		Auth: []ssh.AuthMethod{ssh.Password(password)},
 		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
 			// TODO: check public key
 			return nil
@@ -106,6 +118,37 @@ func FileLocalReadCloser(ctx context.Context, client Client, filePath string) (i
 	return client.File.Do(ctx, dahuarpc.LoadFileURL(client.Conn.URL, filePath), dahuarpc.Cookie(client.RPC.Session(ctx)))
 }
 
+// FileReadCloser opens the file from the afero file system if it is cached, otherwise from its storage.
+func FileReadCloser(ctx context.Context, client Client, file repo.DahuaFile) (io.ReadCloser, error) {
+	aferoFile, err := app.DB.C().DahuaGetAferoFileByFileID(ctx, core.Int64ToNullInt64(file.ID))
+	if err == nil {
+		// File from cache
+		rd, err := app.AFS.Open(aferoFile.Name)
+		if err == nil {
+			return rd, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	} else if !core.IsNotFound(err) {
+		return nil, err
+	}
+
+	switch file.Storage {
+	case models.StorageLocal:
+		// File from device
+		return FileLocalReadCloser(ctx, client, file.FilePath)
+	case models.StorageFTP:
+		// File from FTP
+		return FileFTPReadCloser(ctx, file.FilePath)
+	case models.StorageSFTP:
+		// File from SFTP
+		return FileSFTPReadCloser(ctx, file.FilePath)
+	}
+
+	return nil, fmt.Errorf("storage not supported: %s", file.FilePath)
+}
+
 // FileLocalDownload downloads file from device and saves it to the afero file system.
 func FileLocalDownload(ctx context.Context, client Client, fileID int64, fileFilePath, fileType string) error {
 	rd, err := FileLocalReadCloser(ctx, client, fileFilePath)
@@ -0,0 +1,463 @@
+package dahua
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system/action"
+	"github.com/ItsNotGoodName/ipcmanview/internal/types"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/ssq"
+	sq "github.com/Masterminds/squirrel"
+)
+
+var ErrGuestLinkViewsExceeded = errors.New("guest link has no views left")
+
+// levelGuestLink is the level needed to share a device with guest links.
+const levelGuestLink = models.DahuaPermissionLevel_Operator
+
+const maxGuestLinkDuration = 30 * 24 * time.Hour
+
+// guestLinkViewDuration is how long the media of a guest link can be accessed after its last counted view.
+const guestLinkViewDuration = time.Hour
+
+func generateGuestLinkToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashGuestLinkToken hashes the token for storage.
+// Tokens are random enough that a fast hash is sufficient.
+func hashGuestLinkToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+type _GuestLink struct {
+	Name     string `validate:"gte=1,lte=64"`
+	Channel  int64  `validate:"gte=1"`
+	MaxViews int64  `validate:"gte=0"`
+}
+
+type CreateGuestLinkParams struct {
+	DeviceID int64
+	Name     string
+	// Channel starts at 1 like the channels of streams.
+	Channel int64
+	Live    bool
+	FileIDs []int64
+	// Start and End share the channel's recordings between them when they are set.
+	Start     time.Time
+	End       time.Time
+	MaxViews  int64
+	ExpiredAt time.Time
+}
+
+// CreateGuestLink creates a link that shares the device without an account and returns the token of the link.
+// The token is only returned here because only its hash is stored.
+func CreateGuestLink(ctx context.Context, arg CreateGuestLinkParams) (int64, string, error) {
+	actor := core.UseActor(ctx)
+	ok, err := Level(ctx, arg.DeviceID, levelGuestLink)
+	if err != nil {
+		return 0, "", err
+	}
+	if !ok {
+		return 0, "", core.ErrForbidden
+	}
+
+	model := _GuestLink{
+		Name:     strings.TrimSpace(arg.Name),
+		Channel:  arg.Channel,
+		MaxViews: arg.MaxViews,
+	}
+	if err := core.ValidateStruct(ctx, model); err != nil {
+		return 0, "", err
+	}
+
+	timeRange := !arg.Start.IsZero() || !arg.End.IsZero()
+	if timeRange && !arg.Start.Before(arg.End) {
+		return 0, "", core.NewFieldError("End", "End must be after start.")
+	}
+	if !arg.Live && len(arg.FileIDs) == 0 && !timeRange {
+		return 0, "", core.NewFieldError("Live", "Live view or recordings must be shared.")
+	}
+
+	now := time.Now()
+	if !arg.ExpiredAt.After(now) {
+		return 0, "", core.NewFieldError("ExpiredAt", "Expiration must be in the future.")
+	}
+	if arg.ExpiredAt.Sub(now) > maxGuestLinkDuration {
+		return 0, "", core.NewFieldError("ExpiredAt", fmt.Sprintf("Expiration must be within %s.", maxGuestLinkDuration))
+	}
+
+	fileIDs := slices.Clone(arg.FileIDs)
+	slices.Sort(fileIDs)
+	fileIDs = slices.Compact(fileIDs)
+	for _, fileID := range fileIDs {
+		file, err := app.DB.C().DahuaGetFile(ctx, fileID)
+		if err != nil && !core.IsNotFound(err) {
+			return 0, "", err
+		}
+		if err != nil || file.DeviceID != arg.DeviceID {
+			return 0, "", core.NewFieldError("FileIDs", "Recording not found.")
+		}
+	}
+
+	token, err := generateGuestLinkToken()
+	if err != nil {
+		return 0, "", err
+	}
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	id, err := tx.C().DahuaCreateGuestLink(ctx, repo.DahuaCreateGuestLinkParams{
+		DeviceID:  arg.DeviceID,
+		UserID:    core.Int64ToNullInt64(actor.UserID),
+		Name:      model.Name,
+		TokenHash: hashGuestLinkToken(token),
+		Channel:   model.Channel,
+		Live:      arg.Live,
+		StartTime: types.NullTime{Time: types.NewTime(arg.Start), Valid: timeRange},
+		EndTime:   types.NullTime{Time: types.NewTime(arg.End), Valid: timeRange},
+		MaxViews:  model.MaxViews,
+		CreatedAt: types.NewTime(now),
+		ExpiredAt: types.NewTime(arg.ExpiredAt),
+	})
+	if err != nil {
+		return 0, "", err
+	}
+
+	for _, fileID := range fileIDs {
+		if err := tx.C().DahuaCreateGuestLinkFile(ctx, repo.DahuaCreateGuestLinkFileParams{
+			GuestLinkID: id,
+			FileID:      fileID,
+		}); err != nil {
+			return 0, "", err
+		}
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.DahuaGuestLinkCreated.Create(id)); err != nil {
+		return 0, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, "", err
+	}
+
+	return id, token, nil
+}
+
+func ListGuestLinks(ctx context.Context, deviceID int64) ([]repo.DahuaListGuestLinksByDeviceRow, error) {
+	ok, err := Level(ctx, deviceID, levelGuestLink)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, core.ErrForbidden
+	}
+
+	return app.DB.C().DahuaListGuestLinksByDevice(ctx, deviceID)
+}
+
+// RevokeGuestLink stops the guest link from working.
+func RevokeGuestLink(ctx context.Context, id int64) error {
+	link, err := app.DB.C().DahuaGetGuestLink(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	ok, err := Level(ctx, link.DeviceID, levelGuestLink)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return core.ErrForbidden
+	}
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.C().DahuaRevokeGuestLink(ctx, repo.DahuaRevokeGuestLinkParams{
+		RevokedAt: types.NullTime{Time: types.NewTime(time.Now()), Valid: true},
+		ID:        id,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return nil
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.DahuaGuestLinkRevoked.Create(id)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// guestLinkViewable returns true if the guest link has views left or its last counted view is recent enough to still access its media.
+func guestLinkViewable(link repo.DahuaGuestLink, now time.Time) bool {
+	if link.MaxViews == 0 || link.Views < link.MaxViews {
+		return true
+	}
+	return link.LastViewedAt.Valid && now.Sub(link.LastViewedAt.Time.Time) < guestLinkViewDuration
+}
+
+// GetGuestLinkForContext returns what the guest link shares if it has not expired, been revoked, or used up its views.
+func GetGuestLinkForContext(ctx context.Context, token string) (core.ActorGuest, error) {
+	now := time.Now()
+	link, err := app.DB.C().DahuaGetGuestLinkForContext(ctx, repo.DahuaGetGuestLinkForContextParams{
+		TokenHash: hashGuestLinkToken(token),
+		Now:       types.NewTime(now),
+	})
+	if err != nil {
+		return core.ActorGuest{}, err
+	}
+	if !guestLinkViewable(link, now) {
+		return core.ActorGuest{}, ErrGuestLinkViewsExceeded
+	}
+
+	fileIDs, err := app.DB.C().DahuaListGuestLinkFileIDs(ctx, link.ID)
+	if err != nil {
+		return core.ActorGuest{}, err
+	}
+
+	guest := core.ActorGuest{
+		LinkID:   link.ID,
+		DeviceID: link.DeviceID,
+		Channel:  link.Channel,
+		Live:     link.Live,
+		FileIDs:  fileIDs,
+	}
+	if link.StartTime.Valid && link.EndTime.Valid {
+		guest.Start = link.StartTime.Time.Time
+		guest.End = link.EndTime.Time.Time
+	}
+
+	return guest, nil
+}
+
+func useGuest(ctx context.Context) (core.ActorGuest, error) {
+	actor := core.UseActor(ctx)
+	if actor.Guest == nil {
+		return core.ActorGuest{}, fmt.Errorf("%w: not a guest", core.ErrForbidden)
+	}
+	return *actor.Guest, nil
+}
+
+// ViewGuestLink counts a view of the actor's guest link.
+func ViewGuestLink(ctx context.Context) error {
+	guest, err := useGuest(ctx)
+	if err != nil {
+		return err
+	}
+
+	rows, err := app.DB.C().DahuaViewGuestLink(ctx, repo.DahuaViewGuestLinkParams{
+		LastViewedAt: types.NullTime{Time: types.NewTime(time.Now()), Valid: true},
+		ID:           guest.LinkID,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrGuestLinkViewsExceeded
+	}
+
+	return nil
+}
+
+// CreateGuestAccessEvent records a request made with the actor's guest link in the audit log.
+func CreateGuestAccessEvent(ctx context.Context, method, path string, denied bool) error {
+	guest, err := useGuest(ctx)
+	if err != nil {
+		return err
+	}
+
+	return system.CreateEvent(ctx, app.DB.C(), action.DahuaGuestLinkAccessed.Create(action.DahuaGuestAccess{
+		LinkID:   guest.LinkID,
+		DeviceID: guest.DeviceID,
+		Method:   method,
+		Path:     path,
+		Denied:   denied,
+	}))
+}
+
+type GuestLink struct {
+	repo.DahuaGuestLink
+	DeviceName string
+	// Stream is the stream of the shared live view.
+	Stream *repo.DahuaStream
+	Files  []repo.DahuaFile
+}
+
+// GetGuestLink returns everything shared by the actor's guest link.
+func GetGuestLink(ctx context.Context) (GuestLink, error) {
+	guest, err := useGuest(ctx)
+	if err != nil {
+		return GuestLink{}, err
+	}
+
+	link, err := app.DB.C().DahuaGetGuestLink(ctx, guest.LinkID)
+	if err != nil {
+		return GuestLink{}, err
+	}
+
+	device, err := GetDevice(core.WithSystemActor(ctx), guest.DeviceID)
+	if err != nil {
+		return GuestLink{}, err
+	}
+
+	var stream *repo.DahuaStream
+	if guest.Live {
+		v, err := getGuestLiveStream(ctx, guest)
+		if err != nil && !core.IsNotFound(err) {
+			return GuestLink{}, err
+		}
+		if err == nil {
+			stream = &v
+		}
+	}
+
+	files, err := app.DB.C().DahuaListFilesForGuestLink(ctx, repo.DahuaListFilesForGuestLinkParams{
+		DeviceID:    guest.DeviceID,
+		GuestLinkID: guest.LinkID,
+		Channel:     guest.Channel - 1,
+		Start:       types.NewTime(guest.Start),
+		End:         types.NewTime(guest.End),
+	})
+	if err != nil {
+		return GuestLink{}, err
+	}
+
+	return GuestLink{
+		DahuaGuestLink: link,
+		DeviceName:     device.Name,
+		Stream:         stream,
+		Files:          files,
+	}, nil
+}
+
+// guestFileShared returns true if the recording is in the guest link's files or time range.
+// Recording channels start at 0 unlike the guest link's channel.
+func guestFileShared(guest core.ActorGuest, file repo.DahuaFile) bool {
+	if file.DeviceID != guest.DeviceID {
+		return false
+	}
+	if slices.Contains(guest.FileIDs, file.ID) {
+		return true
+	}
+	return !guest.Start.IsZero() &&
+		file.Channel+1 == guest.Channel &&
+		file.StartTime.Before(guest.End) &&
+		guest.Start.Before(file.EndTime.Time)
+}
+
+// GetGuestFile returns the recording and the client of its device if the recording is shared by the actor's guest link.
+func GetGuestFile(ctx context.Context, fileID int64) (Client, repo.DahuaFile, error) {
+	guest, err := useGuest(ctx)
+	if err != nil {
+		return Client{}, repo.DahuaFile{}, err
+	}
+
+	file, err := app.DB.C().DahuaGetFile(ctx, fileID)
+	if err != nil {
+		if core.IsNotFound(err) {
+			return Client{}, repo.DahuaFile{}, core.ErrNotFound
+		}
+		return Client{}, repo.DahuaFile{}, err
+	}
+	if !guestFileShared(guest, file) {
+		return Client{}, repo.DahuaFile{}, fmt.Errorf("%w: recording is not shared", core.ErrForbidden)
+	}
+
+	client, err := GetClient(core.WithSystemActor(ctx), file.DeviceID)
+	if err != nil {
+		return Client{}, repo.DahuaFile{}, err
+	}
+
+	return client, file, nil
+}
+
+// getGuestLiveStream returns the main stream of the guest link's channel.
+func getGuestLiveStream(ctx context.Context, guest core.ActorGuest) (repo.DahuaStream, error) {
+	if !guest.Live {
+		return repo.DahuaStream{}, fmt.Errorf("%w: live view is not shared", core.ErrForbidden)
+	}
+
+	sb := sq.
+		Select("*").
+		From("dahua_streams").
+		Where(sq.Eq{
+			"device_id": guest.DeviceID,
+			"channel":   guest.Channel,
+		}).
+		OrderBy("subtype").
+		Limit(1)
+
+	var res repo.DahuaStream
+	if err := ssq.QueryOne(ctx, app.DB, &res, sb); err != nil {
+		if core.IsNotFound(err) {
+			return repo.DahuaStream{}, core.ErrNotFound
+		}
+		return repo.DahuaStream{}, err
+	}
+
+	return res, nil
+}
+
+// OpenGuestLiveStream is OpenLiveStream for the live view shared by the actor's guest link.
+func OpenGuestLiveStream(ctx context.Context) (string, error) {
+	guest, err := useGuest(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	stream, err := getGuestLiveStream(ctx, guest)
+	if err != nil {
+		return "", err
+	}
+
+	return OpenLiveStream(core.WithSystemActor(ctx), stream.ID)
+}
+
+// GetGuestLiveStreamPath returns the MediaMTX path of the live view shared by the actor's guest link.
+func GetGuestLiveStreamPath(ctx context.Context) (string, error) {
+	guest, err := useGuest(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	stream, err := getGuestLiveStream(ctx, guest)
+	if err != nil {
+		return "", err
+	}
+
+	path := app.MediamtxConfig.DahuaEmbedPath(stream)
+	if path == "" {
+		return "", core.ErrNotFound
+	}
+
+	return path, nil
+}
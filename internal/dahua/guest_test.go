@@ -0,0 +1,108 @@
+package dahua
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuestFileShared(t *testing.T) {
+	start := time.Date(2024, 3, 26, 12, 0, 0, 0, time.UTC)
+	file := func(id, deviceID, channel int64, offset time.Duration) repo.DahuaFile {
+		return repo.DahuaFile{
+			ID:        id,
+			DeviceID:  deviceID,
+			Channel:   channel,
+			StartTime: types.NewTime(start.Add(offset)),
+			EndTime:   types.NewTime(start.Add(offset + 30*time.Minute)),
+		}
+	}
+	guest := core.ActorGuest{
+		DeviceID: 1,
+		Channel:  1,
+		FileIDs:  []int64{10},
+		Start:    start,
+		End:      start.Add(time.Hour),
+	}
+
+	tests := []struct {
+		name string
+		file repo.DahuaFile
+		want bool
+	}{
+		{name: "listed file", file: file(10, 1, 3, -24*time.Hour), want: true},
+		{name: "listed file on other device", file: file(10, 2, 0, 0), want: false},
+		{name: "inside time range", file: file(11, 1, 0, 15*time.Minute), want: true},
+		{name: "overlaps start of time range", file: file(12, 1, 0, -15*time.Minute), want: true},
+		{name: "before time range", file: file(13, 1, 0, -30*time.Minute), want: false},
+		{name: "after time range", file: file(14, 1, 0, time.Hour), want: false},
+		{name: "other channel", file: file(15, 1, 1, 0), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, guestFileShared(guest, tt.file))
+		})
+	}
+
+	guest.Start, guest.End = time.Time{}, time.Time{}
+	assert.False(t, guestFileShared(guest, file(11, 1, 0, 15*time.Minute)))
+}
+
+func TestGuestLinkViewable(t *testing.T) {
+	now := time.Date(2024, 3, 26, 12, 0, 0, 0, time.UTC)
+	viewedAt := func(offset time.Duration) types.NullTime {
+		return types.NullTime{Time: types.NewTime(now.Add(offset)), Valid: true}
+	}
+
+	tests := []struct {
+		name string
+		link repo.DahuaGuestLink
+		want bool
+	}{
+		{name: "unlimited", link: repo.DahuaGuestLink{MaxViews: 0, Views: 100}, want: true},
+		{name: "views left", link: repo.DahuaGuestLink{MaxViews: 2, Views: 1}, want: true},
+		{name: "used up without view", link: repo.DahuaGuestLink{MaxViews: 1, Views: 1}, want: false},
+		{name: "used up after recent view", link: repo.DahuaGuestLink{MaxViews: 1, Views: 1, LastViewedAt: viewedAt(-time.Minute)}, want: true},
+		{name: "used up after old view", link: repo.DahuaGuestLink{MaxViews: 1, Views: 1, LastViewedAt: viewedAt(-guestLinkViewDuration)}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, guestLinkViewable(tt.link, now))
+		})
+	}
+}
+
+func TestGetGuestLinkForContext(t *testing.T) {
+	db := newTestDB(t, seedDevices(1))
+	useTestApp(t, App{DB: db})
+	ctx := context.Background()
+
+	old := types.NewTime(time.Now().Add(-2 * guestLinkViewDuration))
+	expiredAt := types.NewTime(time.Now().Add(time.Hour))
+	for _, link := range []repo.DahuaGuestLink{
+		{ID: 1, TokenHash: hashGuestLinkToken("unlimited"), MaxViews: 0, Views: 5},
+		{ID: 2, TokenHash: hashGuestLinkToken("used-up"), MaxViews: 1, Views: 1, LastViewedAt: types.NullTime{Time: old, Valid: true}},
+	} {
+		_, err := db.ExecContext(ctx, `INSERT INTO dahua_guest_links
+			(id, device_id, name, token_hash, channel, live, max_views, views, last_viewed_at, created_at, expired_at)
+			VALUES (?, ?, '', ?, 1, true, ?, ?, ?, ?, ?)`,
+			link.ID, 1, link.TokenHash, link.MaxViews, link.Views, link.LastViewedAt, old, expiredAt)
+		require.NoError(t, err)
+	}
+
+	guest, err := GetGuestLinkForContext(ctx, "unlimited")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), guest.LinkID)
+
+	_, err = GetGuestLinkForContext(ctx, "used-up")
+	assert.ErrorIs(t, err, ErrGuestLinkViewsExceeded)
+
+	_, err = GetGuestLinkForContext(ctx, "missing")
+	assert.True(t, core.IsNotFound(err))
+}
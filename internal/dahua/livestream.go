@@ -0,0 +1,257 @@
+package dahua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/ffmpeg"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/sutureext"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrLiveStreamerDisabled = errors.New("embedded live streaming is disabled")
+
+const (
+	LiveStreamPlaylist = "index.m3u8"
+
+	liveStreamIdleTimeout    = 30 * time.Second
+	liveStreamPlaylistWait   = 15 * time.Second
+	liveStreamSegmentLength  = 1 * time.Second
+	liveStreamPlaylistLength = 6
+)
+
+// NewLiveStreamer creates a live streamer that writes HLS playlists and segments under dir.
+func NewLiveStreamer(dir string) *LiveStreamer {
+	return &LiveStreamer{
+		dir:      dir,
+		sessions: make(map[string]*liveStreamSession),
+	}
+}
+
+// LiveStreamer serves live streams and recordings without MediaMTX by running ffmpeg against the device's RTSP URLs.
+// Sessions are started on demand and stopped after they have not been accessed for a while.
+// Only regular HLS is served, low-latency HLS and WebRTC require MediaMTX.
+type LiveStreamer struct {
+	dir string
+
+	mu       sync.Mutex
+	closed   bool
+	sessions map[string]*liveStreamSession
+}
+
+type liveStreamSession struct {
+	dir        string
+	event      bool
+	cancel     context.CancelFunc
+	done       chan struct{}
+	err        error
+	lastAccess time.Time
+}
+
+// exited returns true if ffmpeg has exited and the session should be restarted on access.
+// Recordings are kept after they finish so that the full playlist can still be served.
+func (s *liveStreamSession) exited() bool {
+	select {
+	case <-s.done:
+		return !s.event || s.err != nil
+	default:
+		return false
+	}
+}
+
+func (*LiveStreamer) String() string {
+	return "dahua.LiveStreamer"
+}
+
+func (l *LiveStreamer) Serve(ctx context.Context) error {
+	l.mu.Lock()
+	l.closed = false
+	l.mu.Unlock()
+
+	t := time.NewTicker(5 * time.Second)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			l.mu.Lock()
+			l.closed = true
+			sessions := l.sessions
+			l.sessions = make(map[string]*liveStreamSession)
+			l.mu.Unlock()
+
+			for key, session := range sessions {
+				l.stop(key, session)
+			}
+
+			return sutureext.SanitizeError(ctx, ctx.Err())
+		case <-t.C:
+			stopped := make(map[string]*liveStreamSession)
+			l.mu.Lock()
+			for key, session := range l.sessions {
+				if session.exited() || time.Since(session.lastAccess) > liveStreamIdleTimeout {
+					delete(l.sessions, key)
+					stopped[key] = session
+				}
+			}
+			l.mu.Unlock()
+
+			for key, session := range stopped {
+				l.stop(key, session)
+			}
+		}
+	}
+}
+
+// stop stops the session after it has been removed from the sessions.
+// It waits for ffmpeg to exit so it must be called without the lock held unless ffmpeg has already exited.
+func (l *LiveStreamer) stop(key string, session *liveStreamSession) {
+	session.cancel()
+	<-session.done
+	if err := os.RemoveAll(session.dir); err != nil {
+		log.Err(err).Str("service", l.String()).Str("key", key).Msg("Failed to remove live stream directory")
+	}
+}
+
+// open returns the live stream session for key, starting it if it is not running.
+func (l *LiveStreamer) open(key, rtspURL string, cfg ffmpeg.HLSConfig) (*liveStreamSession, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil, ErrLiveStreamerDisabled
+	}
+
+	if session, ok := l.sessions[key]; ok {
+		if !session.exited() {
+			session.lastAccess = time.Now()
+			return session, nil
+		}
+
+		// ffmpeg has already exited so this does not wait
+		delete(l.sessions, key)
+		l.stop(key, session)
+	}
+
+	// Each session gets its own directory so stopping an old session does not remove the files of a new one
+	dir, err := os.MkdirTemp(l.dir, key+"-")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &liveStreamSession{
+		dir:        dir,
+		event:      cfg.Event,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		lastAccess: time.Now(),
+	}
+	go func() {
+		defer close(session.done)
+		err := ffmpeg.HLS(ctx, rtspURL, dir, cfg)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Err(err).Str("service", l.String()).Str("key", key).Msg("Live stream exited")
+			session.err = err
+		}
+	}()
+	l.sessions[key] = session
+
+	return session, nil
+}
+
+// wait blocks until the session's playlist has been written.
+func (l *LiveStreamer) wait(ctx context.Context, session *liveStreamSession) error {
+	playlist := filepath.Join(session.dir, LiveStreamPlaylist)
+	timeout := time.After(liveStreamPlaylistWait)
+	t := time.NewTicker(250 * time.Millisecond)
+	defer t.Stop()
+	for {
+		exists, err := core.FileExists(playlist)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-session.done:
+			if session.err != nil {
+				return session.err
+			}
+			return fmt.Errorf("live stream exited")
+		case <-timeout:
+			return fmt.Errorf("timed out waiting for live stream")
+		case <-t.C:
+		}
+	}
+}
+
+// EmbeddedStreaming returns true if streams are served by the embedded live streamer instead of MediaMTX.
+func EmbeddedStreaming() bool {
+	return app.LiveStreamer != nil
+}
+
+// OpenLiveStream starts the embedded live stream if needed and returns the directory containing its HLS files.
+// It waits until the playlist has been written.
+func OpenLiveStream(ctx context.Context, streamID int64) (string, error) {
+	if app.LiveStreamer == nil {
+		return "", ErrLiveStreamerDisabled
+	}
+
+	stream, err := app.DB.C().DahuaGetStream(ctx, streamID)
+	if err != nil {
+		if core.IsNotFound(err) {
+			return "", core.ErrNotFound
+		}
+		return "", err
+	}
+
+	ok, err := Level(ctx, stream.DeviceID, levelDefault)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", core.ErrForbidden
+	}
+
+	device, err := GetDevice(ctx, stream.DeviceID)
+	if err != nil {
+		return "", err
+	}
+
+	client, err := GetClient(ctx, stream.DeviceID)
+	if err != nil {
+		return "", err
+	}
+
+	session, err := app.LiveStreamer.open(fmt.Sprintf("stream-%d", streamID), GetLiveRTSPURL(GetLiveRTSPURLParams{
+		Username: client.Conn.Username,
+		Password: client.password,
+		Host:     device.Ip,
+		Port:     554,
+		Channel:  int(stream.Channel),
+		Subtype:  int(stream.Subtype),
+	}), ffmpeg.HLSConfig{
+		SegmentDuration: liveStreamSegmentLength,
+		ListSize:        liveStreamPlaylistLength,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := app.LiveStreamer.wait(ctx, session); err != nil {
+		return "", err
+	}
+
+	return session.dir, nil
+}
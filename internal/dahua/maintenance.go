@@ -0,0 +1,142 @@
+package dahua
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system/action"
+	"github.com/ItsNotGoodName/ipcmanview/internal/types"
+)
+
+type _MaintenanceWindow struct {
+	Reason string `validate:"lte=256"`
+}
+
+type CreateMaintenanceWindowParams struct {
+	// DeviceID is the device in maintenance, it cannot be used with Tag.
+	DeviceID int64
+	// Tag puts every device with the tag in maintenance.
+	Tag    string
+	Reason string
+	Start  time.Time
+	End    time.Time
+}
+
+// CreateMaintenanceWindow puts a device or every device with a tag in maintenance between start and end.
+func CreateMaintenanceWindow(ctx context.Context, arg CreateMaintenanceWindowParams) (int64, error) {
+	actor, err := core.AssertAdmin(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	model := _MaintenanceWindow{
+		Reason: strings.TrimSpace(arg.Reason),
+	}
+	if err := core.ValidateStruct(ctx, model); err != nil {
+		return 0, err
+	}
+
+	tag := strings.ToLower(strings.TrimSpace(arg.Tag))
+	if (arg.DeviceID == 0) == (tag == "") {
+		return 0, core.NewFieldError("DeviceID", "Either a device or a tag must be given, but not both.")
+	}
+	if tag != "" {
+		if err := validateTags(ctx, []string{tag}); err != nil {
+			return 0, err
+		}
+	} else if _, err := GetDevice(ctx, arg.DeviceID); err != nil {
+		if core.IsNotFound(err) {
+			return 0, core.NewFieldError("DeviceID", "Device not found.")
+		}
+		return 0, err
+	}
+
+	if !arg.Start.Before(arg.End) {
+		return 0, core.NewFieldError("End", "End must be after start.")
+	}
+	now := time.Now()
+	if !arg.End.After(now) {
+		return 0, core.NewFieldError("End", "End must be in the future.")
+	}
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := tx.C().DahuaCreateMaintenanceWindow(ctx, repo.DahuaCreateMaintenanceWindowParams{
+		DeviceID:  core.Int64ToNullInt64(arg.DeviceID),
+		Tag:       core.StringToNullString(tag),
+		UserID:    core.Int64ToNullInt64(actor.UserID),
+		Reason:    model.Reason,
+		StartTime: types.NewTime(arg.Start),
+		EndTime:   types.NewTime(arg.End),
+		CreatedAt: types.NewTime(now),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.DahuaMaintenanceCreated.Create(id)); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// DeleteMaintenanceWindow deletes the window, which also ends it early.
+func DeleteMaintenanceWindow(ctx context.Context, id int64) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.C().DahuaGetMaintenanceWindow(ctx, id); err != nil {
+		return err
+	}
+
+	if err := tx.C().DahuaDeleteMaintenanceWindow(ctx, id); err != nil {
+		return err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.DahuaMaintenanceDeleted.Create(id)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func ListMaintenanceWindows(ctx context.Context) ([]repo.DahuaMaintenanceWindow, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	return app.DB.C().DahuaListMaintenanceWindows(ctx)
+}
+
+// MaintenanceWindowActive returns true when the window covers the time.
+func MaintenanceWindowActive(v repo.DahuaMaintenanceWindow, t time.Time) bool {
+	return !t.Before(v.StartTime.Time) && t.Before(v.EndTime.Time)
+}
+
+// inMaintenance returns true when the device or one of its tags is in maintenance at the time.
+func inMaintenance(ctx context.Context, deviceID int64, t time.Time) (bool, error) {
+	return app.DB.C().DahuaCheckDeviceMaintenance(ctx, repo.DahuaCheckDeviceMaintenanceParams{
+		Now:      types.NewTime(t),
+		DeviceID: deviceID,
+	})
+}
@@ -0,0 +1,30 @@
+package dahua
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenanceWindowActive(t *testing.T) {
+	start := time.Date(2024, 3, 31, 9, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	v := repo.DahuaMaintenanceWindow{
+		StartTime: types.NewTime(start),
+		EndTime:   types.NewTime(end),
+	}
+
+	assert.False(t, MaintenanceWindowActive(v, start.Add(-time.Second)))
+	assert.True(t, MaintenanceWindowActive(v, start))
+	assert.True(t, MaintenanceWindowActive(v, end.Add(-time.Second)))
+	assert.False(t, MaintenanceWindowActive(v, end))
+}
+
+func TestSuppressEventRule(t *testing.T) {
+	got := suppressEventRule(repo.DahuaEventRule{Code: "VideoMotion", SnapshotCount: 2})
+
+	assert.Equal(t, repo.DahuaEventRule{Code: "VideoMotion", IgnoreLive: true, IgnoreMqtt: true, SnapshotCount: 2}, got)
+}
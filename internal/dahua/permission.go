@@ -2,19 +2,29 @@ package dahua
 
 import (
 	"context"
+	"errors"
 
 	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
 	"github.com/ItsNotGoodName/ipcmanview/internal/models"
 	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system/action"
 	"github.com/ItsNotGoodName/ipcmanview/pkg/pubsub"
 )
 
 const levelDefault = models.DahuaPermissionLevel_User
 const levelEmail = models.DahuaPermissionLevel_User
 
+var ErrInvalidPermissionSubject = errors.New("permission must be for a user or a group")
+
+// Level returns true if the actor has at least the level on the device.
+// The actor's level is the highest level granted to the user directly or through their enabled groups.
 func Level(ctx context.Context, deviceID int64, level models.DahuaPermissionLevel) (bool, error) {
 	actor := core.UseActor(ctx)
+	if actor.Scope != nil && actor.Scope.Level < level {
+		return false, nil
+	}
 	if actor.Admin {
 		return true, nil
 	}
@@ -32,15 +42,9 @@ func Level(ctx context.Context, deviceID int64, level models.DahuaPermissionLeve
 func PubSubMiddleware(ctx context.Context) pubsub.MiddlewareFunc {
 	actor := core.UseActor(ctx)
 
-	skip := func(ctx context.Context, deviceID int64, level models.DahuaPermissionLevel) bool {
-		dbLevel, err := app.DB.C().DahuaGetPermissionLevel(ctx, repo.DahuaGetPermissionLevelParams{
-			DeviceID: deviceID,
-			UserID:   core.Int64ToNullInt64(actor.UserID),
-		})
-		if err != nil {
-			return true
-		}
-		return dbLevel <= level
+	skip := func(deviceID int64, level models.DahuaPermissionLevel) bool {
+		ok, err := Level(ctx, deviceID, level)
+		return err != nil || !ok
 	}
 
 	return func(next pubsub.HandleFunc) pubsub.HandleFunc {
@@ -51,19 +55,19 @@ func PubSubMiddleware(ctx context.Context) pubsub.MiddlewareFunc {
 
 			switch e := event.(type) {
 			case bus.DahuaEvent:
-				if skip(ctx, e.Event.DeviceID, levelDefault) {
+				if skip(e.Event.DeviceID, levelDefault) {
 					return nil
 				}
 			case bus.DahuaFileCreated:
-				if skip(ctx, e.DeviceID, levelDefault) {
+				if skip(e.DeviceID, levelDefault) {
 					return nil
 				}
 			case bus.DahuaFileCursorUpdated:
-				if skip(ctx, e.Cursor.DeviceID, levelDefault) {
+				if skip(e.Cursor.DeviceID, levelDefault) {
 					return nil
 				}
 			case bus.DahuaEmailCreated:
-				if skip(ctx, e.DeviceID, levelEmail) {
+				if skip(e.DeviceID, levelEmail) {
 					return nil
 				}
 			case bus.UserSecurityUpdated:
@@ -78,3 +82,114 @@ func PubSubMiddleware(ctx context.Context) pubsub.MiddlewareFunc {
 		}
 	}
 }
+
+func ListPermissions(ctx context.Context, deviceID int64) ([]repo.DahuaListPermissionsForDeviceRow, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	return app.DB.C().DahuaListPermissionsForDevice(ctx, deviceID)
+}
+
+type _Permission struct {
+	Level models.DahuaPermissionLevel `validate:"gte=0,lte=2"`
+}
+
+type SetPermissionParams struct {
+	DeviceID int64
+	// UserID or GroupID must be set, but not both.
+	UserID  int64
+	GroupID int64
+	Level   models.DahuaPermissionLevel
+}
+
+// SetPermission grants the level on the device to a user or group, replacing the previous level.
+func SetPermission(ctx context.Context, arg SetPermissionParams) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	if err := core.ValidateStruct(ctx, _Permission{Level: arg.Level}); err != nil {
+		return err
+	}
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	switch {
+	case arg.UserID != 0 && arg.GroupID == 0:
+		err = tx.C().DahuaUpsertUserPermission(ctx, repo.DahuaUpsertUserPermissionParams{
+			UserID:   core.NewNullInt64(arg.UserID),
+			DeviceID: arg.DeviceID,
+			Level:    arg.Level,
+		})
+	case arg.GroupID != 0 && arg.UserID == 0:
+		err = tx.C().DahuaUpsertGroupPermission(ctx, repo.DahuaUpsertGroupPermissionParams{
+			GroupID:  core.NewNullInt64(arg.GroupID),
+			DeviceID: arg.DeviceID,
+			Level:    arg.Level,
+		})
+	default:
+		return ErrInvalidPermissionSubject
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.DahuaPermissionUpdated.Create(arg.DeviceID)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type DeletePermissionParams struct {
+	DeviceID int64
+	// UserID or GroupID must be set, but not both.
+	UserID  int64
+	GroupID int64
+}
+
+// DeletePermission revokes the user's or group's access to the device.
+func DeletePermission(ctx context.Context, arg DeletePermissionParams) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var rows int64
+	switch {
+	case arg.UserID != 0 && arg.GroupID == 0:
+		rows, err = tx.C().DahuaDeleteUserPermission(ctx, repo.DahuaDeleteUserPermissionParams{
+			UserID:   core.NewNullInt64(arg.UserID),
+			DeviceID: arg.DeviceID,
+		})
+	case arg.GroupID != 0 && arg.UserID == 0:
+		rows, err = tx.C().DahuaDeleteGroupPermission(ctx, repo.DahuaDeleteGroupPermissionParams{
+			GroupID:  core.NewNullInt64(arg.GroupID),
+			DeviceID: arg.DeviceID,
+		})
+	default:
+		return ErrInvalidPermissionSubject
+	}
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return nil
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.DahuaPermissionUpdated.Create(arg.DeviceID)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
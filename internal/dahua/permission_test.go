@@ -0,0 +1,192 @@
+package dahua
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/ItsNotGoodName/ipcmanview/internal/sqlite"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/ssq"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	permissionUser  = 1
+	permissionOther = 2
+)
+
+const (
+	permissionDeviceDirect = iota + 1
+	permissionDeviceGroup
+	permissionDeviceDisabledGroup
+	permissionDeviceTag
+	permissionDeviceDisabledGroupTag
+	permissionDeviceOther
+	permissionDeviceNone
+)
+
+// newPermissionDB creates a database where the user has access to devices in different ways.
+func newPermissionDB(t *testing.T) sqlite.DB {
+	return newTestDB(t,
+		`INSERT INTO users (id, email, username, password, created_at, updated_at) VALUES
+			(1, 'user@example.com', 'user', '', 0, 0),
+			(2, 'other@example.com', 'other', '', 0, 0)`,
+		`INSERT INTO groups (id, name, description, created_at, updated_at, disabled_at) VALUES
+			(1, 'enabled', '', 0, 0, NULL),
+			(2, 'disabled', '', 0, 0, 0)`,
+		`INSERT INTO group_users (user_id, group_id, created_at) VALUES (1, 1, 0), (1, 2, 0)`,
+		`INSERT INTO dahua_devices (id, name, ip, url, username, password, location, feature, created_at, updated_at) VALUES
+			(1, 'direct', '192.168.1.1', 'http://192.168.1.1', '', '', '', 0, 0, 0),
+			(2, 'group', '192.168.1.2', 'http://192.168.1.2', '', '', '', 0, 0, 0),
+			(3, 'disabled-group', '192.168.1.3', 'http://192.168.1.3', '', '', '', 0, 0, 0),
+			(4, 'tag', '192.168.1.4', 'http://192.168.1.4', '', '', '', 0, 0, 0),
+			(5, 'disabled-group-tag', '192.168.1.5', 'http://192.168.1.5', '', '', '', 0, 0, 0),
+			(6, 'other', '192.168.1.6', 'http://192.168.1.6', '', '', '', 0, 0, 0),
+			(7, 'none', '192.168.1.7', 'http://192.168.1.7', '', '', '', 0, 0, 0)`,
+		`INSERT INTO dahua_permissions (user_id, group_id, device_id, level) VALUES
+			(1, NULL, 1, 0),
+			(NULL, 1, 2, 1),
+			(NULL, 2, 3, 2),
+			(2, NULL, 6, 2)`,
+		`INSERT INTO dahua_device_tags (device_id, tag) VALUES (4, 'front'), (5, 'back'), (7, 'side')`,
+		`INSERT INTO dahua_tag_permissions (user_id, group_id, tag, level) VALUES
+			(1, NULL, 'front', 2),
+			(NULL, 2, 'back', 2)`,
+	)
+}
+
+func TestAuthFilter(t *testing.T) {
+	db := newPermissionDB(t)
+	useTestApp(t, App{DB: db})
+
+	listDevices := func(ctx context.Context, level models.DahuaPermissionLevel) []int64 {
+		sb := sq.Select("id").From("dahua_devices").OrderBy("id")
+
+		var ids []int64
+		require.NoError(t, ssq.Query(ctx, db, &ids, authFilter(ctx, sb, "dahua_devices.id", level)))
+		return ids
+	}
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		level models.DahuaPermissionLevel
+		ids   []int64
+	}{
+		{
+			name:  "user",
+			ctx:   core.WithUserActor(context.Background(), permissionUser, false),
+			level: models.DahuaPermissionLevel_User,
+			ids:   []int64{permissionDeviceDirect, permissionDeviceGroup, permissionDeviceTag},
+		},
+		{
+			name:  "operator",
+			ctx:   core.WithUserActor(context.Background(), permissionUser, false),
+			level: models.DahuaPermissionLevel_Operator,
+			ids:   []int64{permissionDeviceGroup, permissionDeviceTag},
+		},
+		{
+			name:  "admin level",
+			ctx:   core.WithUserActor(context.Background(), permissionUser, false),
+			level: models.DahuaPermissionLevel_Admin,
+			ids:   []int64{permissionDeviceTag},
+		},
+		{
+			name:  "other user",
+			ctx:   core.WithUserActor(context.Background(), permissionOther, false),
+			level: models.DahuaPermissionLevel_User,
+			ids:   []int64{permissionDeviceOther},
+		},
+		{
+			name:  "admin",
+			ctx:   core.WithUserActor(context.Background(), permissionOther, true),
+			level: models.DahuaPermissionLevel_Admin,
+			ids: []int64{
+				permissionDeviceDirect,
+				permissionDeviceGroup,
+				permissionDeviceDisabledGroup,
+				permissionDeviceTag,
+				permissionDeviceDisabledGroupTag,
+				permissionDeviceOther,
+				permissionDeviceNone,
+			},
+		},
+		{
+			name:  "token below level",
+			ctx:   core.WithTokenActor(context.Background(), permissionUser, false, core.ActorScope{Level: models.DahuaPermissionLevel_User}),
+			level: models.DahuaPermissionLevel_Operator,
+			ids:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ElementsMatch(t, tt.ids, listDevices(tt.ctx, tt.level))
+		})
+	}
+}
+
+func TestLevel(t *testing.T) {
+	useTestApp(t, App{DB: newPermissionDB(t)})
+
+	ctx := core.WithUserActor(context.Background(), permissionUser, false)
+
+	tests := []struct {
+		name     string
+		deviceID int64
+		// levels are the results for the user, operator, and admin levels.
+		levels [3]bool
+	}{
+		{"direct", permissionDeviceDirect, [3]bool{true, false, false}},
+		{"group", permissionDeviceGroup, [3]bool{true, true, false}},
+		{"disabled group", permissionDeviceDisabledGroup, [3]bool{false, false, false}},
+		{"tag", permissionDeviceTag, [3]bool{true, true, true}},
+		{"disabled group tag", permissionDeviceDisabledGroupTag, [3]bool{false, false, false}},
+		{"other user", permissionDeviceOther, [3]bool{false, false, false}},
+		{"none", permissionDeviceNone, [3]bool{false, false, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, level := range []models.DahuaPermissionLevel{
+				models.DahuaPermissionLevel_User,
+				models.DahuaPermissionLevel_Operator,
+				models.DahuaPermissionLevel_Admin,
+			} {
+				ok, err := Level(ctx, tt.deviceID, level)
+				// Devices without any permission for the user are not found
+				if core.IsNotFound(err) {
+					ok, err = false, nil
+				}
+				require.NoError(t, err)
+				assert.Equal(t, tt.levels[i], ok, level)
+			}
+		})
+	}
+}
+
+func TestDeviceHasTags(t *testing.T) {
+	useTestApp(t, App{DB: newPermissionDB(t)})
+	ctx := context.Background()
+
+	tests := []struct {
+		deviceID int64
+		tags     []string
+		ok       bool
+	}{
+		{permissionDeviceTag, []string{" Front "}, true},
+		{permissionDeviceTag, []string{"back", "front"}, true},
+		{permissionDeviceTag, []string{"back"}, false},
+		{permissionDeviceTag, nil, false},
+		{permissionDeviceNone, []string{"front"}, false},
+	}
+
+	for _, tt := range tests {
+		ok, err := DeviceHasTags(ctx, tt.deviceID, tt.tags)
+		require.NoError(t, err)
+		assert.Equal(t, tt.ok, ok, tt.tags)
+	}
+}
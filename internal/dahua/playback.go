@@ -0,0 +1,266 @@
+package dahua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/ffmpeg"
+	"github.com/ItsNotGoodName/ipcmanview/internal/mediamtx"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/sutureext"
+	"github.com/rs/zerolog/log"
+)
+
+type filePlayback struct {
+	File    repo.DahuaFile
+	RTSPURL string
+}
+
+func getFilePlayback(ctx context.Context, deviceID, fileID int64) (filePlayback, error) {
+	ok, err := Level(ctx, deviceID, levelDefault)
+	if err != nil {
+		return filePlayback{}, err
+	}
+	if !ok {
+		return filePlayback{}, core.ErrForbidden
+	}
+
+	file, err := app.DB.C().DahuaGetFile(ctx, fileID)
+	if err != nil {
+		if core.IsNotFound(err) {
+			return filePlayback{}, core.ErrNotFound
+		}
+		return filePlayback{}, err
+	}
+	if file.DeviceID != deviceID {
+		return filePlayback{}, core.ErrNotFound
+	}
+
+	device, err := GetDevice(ctx, deviceID)
+	if err != nil {
+		return filePlayback{}, err
+	}
+
+	client, err := GetClient(ctx, deviceID)
+	if err != nil {
+		return filePlayback{}, err
+	}
+
+	return filePlayback{
+		File: file,
+		RTSPURL: GetPlaybackRTSPURL(GetPlaybackRTSPURLParams{
+			Username:  client.Conn.Username,
+			Password:  client.password,
+			Host:      device.Ip,
+			Port:      554,
+			Channel:   int(file.Channel) + 1,
+			StartTime: file.StartTime.In(device.Location.Location),
+			EndTime:   file.EndTime.In(device.Location.Location),
+		}),
+	}, nil
+}
+
+// PushFilePlayback registers an on-demand MediaMTX path that plays back the recorded file and returns the path.
+func PushFilePlayback(ctx context.Context, deviceID, fileID int64) (string, error) {
+	playback, err := getFilePlayback(ctx, deviceID, fileID)
+	if err != nil {
+		return "", err
+	}
+
+	name := app.MediamtxConfig.DahuaPlaybackPath(playback.File.ID)
+	rtspTransport := "tcp"
+	sourceOnDemand := true
+	if err := pushMediamtxPath(core.WithSystemActor(ctx), name, mediamtx.PathConf{
+		Source:         &playback.RTSPURL,
+		RtspTransport:  &rtspTransport,
+		SourceOnDemand: &sourceOnDemand,
+	}); err != nil {
+		return "", err
+	}
+
+	if app.PlaybackJanitor != nil {
+		app.PlaybackJanitor.track(name)
+	}
+
+	return name, nil
+}
+
+// OpenFilePlayback starts the embedded playback of the recorded file if needed and returns the directory containing its HLS files.
+// It waits until the playlist has been written.
+func OpenFilePlayback(ctx context.Context, deviceID, fileID int64) (string, error) {
+	if app.LiveStreamer == nil {
+		return "", ErrLiveStreamerDisabled
+	}
+
+	playback, err := getFilePlayback(ctx, deviceID, fileID)
+	if err != nil {
+		return "", err
+	}
+
+	session, err := app.LiveStreamer.open(fmt.Sprintf("file-%d", playback.File.ID), playback.RTSPURL, ffmpeg.HLSConfig{
+		SegmentDuration: liveStreamSegmentLength,
+		Event:           true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := app.LiveStreamer.wait(ctx, session); err != nil {
+		return "", err
+	}
+
+	return session.dir, nil
+}
+
+const (
+	playbackJanitorInterval = 1 * time.Minute
+	playbackIdleTimeout     = 5 * time.Minute
+)
+
+// NewPlaybackJanitor creates a playback janitor.
+func NewPlaybackJanitor() *PlaybackJanitor {
+	return &PlaybackJanitor{
+		paths: make(map[string]time.Time),
+	}
+}
+
+// PlaybackJanitor removes the MediaMTX paths created by PushFilePlayback after they have had no readers for a while.
+// Playback paths left over from a previous run are removed on start and every playback path is removed on stop.
+type PlaybackJanitor struct {
+	mu sync.Mutex
+	// paths maps the path name to when it last had a reader.
+	paths map[string]time.Time
+}
+
+func (*PlaybackJanitor) String() string {
+	return "dahua.PlaybackJanitor"
+}
+
+func (j *PlaybackJanitor) Serve(ctx context.Context) error {
+	if err := j.removeStale(ctx); err != nil {
+		log.Err(err).Str("service", j.String()).Msg("Failed to remove stale playback paths")
+	}
+
+	t := time.NewTicker(playbackJanitorInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			j.mu.Lock()
+			for name := range j.paths {
+				j.remove(context.WithoutCancel(ctx), name)
+			}
+			j.mu.Unlock()
+
+			return sutureext.SanitizeError(ctx, ctx.Err())
+		case <-t.C:
+			j.mu.Lock()
+			for name, lastRead := range j.paths {
+				reading, err := mediamtxPathReading(ctx, name)
+				if err != nil {
+					log.Err(err).Str("service", j.String()).Str("path", name).Msg("Failed to get playback path")
+					continue
+				}
+
+				if reading {
+					j.paths[name] = time.Now()
+				} else if time.Since(lastRead) > playbackIdleTimeout {
+					j.remove(ctx, name)
+				}
+			}
+			j.mu.Unlock()
+		}
+	}
+}
+
+func (j *PlaybackJanitor) track(name string) {
+	j.mu.Lock()
+	j.paths[name] = time.Now()
+	j.mu.Unlock()
+}
+
+// remove must be called with the lock held.
+func (j *PlaybackJanitor) remove(ctx context.Context, name string) {
+	delete(j.paths, name)
+	if err := deleteMediamtxPath(ctx, name); err != nil {
+		log.Err(err).Str("service", j.String()).Str("path", name).Msg("Failed to remove playback path")
+	}
+}
+
+// removeStale removes the playback paths that are not tracked.
+func (j *PlaybackJanitor) removeStale(ctx context.Context) error {
+	rsp, err := app.MediamtxClient.ConfigPathsList(ctx, &mediamtx.ConfigPathsListParams{})
+	if err != nil {
+		return err
+	}
+	res, err := mediamtx.ParseConfigPathsListResponse(rsp)
+	if err != nil {
+		return err
+	}
+	if res.JSON200 == nil || res.JSON200.Items == nil {
+		return errors.New(string(res.Body))
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, v := range *res.JSON200.Items {
+		if v.Name == nil || !app.MediamtxConfig.IsDahuaPlaybackPath(*v.Name) {
+			continue
+		}
+		if _, ok := j.paths[*v.Name]; ok {
+			continue
+		}
+
+		if err := deleteMediamtxPath(ctx, *v.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mediamtxPathReading returns true when the MediaMTX path has readers.
+func mediamtxPathReading(ctx context.Context, name string) (bool, error) {
+	rsp, err := app.MediamtxClient.PathsGet(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	res, err := mediamtx.ParsePathsGetResponse(rsp)
+	if err != nil {
+		return false, err
+	}
+
+	switch res.StatusCode() {
+	case http.StatusOK:
+		return res.JSON200.Readers != nil && len(*res.JSON200.Readers) > 0, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, errors.New(string(res.Body))
+	}
+}
+
+func deleteMediamtxPath(ctx context.Context, name string) error {
+	rsp, err := app.MediamtxClient.ConfigPathsDelete(ctx, name)
+	if err != nil {
+		return err
+	}
+	res, err := mediamtx.ParseConfigPathsDeleteResponse(rsp)
+	if err != nil {
+		return err
+	}
+
+	switch res.StatusCode() {
+	case http.StatusOK, http.StatusNotFound:
+		return nil
+	default:
+		return errors.New(string(res.Body))
+	}
+}
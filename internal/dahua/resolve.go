@@ -0,0 +1,168 @@
+package dahua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system/action"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/sutureext"
+	"github.com/rs/zerolog/log"
+)
+
+// normalizeIP returns the IP in its canonical form.
+// IPv4-mapped IPv6 addresses (e.g. "::ffff:192.168.1.108") are returned as IPv4 addresses.
+func normalizeIP(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return v4.String()
+	}
+	return ip.String()
+}
+
+// resolveIP returns the IP of the host, preferring IPv4 over IPv6.
+func resolveIP(ctx context.Context, host string) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return normalizeIP(ip), nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return "", err
+	}
+
+	for _, v := range ips {
+		if v.To4() != nil {
+			return normalizeIP(v), nil
+		}
+	}
+	if len(ips) > 0 {
+		return normalizeIP(ips[0]), nil
+	}
+
+	return "", fmt.Errorf("no IP found for %s", host)
+}
+
+func NewResolverService(interval time.Duration) ResolverService {
+	return ResolverService{
+		interval: interval,
+	}
+}
+
+// ResolverService resolves the hostnames of devices on an interval and updates their IP when it changes.
+type ResolverService struct {
+	interval time.Duration
+}
+
+func (ResolverService) String() string {
+	return "dahua.ResolverService"
+}
+
+func (s ResolverService) Serve(ctx context.Context) error {
+	return sutureext.SanitizeError(ctx, s.serve(ctx))
+}
+
+func (s ResolverService) serve(ctx context.Context) error {
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			if err := ResolveDevices(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ResolveDevices resolves the hostnames of devices and updates their IP when it changes.
+// Devices with an IP in their URL are skipped.
+func ResolveDevices(ctx context.Context) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	devices, err := app.DB.C().DahuaListDeviceAddresses(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, device := range devices {
+		host := device.Url.Hostname()
+		if net.ParseIP(host) != nil {
+			continue
+		}
+
+		ip, err := resolveIP(ctx, host)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Warn().Err(err).Int64("id", device.ID).Str("host", host).Msg("Failed to resolve device")
+			continue
+		}
+		if ip == device.Ip {
+			continue
+		}
+
+		if err := updateDeviceIP(ctx, device.ID, ip); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			log.Err(err).Int64("id", device.ID).Str("host", host).Str("ip", ip).Msg("Failed to update device IP")
+			continue
+		}
+
+		log.Info().Int64("id", device.ID).Str("host", host).Str("old-ip", device.Ip).Str("ip", ip).Msg("Device IP changed")
+	}
+
+	return nil
+}
+
+func updateDeviceIP(ctx context.Context, id int64, ip string) error {
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := deviceAudit(ctx, tx.C(), id)
+	if err != nil {
+		return err
+	}
+
+	err = tx.C().DahuaUpdateDeviceIP(ctx, repo.DahuaUpdateDeviceIPParams{
+		Ip: ip,
+		ID: id,
+	})
+	if err != nil {
+		return err
+	}
+
+	after, err := deviceAudit(ctx, tx.C(), id)
+	if err != nil {
+		return err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.DahuaDeviceUpdated.Create(id).WithDiff(before, after)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	app.Hub.DahuaDeviceUpdated(bus.DahuaDeviceUpdated{
+		DeviceID: id,
+	})
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package dahua
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system/action"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc"
+)
+
+var defaultRPCWriteMethods = []string{
+	"*.set*",
+	"*.modify*",
+	"*.delete*",
+	"magicBox.reboot",
+	"magicBox.shutdown",
+	// Factory reset
+	"magicBox.resetSystem",
+	"configManager.restore*",
+}
+
+// rpcAuditResponseLimit is the size of the largest response that is recorded in the audit log.
+const rpcAuditResponseLimit = 64 * 1024
+
+func rpcMatch(patterns []string, method string) bool {
+	method = strings.ToLower(method)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), method); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rpcMethodLevel returns the lowest permission level that is allowed to call the method.
+func rpcMethodLevel(cfg system.RPCConfig, method string) (models.DahuaPermissionLevel, bool) {
+	admin := cfg.Admin
+	if admin == nil {
+		admin = []string{"*"}
+	}
+
+	switch {
+	case rpcMatch(cfg.User, method):
+		return models.DahuaPermissionLevel_User, true
+	case rpcMatch(cfg.Operator, method):
+		return models.DahuaPermissionLevel_Operator, true
+	case rpcMatch(admin, method):
+		return models.DahuaPermissionLevel_Admin, true
+	default:
+		return 0, false
+	}
+}
+
+func rpcMethodWrite(cfg system.RPCConfig, method string) bool {
+	writeMethods := cfg.WriteMethods
+	if writeMethods == nil {
+		writeMethods = defaultRPCWriteMethods
+	}
+	return rpcMatch(writeMethods, method)
+}
+
+// rpcMethods returns the methods called by the request, including the ones inside of nested multicalls.
+func rpcMethods(method string, params json.RawMessage) ([]string, error) {
+	if !strings.EqualFold(method, "system.multicall") {
+		return []string{method}, nil
+	}
+
+	var calls []struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(params, &calls); err != nil {
+		return nil, err
+	}
+
+	methods := make([]string, 0, len(calls))
+	for _, call := range calls {
+		callMethods, err := rpcMethods(call.Method, call.Params)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, callMethods...)
+	}
+	return methods, nil
+}
+
+// authorizeRPC checks if the actor is allowed to send the RPC request to the device.
+func authorizeRPC(ctx context.Context, cfg system.RPCConfig, deviceID int64, method string, params json.RawMessage) error {
+	methods, err := rpcMethods(method, params)
+	if err != nil {
+		return fmt.Errorf("%w: invalid multicall params", core.ErrForbidden)
+	}
+
+	level := models.DahuaPermissionLevel_User
+	for _, method := range methods {
+		if cfg.ReadOnly && rpcMethodWrite(cfg, method) {
+			return fmt.Errorf("%w: %s is blocked by read-only mode", core.ErrForbidden, method)
+		}
+
+		methodLevel, ok := rpcMethodLevel(cfg, method)
+		if !ok {
+			return fmt.Errorf("%w: %s is not allowed", core.ErrForbidden, method)
+		}
+		level = max(level, methodLevel)
+	}
+
+	ok, err := Level(ctx, deviceID, level)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s requires %s permission", core.ErrForbidden, method, level)
+	}
+
+	return nil
+}
+
+// SendRPC sends a raw RPC request to the device if the RPC policy allows it.
+// Every request is recorded in the audit log along with the response, even when it is denied or fails.
+// Secrets in the params and response are redacted in the audit log.
+func SendRPC(ctx context.Context, cfg system.RPCConfig, client Client, method string, params json.RawMessage, object int64) (dahuarpc.Response[json.RawMessage], error) {
+	event := action.DahuaRPC{
+		DeviceID: client.Conn.ID,
+		Method:   method,
+		Params:   system.RedactJSON(params),
+		Object:   object,
+	}
+
+	var res dahuarpc.Response[json.RawMessage]
+	err := authorizeRPC(ctx, cfg, client.Conn.ID, method, params)
+	if err != nil {
+		event.Denied = core.IsForbidden(err)
+	} else {
+		res, err = dahuarpc.SendRaw[json.RawMessage](ctx, client.RPC, dahuarpc.New(method).
+			Params(params).
+			Object(object))
+		event.Response = rpcAuditResponse(res)
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	if err := system.CreateEvent(ctx, app.DB.C(), action.DahuaDeviceRPC.Create(event)); err != nil {
+		return res, err
+	}
+
+	return res, err
+}
+
+// rpcAuditResponse returns the redacted response without the session or nil if it is too large.
+func rpcAuditResponse(res dahuarpc.Response[json.RawMessage]) json.RawMessage {
+	b, err := json.Marshal(struct {
+		Error  *dahuarpc.ResponseError `json:"error,omitempty"`
+		Params json.RawMessage         `json:"params,omitempty"`
+		Result dahuarpc.ResponseResult `json:"result"`
+	}{
+		Error:  res.Error,
+		Params: res.Params,
+		Result: res.Result,
+	})
+	if err != nil || len(b) > rpcAuditResponseLimit {
+		return nil
+	}
+	return system.RedactJSON(b)
+}
@@ -0,0 +1,82 @@
+package dahua
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRPCMethodLevel(t *testing.T) {
+	cfg := system.RPCConfig{
+		User:     []string{"magicBox.get*"},
+		Operator: []string{"ptz.*"},
+	}
+
+	tests := []struct {
+		method string
+		level  models.DahuaPermissionLevel
+		ok     bool
+	}{
+		{method: "magicBox.getSerialNo", level: models.DahuaPermissionLevel_User, ok: true},
+		{method: "MAGICBOX.GETSERIALNO", level: models.DahuaPermissionLevel_User, ok: true},
+		{method: "ptz.start", level: models.DahuaPermissionLevel_Operator, ok: true},
+		{method: "magicBox.reboot", level: models.DahuaPermissionLevel_Admin, ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			level, ok := rpcMethodLevel(cfg, tt.method)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.level, level)
+		})
+	}
+
+	cfg.Admin = []string{}
+	_, ok := rpcMethodLevel(cfg, "magicBox.reboot")
+	assert.False(t, ok)
+}
+
+func TestRPCMethodWrite(t *testing.T) {
+	assert.True(t, rpcMethodWrite(system.RPCConfig{}, "configManager.setConfig"))
+	assert.True(t, rpcMethodWrite(system.RPCConfig{}, "userManager.modifyPassword"))
+	assert.True(t, rpcMethodWrite(system.RPCConfig{}, "userManager.deleteUser"))
+	assert.False(t, rpcMethodWrite(system.RPCConfig{}, "configManager.getConfig"))
+	assert.True(t, rpcMethodWrite(system.RPCConfig{}, "magicBox.reboot"))
+	assert.True(t, rpcMethodWrite(system.RPCConfig{}, "magicBox.resetSystem"))
+	assert.True(t, rpcMethodWrite(system.RPCConfig{}, "configManager.restoreExcept"))
+	assert.False(t, rpcMethodWrite(system.RPCConfig{}, "magicBox.getSerialNo"))
+	assert.True(t, rpcMethodWrite(system.RPCConfig{WriteMethods: []string{"magicBox.reboot"}}, "magicBox.reboot"))
+}
+
+func TestRPCMethods(t *testing.T) {
+	methods, err := rpcMethods("system.multicall", json.RawMessage(`[{"method":"magicBox.getSerialNo"},{"method":"magicBox.reboot"}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"magicBox.getSerialNo", "magicBox.reboot"}, methods)
+
+	methods, err = rpcMethods("system.multicall", json.RawMessage(`[{"method":"magicBox.getSerialNo"},{"method":"system.multicall","params":[{"method":"system.multicall","params":[{"method":"magicBox.reboot"}]}]}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"magicBox.getSerialNo", "magicBox.reboot"}, methods)
+
+	_, err = rpcMethods("system.multicall", json.RawMessage(`[{"method":"system.multicall","params":{}}]`))
+	assert.Error(t, err)
+
+	_, err = rpcMethods("system.multicall", json.RawMessage(`{}`))
+	assert.Error(t, err)
+
+	methods, err = rpcMethods("magicBox.reboot", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"magicBox.reboot"}, methods)
+}
+
+func TestAuthorizeRPCNestedMulticall(t *testing.T) {
+	params := json.RawMessage(`[{"method":"system.multicall","params":[{"method":"magicBox.reboot"}]}]`)
+
+	err := authorizeRPC(testAdminContext(), system.RPCConfig{ReadOnly: true}, 1, "system.multicall", params)
+	assert.ErrorIs(t, err, core.ErrForbidden)
+
+	err = authorizeRPC(testAdminContext(), system.RPCConfig{User: []string{"system.multicall"}, Admin: []string{}}, 1, "system.multicall", params)
+	assert.ErrorIs(t, err, core.ErrForbidden)
+}
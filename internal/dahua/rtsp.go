@@ -1,6 +1,11 @@
 package dahua
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+)
 
 type GetLiveRTSPURLParams struct {
 	Username string
@@ -13,7 +18,29 @@ type GetLiveRTSPURLParams struct {
 
 func GetLiveRTSPURL(arg GetLiveRTSPURLParams) string {
 	return fmt.Sprintf(
-		"rtsp://%s:%s@%s:%d/cam/realmonitor?channel=%d&subtype=%d&unicast=true&proto=Onvif",
-		arg.Username, arg.Password, arg.Host, arg.Port, arg.Channel, arg.Subtype,
+		"rtsp://%s:%s@%s/cam/realmonitor?channel=%d&subtype=%d&unicast=true&proto=Onvif",
+		arg.Username, arg.Password, core.Address(arg.Host, arg.Port), arg.Channel, arg.Subtype,
+	)
+}
+
+type GetPlaybackRTSPURLParams struct {
+	Username  string
+	Password  string
+	Host      string
+	Port      int
+	Channel   int
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+const playbackRTSPTimeLayout = "2006_01_02_15_04_05"
+
+// GetPlaybackRTSPURL returns the URL for playing back recordings between start and end time.
+// The times are formatted as is, so they should already be in the device's location.
+func GetPlaybackRTSPURL(arg GetPlaybackRTSPURLParams) string {
+	return fmt.Sprintf(
+		"rtsp://%s:%s@%s/cam/playback?channel=%d&starttime=%s&endtime=%s",
+		arg.Username, arg.Password, core.Address(arg.Host, arg.Port), arg.Channel,
+		arg.StartTime.Format(playbackRTSPTimeLayout), arg.EndTime.Format(playbackRTSPTimeLayout),
 	)
 }
@@ -0,0 +1,416 @@
+package dahua
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/ffmpeg"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/types"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuacgi"
+)
+
+func snapshotScheduleFrom(v repo.DahuaSnapshotSchedule) _SnapshotSchedule {
+	return _SnapshotSchedule{
+		Channel:  v.Channel,
+		Interval: v.Interval,
+	}
+}
+
+type _SnapshotSchedule struct {
+	Channel  int64 `validate:"gte=0,lte=256"`
+	Interval int64 `validate:"gte=10,lte=86400"`
+}
+
+type CreateSnapshotScheduleParams struct {
+	DeviceID int64
+	Channel  int64
+	Interval time.Duration
+	Disabled bool
+}
+
+func CreateSnapshotSchedule(ctx context.Context, arg CreateSnapshotScheduleParams) (int64, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return 0, err
+	}
+
+	model := _SnapshotSchedule{
+		Channel:  arg.Channel,
+		Interval: int64(arg.Interval / time.Second),
+	}
+
+	if err := core.ValidateStruct(ctx, model); err != nil {
+		return 0, err
+	}
+
+	now := types.NewTime(time.Now())
+	id, err := app.DB.C().DahuaCreateSnapshotSchedule(ctx, repo.DahuaCreateSnapshotScheduleParams{
+		DeviceID:  arg.DeviceID,
+		Channel:   model.Channel,
+		Interval:  model.Interval,
+		CreatedAt: now,
+		UpdatedAt: now,
+		DisabledAt: types.NullTime{
+			Time:  now,
+			Valid: arg.Disabled,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	app.Hub.DahuaSnapshotScheduleUpdated(bus.DahuaSnapshotScheduleUpdated{
+		DeviceID: arg.DeviceID,
+	})
+
+	return id, nil
+}
+
+type UpdateSnapshotScheduleParams struct {
+	ID       int64
+	Channel  int64
+	Interval time.Duration
+}
+
+func UpdateSnapshotSchedule(ctx context.Context, arg UpdateSnapshotScheduleParams) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	dbModel, err := app.DB.C().DahuaGetSnapshotSchedule(ctx, arg.ID)
+	if err != nil {
+		return err
+	}
+	model := snapshotScheduleFrom(dbModel)
+
+	// Mutate
+	model.Channel = arg.Channel
+	model.Interval = int64(arg.Interval / time.Second)
+
+	if err := core.ValidateStruct(ctx, model); err != nil {
+		return err
+	}
+
+	_, err = app.DB.C().DahuaUpdateSnapshotSchedule(ctx, repo.DahuaUpdateSnapshotScheduleParams{
+		Channel:   model.Channel,
+		Interval:  model.Interval,
+		UpdatedAt: types.NewTime(time.Now()),
+		ID:        arg.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	app.Hub.DahuaSnapshotScheduleUpdated(bus.DahuaSnapshotScheduleUpdated{
+		DeviceID: dbModel.DeviceID,
+	})
+
+	return nil
+}
+
+func UpdateSnapshotScheduleDisabled(ctx context.Context, id int64, disable bool) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	dbModel, err := app.DB.C().DahuaGetSnapshotSchedule(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = app.DB.C().DahuaUpdateSnapshotScheduleDisabledAt(ctx, repo.DahuaUpdateSnapshotScheduleDisabledAtParams{
+		DisabledAt: types.NullTime{
+			Time:  types.NewTime(time.Now()),
+			Valid: disable,
+		},
+		ID: id,
+	})
+	if err != nil {
+		return err
+	}
+
+	app.Hub.DahuaSnapshotScheduleUpdated(bus.DahuaSnapshotScheduleUpdated{
+		DeviceID: dbModel.DeviceID,
+	})
+
+	return nil
+}
+
+func DeleteSnapshotSchedule(ctx context.Context, id int64) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	dbModel, err := app.DB.C().DahuaGetSnapshotSchedule(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := app.DB.C().DahuaDeleteSnapshotSchedule(ctx, id); err != nil {
+		return err
+	}
+
+	app.Hub.DahuaSnapshotScheduleUpdated(bus.DahuaSnapshotScheduleUpdated{
+		DeviceID: dbModel.DeviceID,
+	})
+
+	return nil
+}
+
+func ListSnapshotSchedules(ctx context.Context) ([]repo.DahuaSnapshotSchedule, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	return app.DB.C().DahuaListSnapshotSchedules(ctx)
+}
+
+// CreateSnapshot captures a snapshot from the device and saves it to the afero file system.
+func CreateSnapshot(ctx context.Context, client Client, channel int) (int64, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return 0, err
+	}
+
+	snapshot, err := createSnapshot(ctx, client, channel, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	return snapshot.ID, nil
+}
+
+const (
+	eventSnapshotInterval   = 1 * time.Second
+	snapshotThumbnailWidth  = 320
+	snapshotThumbnailHeight = -1
+)
+
+// CreateEventSnapshots saves snapshots with thumbnails for an event.
+// The snapshots captured before the event are saved first, then the first snapshot after the event is captured immediately and the rest are captured on an interval after it.
+func CreateEventSnapshots(ctx context.Context, client Client, event repo.DahuaEvent, count int, pre []bufferedSnapshot) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	channel := int(event.Index) + 1
+
+	enabled, err := channelEnabled(ctx, client.Conn.ID, channel)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return nil
+	}
+
+	for _, v := range pre {
+		snapshot, err := saveSnapshot(ctx, client.Conn.ID, channel, event.ID, v.contentType, bytes.NewReader(v.data), v.capturedAt)
+		if err != nil {
+			return err
+		}
+
+		if err := createSnapshotThumbnail(ctx, snapshot); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		if i != 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(eventSnapshotInterval):
+			}
+		}
+
+		snapshot, err := createSnapshot(ctx, client, channel, event.ID)
+		if err != nil {
+			return err
+		}
+
+		if err := createSnapshotThumbnail(ctx, snapshot); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type snapshotResult struct {
+	ID            int64
+	AferoFileName string
+}
+
+func createSnapshot(ctx context.Context, client Client, channel int, eventID int64) (snapshotResult, error) {
+	snapshot, err := dahuacgi.SnapshotGet(ctx, client.CGI, channel)
+	if err != nil {
+		return snapshotResult{}, err
+	}
+	defer snapshot.Close()
+
+	return saveSnapshot(ctx, client.Conn.ID, channel, eventID, snapshot.ContentType, snapshot, time.Now())
+}
+
+func saveSnapshot(ctx context.Context, deviceID int64, channel int, eventID int64, contentType string, r io.Reader, createdAt time.Time) (snapshotResult, error) {
+	id, err := app.DB.C().DahuaCreateSnapshot(ctx, repo.DahuaCreateSnapshotParams{
+		DeviceID:  deviceID,
+		Channel:   int64(channel),
+		EventID:   core.Int64ToNullInt64(eventID),
+		CreatedAt: types.NewTime(createdAt),
+	})
+	if err != nil {
+		return snapshotResult{}, err
+	}
+
+	ext := parseFileExtension("", contentType)
+	if ext == "" {
+		ext = models.DahuaFileType_JPG
+	}
+
+	aferoFile, err := createAferoFile(ctx, aferoForeignKeys{SnapshotID: id}, newAferoFileName(ext))
+	if err != nil {
+		return snapshotResult{}, err
+	}
+	defer aferoFile.Close()
+
+	if _, err := io.Copy(aferoFile, r); err != nil {
+		return snapshotResult{}, err
+	}
+
+	if err := aferoFile.Ready(ctx); err != nil {
+		return snapshotResult{}, err
+	}
+
+	return snapshotResult{
+		ID:            id,
+		AferoFileName: aferoFile.Name,
+	}, nil
+}
+
+type bufferedSnapshot struct {
+	contentType string
+	data        []byte
+	capturedAt  time.Time
+}
+
+// captureBufferedSnapshot captures a snapshot into memory.
+func captureBufferedSnapshot(ctx context.Context, client Client, channel int) (bufferedSnapshot, error) {
+	snapshot, err := dahuacgi.SnapshotGet(ctx, client.CGI, channel)
+	if err != nil {
+		return bufferedSnapshot{}, err
+	}
+	defer snapshot.Close()
+
+	capturedAt := time.Now()
+	data, err := io.ReadAll(snapshot)
+	if err != nil {
+		return bufferedSnapshot{}, err
+	}
+
+	return bufferedSnapshot{
+		contentType: snapshot.ContentType,
+		data:        data,
+		capturedAt:  capturedAt,
+	}, nil
+}
+
+// snapshotBuffer keeps the latest snapshots of each channel so the snapshots from before an event can be saved.
+type snapshotBuffer struct {
+	size     int
+	channels map[int][]bufferedSnapshot
+}
+
+func newSnapshotBuffer() snapshotBuffer {
+	return snapshotBuffer{
+		channels: make(map[int][]bufferedSnapshot),
+	}
+}
+
+// resize changes how many snapshots are kept for each channel.
+func (b *snapshotBuffer) resize(size int) {
+	b.size = size
+	for channel := range b.channels {
+		b.trim(channel)
+	}
+}
+
+func (b *snapshotBuffer) trim(channel int) {
+	v := b.channels[channel]
+	if len(v) <= b.size {
+		return
+	}
+	if b.size == 0 {
+		delete(b.channels, channel)
+		return
+	}
+	b.channels[channel] = slices.Clone(v[len(v)-b.size:])
+}
+
+func (b *snapshotBuffer) push(channel int, v bufferedSnapshot) {
+	if b.size == 0 {
+		return
+	}
+	b.channels[channel] = append(b.channels[channel], v)
+	b.trim(channel)
+}
+
+// last returns up to count of the channel's snapshots captured before the time, oldest first.
+func (b *snapshotBuffer) last(channel, count int, before time.Time) []bufferedSnapshot {
+	var res []bufferedSnapshot
+	for _, v := range b.channels[channel] {
+		if v.capturedAt.Before(before) {
+			res = append(res, v)
+		}
+	}
+	if len(res) > count {
+		res = res[len(res)-count:]
+	}
+	return res
+}
+
+func createSnapshotThumbnail(ctx context.Context, snapshot snapshotResult) error {
+	inputPath, err := aferoRealPath(snapshot.AferoFileName)
+	if err != nil {
+		return err
+	}
+
+	thumbnail, err := CreateThumbnail(ctx, ThumbnailForeignKeys{SnapshotID: snapshot.ID}, snapshotThumbnailWidth, snapshotThumbnailHeight, newAferoFileName(models.DahuaFileType_JPG))
+	if err != nil {
+		return err
+	}
+	defer thumbnail.Close()
+
+	if err := ffmpeg.ImageSnapshot(ctx, inputPath, models.DahuaFileType_JPG, thumbnail, ffmpeg.ImageSnapshotConfig{
+		Width:  snapshotThumbnailWidth,
+		Height: snapshotThumbnailHeight,
+	}); err != nil {
+		return err
+	}
+
+	return thumbnail.Ready(ctx)
+}
+
+type snapshotScheduleState struct {
+	channel  int
+	interval time.Duration
+	next     time.Time
+}
+
+// newSnapshotScheduleStates aligns the next capture of each schedule to a multiple of its interval.
+func newSnapshotScheduleStates(schedules []repo.DahuaSnapshotSchedule, now time.Time) []snapshotScheduleState {
+	states := make([]snapshotScheduleState, 0, len(schedules))
+	for _, v := range schedules {
+		interval := time.Duration(v.Interval) * time.Second
+		states = append(states, snapshotScheduleState{
+			channel:  int(v.Channel),
+			interval: interval,
+			next:     now.Truncate(interval).Add(interval),
+		})
+	}
+	return states
+}
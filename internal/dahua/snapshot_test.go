@@ -0,0 +1,37 @@
+package dahua
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotBuffer(t *testing.T) {
+	start := time.Date(2024, 4, 1, 8, 0, 0, 0, time.UTC)
+	at := func(i int) time.Time { return start.Add(time.Duration(i) * time.Second) }
+
+	buffer := newSnapshotBuffer()
+	buffer.push(1, bufferedSnapshot{capturedAt: at(0)})
+	assert.Empty(t, buffer.last(1, 3, at(10)), "buffer without a size keeps nothing")
+
+	buffer.resize(3)
+	for i := 0; i < 5; i++ {
+		buffer.push(1, bufferedSnapshot{capturedAt: at(i)})
+	}
+	buffer.push(2, bufferedSnapshot{capturedAt: at(0)})
+
+	got := buffer.last(1, 2, at(10))
+	assert.Equal(t, []bufferedSnapshot{{capturedAt: at(3)}, {capturedAt: at(4)}}, got)
+
+	got = buffer.last(1, 3, at(4))
+	assert.Equal(t, []bufferedSnapshot{{capturedAt: at(2)}, {capturedAt: at(3)}}, got, "snapshots after the event are not returned")
+
+	assert.Len(t, buffer.last(2, 3, at(10)), 1)
+
+	buffer.resize(1)
+	assert.Equal(t, []bufferedSnapshot{{capturedAt: at(4)}}, buffer.last(1, 3, at(10)))
+
+	buffer.resize(0)
+	assert.Empty(t, buffer.last(1, 3, at(10)))
+}
@@ -84,13 +84,18 @@ func CreateStorageDestination(ctx context.Context, arg StorageDestination) (int6
 		return 0, err
 	}
 
+	password, err := encryptPassword(arg.Password)
+	if err != nil {
+		return 0, err
+	}
+
 	return app.DB.C().DahuaCreateStorageDestination(ctx, repo.DahuaCreateStorageDestinationParams{
 		Name:            arg.Name,
 		Storage:         arg.Storage,
 		ServerAddress:   arg.ServerAddress,
 		Port:            arg.Port,
 		Username:        arg.Username,
-		Password:        arg.Password,
+		Password:        password,
 		RemoteDirectory: arg.RemoteDirectory,
 	})
 }
@@ -103,13 +108,18 @@ func UpdateStorageDestination(ctx context.Context, arg StorageDestination) error
 		return err
 	}
 
+	password, err := encryptPassword(arg.Password)
+	if err != nil {
+		return err
+	}
+
 	_, err = app.DB.C().DahuaUpdateStorageDestination(ctx, repo.DahuaUpdateStorageDestinationParams{
 		Name:            arg.Name,
 		Storage:         arg.Storage,
 		ServerAddress:   arg.ServerAddress,
 		Port:            arg.Port,
 		Username:        arg.Username,
-		Password:        arg.Password,
+		Password:        password,
 		RemoteDirectory: arg.RemoteDirectory,
 		ID:              arg.ID,
 	})
@@ -34,7 +34,7 @@ func DeleteStream(ctx context.Context, stream repo.DahuaStream) error {
 }
 
 func SupportStream(feature models.DahuaFeature) bool {
-	return feature.EQ(models.DahuaFeature_Camera)
+	return feature.EQ(models.DahuaFeature_Camera) || feature.EQ(models.DahuaFeature_NVR)
 }
 
 // SyncStreams fetches streams from device and sync them with database.
@@ -53,15 +53,25 @@ func SyncStreams(ctx context.Context, deviceID int64, conn dahuarpc.Conn) error
 		subtypes += caps.MaxExtraStream
 	}
 
-	for channelIndex, device := range caps.VideoEncodeDevices {
+	channels, err := app.DB.C().DahuaListChannelsByDevice(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+
+	// NVRs can have more channels than encode devices
+	channelCount := max(len(caps.VideoEncodeDevices), len(channels))
+
+	args := []upsertStreamsParams{}
+	for channelIndex := 0; channelIndex < channelCount; channelIndex++ {
 		names := make([]string, subtypes)
-		for i, v := range device.SupportDynamicBitrate {
-			if i < len(names) {
-				names[i] = v.Stream
+		if channelIndex < len(caps.VideoEncodeDevices) {
+			for i, v := range caps.VideoEncodeDevices[channelIndex].SupportDynamicBitrate {
+				if i < len(names) {
+					names[i] = v.Stream
+				}
 			}
 		}
 
-		args := []upsertStreamsParams{}
 		for i := 0; i < subtypes; i++ {
 			arg := upsertStreamsParams{
 				Channel: int64(channelIndex + 1),
@@ -70,13 +80,9 @@ func SyncStreams(ctx context.Context, deviceID int64, conn dahuarpc.Conn) error
 			}
 			args = append(args, arg)
 		}
-		err := upsertStreams(ctx, deviceID, args)
-		if err != nil {
-			return err
-		}
 	}
 
-	return nil
+	return upsertStreams(ctx, deviceID, args)
 }
 
 type upsertStreamsParams struct {
@@ -120,21 +126,39 @@ func PushStreams(ctx context.Context, deviceID int64) error {
 		return err
 	}
 
+	// Streams are served by the embedded live streamer
+	if app.LiveStreamer != nil {
+		return nil
+	}
+
 	device, err := GetDevice(ctx, deviceID)
 	if err != nil {
 		return err
 	}
 
+	client, err := GetClient(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+
 	streams, err := app.DB.C().DahuaListStreamsByDevice(ctx, deviceID)
 	if err != nil {
 		return err
 	}
 
 	for _, stream := range streams {
+		enabled, err := channelEnabled(ctx, deviceID, int(stream.Channel))
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			continue
+		}
+
 		name := app.MediamtxConfig.DahuaEmbedPath(stream)
 		rtspURL := GetLiveRTSPURL(GetLiveRTSPURLParams{
-			Username: device.Username,
-			Password: device.Password,
+			Username: client.Conn.Username,
+			Password: client.password,
 			Host:     device.Ip,
 			Port:     554,
 			Channel:  int(stream.Channel),
@@ -146,31 +170,40 @@ func PushStreams(ctx context.Context, deviceID int64) error {
 			RtspTransport: &rtspTransport,
 		}
 
-		rsp, err := app.MediamtxClient.ConfigPathsGet(ctx, name)
-		if err != nil {
+		if err := pushMediamtxPath(ctx, name, pathConf); err != nil {
 			return err
 		}
-		res, err := mediamtx.ParseConfigPathsGetResponse(rsp)
+	}
+
+	return nil
+}
+
+// pushMediamtxPath creates or updates the MediaMTX path configuration.
+func pushMediamtxPath(ctx context.Context, name string, pathConf mediamtx.PathConf) error {
+	rsp, err := app.MediamtxClient.ConfigPathsGet(ctx, name)
+	if err != nil {
+		return err
+	}
+	res, err := mediamtx.ParseConfigPathsGetResponse(rsp)
+	if err != nil {
+		return err
+	}
+
+	switch res.StatusCode() {
+	case http.StatusOK:
+		rsp, err := app.MediamtxClient.ConfigPathsPatch(ctx, name, pathConf)
 		if err != nil {
 			return err
 		}
-
-		switch res.StatusCode() {
-		case http.StatusOK:
-			rsp, err := app.MediamtxClient.ConfigPathsPatch(ctx, name, pathConf)
-			if err != nil {
-				return err
-			}
-			rsp.Body.Close()
-		case http.StatusNotFound, http.StatusInternalServerError:
-			rsp, err := app.MediamtxClient.ConfigPathsAdd(ctx, name, pathConf)
-			if err != nil {
-				return err
-			}
-			rsp.Body.Close()
-		default:
-			return errors.New(string(res.Body))
+		rsp.Body.Close()
+	case http.StatusNotFound, http.StatusInternalServerError:
+		rsp, err := app.MediamtxClient.ConfigPathsAdd(ctx, name, pathConf)
+		if err != nil {
+			return err
 		}
+		rsp.Body.Close()
+	default:
+		return errors.New(string(res.Body))
 	}
 
 	return nil
@@ -0,0 +1,253 @@
+package dahua
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/sqlite"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system/action"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/ssq"
+	sq "github.com/Masterminds/squirrel"
+)
+
+type _Tag struct {
+	Tag string `validate:"gte=1,lte=64"`
+}
+
+// normalizeTags lowercases, trims, and deduplicates the tags.
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || slices.Contains(normalized, tag) {
+			continue
+		}
+		normalized = append(normalized, tag)
+	}
+	slices.Sort(normalized)
+	return normalized
+}
+
+func validateTags(ctx context.Context, tags []string) error {
+	for _, tag := range tags {
+		if err := core.ValidateStruct(ctx, _Tag{Tag: tag}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setDeviceTags replaces the device's tags.
+func setDeviceTags(ctx context.Context, tx sqlite.Tx, deviceID int64, tags []string) error {
+	if err := tx.C().DahuaDeleteDeviceTags(ctx, deviceID); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if err := tx.C().DahuaCreateDeviceTag(ctx, repo.DahuaCreateDeviceTagParams{
+			DeviceID: deviceID,
+			Tag:      tag,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tagFilter matches rows whose device has any of the tags.
+func tagFilter(deviceIDField string, tags []string) sq.Sqlizer {
+	args := make([]any, 0, len(tags))
+	for _, tag := range normalizeTags(tags) {
+		args = append(args, tag)
+	}
+	if len(args) == 0 {
+		return sq.Expr("false")
+	}
+
+	return sq.Expr(deviceIDField+` IN (
+		SELECT
+			device_id
+		FROM
+			dahua_device_tags
+		WHERE
+			tag IN (`+sq.Placeholders(len(args))+`)
+	)`, args...)
+}
+
+func ListDeviceTags(ctx context.Context, deviceID int64) ([]string, error) {
+	if _, err := GetDevice(ctx, deviceID); err != nil {
+		return nil, err
+	}
+
+	return app.DB.C().DahuaListDeviceTags(ctx, deviceID)
+}
+
+// ListTags returns the tags of the devices the actor can access.
+func ListTags(ctx context.Context) ([]string, error) {
+	sb := sq.Select("DISTINCT tag").From("dahua_device_tags").OrderBy("tag")
+
+	var res []string
+	if err := ssq.Query(ctx, app.DB, &res, authFilter(ctx, sb, "dahua_device_tags.device_id", levelDefault)); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ListDeviceTagsMap returns the tags of every device keyed by device ID.
+// It does not check permissions so callers must only look up devices the actor can access.
+func ListDeviceTagsMap(ctx context.Context) (map[int64][]string, error) {
+	v, err := app.DB.C().DahuaListAllDeviceTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[int64][]string)
+	for _, v := range v {
+		tags[v.DeviceID] = append(tags[v.DeviceID], v.Tag)
+	}
+	return tags, nil
+}
+
+// DeviceHasTags returns true if the device has any of the tags, without checking permissions.
+func DeviceHasTags(ctx context.Context, deviceID int64, tags []string) (bool, error) {
+	tags = normalizeTags(tags)
+	if len(tags) == 0 {
+		return false, nil
+	}
+
+	deviceTags, err := app.DB.C().DahuaListDeviceTags(ctx, deviceID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, tag := range deviceTags {
+		if slices.Contains(tags, tag) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func ListTagPermissions(ctx context.Context) ([]repo.DahuaListTagPermissionsRow, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	return app.DB.C().DahuaListTagPermissions(ctx)
+}
+
+type SetTagPermissionParams struct {
+	Tag string
+	// UserID or GroupID must be set, but not both.
+	UserID  int64
+	GroupID int64
+	Level   models.DahuaPermissionLevel
+}
+
+// SetTagPermission grants the level to a user or group on every device with the tag, including devices tagged later.
+func SetTagPermission(ctx context.Context, arg SetTagPermissionParams) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	tags := normalizeTags([]string{arg.Tag})
+	if len(tags) != 1 {
+		return core.NewFieldError("Tag", "Tag is required.")
+	}
+	tag := tags[0]
+
+	if err := validateTags(ctx, tags); err != nil {
+		return err
+	}
+	if err := core.ValidateStruct(ctx, _Permission{Level: arg.Level}); err != nil {
+		return err
+	}
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	switch {
+	case arg.UserID != 0 && arg.GroupID == 0:
+		err = tx.C().DahuaUpsertUserTagPermission(ctx, repo.DahuaUpsertUserTagPermissionParams{
+			UserID: core.NewNullInt64(arg.UserID),
+			Tag:    tag,
+			Level:  arg.Level,
+		})
+	case arg.GroupID != 0 && arg.UserID == 0:
+		err = tx.C().DahuaUpsertGroupTagPermission(ctx, repo.DahuaUpsertGroupTagPermissionParams{
+			GroupID: core.NewNullInt64(arg.GroupID),
+			Tag:     tag,
+			Level:   arg.Level,
+		})
+	default:
+		return ErrInvalidPermissionSubject
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.DahuaTagPermissionUpdated.Create(tag)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type DeleteTagPermissionParams struct {
+	Tag string
+	// UserID or GroupID must be set, but not both.
+	UserID  int64
+	GroupID int64
+}
+
+func DeleteTagPermission(ctx context.Context, arg DeleteTagPermissionParams) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	tag := strings.ToLower(strings.TrimSpace(arg.Tag))
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var rows int64
+	switch {
+	case arg.UserID != 0 && arg.GroupID == 0:
+		rows, err = tx.C().DahuaDeleteUserTagPermission(ctx, repo.DahuaDeleteUserTagPermissionParams{
+			UserID: core.NewNullInt64(arg.UserID),
+			Tag:    tag,
+		})
+	case arg.GroupID != 0 && arg.UserID == 0:
+		rows, err = tx.C().DahuaDeleteGroupTagPermission(ctx, repo.DahuaDeleteGroupTagPermissionParams{
+			GroupID: core.NewNullInt64(arg.GroupID),
+			Tag:     tag,
+		})
+	default:
+		return ErrInvalidPermissionSubject
+	}
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return nil
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.DahuaTagPermissionUpdated.Create(tag)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
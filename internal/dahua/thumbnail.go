@@ -10,6 +10,7 @@ import (
 type ThumbnailForeignKeys struct {
 	FileID            int64
 	EmailAttachmentID int64
+	SnapshotID        int64
 }
 
 type Thumbnail struct {
@@ -21,6 +22,7 @@ func CreateThumbnail(ctx context.Context, fk ThumbnailForeignKeys, width, height
 	thumbnail, err := app.DB.C().DahuaCreateThumbnail(ctx, repo.DahuaCreateThumbnailParams{
 		EmailAttachmentID: core.Int64ToNullInt64(fk.EmailAttachmentID),
 		FileID:            core.Int64ToNullInt64(fk.FileID),
+		SnapshotID:        core.Int64ToNullInt64(fk.SnapshotID),
 		Width:             int64(width),
 		Height:            int64(height),
 	})
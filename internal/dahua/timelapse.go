@@ -0,0 +1,131 @@
+package dahua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/ffmpeg"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/types"
+)
+
+var ErrNoSnapshots = fmt.Errorf("no snapshots")
+
+type CreateTimelapseParams struct {
+	DeviceID  int64
+	Channel   int64
+	Start     time.Time
+	End       time.Time
+	Framerate int
+}
+
+// CreateTimelapse stitches the snapshots between start and end into an MP4 saved to the afero file system.
+func CreateTimelapse(ctx context.Context, arg CreateTimelapseParams) (int64, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return 0, err
+	}
+
+	if arg.Framerate <= 0 {
+		arg.Framerate = 30
+	}
+
+	names, err := app.DB.C().DahuaListSnapshotFilesForTimelapse(ctx, repo.DahuaListSnapshotFilesForTimelapseParams{
+		DeviceID: arg.DeviceID,
+		Channel:  arg.Channel,
+		Start:    types.NewTime(arg.Start),
+		End:      types.NewTime(arg.End),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(names) == 0 {
+		return 0, ErrNoSnapshots
+	}
+
+	id, err := app.DB.C().DahuaCreateTimelapse(ctx, repo.DahuaCreateTimelapseParams{
+		DeviceID:   arg.DeviceID,
+		Channel:    arg.Channel,
+		StartTime:  types.NewTime(arg.Start),
+		EndTime:    types.NewTime(arg.End),
+		FrameCount: int64(len(names)),
+		CreatedAt:  types.NewTime(time.Now()),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := createTimelapseFile(ctx, id, names, arg.Framerate); err != nil {
+		// Failed timelapses are not kept
+		return 0, errors.Join(err, app.DB.C().DahuaDeleteTimelapse(context.WithoutCancel(ctx), id))
+	}
+
+	app.Hub.DahuaTimelapseCreated(bus.DahuaTimelapseCreated{
+		DeviceID:    arg.DeviceID,
+		TimelapseID: id,
+	})
+
+	return id, nil
+}
+
+// createTimelapseFile encodes the snapshots into the timelapse's file.
+// The file is deleted when encoding fails.
+func createTimelapseFile(ctx context.Context, id int64, names []string, framerate int) error {
+	aferoFile, err := createAferoFile(ctx, aferoForeignKeys{TimelapseID: id}, newAferoFileName("mp4"))
+	if err != nil {
+		return err
+	}
+
+	rd, wr := io.Pipe()
+	go func() {
+		wr.CloseWithError(copySnapshotFiles(wr, names))
+	}()
+	defer rd.Close()
+
+	err = ffmpeg.Timelapse(ctx, rd, aferoFile, ffmpeg.TimelapseConfig{
+		Framerate: framerate,
+	})
+	if err == nil {
+		err = aferoFile.Ready(ctx)
+	}
+	if err != nil {
+		return errors.Join(err, aferoFile.Delete(context.WithoutCancel(ctx)))
+	}
+
+	return aferoFile.Close()
+}
+
+func copySnapshotFiles(w io.Writer, names []string) error {
+	for _, name := range names {
+		err := func() error {
+			file, err := app.AFS.Open(name)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			_, err = io.Copy(w, file)
+			return err
+		}()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ListTimelapses(ctx context.Context, deviceID int64) ([]repo.DahuaListTimelapsesByDeviceRow, error) {
+	ok, err := Level(ctx, deviceID, levelDefault)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, core.ErrForbidden
+	}
+
+	return app.DB.C().DahuaListTimelapsesByDevice(ctx, deviceID)
+}
@@ -0,0 +1,240 @@
+package dahua
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system/action"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// TLSModeVerify verifies the device's certificate with the system's CAs or the device's CA bundle.
+	TLSModeVerify = "verify"
+	// TLSModePin trusts the device's certificate on first use and rejects any other certificate after that.
+	TLSModePin = "pin"
+	// TLSModeInsecure does not verify the device's certificate.
+	TLSModeInsecure = "insecure"
+)
+
+var TLSModes = []string{TLSModeVerify, TLSModePin, TLSModeInsecure}
+
+// CertificateChangedError is returned when a pinned device presents a different certificate.
+type CertificateChangedError struct {
+	Fingerprint    string
+	NewFingerprint string
+}
+
+func (e CertificateChangedError) Error() string {
+	return fmt.Sprintf("certificate changed from %s to %s, reset the fingerprint to trust the new certificate", e.Fingerprint, e.NewFingerprint)
+}
+
+// CertificateFingerprint returns the SHA-256 fingerprint of the certificate.
+func CertificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeTLSMode(mode string) string {
+	if mode == "" {
+		return TLSModeVerify
+	}
+	return mode
+}
+
+func validateTLS(mode, ca string) error {
+	if !slices.Contains(TLSModes, mode) {
+		return core.NewFieldError("TLSMode", "Invalid TLS mode.")
+	}
+	if ca != "" {
+		if ok := x509.NewCertPool().AppendCertsFromPEM([]byte(ca)); !ok {
+			return core.NewFieldError("TLSCA", "No certificates found in CA bundle.")
+		}
+	}
+	return nil
+}
+
+// newTLSConfig returns the TLS config for connecting to the device.
+// It is shared by the RPC, CGI, and file clients so they all trust the same certificates.
+func newTLSConfig(conn Conn) *tls.Config {
+	switch conn.TLSMode {
+	case TLSModeInsecure:
+		return &tls.Config{InsecureSkipVerify: true}
+	case TLSModePin:
+		pin := &tlsPin{
+			deviceID:    conn.ID,
+			fingerprint: conn.TLSFingerprint,
+		}
+		return &tls.Config{
+			// Devices usually have self-signed certificates so the chain is not verified, the fingerprint is
+			InsecureSkipVerify: true,
+			VerifyConnection:   pin.verify,
+		}
+	default:
+		config := &tls.Config{}
+		if conn.TLSCA != "" {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM([]byte(conn.TLSCA)) {
+				log.Error().Int64("id", conn.ID).Msg("Failed to parse device CA bundle")
+			}
+			config.RootCAs = pool
+		}
+		return config
+	}
+}
+
+type tlsPin struct {
+	deviceID int64
+
+	mu          sync.Mutex
+	fingerprint string
+}
+
+func (p *tlsPin) verify(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return &tls.CertificateVerificationError{Err: fmt.Errorf("no certificate")}
+	}
+	fingerprint := CertificateFingerprint(cs.PeerCertificates[0])
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.fingerprint == "" {
+		// Devices that are not saved yet (e.g. connection tests) only pin in memory
+		if p.deviceID == 0 {
+			p.fingerprint = fingerprint
+			return nil
+		}
+
+		pinned, err := pinDeviceTLSFingerprint(p.deviceID, fingerprint)
+		if err != nil {
+			return err
+		}
+		p.fingerprint = pinned
+	}
+
+	if subtle.ConstantTimeCompare([]byte(p.fingerprint), []byte(fingerprint)) != 1 {
+		err := CertificateChangedError{
+			Fingerprint:    p.fingerprint,
+			NewFingerprint: fingerprint,
+		}
+		log.Warn().Int64("id", p.deviceID).Str("fingerprint", p.fingerprint).Str("new-fingerprint", fingerprint).Msg("Device certificate changed")
+		return &tls.CertificateVerificationError{
+			UnverifiedCertificates: cs.PeerCertificates,
+			Err:                    err,
+		}
+	}
+
+	return nil
+}
+
+// pinDeviceTLSFingerprint stores the fingerprint of the device's first certificate.
+// It returns the stored fingerprint, which is a different one when another connection pinned first.
+func pinDeviceTLSFingerprint(id int64, fingerprint string) (string, error) {
+	ctx := core.WithSystemActor(context.Background())
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	before, err := deviceAudit(ctx, tx.C(), id)
+	if err != nil {
+		return "", err
+	}
+
+	rows, err := tx.C().DahuaPinDeviceTLSFingerprint(ctx, repo.DahuaPinDeviceTLSFingerprintParams{
+		TlsFingerprint: core.StringToNullString(fingerprint),
+		ID:             id,
+	})
+	if err != nil {
+		return "", err
+	}
+	if rows == 0 {
+		// Already pinned by another connection
+		v, err := tx.C().DahuaGetDevice(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		if !v.TlsFingerprint.Valid {
+			// The device does not pin anymore
+			return fingerprint, nil
+		}
+		return v.TlsFingerprint.String, nil
+	}
+
+	after, err := deviceAudit(ctx, tx.C(), id)
+	if err != nil {
+		return "", err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.DahuaDeviceUpdated.Create(id).WithDiff(before, after)); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	log.Info().Int64("id", id).Str("fingerprint", fingerprint).Msg("Pinned device certificate")
+
+	return fingerprint, nil
+}
+
+// ResetDeviceTLSFingerprint forgets the pinned certificate so the device's next certificate is trusted.
+func ResetDeviceTLSFingerprint(ctx context.Context, id int64) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := deviceAudit(ctx, tx.C(), id)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.C().DahuaResetDeviceTLSFingerprint(ctx, id); err != nil {
+		return err
+	}
+
+	after, err := deviceAudit(ctx, tx.C(), id)
+	if err != nil {
+		return err
+	}
+
+	if err := system.CreateEvent(ctx, tx.C(), action.DahuaDeviceUpdated.Create(id).WithDiff(before, after)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	app.Hub.DahuaDeviceUpdated(bus.DahuaDeviceUpdated{
+		DeviceID: id,
+	})
+
+	return nil
+}
+
+func normalizeTLSCA(ca string) string {
+	return strings.TrimSpace(ca)
+}
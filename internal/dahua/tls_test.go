@@ -0,0 +1,93 @@
+package dahua
+
+import (
+	"context"
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	get := func(conn Conn) error {
+		client := http.Client{Transport: &http.Transport{TLSClientConfig: newTLSConfig(conn)}}
+		res, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+
+	cert := server.Certificate()
+	fingerprint := CertificateFingerprint(cert)
+	ca := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+
+	assert.Error(t, get(Conn{TLSMode: TLSModeVerify}))
+	assert.NoError(t, get(Conn{TLSMode: TLSModeVerify, TLSCA: ca}))
+	assert.NoError(t, get(Conn{TLSMode: TLSModeInsecure}))
+	assert.NoError(t, get(Conn{TLSMode: TLSModePin, TLSFingerprint: fingerprint}))
+
+	err := get(Conn{TLSMode: TLSModePin, TLSFingerprint: "0000"})
+	var changedErr CertificateChangedError
+	require.True(t, errors.As(err, &changedErr))
+	assert.Equal(t, fingerprint, changedErr.NewFingerprint)
+}
+
+func TestNewTLSConfigPin(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	fingerprint := CertificateFingerprint(server.Certificate())
+
+	// The connection was created before the device was pinned by another connection
+	get := func() error {
+		conn := Conn{ID: 1, TLSMode: TLSModePin}
+		client := http.Client{Transport: &http.Transport{TLSClientConfig: newTLSConfig(conn)}}
+		res, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+	storedFingerprint := func() string {
+		var v sql.NullString
+		require.NoError(t, app.DB.QueryRowContext(context.Background(), "SELECT tls_fingerprint FROM dahua_devices WHERE id = 1").Scan(&v))
+		return v.String
+	}
+
+	t.Run("not pinned", func(t *testing.T) {
+		useTestApp(t, App{DB: newTestDB(t, seedDevices(1), "UPDATE dahua_devices SET tls_mode = 'pin'")})
+
+		assert.NoError(t, get())
+		assert.Equal(t, fingerprint, storedFingerprint())
+	})
+
+	t.Run("pinned same certificate", func(t *testing.T) {
+		useTestApp(t, App{DB: newTestDB(t, seedDevices(1), "UPDATE dahua_devices SET tls_mode = 'pin', tls_fingerprint = '"+fingerprint+"'")})
+
+		assert.NoError(t, get())
+	})
+
+	t.Run("pinned different certificate", func(t *testing.T) {
+		useTestApp(t, App{DB: newTestDB(t, seedDevices(1), "UPDATE dahua_devices SET tls_mode = 'pin', tls_fingerprint = '0000'")})
+
+		var changedErr CertificateChangedError
+		require.True(t, errors.As(get(), &changedErr))
+		assert.Equal(t, "0000", changedErr.Fingerprint)
+		assert.Equal(t, fingerprint, changedErr.NewFingerprint)
+		assert.Equal(t, "0000", storedFingerprint())
+	})
+}
+
+func TestValidateTLS(t *testing.T) {
+	assert.NoError(t, validateTLS(TLSModePin, ""))
+	assert.Error(t, validateTLS("none", ""))
+	assert.Error(t, validateTLS(TLSModeVerify, "not a certificate"))
+}
@@ -12,8 +12,10 @@ import (
 	"github.com/ItsNotGoodName/ipcmanview/internal/bus"
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
 	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
 	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuacgi"
 	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuaevents"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc"
 	"github.com/ItsNotGoodName/ipcmanview/pkg/pubsub"
 	"github.com/ItsNotGoodName/ipcmanview/pkg/sutureext"
 	"github.com/rs/zerolog/log"
@@ -246,6 +248,14 @@ func (w QuickScanWorker) scan(ctx context.Context) error {
 		return err
 	}
 
+	caps, err := GetCapabilities(ctx, client)
+	if err != nil {
+		return err
+	}
+	if !caps.Storage {
+		return nil
+	}
+
 	return Scan(ctx, client.RPC, client.Conn, models.DahuaScanType_Quick)
 }
 
@@ -277,9 +287,12 @@ func (w EventWorker) Serve(ctx context.Context) error {
 }
 
 func (w EventWorker) serve(ctx context.Context) error {
-	c := dahuacgi.NewClient(http.Client{}, w.device.URL, w.device.Username, w.device.Password)
+	client, err := app.Store.GetClient(ctx, w.device.ID)
+	if err != nil {
+		return err
+	}
 
-	manager, err := dahuacgi.EventManagerGet(ctx, c, 0)
+	manager, err := dahuacgi.EventManagerGet(ctx, client.CGI, 0)
 	if err != nil {
 		var httpErr dahuacgi.HTTPError
 		if errors.As(err, &httpErr) && slices.Contains([]int{
@@ -313,21 +326,23 @@ func (w EventWorker) serve(ctx context.Context) error {
 	}
 }
 
-func NewCoaxialWorker(hooks WorkerHooks, deviceID int64) CoaxialWorker {
+func NewCoaxialWorker(hooks WorkerHooks, pub *pubsub.Pub, deviceID int64) CoaxialWorker {
 	return CoaxialWorker{
 		hooks: hooks,
 		worker: Worker{
 			DeviceID: deviceID,
 			Type:     models.DahuaWorkerType_Coaxial,
 		},
+		pub:      pub,
 		deviceID: deviceID,
 	}
 }
 
-// CoaxialWorker publishes coaxial status to the bus.
+// CoaxialWorker publishes coaxial status of each enabled channel to the bus.
 type CoaxialWorker struct {
 	hooks    WorkerHooks
 	worker   Worker
+	pub      *pubsub.Pub
 	deviceID int64
 }
 
@@ -340,57 +355,324 @@ func (w CoaxialWorker) Serve(ctx context.Context) error {
 	return sutureext.SanitizeError(ctx, err)
 }
 
-func (w CoaxialWorker) serve(ctx context.Context) error {
-	client, err := app.Store.GetClient(ctx, w.deviceID)
-	if err != nil {
-		return err
-	}
+type coaxialChannelState struct {
+	channel int
+	status  models.DahuaCoaxialStatus
+}
 
-	channel := 1
+func (w CoaxialWorker) serve(ctx context.Context) error {
+	// Channels or capabilities were changed
+	reloadC := make(chan struct{}, 1)
 
-	// Does this device support coaxial?
-	caps, err := GetCoaxialCaps(ctx, client.RPC, channel)
+	// Subscribe
+	sub, err := w.pub.
+		Subscribe().
+		Function(func(ctx context.Context, event pubsub.Event) error {
+			switch e := event.(type) {
+			case bus.DahuaChannelsUpdated:
+				if e.DeviceID == w.deviceID {
+					core.FlagChannel(reloadC)
+				}
+			case bus.DahuaCapabilitiesUpdated:
+				if e.DeviceID == w.deviceID {
+					core.FlagChannel(reloadC)
+				}
+			}
+			return nil
+		})
 	if err != nil {
 		return err
 	}
-	if !(caps.SupportControlSpeaker || caps.SupportControlLight || caps.SupportControlFullcolorLight) {
-		return suture.ErrDoNotRestart
-	}
+	defer sub.Close()
 
-	// Get and publish initial coaxial status
-	coaxialStatus, err := GetCoaxialStatus(ctx, client.RPC, channel)
+	client, err := app.Store.GetClient(ctx, w.deviceID)
 	if err != nil {
 		return err
 	}
-	app.Hub.DahuaCoaxialStatus(bus.DahuaCoaxialStatus{
-		DeviceID:      w.deviceID,
-		Channel:       channel,
-		CoaxialStatus: coaxialStatus,
-	})
+
+	core.FlagChannel(reloadC)
 
 	t := time.NewTicker(1 * time.Second)
+	defer t.Stop()
 
-	// Get and send coaxial status if it changes on an interval
+	var states []coaxialChannelState
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
+		case <-reloadC:
+			states, err = w.load(ctx, client)
+			if err != nil {
+				return err
+			}
+			continue
 		case <-t.C:
 		}
 
-		s, err := GetCoaxialStatus(ctx, client.RPC, channel)
-		if err != nil {
-			return err
-		}
-		if coaxialStatus.Speaker == s.Speaker && coaxialStatus.WhiteLight == s.WhiteLight {
-			continue
+		// Get and send coaxial status if it changes on an interval
+		for i := range states {
+			s, err := GetCoaxialStatus(ctx, client.RPC, states[i].channel)
+			if err != nil {
+				return err
+			}
+			if states[i].status.Speaker == s.Speaker && states[i].status.WhiteLight == s.WhiteLight {
+				continue
+			}
+			states[i].status = s
+
+			app.Hub.DahuaCoaxialStatus(bus.DahuaCoaxialStatus{
+				DeviceID:      w.deviceID,
+				Channel:       states[i].channel,
+				CoaxialStatus: s,
+			})
 		}
-		coaxialStatus = s
+	}
+}
+
+// load returns the enabled channels that support coaxial and publishes their initial status.
+func (w CoaxialWorker) load(ctx context.Context, client Client) ([]coaxialChannelState, error) {
+	caps, err := GetCapabilities(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	if !caps.Coaxial {
+		return nil, nil
+	}
+
+	channels, err := ListCoaxialChannels(ctx, w.deviceID)
+	if err != nil {
+		return nil, err
+	}
 
+	return loadCoaxialChannels(ctx, w.deviceID, client.RPC, channels)
+}
+
+// loadCoaxialChannels returns the state of each channel and publishes their initial status.
+func loadCoaxialChannels(ctx context.Context, deviceID int64, conn dahuarpc.Conn, channels []repo.DahuaChannel) ([]coaxialChannelState, error) {
+	var states []coaxialChannelState
+	for _, v := range channels {
+		channel := int(v.Channel)
+
+		// Get and publish initial coaxial status
+		status, err := GetCoaxialStatus(ctx, conn, channel)
+		if err != nil {
+			return nil, err
+		}
 		app.Hub.DahuaCoaxialStatus(bus.DahuaCoaxialStatus{
-			DeviceID:      w.deviceID,
+			DeviceID:      deviceID,
 			Channel:       channel,
-			CoaxialStatus: coaxialStatus,
+			CoaxialStatus: status,
 		})
+
+		states = append(states, coaxialChannelState{
+			channel: channel,
+			status:  status,
+		})
+	}
+
+	return states, nil
+}
+
+func NewSnapshotWorker(hooks WorkerHooks, pub *pubsub.Pub, deviceID int64) SnapshotWorker {
+	return SnapshotWorker{
+		hooks: hooks,
+		worker: Worker{
+			DeviceID: deviceID,
+			Type:     models.DahuaWorkerType_Snapshot,
+		},
+		pub:      pub,
+		deviceID: deviceID,
+	}
+}
+
+// SnapshotWorker captures snapshots on the device's snapshot schedules and events.
+type SnapshotWorker struct {
+	hooks    WorkerHooks
+	worker   Worker
+	pub      *pubsub.Pub
+	deviceID int64
+}
+
+func (w SnapshotWorker) String() string {
+	return fmt.Sprintf("dahua.SnapshotWorker(id=%d)", w.deviceID)
+}
+
+func (w SnapshotWorker) Serve(ctx context.Context) error {
+	err := w.hooks.Serve(ctx, w.worker, true, w.serve)
+	return sutureext.SanitizeError(ctx, err)
+}
+
+func (w SnapshotWorker) serve(ctx context.Context) error {
+	// Snapshot schedules were changed
+	reloadC := make(chan struct{}, 1)
+	// Event wants snapshots
+	eventC := make(chan bus.DahuaEvent, 10)
+
+	// Subscribe
+	sub, err := w.pub.
+		Subscribe().
+		Function(func(ctx context.Context, event pubsub.Event) error {
+			switch e := event.(type) {
+			case bus.DahuaSnapshotScheduleUpdated:
+				if e.DeviceID == w.deviceID {
+					core.FlagChannel(reloadC)
+				}
+			case bus.DahuaChannelsUpdated:
+				if e.DeviceID == w.deviceID {
+					core.FlagChannel(reloadC)
+				}
+			case bus.DahuaEventRulesUpdated:
+				core.FlagChannel(reloadC)
+			case bus.DahuaEvent:
+				if e.Event.DeviceID != w.deviceID || e.Event.ID == 0 || (e.EventRule.SnapshotCount <= 0 && e.EventRule.PreSnapshotCount <= 0) {
+					return nil
+				}
+
+				switch e.Event.Action {
+				case dahuaevents.ActionStart, dahuaevents.ActionPulse:
+					select {
+					case eventC <- e:
+					default:
+						log.Warn().Str("service", w.String()).Int64("event-id", e.Event.ID).Msg("Dropped event snapshots")
+					}
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	core.FlagChannel(reloadC)
+
+	var schedules []snapshotScheduleState
+	// Snapshots from before events
+	buffer := newSnapshotBuffer()
+	var bufferChannels []repo.DahuaChannel
+	var bufferTicker *time.Ticker
+	// bufferPassEnd is when the last pass of buffered snapshots finished.
+	var bufferPassEnd time.Time
+	defer func() {
+		if bufferTicker != nil {
+			bufferTicker.Stop()
+		}
+	}()
+	for {
+		var bufferC <-chan time.Time
+		if bufferTicker != nil {
+			bufferC = bufferTicker.C
+		}
+
+		// Wait for the closest capture
+		var timerC <-chan time.Time
+		var timer *time.Timer
+		if len(schedules) > 0 {
+			next := schedules[0].next
+			for _, v := range schedules[1:] {
+				if v.next.Before(next) {
+					next = v.next
+				}
+			}
+			timer = time.NewTimer(time.Until(next))
+			timerC = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return ctx.Err()
+		case <-reloadC:
+			if timer != nil {
+				timer.Stop()
+			}
+
+			dbSchedules, err := app.DB.C().DahuaListEnabledSnapshotSchedulesByDevice(ctx, w.deviceID)
+			if err != nil {
+				return err
+			}
+			schedules = newSnapshotScheduleStates(dbSchedules, time.Now())
+
+			preSnapshotCount, err := app.DB.C().DahuaGetMaxPreSnapshotCount(ctx, w.deviceID)
+			if err != nil {
+				return err
+			}
+			buffer.resize(int(preSnapshotCount))
+			if preSnapshotCount > 0 {
+				bufferChannels, err = ListEnabledChannels(ctx, w.deviceID)
+				if err != nil {
+					return err
+				}
+				if bufferTicker == nil {
+					bufferTicker = time.NewTicker(eventSnapshotInterval)
+				}
+			} else if bufferTicker != nil {
+				bufferTicker.Stop()
+				bufferTicker = nil
+			}
+		case e := <-eventC:
+			if timer != nil {
+				timer.Stop()
+			}
+
+			client, err := app.Store.GetClient(ctx, w.deviceID)
+			if err != nil {
+				return err
+			}
+
+			pre := buffer.last(int(e.Event.Index)+1, int(e.EventRule.PreSnapshotCount), e.Event.CreatedAt.Time)
+			if err := CreateEventSnapshots(ctx, client, e.Event, int(e.EventRule.SnapshotCount), pre); err != nil {
+				log.Err(err).Str("service", w.String()).Int64("event-id", e.Event.ID).Msg("Failed to create event snapshots")
+			}
+		case tick := <-bufferC:
+			if timer != nil {
+				timer.Stop()
+			}
+
+			// Skip the tick that was queued while the last pass was still running
+			if tick.Before(bufferPassEnd) {
+				continue
+			}
+
+			client, err := app.Store.GetClient(ctx, w.deviceID)
+			if err != nil {
+				return err
+			}
+
+			for _, channel := range bufferChannels {
+				v, err := captureBufferedSnapshot(ctx, client, int(channel.Channel))
+				if err != nil {
+					log.Err(err).Str("service", w.String()).Int64("channel", channel.Channel).Msg("Failed to capture buffered snapshot")
+					continue
+				}
+				buffer.push(int(channel.Channel), v)
+			}
+			bufferPassEnd = time.Now()
+		case now := <-timerC:
+			client, err := app.Store.GetClient(ctx, w.deviceID)
+			if err != nil {
+				return err
+			}
+
+			for i := range schedules {
+				if schedules[i].next.After(now) {
+					continue
+				}
+
+				enabled, err := channelEnabled(ctx, w.deviceID, schedules[i].channel)
+				if err != nil {
+					return err
+				}
+				if enabled {
+					if _, err := CreateSnapshot(ctx, client, schedules[i].channel); err != nil {
+						log.Err(err).Str("service", w.String()).Int("channel", schedules[i].channel).Msg("Failed to create scheduled snapshot")
+					}
+				}
+
+				schedules[i].next = now.Truncate(schedules[i].interval).Add(schedules[i].interval)
+			}
+		}
 	}
 }
@@ -60,10 +60,15 @@ func (h DefaultWorkerHooks) Serve(ctx context.Context, w Worker, connected bool,
 	if err != nil {
 		return err
 	}
+	maintenance, err := inMaintenance(ctx, w.DeviceID, time.Now())
+	if err != nil {
+		log.Err(err).Int64("id", w.DeviceID).Msg("Failed to check maintenance")
+	}
 	app.Hub.DahuaWorkerDisconnected(bus.DahuaWorkerDisconnected{
-		DeviceID: w.DeviceID,
-		Type:     w.Type,
-		Error:    err,
+		DeviceID:    w.DeviceID,
+		Type:        w.Type,
+		Error:       serveError,
+		Maintenance: maintenance,
 	})
 
 	return serveError
@@ -104,12 +104,21 @@ func (c Conn) haSyncDevice(ctx context.Context, id int64) error {
 		return nil
 	}
 
-	coaxialCaps, err := dahua.GetCoaxialCaps(ctx, client.RPC, 1)
+	caps, err := dahua.GetCapabilities(ctx, client)
 	if err != nil {
-		log.Err(err).Msg("Failed to get coaxial caps")
+		log.Err(err).Msg("Failed to get capabilities")
 		return nil
 	}
 
+	// Coaxial entities are created for each enabled channel that supports coaxial
+	var channels []repo.DahuaChannel
+	if caps.Coaxial {
+		channels, err = dahua.ListCoaxialChannels(ctx, id)
+		if err != nil {
+			return err
+		}
+	}
+
 	deviceID := mqtt.Int(device.ID)
 	deviceUID := newDeviceUID(deviceID)
 
@@ -146,51 +155,74 @@ func (c Conn) haSyncDevice(ctx context.Context, id int64) error {
 		}
 	}
 
-	// white_light
-	if coaxialCaps.SupportControlLight {
-		topicDahuaIDWhiteLight := mqtt.Topic(c.conn.Topic.Join("dahua", deviceID, "white_light"))
-
-		binarySensor := mqtt.HaBinarySensor{HaEntity: haEntity}
-		binarySensor.StateTopic = string(topicDahuaIDWhiteLight)
-		binarySensor.UniqueId = newDeviceUID(deviceID, "white_light")
-		binarySensor.Name = "White Light"
-		binarySensor.Icon = "mdi:lightbulb"
-
-		b, err := json.Marshal(binarySensor)
+	for _, channel := range channels {
+		coaxialCaps, err := dahua.GetCoaxialCaps(ctx, client.RPC, int(channel.Channel))
 		if err != nil {
-			return err
+			log.Err(err).Int64("channel", channel.Channel).Msg("Failed to get coaxial caps")
+			return nil
 		}
 
-		topicConfig := c.haTopic.Join("binary_sensor", deviceUID, "white_light", "config")
-		if err := mqtt.Wait(c.conn.Client.Publish(topicConfig, 0, true, b)); err != nil {
-			return err
+		// The first channel keeps the IDs it had before devices had channels
+		extra := []string{}
+		namePrefix := ""
+		if channel.Channel > 1 {
+			extra = append(extra, mqtt.Int(channel.Channel))
+		}
+		if device.Feature.EQ(models.DahuaFeature_NVR) && channel.Name != "" {
+			namePrefix = channel.Name + " "
 		}
-	}
 
-	// speaker
-	if coaxialCaps.SupportControlSpeaker {
-		topicDahuaIDSpeaker := mqtt.Topic(c.conn.Topic.Join("dahua", deviceID, "speaker"))
+		// white_light
+		if coaxialCaps.SupportControlLight {
+			binarySensor := mqtt.HaBinarySensor{HaEntity: haEntity}
+			binarySensor.StateTopic = c.coaxialTopic(deviceID, int(channel.Channel), "white_light")
+			binarySensor.UniqueId = newDeviceUID(deviceID, append(extra, "white_light")...)
+			binarySensor.Name = namePrefix + "White Light"
+			binarySensor.Icon = "mdi:lightbulb"
 
-		binarySensor := mqtt.HaBinarySensor{HaEntity: haEntity}
-		binarySensor.StateTopic = string(topicDahuaIDSpeaker)
-		binarySensor.UniqueId = newDeviceUID(deviceID, "speaker")
-		binarySensor.Name = "Speaker"
-		binarySensor.Icon = "mdi:bullhorn"
+			b, err := json.Marshal(binarySensor)
+			if err != nil {
+				return err
+			}
 
-		b, err := json.Marshal(binarySensor)
-		if err != nil {
-			return err
+			topicConfig := c.haTopic.Join(append([]string{"binary_sensor", deviceUID}, append(extra, "white_light", "config")...)...)
+			if err := mqtt.Wait(c.conn.Client.Publish(topicConfig, 0, true, b)); err != nil {
+				return err
+			}
 		}
 
-		topicConfig := c.haTopic.Join("binary_sensor", deviceUID, "speaker", "config")
-		if err := mqtt.Wait(c.conn.Client.Publish(topicConfig, 0, true, b)); err != nil {
-			return err
+		// speaker
+		if coaxialCaps.SupportControlSpeaker {
+			binarySensor := mqtt.HaBinarySensor{HaEntity: haEntity}
+			binarySensor.StateTopic = c.coaxialTopic(deviceID, int(channel.Channel), "speaker")
+			binarySensor.UniqueId = newDeviceUID(deviceID, append(extra, "speaker")...)
+			binarySensor.Name = namePrefix + "Speaker"
+			binarySensor.Icon = "mdi:bullhorn"
+
+			b, err := json.Marshal(binarySensor)
+			if err != nil {
+				return err
+			}
+
+			topicConfig := c.haTopic.Join(append([]string{"binary_sensor", deviceUID}, append(extra, "speaker", "config")...)...)
+			if err := mqtt.Wait(c.conn.Client.Publish(topicConfig, 0, true, b)); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
+// coaxialTopic returns the topic of the channel's coaxial status.
+// The first channel does not have the channel in the topic so existing subscribers keep working.
+func (c Conn) coaxialTopic(deviceID string, channel int, name string) string {
+	if channel > 1 {
+		return c.conn.Topic.Join("dahua", deviceID, string(models.DahuaWorkerType_Coaxial), strconv.Itoa(channel), name)
+	}
+	return c.conn.Topic.Join("dahua", deviceID, string(models.DahuaWorkerType_Coaxial), name)
+}
+
 type Event struct {
 	ID        int64           `json:"id"`
 	DeviceID  int64           `json:"device_id"`
@@ -215,6 +247,14 @@ func NewEvent(v repo.DahuaEvent) Event {
 	}
 }
 
+type LoginFailed struct {
+	UserID          int64     `json:"user_id,omitempty"`
+	UsernameOrEmail string    `json:"username_or_email"`
+	IP              string    `json:"ip"`
+	Failures        int64     `json:"failures"`
+	LockedUntil     time.Time `json:"locked_until"`
+}
+
 func (c Conn) Register(hub *bus.Hub) Conn {
 	if c.haEnable {
 		hub.OnDahuaDeviceCreated(c.String(), func(ctx context.Context, event bus.DahuaDeviceCreated) error {
@@ -225,6 +265,14 @@ func (c Conn) Register(hub *bus.Hub) Conn {
 			c.conn.Ready()
 			return c.haSyncDevice(ctx, event.DeviceID)
 		})
+		hub.OnDahuaChannelsUpdated(c.String(), func(ctx context.Context, event bus.DahuaChannelsUpdated) error {
+			c.conn.Ready()
+			return c.haSyncDevice(ctx, event.DeviceID)
+		})
+		hub.OnDahuaCapabilitiesUpdated(c.String(), func(ctx context.Context, event bus.DahuaCapabilitiesUpdated) error {
+			c.conn.Ready()
+			return c.haSyncDevice(ctx, event.DeviceID)
+		})
 	}
 	hub.OnDahuaEvent(c.String(), func(ctx context.Context, event bus.DahuaEvent) error {
 		c.conn.Ready()
@@ -252,8 +300,11 @@ func (c Conn) Register(hub *bus.Hub) Conn {
 	hub.OnDahuaWorkerDisconnected(c.String(), func(ctx context.Context, event bus.DahuaWorkerDisconnected) error {
 		c.conn.Ready()
 
-		if err := publishDeviceError(ctx, c.conn, event.DeviceID, string(event.Type), event.Error); err != nil {
-			return err
+		// Devices in maintenance are expected to go offline so only their state is published
+		if !event.Maintenance {
+			if err := publishDeviceError(ctx, c.conn, event.DeviceID, string(event.Type), event.Error); err != nil {
+				return err
+			}
 		}
 
 		return mqtt.Wait(c.conn.Client.Publish(c.conn.Topic.Join("dahua", mqtt.Int(event.DeviceID), string(event.Type), "state"), 0, true, "offline"))
@@ -267,7 +318,7 @@ func (c Conn) Register(hub *bus.Hub) Conn {
 				payload = "ON"
 			}
 
-			if err := mqtt.Wait(c.conn.Client.Publish(c.conn.Topic.Join("dahua", mqtt.Int(event.DeviceID), string(models.DahuaWorkerType_Coaxial), "white_light"), 0, true, payload)); err != nil {
+			if err := mqtt.Wait(c.conn.Client.Publish(c.coaxialTopic(mqtt.Int(event.DeviceID), event.Channel, "white_light"), 0, true, payload)); err != nil {
 				return err
 			}
 		}
@@ -278,13 +329,29 @@ func (c Conn) Register(hub *bus.Hub) Conn {
 				payload = "ON"
 			}
 
-			if err := mqtt.Wait(c.conn.Client.Publish(c.conn.Topic.Join("dahua", mqtt.Int(event.DeviceID), string(models.DahuaWorkerType_Coaxial), "speaker"), 0, true, payload)); err != nil {
+			if err := mqtt.Wait(c.conn.Client.Publish(c.coaxialTopic(mqtt.Int(event.DeviceID), event.Channel, "speaker"), 0, true, payload)); err != nil {
 				return err
 			}
 		}
 
 		return nil
 	})
+	hub.OnAuthLoginFailed(c.String(), func(ctx context.Context, event bus.AuthLoginFailed) error {
+		c.conn.Ready()
+
+		payload, err := json.Marshal(LoginFailed{
+			UserID:          event.UserID,
+			UsernameOrEmail: event.UsernameOrEmail,
+			IP:              event.IP,
+			Failures:        event.Failures,
+			LockedUntil:     event.LockedUntil,
+		})
+		if err != nil {
+			return err
+		}
+
+		return mqtt.Wait(c.conn.Client.Publish(c.conn.Topic.Join("auth", "login_failed"), 0, false, payload))
+	})
 	hub.OnDahuaFileCursorUpdated(c.String(), func(ctx context.Context, event bus.DahuaFileCursorUpdated) error {
 		c.conn.Ready()
 
@@ -81,11 +81,23 @@ func (s *session) Data(r io.Reader) error {
 	ctx := s.ctx
 	log := s.log.With().Logger()
 
-	// Get device by IP
+	// Read
+	e, err := enmime.ReadEnvelope(r)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read envelope")
+		return err
+	}
+
+	// Parse content
+	content := dahua.ParseEmailContent(e.Text)
+
+	// Get device by IP, serial, or email
 	host, _ := core.SplitAddress(s.address)
 	device, err := dahua.LoginSMTP(ctx, dahua.LoginSMTPParams{
-		IP:   host,
-		From: s.from,
+		IP:        host,
+		From:      s.from,
+		Serial:    content.SerialNo,
+		ContentIP: content.IPAddress,
 	})
 	if err != nil {
 		if core.IsNotFound(err) {
@@ -96,13 +108,6 @@ func (s *session) Data(r io.Reader) error {
 	}
 	log = log.With().Str("device", device.Name).Logger()
 
-	// Read
-	e, err := enmime.ReadEnvelope(r)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to read envelope")
-		return err
-	}
-
 	// Parse to
 	to := []string{s.to}
 	if addresses, err := e.AddressList("To"); err == nil {
@@ -123,9 +128,6 @@ func (s *session) Data(r io.Reader) error {
 	// Parse subject
 	subject := e.GetHeader("Subject")
 
-	// Parse content
-	content := dahua.ParseEmailContent(e.Text)
-
 	// Create email
 	attachments := make([]dahua.CreateEmailParamsAttachment, 0, len(e.Attachments))
 	for _, a := range e.Attachments {
@@ -0,0 +1,69 @@
+package dahuatasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/dahua"
+	"github.com/ItsNotGoodName/ipcmanview/internal/squeuel"
+)
+
+type ExportPayload struct {
+	ExportID int64
+}
+
+func (p ExportPayload) TaskID() squeuel.Option {
+	return squeuel.TaskID(fmt.Sprintf("%d", p.ExportID))
+}
+
+var CreateExportTask = squeuel.NewTaskBuilder[ExportPayload]("dahua-export:create")
+
+// EnqueueExport creates the export and queues it to be remuxed.
+func EnqueueExport(ctx context.Context, arg dahua.CreateExportParams) (int64, string, error) {
+	tx, err := app.DB.BeginTx(ctx, true)
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	id, err := dahua.CreateExport(ctx, tx, arg)
+	if err != nil {
+		return 0, "", err
+	}
+
+	payload := ExportPayload{
+		ExportID: id,
+	}
+	task, err := CreateExportTask.New(payload, payload.TaskID(), squeuel.MaxRetry(1))
+	if err != nil {
+		return 0, "", err
+	}
+
+	taskID, err := squeuel.EnqueueTaskTx(ctx, tx, app.Hub, task)
+	if err != nil {
+		return 0, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, "", err
+	}
+
+	return id, taskID, nil
+}
+
+func HandleCreateExportTask(ctx context.Context, task *squeuel.Task) error {
+	payload, err := CreateExportTask.Payload(task)
+	if err != nil {
+		return err
+	}
+
+	if err := dahua.RunExport(ctx, payload.ExportID); err != nil {
+		if errors.Is(err, dahua.ErrNoFiles) || errors.Is(err, dahua.ErrExportGap) {
+			return errors.Join(squeuel.ErrSkipRetry, err)
+		}
+		return err
+	}
+
+	return nil
+}
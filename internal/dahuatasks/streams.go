@@ -54,6 +54,10 @@ func HandleSyncStreamTask(ctx context.Context, task *squeuel.Task) error {
 		return err
 	}
 
+	if err := dahua.SyncChannels(ctx, payload.DeviceID, conn.RPC, conn.Conn.Feature); err != nil {
+		return err
+	}
+
 	if !dahua.SupportStream(conn.Conn.Feature) {
 		return nil
 	}
@@ -0,0 +1,66 @@
+package dahuatasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/dahua"
+	"github.com/ItsNotGoodName/ipcmanview/internal/squeuel"
+)
+
+type TimelapsePayload struct {
+	DeviceID  int64
+	Channel   int64
+	Start     time.Time
+	End       time.Time
+	Framerate int
+}
+
+func (p TimelapsePayload) TaskID() squeuel.Option {
+	return squeuel.TaskID(fmt.Sprintf("%d|%d|%d|%d", p.DeviceID, p.Channel, p.Start.Unix(), p.End.Unix()))
+}
+
+var CreateTimelapseTask = squeuel.NewTaskBuilder[TimelapsePayload]("dahua-timelapse:create")
+
+func EnqueueTimelapse(ctx context.Context, payload TimelapsePayload) (string, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return "", err
+	}
+
+	if !payload.Start.Before(payload.End) {
+		return "", core.NewFieldError("End", "End must be after start.")
+	}
+
+	task, err := CreateTimelapseTask.New(payload, payload.TaskID(), squeuel.MaxRetry(1))
+	if err != nil {
+		return "", err
+	}
+
+	return squeuel.EnqueueTask(ctx, app.DB, app.Hub, task)
+}
+
+func HandleCreateTimelapseTask(ctx context.Context, task *squeuel.Task) error {
+	payload, err := CreateTimelapseTask.Payload(task)
+	if err != nil {
+		return err
+	}
+
+	_, err = dahua.CreateTimelapse(ctx, dahua.CreateTimelapseParams{
+		DeviceID:  payload.DeviceID,
+		Channel:   payload.Channel,
+		Start:     payload.Start,
+		End:       payload.End,
+		Framerate: payload.Framerate,
+	})
+	if err != nil {
+		if errors.Is(err, dahua.ErrNoSnapshots) {
+			return errors.Join(squeuel.ErrSkipRetry, err)
+		}
+		return err
+	}
+
+	return nil
+}
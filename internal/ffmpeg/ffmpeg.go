@@ -1,11 +1,15 @@
 package ffmpeg
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -74,3 +78,180 @@ func ImageSnapshot(ctx context.Context, inputPath, outputFormat string, outputWr
 
 	return nil
 }
+
+type TimelapseConfig struct {
+	Framerate int
+	Width     int
+	Height    int
+}
+
+// Timelapse encodes a stream of concatenated images into a fragmented MP4.
+func Timelapse(ctx context.Context, input io.Reader, outputWriter io.Writer, cfg TimelapseConfig) error {
+	var stderr bytes.Buffer
+
+	// ffmpeg -hide_banner -f image2pipe -framerate 30 -i pipe:0 -c:v libx264 -pix_fmt yuv420p -movflags frag_keyframe+empty_moov -f mp4 pipe:1
+	args := []string{
+		"-hide_banner",
+		"-f", "image2pipe",
+		"-framerate", fmt.Sprintf("%d", cfg.Framerate),
+		"-i", "pipe:0",
+		"-c:v", "libx264",
+		"-pix_fmt", "yuv420p",
+	}
+	if cfg.Width != 0 || cfg.Height != 0 {
+		args = append(args, "-vf", fmt.Sprintf("scale=%d:%d", cfg.Width, cfg.Height))
+	}
+	args = append(args, "-movflags", "frag_keyframe+empty_moov", "-f", "mp4", "pipe:1")
+	cmd := exec.CommandContext(
+		ctx,
+		"ffmpeg",
+		args...,
+	)
+	cmd.Stdin = input
+	cmd.Stdout = outputWriter
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", err, stderr.String())
+	}
+
+	return nil
+}
+
+type HLSConfig struct {
+	SegmentDuration time.Duration
+	// ListSize is the number of segments kept in a live playlist.
+	ListSize int
+	// Event keeps every segment in the playlist so that it can be seeked, which is used for recordings.
+	Event bool
+}
+
+// HLS remuxes an RTSP stream into an HLS playlist named index.m3u8 in outputDir until the stream ends or the context is canceled.
+func HLS(ctx context.Context, inputURL, outputDir string, cfg HLSConfig) error {
+	var stderr bytes.Buffer
+
+	// ffmpeg -hide_banner -rtsp_transport tcp -fflags nobuffer -i rtsp://... -c:v copy -c:a aac -f hls -hls_time 1 -hls_list_size 6 -hls_flags delete_segments+omit_endlist index.m3u8
+	args := []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-rtsp_transport", "tcp",
+		"-fflags", "nobuffer",
+		"-i", inputURL,
+		"-c:v", "copy",
+		"-c:a", "aac",
+		"-f", "hls",
+		"-hls_time", fmt.Sprintf("%g", cfg.SegmentDuration.Seconds()),
+	}
+	if cfg.Event {
+		args = append(args,
+			"-hls_playlist_type", "event",
+			"-hls_flags", "independent_segments",
+		)
+	} else {
+		args = append(args,
+			"-hls_list_size", fmt.Sprintf("%d", cfg.ListSize),
+			"-hls_flags", "delete_segments+omit_endlist+independent_segments",
+		)
+	}
+	args = append(args,
+		"-hls_segment_filename", filepath.Join(outputDir, "segment_%d.ts"),
+		filepath.Join(outputDir, "index.m3u8"),
+	)
+	cmd := exec.CommandContext(
+		ctx,
+		"ffmpeg",
+		args...,
+	)
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w: %s", err, stderr.String())
+	}
+
+	return nil
+}
+
+type RemuxConfig struct {
+	// InputFormat forces the input format (e.g. "dhav" for DAV files).
+	InputFormat string
+	// Offset is where the output starts in the input.
+	Offset time.Duration
+	// Duration limits the length of the output when it is not zero.
+	Duration time.Duration
+	// Progress is called with the position of the output as it is written.
+	Progress func(position time.Duration)
+}
+
+// Remux copies the video of the input into a fragmented MP4 without re-encoding it.
+// Audio is converted to AAC because codecs such as G.711 are not supported by MP4 players.
+func Remux(ctx context.Context, input io.Reader, outputWriter io.Writer, cfg RemuxConfig) error {
+	// ffmpeg -hide_banner -loglevel error -nostats -progress pipe:2 -f dhav -i pipe:0 -ss 00:00:06.000 -t 10 -c:v copy -c:a aac -movflags frag_keyframe+empty_moov -f mp4 pipe:1
+	args := []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-nostats",
+		"-progress", "pipe:2",
+	}
+	if cfg.InputFormat != "" {
+		args = append(args, "-f", cfg.InputFormat)
+	}
+	args = append(args, "-i", "pipe:0")
+	if cfg.Offset > 0 {
+		args = append(args, "-ss", fmt.Sprintf("%f", cfg.Offset.Seconds()))
+	}
+	if cfg.Duration > 0 {
+		args = append(args, "-t", fmt.Sprintf("%f", cfg.Duration.Seconds()))
+	}
+	args = append(args,
+		"-c:v", "copy",
+		"-c:a", "aac",
+		"-movflags", "frag_keyframe+empty_moov",
+		"-f", "mp4",
+		"pipe:1",
+	)
+	cmd := exec.CommandContext(
+		ctx,
+		"ffmpeg",
+		args...,
+	)
+	cmd.Stdin = input
+	cmd.Stdout = outputWriter
+
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// Progress is written as key=value lines and everything else is an error
+	var stderr bytes.Buffer
+	scanner := bufio.NewScanner(stderrPipe)
+	for scanner.Scan() {
+		line := scanner.Text()
+		key, value, found := strings.Cut(line, "=")
+		if !found || strings.ContainsAny(key, " :") {
+			stderr.WriteString(line)
+			stderr.WriteString("\n")
+			continue
+		}
+
+		if key == "out_time_us" && cfg.Progress != nil {
+			us, err := strconv.ParseInt(value, 10, 64)
+			if err == nil && us >= 0 {
+				cfg.Progress(time.Duration(us) * time.Microsecond)
+			}
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%w: %s", err, stderr.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package mail
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/emersion/go-smtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// relay is a local stand-in for an SMTP relay that keeps the last message.
+type relay struct {
+	from string
+	to   []string
+	data []byte
+}
+
+func (r *relay) NewSession(c *smtp.Conn) (smtp.Session, error) {
+	return &relaySession{relay: r}, nil
+}
+
+type relaySession struct {
+	relay *relay
+}
+
+func (s *relaySession) Reset()        {}
+func (s *relaySession) Logout() error { return nil }
+
+func (s *relaySession) AuthPlain(username, password string) error {
+	return nil
+}
+
+func (s *relaySession) Mail(from string, opts *smtp.MailOptions) error {
+	s.relay.from = from
+	return nil
+}
+
+func (s *relaySession) Rcpt(to string, opts *smtp.RcptOptions) error {
+	s.relay.to = append(s.relay.to, to)
+	return nil
+}
+
+func (s *relaySession) Data(r io.Reader) error {
+	b, err := io.ReadAll(r)
+	s.relay.data = b
+	return err
+}
+
+func TestSMTPSender(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	r := &relay{}
+	server := smtp.NewServer(r)
+	server.Domain = "localhost"
+	server.AllowInsecureAuth = true
+	go server.Serve(l)
+	t.Cleanup(func() { server.Close() })
+
+	sender, err := NewSMTPSender("smtp://user:pass@"+l.Addr().String(), "ipcmanview@example.com")
+	require.NoError(t, err)
+
+	err = sender.Send(context.Background(), Message{
+		To:      []string{"user@example.com"},
+		Subject: "Reset password",
+		Body:    "Line 1\nLine 2",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "ipcmanview@example.com", r.from)
+	assert.Equal(t, []string{"user@example.com"}, r.to)
+	assert.Contains(t, string(r.data), "Subject: Reset password\r\n")
+	assert.Contains(t, string(r.data), "\r\n\r\nLine 1\r\nLine 2")
+}
+
+func TestNewSMTPSender(t *testing.T) {
+	_, err := NewSMTPSender("http://example.com", "from@example.com")
+	assert.Error(t, err)
+
+	_, err = NewSMTPSender("smtp://example.com", "")
+	assert.Error(t, err)
+
+	sender, err := NewSMTPSender("smtps://example.com", "from@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "example.com:465", sender.address)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"net/url"
+	"strings"
 	"text/template"
 
 	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
@@ -60,6 +61,18 @@ type DahuaStream struct {
 	MediamtxPath string
 }
 
+const dahuaPlaybackPathPrefix = "ipcmanview_dahua_playback_"
+
+// DahuaPlaybackPath returns the MediaMTX path used for playing back a recorded file.
+func (c Config) DahuaPlaybackPath(fileID int64) string {
+	return fmt.Sprintf("%s%d", dahuaPlaybackPathPrefix, fileID)
+}
+
+// IsDahuaPlaybackPath returns true when the MediaMTX path was created by DahuaPlaybackPath.
+func (c Config) IsDahuaPlaybackPath(name string) bool {
+	return strings.HasPrefix(name, dahuaPlaybackPathPrefix)
+}
+
 func (c Config) DahuaEmbedPath(stream repo.DahuaStream) string {
 	if stream.MediamtxPath != "" {
 		return stream.MediamtxPath
@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc"
@@ -26,6 +27,7 @@ const (
 	DahuaWorkerType_Event     DahuaWorkerType = "event"
 	DahuaWorkerType_Coaxial   DahuaWorkerType = "coaxial"
 	DahuaWorkerType_QuickScan DahuaWorkerType = "quick-scan"
+	DahuaWorkerType_Snapshot  DahuaWorkerType = "snapshot"
 )
 
 type DahuaWorkerState string
@@ -45,6 +47,8 @@ func (f DahuaFeature) EQ(feature DahuaFeature) bool {
 const (
 	// DahuaFeature_Camera means the device is a camera.
 	DahuaFeature_Camera DahuaFeature = 1 << iota
+	// DahuaFeature_NVR means the device is a network video recorder with multiple channels.
+	DahuaFeature_NVR
 )
 
 type DahuaScanType string
@@ -77,6 +81,19 @@ func (l DahuaPermissionLevel) String() string {
 	}
 }
 
+func ParseDahuaPermissionLevel(s string) (DahuaPermissionLevel, error) {
+	switch s {
+	case "user":
+		return DahuaPermissionLevel_User, nil
+	case "operator":
+		return DahuaPermissionLevel_Operator, nil
+	case "admin":
+		return DahuaPermissionLevel_Admin, nil
+	default:
+		return 0, fmt.Errorf("invalid permission level: %s", s)
+	}
+}
+
 type DahuaError struct {
 	Error string `json:"error"`
 }
@@ -130,6 +147,17 @@ type DahuaCoaxialCaps struct {
 	SupportControlSpeaker        bool `json:"support_control_speaker"`
 }
 
+type DahuaCapabilities struct {
+	Methods     []string  `json:"methods"`
+	PTZ         bool      `json:"ptz"`
+	Coaxial     bool      `json:"coaxial"`
+	AudioInput  bool      `json:"audio_input"`
+	AudioOutput bool      `json:"audio_output"`
+	Storage     bool      `json:"storage"`
+	SmartEvent  bool      `json:"smart_event"`
+	ProbedAt    time.Time `json:"probed_at"`
+}
+
 type DahuaFile struct {
 	Channel     int       `json:"channel"`
 	StartTime   time.Time `json:"start_time"`
@@ -181,13 +209,14 @@ type DahuaPreset struct {
 }
 
 type DahuaEvent struct {
-	ID        int64           `json:"id"`
-	DeviceID  int64           `json:"device_id"`
-	Code      string          `json:"code"`
-	Action    string          `json:"action"`
-	Index     int64           `json:"index"`
-	Data      json.RawMessage `json:"data"`
-	CreatedAt time.Time       `json:"created_at"`
+	ID          int64           `json:"id"`
+	DeviceID    int64           `json:"device_id"`
+	Code        string          `json:"code"`
+	Action      string          `json:"action"`
+	Index       int64           `json:"index"`
+	Data        json.RawMessage `json:"data"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Maintenance bool            `json:"maintenance"`
 }
 
 type DahuaUptime struct {
@@ -22,25 +22,63 @@ type DahuaAferoFile struct {
 	FileID            sql.NullInt64
 	ThumbnailID       sql.NullInt64
 	EmailAttachmentID sql.NullInt64
+	SnapshotID        sql.NullInt64
+	TimelapseID       sql.NullInt64
+	ExportID          sql.NullInt64
 	Name              string
 	Ready             bool
 	Size              int64
 	CreatedAt         types.Time
 }
 
+type DahuaCapability struct {
+	DeviceID    int64
+	Methods     types.StringSlice
+	Ptz         bool
+	Coaxial     bool
+	AudioInput  bool
+	AudioOutput bool
+	Storage     bool
+	SmartEvent  bool
+	ProbedAt    types.Time
+}
+
+type DahuaChannel struct {
+	ID       int64
+	DeviceID int64
+	Channel  int64
+	Name     string
+	Enabled  bool
+}
+
+type DahuaChannelCapability struct {
+	DeviceID int64
+	Channel  int64
+	Coaxial  bool
+}
+
 type DahuaDevice struct {
-	ID         int64
-	Name       string
-	Ip         string
-	Url        types.URL
-	Username   string
-	Password   string
-	Location   types.Location
-	Feature    models.DahuaFeature
-	Email      sql.NullString
-	CreatedAt  types.Time
-	UpdatedAt  types.Time
-	DisabledAt types.NullTime
+	ID             int64
+	Name           string
+	Ip             string
+	Url            types.URL
+	Username       string
+	Password       string
+	Location       types.Location
+	Feature        models.DahuaFeature
+	Email          sql.NullString
+	CreatedAt      types.Time
+	UpdatedAt      types.Time
+	DisabledAt     types.NullTime
+	Serial         sql.NullString
+	TlsMode        string
+	TlsCa          sql.NullString
+	TlsFingerprint sql.NullString
+}
+
+type DahuaDeviceTag struct {
+	DeviceID int64
+	Tag      string
 }
 
 type DahuaEmailAttachment struct {
@@ -64,29 +102,45 @@ type DahuaEmailMessage struct {
 }
 
 type DahuaEvent struct {
-	ID        int64
-	DeviceID  int64
-	Code      string
-	Action    string
-	Index     int64
-	Data      types.JSON
-	CreatedAt types.Time
+	ID          int64
+	DeviceID    int64
+	Code        string
+	Action      string
+	Index       int64
+	Data        types.JSON
+	CreatedAt   types.Time
+	Maintenance bool
 }
 
 type DahuaEventDeviceRule struct {
-	DeviceID   int64
-	Code       string
-	IgnoreDb   bool
-	IgnoreLive bool
-	IgnoreMqtt bool
+	DeviceID         int64
+	Code             string
+	IgnoreDb         bool
+	IgnoreLive       bool
+	IgnoreMqtt       bool
+	SnapshotCount    int64
+	PreSnapshotCount int64
 }
 
 type DahuaEventRule struct {
-	ID         int64
-	Code       string
-	IgnoreDb   bool
-	IgnoreLive bool
-	IgnoreMqtt bool
+	ID               int64
+	Code             string
+	IgnoreDb         bool
+	IgnoreLive       bool
+	IgnoreMqtt       bool
+	SnapshotCount    int64
+	PreSnapshotCount int64
+}
+
+type DahuaExport struct {
+	ID          int64
+	DeviceID    int64
+	Channel     int64
+	StartTime   types.Time
+	EndTime     types.Time
+	Error       string
+	CreatedAt   types.Time
+	CompletedAt types.NullTime
 }
 
 type DahuaFile struct {
@@ -125,6 +179,40 @@ type DahuaFileCursor struct {
 	ScanType     models.DahuaScanType
 }
 
+type DahuaGuestLink struct {
+	ID           int64
+	DeviceID     int64
+	UserID       sql.NullInt64
+	Name         string
+	TokenHash    string
+	Channel      int64
+	Live         bool
+	StartTime    types.NullTime
+	EndTime      types.NullTime
+	MaxViews     int64
+	Views        int64
+	LastViewedAt types.NullTime
+	CreatedAt    types.Time
+	ExpiredAt    types.Time
+	RevokedAt    types.NullTime
+}
+
+type DahuaGuestLinkFile struct {
+	GuestLinkID int64
+	FileID      int64
+}
+
+type DahuaMaintenanceWindow struct {
+	ID        int64
+	DeviceID  sql.NullInt64
+	Tag       sql.NullString
+	UserID    sql.NullInt64
+	Reason    string
+	StartTime types.Time
+	EndTime   types.Time
+	CreatedAt types.Time
+}
+
 type DahuaPermission struct {
 	UserID   sql.NullInt64
 	GroupID  sql.NullInt64
@@ -137,6 +225,24 @@ type DahuaSeed struct {
 	DeviceID sql.NullInt64
 }
 
+type DahuaSnapshot struct {
+	ID        int64
+	DeviceID  int64
+	Channel   int64
+	EventID   sql.NullInt64
+	CreatedAt types.Time
+}
+
+type DahuaSnapshotSchedule struct {
+	ID         int64
+	DeviceID   int64
+	Channel    int64
+	Interval   int64
+	CreatedAt  types.Time
+	UpdatedAt  types.Time
+	DisabledAt types.NullTime
+}
+
 type DahuaStorageDestination struct {
 	ID              int64
 	Name            string
@@ -158,14 +264,32 @@ type DahuaStream struct {
 	MediamtxPath string
 }
 
+type DahuaTagPermission struct {
+	UserID  sql.NullInt64
+	GroupID sql.NullInt64
+	Tag     string
+	Level   models.DahuaPermissionLevel
+}
+
 type DahuaThumbnail struct {
 	ID                int64
 	FileID            sql.NullInt64
 	EmailAttachmentID sql.NullInt64
+	SnapshotID        sql.NullInt64
 	Width             int64
 	Height            int64
 }
 
+type DahuaTimelapse struct {
+	ID         int64
+	DeviceID   int64
+	Channel    int64
+	StartTime  types.Time
+	EndTime    types.Time
+	FrameCount int64
+	CreatedAt  types.Time
+}
+
 type DahuaWorkerEvent struct {
 	ID        int64
 	DeviceID  int64
@@ -182,15 +306,20 @@ type Event struct {
 	Actor     core.ActorType
 	UserID    sql.NullInt64
 	CreatedAt types.Time
+	Ip        string
+	UserAgent string
+	Target    string
+	Diff      types.JSON
 }
 
 type Group struct {
-	ID          int64
-	Name        string
-	Description string
-	CreatedAt   types.Time
-	UpdatedAt   types.Time
-	DisabledAt  types.NullTime
+	ID               int64
+	Name             string
+	Description      string
+	CreatedAt        types.Time
+	UpdatedAt        types.Time
+	DisabledAt       types.NullTime
+	RequireTwoFactor bool
 }
 
 type GroupUser struct {
@@ -199,6 +328,15 @@ type GroupUser struct {
 	CreatedAt types.Time
 }
 
+type LoginLockout struct {
+	ID           int64
+	Kind         string
+	Value        string
+	Failures     int64
+	LastFailedAt types.Time
+	LockedUntil  types.Time
+}
+
 type Squeuel struct {
 	ID          string
 	TaskID      sql.NullString
@@ -221,6 +359,29 @@ type User struct {
 	DisabledAt types.NullTime
 }
 
+type UserOidcIdentity struct {
+	UserID    int64
+	Issuer    string
+	Subject   string
+	CreatedAt types.Time
+}
+
+type UserPasswordReset struct {
+	ID        int64
+	UserID    int64
+	TokenHash string
+	CreatedAt types.Time
+	ExpiredAt types.Time
+	UsedAt    types.NullTime
+}
+
+type UserRecoveryCode struct {
+	ID       int64
+	UserID   int64
+	CodeHash string
+	UsedAt   types.NullTime
+}
+
 type UserSession struct {
 	ID         int64
 	UserID     int64
@@ -232,3 +393,24 @@ type UserSession struct {
 	CreatedAt  types.Time
 	ExpiredAt  types.Time
 }
+
+type UserToken struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	TokenHash  string
+	Level      models.DahuaPermissionLevel
+	ReadOnly   bool
+	LastIp     string
+	LastUsedAt types.NullTime
+	CreatedAt  types.Time
+	ExpiredAt  types.NullTime
+}
+
+type UserTotp struct {
+	UserID    int64
+	Secret    string
+	LastStep  int64
+	CreatedAt types.Time
+	EnabledAt types.NullTime
+}
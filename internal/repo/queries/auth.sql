@@ -83,11 +83,24 @@ SELECT
   user_sessions.last_ip,
   user_sessions.last_used_at,
   users.disabled_at AS 'users_disabled_at',
-  user_sessions.session
+  user_sessions.session,
+  user_totps.enabled_at IS NOT NULL AS 'two_factor_enabled',
+  EXISTS (
+    SELECT
+      1
+    FROM
+      group_users
+      LEFT JOIN groups ON groups.id = group_users.group_id
+    WHERE
+      group_users.user_id = user_sessions.user_id
+      AND groups.require_two_factor = true
+      AND groups.disabled_at IS NULL
+  ) AS 'two_factor_group_required'
 FROM
   user_sessions
   LEFT JOIN users ON users.id = user_sessions.user_id
   LEFT JOIN admins ON admins.user_id = user_sessions.user_id
+  LEFT JOIN user_totps ON user_totps.user_id = user_sessions.user_id
 WHERE
   session = ?
   AND expired_at > sqlc.arg ('now');
@@ -182,6 +195,13 @@ SET
 WHERE
   id = ? RETURNING id;
 
+-- name: AuthUpdateGroupRequireTwoFactor :one
+UPDATE groups
+SET
+  require_two_factor = ?
+WHERE
+  id = ? RETURNING id;
+
 -- name: AuthUpsertAdmin :one
 INSERT OR IGNORE INTO
   admins (user_id, created_at)
@@ -192,3 +212,323 @@ VALUES
 DELETE FROM admins
 WHERE
   user_id = ?;
+
+-- name: AuthCountAdminForUser :one
+SELECT
+  COUNT(*)
+FROM
+  admins
+WHERE
+  user_id = ?;
+
+-- name: AuthCreateUserToken :one
+INSERT INTO
+  user_tokens (
+    user_id,
+    name,
+    token_hash,
+    level,
+    read_only,
+    created_at,
+    expired_at
+  )
+VALUES
+  (?, ?, ?, ?, ?, ?, ?) RETURNING id;
+
+-- name: AuthGetUserTokenForContext :one
+SELECT
+  user_tokens.id as id,
+  user_tokens.user_id as user_id,
+  users.username,
+  admins.user_id IS NOT NULL as 'admin',
+  user_tokens.level,
+  user_tokens.read_only,
+  user_tokens.last_ip,
+  user_tokens.last_used_at,
+  users.disabled_at AS 'users_disabled_at',
+  user_totps.enabled_at IS NOT NULL AS 'two_factor_enabled',
+  EXISTS (
+    SELECT
+      1
+    FROM
+      group_users
+      LEFT JOIN groups ON groups.id = group_users.group_id
+    WHERE
+      group_users.user_id = user_tokens.user_id
+      AND groups.require_two_factor = true
+      AND groups.disabled_at IS NULL
+  ) AS 'two_factor_group_required'
+FROM
+  user_tokens
+  LEFT JOIN users ON users.id = user_tokens.user_id
+  LEFT JOIN admins ON admins.user_id = user_tokens.user_id
+  LEFT JOIN user_totps ON user_totps.user_id = user_tokens.user_id
+WHERE
+  token_hash = ?
+  AND (
+    expired_at IS NULL
+    OR expired_at > sqlc.arg ('now')
+  );
+
+-- name: AuthListUserTokensForUser :many
+SELECT
+  *
+FROM
+  user_tokens
+WHERE
+  user_id = ?
+ORDER BY
+  created_at DESC;
+
+-- name: AuthUpdateUserToken :exec
+UPDATE user_tokens
+SET
+  last_ip = ?,
+  last_used_at = ?
+WHERE
+  id = ?;
+
+-- name: AuthDeleteUserTokenForUser :exec
+DELETE FROM user_tokens
+WHERE
+  id = ?
+  AND user_id = ?;
+
+-- name: AuthGetUserOIDCIdentity :one
+SELECT
+  user_id
+FROM
+  user_oidc_identities
+WHERE
+  issuer = ?
+  AND subject = ?;
+
+-- name: AuthCreateUserOIDCIdentity :exec
+INSERT INTO
+  user_oidc_identities (user_id, issuer, subject, created_at)
+VALUES
+  (?, ?, ?, ?);
+
+-- name: AuthListGroupIDsByName :many
+SELECT
+  id
+FROM
+  groups
+WHERE
+  name IN (sqlc.slice ('names'));
+
+-- name: AuthCreateGroupUser :exec
+INSERT OR IGNORE INTO
+  group_users (user_id, group_id, created_at)
+VALUES
+  (?, ?, ?);
+
+-- name: AuthDeleteGroupUsersForUserAndNotGroups :exec
+DELETE FROM group_users
+WHERE
+  user_id = ?
+  AND group_id NOT IN (sqlc.slice ('group_ids'));
+
+-- name: AuthDeleteGroupUsersForUser :exec
+DELETE FROM group_users
+WHERE
+  user_id = ?;
+
+-- name: AuthGetUserTwoFactorPolicy :one
+SELECT
+  EXISTS (
+    SELECT
+      1
+    FROM
+      user_totps
+    WHERE
+      user_totps.user_id = sqlc.arg ('user_id')
+      AND enabled_at IS NOT NULL
+  ) AS 'enabled',
+  EXISTS (
+    SELECT
+      1
+    FROM
+      admins
+    WHERE
+      admins.user_id = sqlc.arg ('user_id')
+  ) AS 'admin',
+  EXISTS (
+    SELECT
+      1
+    FROM
+      group_users
+      LEFT JOIN groups ON groups.id = group_users.group_id
+    WHERE
+      group_users.user_id = sqlc.arg ('user_id')
+      AND groups.require_two_factor = true
+      AND groups.disabled_at IS NULL
+  ) AS 'group_required';
+
+-- name: AuthGetUserTotp :one
+SELECT
+  *
+FROM
+  user_totps
+WHERE
+  user_id = ?;
+
+-- name: AuthUpsertUserTotp :exec
+INSERT INTO
+  user_totps (user_id, secret, created_at)
+VALUES
+  (?, ?, ?) ON CONFLICT (user_id) DO
+UPDATE
+SET
+  secret = EXCLUDED.secret,
+  last_step = 0,
+  created_at = EXCLUDED.created_at,
+  enabled_at = NULL;
+
+-- name: AuthUpdateUserTotpEnabledAt :exec
+UPDATE user_totps
+SET
+  enabled_at = ?
+WHERE
+  user_id = ?;
+
+-- name: AuthUpdateUserTotpLastStep :execrows
+UPDATE user_totps
+SET
+  last_step = sqlc.arg ('last_step')
+WHERE
+  user_id = sqlc.arg ('user_id')
+  AND last_step < sqlc.arg ('last_step');
+
+-- name: AuthDeleteUserTotp :exec
+DELETE FROM user_totps
+WHERE
+  user_id = ?;
+
+-- name: AuthCreateUserRecoveryCode :exec
+INSERT INTO
+  user_recovery_codes (user_id, code_hash)
+VALUES
+  (?, ?);
+
+-- name: AuthUpdateUserRecoveryCodeUsedAt :execrows
+UPDATE user_recovery_codes
+SET
+  used_at = ?
+WHERE
+  user_id = ?
+  AND code_hash = ?
+  AND used_at IS NULL;
+
+-- name: AuthCountUserRecoveryCodesUnused :one
+SELECT
+  count(*)
+FROM
+  user_recovery_codes
+WHERE
+  user_id = ?
+  AND used_at IS NULL;
+
+-- name: AuthDeleteUserRecoveryCodes :exec
+DELETE FROM user_recovery_codes
+WHERE
+  user_id = ?;
+
+-- name: AuthGetLoginLockout :one
+SELECT
+  *
+FROM
+  login_lockouts
+WHERE
+  kind = ?
+  AND value = ?;
+
+-- name: AuthListLoginLockouts :many
+SELECT
+  *
+FROM
+  login_lockouts
+ORDER BY
+  last_failed_at DESC;
+
+-- name: AuthUpsertLoginLockout :exec
+INSERT INTO
+  login_lockouts (
+    kind,
+    value,
+    failures,
+    last_failed_at,
+    locked_until
+  )
+VALUES
+  (?, ?, ?, ?, ?) ON CONFLICT (kind, value) DO
+UPDATE
+SET
+  failures = EXCLUDED.failures,
+  last_failed_at = EXCLUDED.last_failed_at,
+  locked_until = EXCLUDED.locked_until;
+
+-- name: AuthDeleteLoginLockout :exec
+DELETE FROM login_lockouts
+WHERE
+  kind = ?
+  AND value = ?;
+
+-- name: AuthDeleteLoginLockoutByID :exec
+DELETE FROM login_lockouts
+WHERE
+  id = ?;
+
+-- name: AuthDeleteLoginLockoutByExpired :exec
+DELETE FROM login_lockouts
+WHERE
+  last_failed_at < ?;
+
+-- name: AuthDeleteUserSessionByUser :exec
+DELETE FROM user_sessions
+WHERE
+  user_id = ?;
+
+-- name: AuthCreateUserPasswordReset :exec
+INSERT INTO
+  user_password_resets (user_id, token_hash, created_at, expired_at)
+VALUES
+  (?, ?, ?, ?);
+
+-- name: AuthGetUserPasswordResetByTokenHash :one
+SELECT
+  *
+FROM
+  user_password_resets
+WHERE
+  token_hash = ?
+  AND used_at IS NULL
+  AND expired_at > sqlc.arg ('now');
+
+-- name: AuthUpdateUserPasswordResetUsedAt :execrows
+UPDATE user_password_resets
+SET
+  used_at = ?
+WHERE
+  id = ?
+  AND used_at IS NULL;
+
+-- name: AuthCountUserPasswordResetsSince :one
+SELECT
+  count(*)
+FROM
+  user_password_resets
+WHERE
+  user_id = ?
+  AND created_at > ?;
+
+-- name: AuthDeleteUserPasswordResetForUserAndUnused :exec
+DELETE FROM user_password_resets
+WHERE
+  user_id = ?
+  AND used_at IS NULL;
+
+-- name: AuthDeleteUserPasswordResetByExpired :exec
+DELETE FROM user_password_resets
+WHERE
+  expired_at < ?;
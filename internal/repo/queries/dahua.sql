@@ -9,11 +9,13 @@ INSERT INTO
     location,
     feature,
     email,
+    tls_mode,
+    tls_ca,
     created_at,
     updated_at
   )
 VALUES
-  (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id;
+  (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id;
 
 -- name: DahuaCheckDevice :one
 SELECT
@@ -23,14 +25,29 @@ FROM
 WHERE
   id = ?;
 
--- name: DahuaGetDeviceForSMTP :one
+-- name: DahuaGetDeviceByIP :one
 SELECT
   *
 FROM
   dahua_devices
 WHERE
-  ip = ?
-  OR email = ?;
+  ip = ?;
+
+-- name: DahuaGetDeviceByEmail :one
+SELECT
+  *
+FROM
+  dahua_devices
+WHERE
+  email = ?;
+
+-- name: DahuaGetDeviceBySerial :one
+SELECT
+  *
+FROM
+  dahua_devices
+WHERE
+  serial = ?;
 
 -- name: DahuaUpdateDevice :one
 UPDATE dahua_devices
@@ -43,10 +60,74 @@ SET
   location = ?,
   feature = ?,
   email = ?,
+  tls_mode = ?,
+  tls_ca = ?,
+  tls_fingerprint = ?,
   updated_at = ?
 WHERE
   id = ? RETURNING id;
 
+-- name: DahuaListDevicePasswords :many
+SELECT
+  id,
+  password
+FROM
+  dahua_devices;
+
+-- name: DahuaUpdateDevicePassword :exec
+UPDATE dahua_devices
+SET
+  password = ?
+WHERE
+  id = ?;
+
+-- name: DahuaListDeviceAddresses :many
+SELECT
+  id,
+  url,
+  ip
+FROM
+  dahua_devices
+WHERE
+  disabled_at IS NULL;
+
+-- name: DahuaUpdateDeviceIP :exec
+UPDATE dahua_devices
+SET
+  ip = ?
+WHERE
+  id = ?;
+
+-- name: DahuaUpdateDeviceFeature :exec
+UPDATE dahua_devices
+SET
+  feature = ?
+WHERE
+  id = ?;
+
+-- name: DahuaUpdateDeviceSerial :exec
+UPDATE dahua_devices
+SET
+  serial = ?
+WHERE
+  id = ?;
+
+-- name: DahuaPinDeviceTLSFingerprint :execrows
+UPDATE dahua_devices
+SET
+  tls_fingerprint = ?
+WHERE
+  id = ?
+  AND tls_mode = 'pin'
+  AND tls_fingerprint IS NULL;
+
+-- name: DahuaResetDeviceTLSFingerprint :exec
+UPDATE dahua_devices
+SET
+  tls_fingerprint = NULL
+WHERE
+  id = ?;
+
 -- name: DahuaUpdateDeviceDisabledAt :one
 UPDATE dahua_devices
 SET
@@ -54,6 +135,14 @@ SET
 WHERE
   id = ? RETURNING id;
 
+-- name: DahuaGetDevice :one
+SELECT
+  *
+FROM
+  dahua_devices
+WHERE
+  id = ?;
+
 -- name: DahuaDeleteDevice :exec
 DELETE FROM dahua_devices
 WHERE
@@ -284,9 +373,15 @@ WHERE
 
 -- name: DahuaCreateThumbnail :one
 INSERT INTO
-  dahua_thumbnails (file_id, email_attachment_id, width, height)
+  dahua_thumbnails (
+    file_id,
+    email_attachment_id,
+    snapshot_id,
+    width,
+    height
+  )
 VALUES
-  (?, ?, ?, ?) RETURNING *;
+  (?, ?, ?, ?, ?) RETURNING *;
 
 -- name: DahuaOrphanDeleteThumbnail :exec
 DELETE FROM dahua_thumbnails
@@ -309,10 +404,11 @@ INSERT INTO
     action,
     `index`,
     data,
-    created_at
+    created_at,
+    maintenance
   )
 VALUES
-  (?, ?, ?, ?, ?, ?) RETURNING id;
+  (?, ?, ?, ?, ?, ?, ?) RETURNING id;
 
 -- name: DahuaListEventCodes :many
 SELECT DISTINCT
@@ -342,6 +438,8 @@ SELECT
   ignore_db,
   ignore_live,
   ignore_mqtt,
+  snapshot_count,
+  pre_snapshot_count,
   code
 FROM
   dahua_event_device_rules
@@ -356,6 +454,8 @@ SELECT
   ignore_db,
   ignore_live,
   ignore_mqtt,
+  snapshot_count,
+  pre_snapshot_count,
   code
 FROM
   dahua_event_rules
@@ -385,21 +485,48 @@ SET
   code = ?,
   ignore_db = ?,
   ignore_live = ?,
-  ignore_mqtt = ?
+  ignore_mqtt = ?,
+  snapshot_count = ?,
+  pre_snapshot_count = ?
 WHERE
   id = ?;
 
 -- name: DahuaCreateEventRule :one
 INSERT INTO
-  dahua_event_rules (code, ignore_db, ignore_live, ignore_mqtt)
+  dahua_event_rules (
+    code,
+    ignore_db,
+    ignore_live,
+    ignore_mqtt,
+    snapshot_count,
+    pre_snapshot_count
+  )
 VALUES
-  (?, ?, ?, ?) RETURNING id;
+  (?, ?, ?, ?, ?, ?) RETURNING id;
 
 -- name: DahuaDeleteEventRule :exec
 DELETE FROM dahua_event_rules
 WHERE
   id = ?;
 
+-- name: DahuaGetMaxPreSnapshotCount :one
+SELECT
+  CAST(coalesce(max(pre_snapshot_count), 0) AS INTEGER)
+FROM
+  (
+    SELECT
+      pre_snapshot_count
+    FROM
+      dahua_event_rules
+    UNION ALL
+    SELECT
+      pre_snapshot_count
+    FROM
+      dahua_event_device_rules
+    WHERE
+      device_id = ?
+  );
+
 -- name: DahuaCreateWorkerEvent :exec
 INSERT INTO
   dahua_worker_events (device_id, type, state, error, created_at)
@@ -456,11 +583,135 @@ SET
 WHERE
   id = ? RETURNING id;
 
+-- name: DahuaListStorageDestinationPasswords :many
+SELECT
+  id,
+  password
+FROM
+  dahua_storage_destinations;
+
+-- name: DahuaUpdateStorageDestinationPassword :exec
+UPDATE dahua_storage_destinations
+SET
+  password = ?
+WHERE
+  id = ?;
+
 -- name: DahuaDeleteStorageDestination :exec
 DELETE FROM dahua_storage_destinations
 WHERE
   id = ?;
 
+-- name: DahuaGetCapability :one
+SELECT
+  *
+FROM
+  dahua_capabilities
+WHERE
+  device_id = ?;
+
+-- name: DahuaUpsertCapability :exec
+INSERT INTO
+  dahua_capabilities (
+    device_id,
+    methods,
+    ptz,
+    coaxial,
+    audio_input,
+    audio_output,
+    storage,
+    smart_event,
+    probed_at
+  )
+VALUES
+  (?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (device_id) DO
+UPDATE
+SET
+  methods = EXCLUDED.methods,
+  ptz = EXCLUDED.ptz,
+  coaxial = EXCLUDED.coaxial,
+  audio_input = EXCLUDED.audio_input,
+  audio_output = EXCLUDED.audio_output,
+  storage = EXCLUDED.storage,
+  smart_event = EXCLUDED.smart_event,
+  probed_at = EXCLUDED.probed_at;
+
+-- name: DahuaListChannelCapabilities :many
+SELECT
+  *
+FROM
+  dahua_channel_capabilities
+WHERE
+  device_id = ?
+ORDER BY
+  channel;
+
+-- name: DahuaGetChannelCapability :one
+SELECT
+  *
+FROM
+  dahua_channel_capabilities
+WHERE
+  device_id = ?
+  AND channel = ?;
+
+-- name: DahuaCreateChannelCapability :exec
+INSERT INTO
+  dahua_channel_capabilities (device_id, channel, coaxial)
+VALUES
+  (?, ?, ?);
+
+-- name: DahuaDeleteChannelCapabilities :exec
+DELETE FROM dahua_channel_capabilities
+WHERE
+  device_id = ?;
+
+-- name: DahuaDeleteCapability :exec
+DELETE FROM dahua_capabilities
+WHERE
+  device_id = ?;
+
+-- name: DahuaCreateChannel :exec
+INSERT INTO
+  dahua_channels (device_id, channel, name)
+VALUES
+  (?, ?, ?)
+ON CONFLICT (device_id, channel) DO NOTHING;
+
+-- name: DahuaDeleteChannelsAfter :exec
+DELETE FROM dahua_channels
+WHERE
+  device_id = ?
+  AND channel > ?;
+
+-- name: DahuaListChannelsByDevice :many
+SELECT
+  *
+FROM
+  dahua_channels
+WHERE
+  device_id = ?
+ORDER BY
+  channel;
+
+-- name: DahuaGetChannel :one
+SELECT
+  *
+FROM
+  dahua_channels
+WHERE
+  device_id = ?
+  AND channel = ?;
+
+-- name: DahuaUpdateChannel :one
+UPDATE dahua_channels
+SET
+  name = ?,
+  enabled = ?
+WHERE
+  device_id = ?
+  AND channel = ? RETURNING id;
+
 -- name: DahuaCreateStreamForInternal :one
 INSERT INTO
   dahua_streams (
@@ -551,11 +802,14 @@ INSERT INTO
     file_id,
     thumbnail_id,
     email_attachment_id,
+    snapshot_id,
+    timelapse_id,
+    export_id,
     name,
     created_at
   )
 VALUES
-  (?, ?, ?, ?, ?) RETURNING id;
+  (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id;
 
 -- name: DahuaGetAferoFileByFileID :one
 SELECT
@@ -565,6 +819,14 @@ FROM
 WHERE
   file_id = ?;
 
+-- name: DahuaGetAferoFileByExport :one
+SELECT
+  *
+FROM
+  dahua_afero_files
+WHERE
+  export_id = ?;
+
 -- name: DahuaReadyAferoFile :one
 UPDATE dahua_afero_files
 SET
@@ -588,6 +850,9 @@ WHERE
   file_id IS NULL
   AND thumbnail_id IS NULL
   AND email_attachment_id IS NULL
+  AND snapshot_id IS NULL
+  AND timelapse_id IS NULL
+  AND export_id IS NULL
   AND ready = true
 LIMIT
   ?;
@@ -600,6 +865,9 @@ SELECT
   d.password,
   d.location,
   d.feature,
+  d.tls_mode,
+  d.tls_ca,
+  d.tls_fingerprint,
   coalesce(seed, d.id)
 FROM
   dahua_devices as d
@@ -618,11 +886,32 @@ WHERE
         dahua_permissions.user_id = sqlc.arg ('user_id')
         OR dahua_permissions.group_id IN (
           SELECT
-            group_id
+            group_users.group_id
           FROM
             group_users
+            JOIN groups ON groups.id = group_users.group_id
           WHERE
             group_users.user_id = sqlc.arg ('user_id')
+            AND groups.disabled_at IS NULL
+        )
+    )
+    OR id IN (
+      SELECT
+        dahua_device_tags.device_id
+      FROM
+        dahua_device_tags
+        JOIN dahua_tag_permissions ON dahua_tag_permissions.tag = dahua_device_tags.tag
+      WHERE
+        dahua_tag_permissions.user_id = sqlc.arg ('user_id')
+        OR dahua_tag_permissions.group_id IN (
+          SELECT
+            group_users.group_id
+          FROM
+            group_users
+            JOIN groups ON groups.id = group_users.group_id
+          WHERE
+            group_users.user_id = sqlc.arg ('user_id')
+            AND groups.disabled_at IS NULL
         )
     )
   );
@@ -635,6 +924,9 @@ SELECT
   d.password,
   d.location,
   d.feature,
+  d.tls_mode,
+  d.tls_ca,
+  d.tls_fingerprint,
   coalesce(seed, d.id)
 FROM
   dahua_devices as d
@@ -652,11 +944,32 @@ WHERE
         dahua_permissions.user_id = sqlc.arg ('user_id')
         OR dahua_permissions.group_id IN (
           SELECT
-            group_id
+            group_users.group_id
+          FROM
+            group_users
+            JOIN groups ON groups.id = group_users.group_id
+          WHERE
+            group_users.user_id = sqlc.arg ('user_id')
+            AND groups.disabled_at IS NULL
+        )
+    )
+    OR id IN (
+      SELECT
+        dahua_device_tags.device_id
+      FROM
+        dahua_device_tags
+        JOIN dahua_tag_permissions ON dahua_tag_permissions.tag = dahua_device_tags.tag
+      WHERE
+        dahua_tag_permissions.user_id = sqlc.arg ('user_id')
+        OR dahua_tag_permissions.group_id IN (
+          SELECT
+            group_users.group_id
           FROM
             group_users
+            JOIN groups ON groups.id = group_users.group_id
           WHERE
             group_users.user_id = sqlc.arg ('user_id')
+            AND groups.disabled_at IS NULL
         )
     )
   );
@@ -682,12 +995,526 @@ WHERE
     dahua_permissions.user_id = sqlc.arg ('user_id')
     OR dahua_permissions.group_id IN (
       SELECT
-        group_id
+        group_users.group_id
+      FROM
+        group_users
+        JOIN groups ON groups.id = group_users.group_id
+      WHERE
+        group_users.user_id = sqlc.arg ('user_id')
+        AND groups.disabled_at IS NULL
+    )
+  )
+UNION ALL
+SELECT
+  dahua_tag_permissions.level
+FROM
+  dahua_tag_permissions
+  JOIN dahua_device_tags ON dahua_device_tags.tag = dahua_tag_permissions.tag
+WHERE
+  dahua_device_tags.device_id = sqlc.arg ('device_id')
+  AND (
+    dahua_tag_permissions.user_id = sqlc.arg ('user_id')
+    OR dahua_tag_permissions.group_id IN (
+      SELECT
+        group_users.group_id
       FROM
         group_users
+        JOIN groups ON groups.id = group_users.group_id
       WHERE
         group_users.user_id = sqlc.arg ('user_id')
+        AND groups.disabled_at IS NULL
+    )
+  )
+ORDER BY
+  level DESC
+LIMIT
+  1;
+
+-- name: DahuaListPermissionsForDevice :many
+SELECT
+  dahua_permissions.*,
+  coalesce(users.username, '') AS username,
+  coalesce(groups.name, '') AS group_name
+FROM
+  dahua_permissions
+  LEFT JOIN users ON users.id = dahua_permissions.user_id
+  LEFT JOIN groups ON groups.id = dahua_permissions.group_id
+WHERE
+  device_id = ?
+ORDER BY
+  dahua_permissions.group_id IS NOT NULL,
+  username,
+  group_name;
+
+-- name: DahuaUpsertUserPermission :exec
+INSERT INTO
+  dahua_permissions (user_id, device_id, level)
+VALUES
+  (?, ?, ?) ON CONFLICT (user_id, device_id) DO
+UPDATE
+SET
+  level = EXCLUDED.level;
+
+-- name: DahuaUpsertGroupPermission :exec
+INSERT INTO
+  dahua_permissions (group_id, device_id, level)
+VALUES
+  (?, ?, ?) ON CONFLICT (group_id, device_id) DO
+UPDATE
+SET
+  level = EXCLUDED.level;
+
+-- name: DahuaDeleteUserPermission :execrows
+DELETE FROM dahua_permissions
+WHERE
+  user_id = ?
+  AND device_id = ?;
+
+-- name: DahuaDeleteGroupPermission :execrows
+DELETE FROM dahua_permissions
+WHERE
+  group_id = ?
+  AND device_id = ?;
+
+-- name: DahuaCreateSnapshotSchedule :one
+INSERT INTO
+  dahua_snapshot_schedules (
+    device_id,
+    channel,
+    interval,
+    created_at,
+    updated_at,
+    disabled_at
+  )
+VALUES
+  (?, ?, ?, ?, ?, ?) RETURNING id;
+
+-- name: DahuaGetSnapshotSchedule :one
+SELECT
+  *
+FROM
+  dahua_snapshot_schedules
+WHERE
+  id = ?;
+
+-- name: DahuaListSnapshotSchedules :many
+SELECT
+  *
+FROM
+  dahua_snapshot_schedules
+ORDER BY
+  device_id,
+  channel;
+
+-- name: DahuaListEnabledSnapshotSchedulesByDevice :many
+SELECT
+  *
+FROM
+  dahua_snapshot_schedules
+WHERE
+  device_id = ?
+  AND disabled_at IS NULL;
+
+-- name: DahuaUpdateSnapshotSchedule :one
+UPDATE dahua_snapshot_schedules
+SET
+  channel = ?,
+  interval = ?,
+  updated_at = ?
+WHERE
+  id = ? RETURNING id;
+
+-- name: DahuaUpdateSnapshotScheduleDisabledAt :one
+UPDATE dahua_snapshot_schedules
+SET
+  disabled_at = ?
+WHERE
+  id = ? RETURNING id;
+
+-- name: DahuaDeleteSnapshotSchedule :exec
+DELETE FROM dahua_snapshot_schedules
+WHERE
+  id = ?;
+
+-- name: DahuaCreateSnapshot :one
+INSERT INTO
+  dahua_snapshots (device_id, channel, event_id, created_at)
+VALUES
+  (?, ?, ?, ?) RETURNING id;
+
+-- name: DahuaListSnapshotFilesForTimelapse :many
+SELECT
+  dahua_afero_files.name
+FROM
+  dahua_snapshots
+  JOIN dahua_afero_files ON dahua_afero_files.snapshot_id = dahua_snapshots.id
+WHERE
+  dahua_snapshots.device_id = sqlc.arg ('device_id')
+  AND dahua_snapshots.channel = sqlc.arg ('channel')
+  AND sqlc.arg ('start') <= dahua_snapshots.created_at
+  AND dahua_snapshots.created_at < sqlc.arg ('end')
+  AND dahua_afero_files.ready = true
+ORDER BY
+  dahua_snapshots.created_at ASC;
+
+-- name: DahuaCreateTimelapse :one
+INSERT INTO
+  dahua_timelapses (
+    device_id,
+    channel,
+    start_time,
+    end_time,
+    frame_count,
+    created_at
+  )
+VALUES
+  (?, ?, ?, ?, ?, ?) RETURNING id;
+
+-- name: DahuaDeleteTimelapse :exec
+DELETE FROM dahua_timelapses
+WHERE
+  id = ?;
+
+-- name: DahuaListTimelapsesByDevice :many
+SELECT
+  sqlc.embed(dahua_timelapses),
+  sqlc.embed(dahua_afero_files)
+FROM
+  dahua_timelapses
+  JOIN dahua_afero_files ON dahua_afero_files.timelapse_id = dahua_timelapses.id
+WHERE
+  dahua_timelapses.device_id = ?
+  AND dahua_afero_files.ready = true
+ORDER BY
+  dahua_timelapses.created_at DESC;
+
+-- name: DahuaCreateExport :one
+INSERT INTO
+  dahua_exports (
+    device_id,
+    channel,
+    start_time,
+    end_time,
+    created_at
+  )
+VALUES
+  (?, ?, ?, ?, ?) RETURNING id;
+
+-- name: DahuaGetExport :one
+SELECT
+  *
+FROM
+  dahua_exports
+WHERE
+  id = ?;
+
+-- name: DahuaUpdateExportCompleted :exec
+UPDATE dahua_exports
+SET
+  error = ?,
+  completed_at = ?
+WHERE
+  id = ?;
+
+-- name: DahuaListExportsByDevice :many
+SELECT
+  dahua_exports.*,
+  dahua_afero_files.name AS afero_file_name
+FROM
+  dahua_exports
+  LEFT JOIN dahua_afero_files ON dahua_afero_files.export_id = dahua_exports.id
+  AND dahua_afero_files.ready = true
+WHERE
+  dahua_exports.device_id = ?
+ORDER BY
+  dahua_exports.created_at DESC;
+
+-- name: DahuaListFilesForExport :many
+SELECT
+  *
+FROM
+  dahua_files
+WHERE
+  device_id = sqlc.arg ('device_id')
+  AND channel = sqlc.arg ('channel')
+  AND type = 'dav'
+  AND start_time < sqlc.arg ('end')
+  AND sqlc.arg ('start') < end_time
+ORDER BY
+  start_time;
+
+-- name: DahuaGetAferoFileDeviceID :one
+SELECT
+  CAST(
+    coalesce(
+      f.device_id,
+      m.device_id,
+      s.device_id,
+      t.device_id,
+      e.device_id,
+      thf.device_id,
+      thm.device_id,
+      ths.device_id,
+      0
+    ) AS INTEGER
+  )
+FROM
+  dahua_afero_files AS a
+  LEFT JOIN dahua_files AS f ON f.id = a.file_id
+  LEFT JOIN dahua_email_attachments AS ea ON ea.id = a.email_attachment_id
+  LEFT JOIN dahua_email_messages AS m ON m.id = ea.message_id
+  LEFT JOIN dahua_snapshots AS s ON s.id = a.snapshot_id
+  LEFT JOIN dahua_timelapses AS t ON t.id = a.timelapse_id
+  LEFT JOIN dahua_exports AS e ON e.id = a.export_id
+  LEFT JOIN dahua_thumbnails AS th ON th.id = a.thumbnail_id
+  LEFT JOIN dahua_files AS thf ON thf.id = th.file_id
+  LEFT JOIN dahua_email_attachments AS thea ON thea.id = th.email_attachment_id
+  LEFT JOIN dahua_email_messages AS thm ON thm.id = thea.message_id
+  LEFT JOIN dahua_snapshots AS ths ON ths.id = th.snapshot_id
+WHERE
+  a.name = ?;
+
+-- name: DahuaListDeviceTags :many
+SELECT
+  tag
+FROM
+  dahua_device_tags
+WHERE
+  device_id = ?
+ORDER BY
+  tag;
+
+-- name: DahuaListAllDeviceTags :many
+SELECT
+  *
+FROM
+  dahua_device_tags
+ORDER BY
+  device_id,
+  tag;
+
+-- name: DahuaCreateDeviceTag :exec
+INSERT OR IGNORE INTO
+  dahua_device_tags (device_id, tag)
+VALUES
+  (?, ?);
+
+-- name: DahuaDeleteDeviceTags :exec
+DELETE FROM dahua_device_tags
+WHERE
+  device_id = ?;
+
+-- name: DahuaListTagPermissions :many
+SELECT
+  dahua_tag_permissions.*,
+  coalesce(users.username, '') AS username,
+  coalesce(groups.name, '') AS group_name
+FROM
+  dahua_tag_permissions
+  LEFT JOIN users ON users.id = dahua_tag_permissions.user_id
+  LEFT JOIN groups ON groups.id = dahua_tag_permissions.group_id
+ORDER BY
+  dahua_tag_permissions.tag,
+  dahua_tag_permissions.group_id IS NOT NULL,
+  username,
+  group_name;
+
+-- name: DahuaUpsertUserTagPermission :exec
+INSERT INTO
+  dahua_tag_permissions (user_id, tag, level)
+VALUES
+  (?, ?, ?) ON CONFLICT (user_id, tag) DO
+UPDATE
+SET
+  level = EXCLUDED.level;
+
+-- name: DahuaUpsertGroupTagPermission :exec
+INSERT INTO
+  dahua_tag_permissions (group_id, tag, level)
+VALUES
+  (?, ?, ?) ON CONFLICT (group_id, tag) DO
+UPDATE
+SET
+  level = EXCLUDED.level;
+
+-- name: DahuaDeleteUserTagPermission :execrows
+DELETE FROM dahua_tag_permissions
+WHERE
+  user_id = ?
+  AND tag = ?;
+
+-- name: DahuaDeleteGroupTagPermission :execrows
+DELETE FROM dahua_tag_permissions
+WHERE
+  group_id = ?
+  AND tag = ?;
+
+-- name: DahuaCreateGuestLink :one
+INSERT INTO
+  dahua_guest_links (
+    device_id,
+    user_id,
+    name,
+    token_hash,
+    channel,
+    live,
+    start_time,
+    end_time,
+    max_views,
+    created_at,
+    expired_at
+  )
+VALUES
+  (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id;
+
+-- name: DahuaCreateGuestLinkFile :exec
+INSERT INTO
+  dahua_guest_link_files (guest_link_id, file_id)
+VALUES
+  (?, ?);
+
+-- name: DahuaGetGuestLink :one
+SELECT
+  *
+FROM
+  dahua_guest_links
+WHERE
+  id = ?;
+
+-- name: DahuaGetGuestLinkForContext :one
+SELECT
+  *
+FROM
+  dahua_guest_links
+WHERE
+  token_hash = ?
+  AND revoked_at IS NULL
+  AND expired_at > sqlc.arg ('now');
+
+-- name: DahuaListGuestLinksByDevice :many
+SELECT
+  dahua_guest_links.*,
+  coalesce(users.username, '') AS username,
+  (
+    SELECT
+      count(*)
+    FROM
+      dahua_guest_link_files
+    WHERE
+      guest_link_id = dahua_guest_links.id
+  ) AS file_count
+FROM
+  dahua_guest_links
+  LEFT JOIN users ON users.id = dahua_guest_links.user_id
+WHERE
+  dahua_guest_links.device_id = ?
+ORDER BY
+  dahua_guest_links.created_at DESC;
+
+-- name: DahuaListGuestLinkFileIDs :many
+SELECT
+  file_id
+FROM
+  dahua_guest_link_files
+WHERE
+  guest_link_id = ?;
+
+-- name: DahuaListFilesForGuestLink :many
+SELECT
+  *
+FROM
+  dahua_files
+WHERE
+  device_id = sqlc.arg ('device_id')
+  AND (
+    id IN (
+      SELECT
+        file_id
+      FROM
+        dahua_guest_link_files
+      WHERE
+        guest_link_id = sqlc.arg ('guest_link_id')
     )
+    OR (
+      channel = sqlc.arg ('channel')
+      AND start_time < sqlc.arg ('end')
+      AND sqlc.arg ('start') < end_time
+    )
+  )
+ORDER BY
+  start_time;
+
+-- name: DahuaViewGuestLink :execrows
+UPDATE dahua_guest_links
+SET
+  views = views + 1,
+  last_viewed_at = ?
+WHERE
+  id = ?
+  AND (
+    max_views = 0
+    OR views < max_views
+  );
+
+-- name: DahuaRevokeGuestLink :execrows
+UPDATE dahua_guest_links
+SET
+  revoked_at = ?
+WHERE
+  id = ?
+  AND revoked_at IS NULL;
+
+-- name: DahuaCreateMaintenanceWindow :one
+INSERT INTO
+  dahua_maintenance_windows (
+    device_id,
+    tag,
+    user_id,
+    reason,
+    start_time,
+    end_time,
+    created_at
   )
+VALUES
+  (?, ?, ?, ?, ?, ?, ?) RETURNING id;
+
+-- name: DahuaGetMaintenanceWindow :one
+SELECT
+  *
+FROM
+  dahua_maintenance_windows
+WHERE
+  id = ?;
+
+-- name: DahuaListMaintenanceWindows :many
+SELECT
+  *
+FROM
+  dahua_maintenance_windows
 ORDER BY
-  level DESC;
+  start_time DESC;
+
+-- name: DahuaDeleteMaintenanceWindow :exec
+DELETE FROM dahua_maintenance_windows
+WHERE
+  id = ?;
+
+-- name: DahuaCheckDeviceMaintenance :one
+SELECT
+  COUNT(*) > 0
+FROM
+  dahua_maintenance_windows
+WHERE
+  start_time <= sqlc.arg ('now')
+  AND sqlc.arg ('now') < end_time
+  AND (
+    tag IN (
+      SELECT
+        tag
+      FROM
+        dahua_device_tags
+      WHERE
+        dahua_device_tags.device_id = sqlc.arg ('device_id')
+    )
+    OR dahua_maintenance_windows.device_id = sqlc.arg ('device_id')
+  );
@@ -1,5 +1,23 @@
 -- name: CreateEvent :one
 INSERT INTO
-  events (action, data, user_id, actor, created_at)
+  events (
+    action,
+    data,
+    user_id,
+    actor,
+    created_at,
+    ip,
+    user_agent,
+    target,
+    diff
+  )
 VALUES
-  (?, ?, ?, ?, ?) RETURNING id;
+  (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id;
+
+-- name: ListEventActions :many
+SELECT DISTINCT
+  action
+FROM
+  events
+ORDER BY
+  action;
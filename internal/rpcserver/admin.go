@@ -1,19 +1,25 @@
 package rpcserver
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"net/url"
+	"slices"
 	"time"
 
 	"github.com/ItsNotGoodName/ipcmanview/internal/auth"
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
 	"github.com/ItsNotGoodName/ipcmanview/internal/dahua"
+	"github.com/ItsNotGoodName/ipcmanview/internal/dahuatasks"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
 	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
 	"github.com/ItsNotGoodName/ipcmanview/internal/sqlite"
 	"github.com/ItsNotGoodName/ipcmanview/internal/system"
 	"github.com/ItsNotGoodName/ipcmanview/pkg/ssq"
 	"github.com/ItsNotGoodName/ipcmanview/rpc"
 	sq "github.com/Masterminds/squirrel"
+	"github.com/twitchtv/twirp"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
@@ -110,6 +116,11 @@ func (a *Admin) GetAdminDevicesIDPage(ctx context.Context, req *rpc.GetAdminDevi
 		return nil, err
 	}
 
+	tags, err := dahua.ListDeviceTags(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
 	return &rpc.GetAdminDevicesIDPageResp{
 		Device: &rpc.GetAdminDevicesIDPageResp_Device{
 			Id:             v.ID,
@@ -122,6 +133,7 @@ func (a *Admin) GetAdminDevicesIDPage(ctx context.Context, req *rpc.GetAdminDevi
 			UpdatedAtTime:  timestamppb.New(v.UpdatedAt.Time),
 			DisabledAtTime: timestamppb.New(v.DisabledAt.Time.Time),
 			Features:       dahua.FeatureToStrings(v.Feature),
+			Tags:           tags,
 		},
 	}, nil
 
@@ -133,14 +145,23 @@ func (a *Admin) GetDevice(ctx context.Context, req *rpc.GetDeviceReq) (*rpc.GetD
 		return nil, err
 	}
 
+	tags, err := dahua.ListDeviceTags(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
 	return &rpc.GetDeviceResp{
-		Id:       v.ID,
-		Name:     v.Name,
-		Url:      v.Url.String(),
-		Username: v.Username,
-		Location: v.Location.String(),
-		Features: dahua.FeatureToStrings(v.Feature),
-		Email:    v.Email.String,
+		Id:             v.ID,
+		Name:           v.Name,
+		Url:            v.Url.String(),
+		Username:       v.Username,
+		Location:       v.Location.String(),
+		Features:       dahua.FeatureToStrings(v.Feature),
+		Email:          v.Email.String,
+		Tags:           tags,
+		TlsMode:        v.TlsMode,
+		TlsCa:          v.TlsCa.String,
+		TlsFingerprint: v.TlsFingerprint.String,
 	}, nil
 }
 
@@ -162,6 +183,11 @@ func (a *Admin) CreateDevice(ctx context.Context, req *rpc.CreateDeviceReq) (*rp
 		Location: loc,
 		Feature:  dahua.FeatureFromStrings(req.Features),
 		Email:    req.Email,
+		Tags:     req.Tags,
+		TLSMode:  req.TlsMode,
+		TLSCA:    req.TlsCa,
+
+		TestConnection: req.TestConnection,
 	})
 	if err != nil {
 		if errs, ok := core.AsFieldErrors(err); ok {
@@ -169,6 +195,10 @@ func (a *Admin) CreateDevice(ctx context.Context, req *rpc.CreateDeviceReq) (*rp
 				keymap("name", "Name"),
 				keymap("url", "URL"),
 				keymap("email", "Email"),
+				keymap("tags", "Tag"),
+				keymap("tls_mode", "TLSMode"),
+				keymap("tls_ca", "TLSCA"),
+				keymap("password", "Password"),
 			)
 		}
 		return nil, err
@@ -179,6 +209,283 @@ func (a *Admin) CreateDevice(ctx context.Context, req *rpc.CreateDeviceReq) (*rp
 	}, nil
 }
 
+func (a *Admin) ListDiscoveredDevices(ctx context.Context, _ *emptypb.Empty) (*rpc.ListDiscoveredDevicesResp, error) {
+	v, err := dahua.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*rpc.ListDiscoveredDevicesResp_Device, 0, len(v))
+	for _, v := range v {
+		items = append(items, &rpc.ListDiscoveredDevicesResp_Device{
+			Protocol: v.Protocol,
+			Serial:   v.Serial,
+			Model:    v.Model,
+			Mac:      v.MAC,
+			Ip:       v.IP,
+			HttpPort: int64(v.HTTPPort),
+			Firmware: v.Firmware,
+			Name:     v.Name,
+			Vendor:   v.Vendor,
+			DeviceId: v.DeviceID,
+		})
+	}
+
+	return &rpc.ListDiscoveredDevicesResp{
+		Items: items,
+	}, nil
+}
+
+func (a *Admin) AdoptDevices(ctx context.Context, req *rpc.AdoptDevicesReq) (*rpc.AdoptDevicesResp, error) {
+	loc, err := time.LoadLocation(req.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]dahua.AdoptDeviceParams, 0, len(req.Devices))
+	for _, v := range req.Devices {
+		devices = append(devices, dahua.AdoptDeviceParams{
+			IP:       v.Ip,
+			HTTPPort: int(v.HttpPort),
+			Name:     v.Name,
+			Serial:   v.Serial,
+		})
+	}
+
+	v, err := dahua.AdoptDevices(ctx, dahua.AdoptDevicesParams{
+		Devices:  devices,
+		Username: req.Username,
+		Password: req.Password,
+		Location: loc,
+		Feature:  dahua.FeatureFromStrings(req.Features),
+		Tags:     req.Tags,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*rpc.AdoptDevicesResp_Result, 0, len(v))
+	for _, v := range v {
+		var errString string
+		if v.Err != nil {
+			errString = v.Err.Error()
+		}
+
+		results = append(results, &rpc.AdoptDevicesResp_Result{
+			Ip:    v.IP,
+			Id:    v.ID,
+			Error: errString,
+		})
+	}
+
+	return &rpc.AdoptDevicesResp{
+		Results: results,
+	}, nil
+}
+
+func (a *Admin) ImportDevices(ctx context.Context, req *rpc.ImportDevicesReq) (*rpc.ImportDevicesResp, error) {
+	if !slices.Contains(dahua.DeviceFormats, req.Format) {
+		return nil, twirp.InvalidArgumentError("format", "Invalid format.")
+	}
+
+	records, err := dahua.ReadDeviceRecords(bytes.NewReader(req.Data), req.Format)
+	if err != nil {
+		return nil, twirp.InvalidArgumentError("data", err.Error())
+	}
+
+	v, err := dahua.ImportDevices(ctx, dahua.ImportDevicesParams{
+		Records: records,
+		DryRun:  req.DryRun,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*rpc.ImportDevicesResp_Result, 0, len(v))
+	for _, v := range v {
+		result := &rpc.ImportDevicesResp_Result{
+			Row:    int64(v.Row),
+			Name:   v.Name,
+			Action: v.Action,
+			Id:     v.DeviceID,
+		}
+		if v.Err != nil {
+			result.Error = v.Err.Error()
+			if errs, ok := core.AsFieldErrors(v.Err); ok {
+				for _, f := range errs {
+					result.FieldErrors = append(result.FieldErrors, &rpc.ImportDevicesResp_FieldError{
+						Field:   f.Field,
+						Message: f.Message(),
+					})
+				}
+			}
+		}
+		results = append(results, result)
+	}
+
+	return &rpc.ImportDevicesResp{
+		Results: results,
+	}, nil
+}
+
+func (a *Admin) ExportDevices(ctx context.Context, req *rpc.ExportDevicesReq) (*rpc.ExportDevicesResp, error) {
+	if !slices.Contains(dahua.DeviceFormats, req.Format) {
+		return nil, twirp.InvalidArgumentError("format", "Invalid format.")
+	}
+
+	records, err := dahua.ExportDevices(ctx, dahua.ExportDevicesParams{
+		IncludePasswords: req.IncludePasswords,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := dahua.WriteDeviceRecords(&buf, req.Format, records); err != nil {
+		return nil, err
+	}
+
+	return &rpc.ExportDevicesResp{
+		Data: buf.Bytes(),
+	}, nil
+}
+
+func (a *Admin) RotateDevicePasswords(ctx context.Context, req *rpc.RotateDevicePasswordsReq) (*rpc.RotateDevicePasswordsResp, error) {
+	v, err := dahua.RotateDevicePasswords(ctx, dahua.RotateDevicePasswordsParams{
+		DeviceIDs: req.Ids,
+		Password:  req.Password,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*rpc.RotateDevicePasswordsResp_Result, 0, len(v))
+	for _, v := range v {
+		result := &rpc.RotateDevicePasswordsResp_Result{
+			Id:         v.DeviceID,
+			Username:   v.Username,
+			Rotated:    v.Rotated,
+			RolledBack: v.RolledBack,
+		}
+		if v.Err != nil {
+			result.Error = v.Err.Error()
+		}
+		if v.RollbackErr != nil {
+			result.RollbackError = v.RollbackErr.Error()
+		}
+		results = append(results, result)
+	}
+
+	return &rpc.RotateDevicePasswordsResp{
+		Results: results,
+	}, nil
+}
+
+// ---------- Device account
+
+func convertDeviceAccountError(err error) error {
+	if errors.Is(err, dahua.ErrDeviceAccountInUse) {
+		return twirp.FailedPrecondition.Error("Account is used to connect to the device.")
+	}
+	if errs, ok := core.AsFieldErrors(err); ok {
+		return newInvalidArgument(errs,
+			keymap("name", "Name"),
+			keymap("group", "Group"),
+			keymap("password", "Password"),
+			keymap("new_password", "NewPassword"),
+		)
+	}
+	return err
+}
+
+func (a *Admin) ListDeviceAccounts(ctx context.Context, req *rpc.ListDeviceAccountsReq) (*rpc.ListDeviceAccountsResp, error) {
+	v, err := dahua.ListDeviceAccounts(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*rpc.ListDeviceAccountsResp_User, 0, len(v.Users))
+	for _, u := range v.Users {
+		users = append(users, &rpc.ListDeviceAccountsResp_User{
+			Name:          u.Name,
+			Group:         u.Group,
+			AuthorityList: u.AuthorityList,
+			Memo:          u.Memo,
+			Reserved:      u.Reserved,
+			Sharable:      u.Sharable,
+			InUse:         u.Name == v.Username,
+		})
+	}
+
+	groups := make([]*rpc.ListDeviceAccountsResp_Group, 0, len(v.Groups))
+	for _, g := range v.Groups {
+		groups = append(groups, &rpc.ListDeviceAccountsResp_Group{
+			Name:          g.Name,
+			AuthorityList: g.AuthorityList,
+			Memo:          g.Memo,
+		})
+	}
+
+	return &rpc.ListDeviceAccountsResp{
+		Users:       users,
+		Groups:      groups,
+		Authorities: v.Authorities,
+	}, nil
+}
+
+func (a *Admin) CreateDeviceAccount(ctx context.Context, req *rpc.CreateDeviceAccountReq) (*emptypb.Empty, error) {
+	err := dahua.CreateDeviceAccount(ctx, req.Id, dahua.DeviceAccountParams{
+		Name:          req.Name,
+		Password:      req.Password,
+		Group:         req.Group,
+		AuthorityList: req.AuthorityList,
+		Memo:          req.Memo,
+		Sharable:      req.Sharable,
+	})
+	if err != nil {
+		return nil, convertDeviceAccountError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (a *Admin) UpdateDeviceAccount(ctx context.Context, req *rpc.UpdateDeviceAccountReq) (*emptypb.Empty, error) {
+	newName := req.NewName
+	if newName == "" {
+		newName = req.Name
+	}
+
+	err := dahua.UpdateDeviceAccount(ctx, req.Id, req.Name, dahua.DeviceAccountParams{
+		Name:          newName,
+		Group:         req.Group,
+		AuthorityList: req.AuthorityList,
+		Memo:          req.Memo,
+		Sharable:      req.Sharable,
+	})
+	if err != nil {
+		return nil, convertDeviceAccountError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (a *Admin) DeleteDeviceAccount(ctx context.Context, req *rpc.DeleteDeviceAccountReq) (*emptypb.Empty, error) {
+	if err := dahua.DeleteDeviceAccount(ctx, req.Id, req.Name); err != nil {
+		return nil, convertDeviceAccountError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (a *Admin) UpdateDeviceAccountPassword(ctx context.Context, req *rpc.UpdateDeviceAccountPasswordReq) (*emptypb.Empty, error) {
+	err := dahua.UpdateDeviceAccountPassword(ctx, req.Id, req.Name, req.OldPassword, req.NewPassword)
+	if err != nil {
+		return nil, convertDeviceAccountError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
 func (a *Admin) UpdateDevice(ctx context.Context, req *rpc.UpdateDeviceReq) (*emptypb.Empty, error) {
 	urL, err := url.Parse(req.Url)
 	if err != nil {
@@ -198,6 +505,11 @@ func (a *Admin) UpdateDevice(ctx context.Context, req *rpc.UpdateDeviceReq) (*em
 		Location:    loc,
 		Feature:     dahua.FeatureFromStrings(req.Features),
 		Email:       req.Email,
+		Tags:        req.Tags,
+		TLSMode:     req.TlsMode,
+		TLSCA:       req.TlsCa,
+
+		TestConnection: req.TestConnection,
 	})
 	if err != nil {
 		if errs, ok := core.AsFieldErrors(err); ok {
@@ -205,11 +517,119 @@ func (a *Admin) UpdateDevice(ctx context.Context, req *rpc.UpdateDeviceReq) (*em
 				keymap("name", "Name"),
 				keymap("url", "URL"),
 				keymap("email", "Email"),
+				keymap("tags", "Tag"),
+				keymap("tls_mode", "TLSMode"),
+				keymap("tls_ca", "TLSCA"),
+				keymap("new_password", "Password"),
+			)
+		}
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (a *Admin) TestDeviceConnection(ctx context.Context, req *rpc.TestDeviceConnectionReq) (*rpc.TestDeviceConnectionResp, error) {
+	urL, err := url.Parse(req.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := dahua.TestConnection(ctx, dahua.TestConnectionParams{
+		ID:       req.Id,
+		URL:      urL,
+		Username: req.Username,
+		Password: req.Password,
+		TLSMode:  req.TlsMode,
+		TLSCA:    req.TlsCa,
+	})
+	if err != nil {
+		if errs, ok := core.AsFieldErrors(err); ok {
+			return nil, newInvalidArgument(errs,
+				keymap("url", "URL"),
+				keymap("tls_mode", "TLSMode"),
+				keymap("tls_ca", "TLSCA"),
 			)
 		}
 		return nil, err
 	}
 
+	return &rpc.TestDeviceConnectionResp{
+		Ok:           v.OK(),
+		Ip:           v.IP,
+		Rpc:          v.RPC,
+		RpcError:     v.RPCError,
+		Cgi:          v.CGI,
+		CgiError:     v.CGIError,
+		DeviceType:   v.DeviceType,
+		DeviceClass:  v.DeviceClass,
+		SerialNumber: v.SerialNumber,
+		Firmware:     v.Firmware,
+		ChannelCount: int64(v.ChannelCount),
+		Features:     dahua.FeatureToStrings(v.Feature),
+		Modules:      v.Modules,
+	}, nil
+}
+
+func (a *Admin) ResetDeviceTLSFingerprint(ctx context.Context, req *rpc.ResetDeviceTLSFingerprintReq) (*emptypb.Empty, error) {
+	if err := dahua.ResetDeviceTLSFingerprint(ctx, req.Id); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (a *Admin) ProbeDeviceCapabilities(ctx context.Context, req *rpc.ProbeDeviceCapabilitiesReq) (*rpc.ProbeDeviceCapabilitiesResp, error) {
+	v, err := dahua.ProbeCapabilities(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.ProbeDeviceCapabilitiesResp{
+		Methods:      v.Methods.Slice,
+		Ptz:          v.Ptz,
+		Coaxial:      v.Coaxial,
+		AudioInput:   v.AudioInput,
+		AudioOutput:  v.AudioOutput,
+		Storage:      v.Storage,
+		SmartEvent:   v.SmartEvent,
+		ProbedAtTime: timestamppb.New(v.ProbedAt.Time),
+	}, nil
+}
+
+func (a *Admin) ListDeviceChannels(ctx context.Context, req *rpc.ListDeviceChannelsReq) (*rpc.ListDeviceChannelsResp, error) {
+	v, err := dahua.ListChannels(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*rpc.ListDeviceChannelsResp_Channel, 0, len(v))
+	for _, v := range v {
+		items = append(items, &rpc.ListDeviceChannelsResp_Channel{
+			Channel: v.Channel,
+			Name:    v.Name,
+			Enabled: v.Enabled,
+		})
+	}
+
+	return &rpc.ListDeviceChannelsResp{
+		Items: items,
+	}, nil
+}
+
+func (a *Admin) UpdateDeviceChannel(ctx context.Context, req *rpc.UpdateDeviceChannelReq) (*emptypb.Empty, error) {
+	err := dahua.UpdateChannel(ctx, dahua.UpdateChannelParams{
+		DeviceID: req.Id,
+		Channel:  int(req.Channel),
+		Name:     req.Name,
+		Enabled:  req.Enabled,
+	})
+	if err != nil {
+		if errs, ok := core.AsFieldErrors(err); ok {
+			return nil, newInvalidArgument(errs, keymap("name", "Name"))
+		}
+		return nil, err
+	}
+
 	return &emptypb.Empty{}, nil
 }
 
@@ -233,6 +653,198 @@ func (a *Admin) SetDeviceDisable(ctx context.Context, req *rpc.SetDeviceDisableR
 	return &emptypb.Empty{}, nil
 }
 
+func (a *Admin) ListDevicePermissions(ctx context.Context, req *rpc.ListDevicePermissionsReq) (*rpc.ListDevicePermissionsResp, error) {
+	v, err := dahua.ListPermissions(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*rpc.ListDevicePermissionsResp_Permission, 0, len(v))
+	for _, v := range v {
+		items = append(items, &rpc.ListDevicePermissionsResp_Permission{
+			UserId:    v.UserID.Int64,
+			Username:  v.Username,
+			GroupId:   v.GroupID.Int64,
+			GroupName: v.GroupName,
+			Level:     v.Level.String(),
+		})
+	}
+
+	return &rpc.ListDevicePermissionsResp{
+		Items: items,
+	}, nil
+}
+
+func (a *Admin) GrantDevicePermission(ctx context.Context, req *rpc.GrantDevicePermissionReq) (*emptypb.Empty, error) {
+	level, err := models.ParseDahuaPermissionLevel(req.Level)
+	if err != nil {
+		return nil, twirp.InvalidArgumentError("level", "Invalid level.")
+	}
+
+	err = dahua.SetPermission(ctx, dahua.SetPermissionParams{
+		DeviceID: req.Id,
+		UserID:   req.UserId,
+		GroupID:  req.GroupId,
+		Level:    level,
+	})
+	if err != nil {
+		if errors.Is(err, dahua.ErrInvalidPermissionSubject) {
+			return nil, twirp.InvalidArgumentError("userId", "Either user or group must be set.")
+		}
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (a *Admin) RevokeDevicePermission(ctx context.Context, req *rpc.RevokeDevicePermissionReq) (*emptypb.Empty, error) {
+	err := dahua.DeletePermission(ctx, dahua.DeletePermissionParams{
+		DeviceID: req.Id,
+		UserID:   req.UserId,
+		GroupID:  req.GroupId,
+	})
+	if err != nil {
+		if errors.Is(err, dahua.ErrInvalidPermissionSubject) {
+			return nil, twirp.InvalidArgumentError("userId", "Either user or group must be set.")
+		}
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// ---------- Tag
+
+func (a *Admin) ListTagPermissions(ctx context.Context, _ *emptypb.Empty) (*rpc.ListTagPermissionsResp, error) {
+	v, err := dahua.ListTagPermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*rpc.ListTagPermissionsResp_Permission, 0, len(v))
+	for _, v := range v {
+		items = append(items, &rpc.ListTagPermissionsResp_Permission{
+			Tag:       v.Tag,
+			UserId:    v.UserID.Int64,
+			Username:  v.Username,
+			GroupId:   v.GroupID.Int64,
+			GroupName: v.GroupName,
+			Level:     v.Level.String(),
+		})
+	}
+
+	return &rpc.ListTagPermissionsResp{
+		Items: items,
+	}, nil
+}
+
+func (a *Admin) GrantTagPermission(ctx context.Context, req *rpc.GrantTagPermissionReq) (*emptypb.Empty, error) {
+	level, err := models.ParseDahuaPermissionLevel(req.Level)
+	if err != nil {
+		return nil, twirp.InvalidArgumentError("level", "Invalid level.")
+	}
+
+	err = dahua.SetTagPermission(ctx, dahua.SetTagPermissionParams{
+		Tag:     req.Tag,
+		UserID:  req.UserId,
+		GroupID: req.GroupId,
+		Level:   level,
+	})
+	if err != nil {
+		if errs, ok := core.AsFieldErrors(err); ok {
+			return nil, newInvalidArgument(errs, keymap("tag", "Tag"))
+		}
+		if errors.Is(err, dahua.ErrInvalidPermissionSubject) {
+			return nil, twirp.InvalidArgumentError("userId", "Either user or group must be set.")
+		}
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (a *Admin) RevokeTagPermission(ctx context.Context, req *rpc.RevokeTagPermissionReq) (*emptypb.Empty, error) {
+	err := dahua.DeleteTagPermission(ctx, dahua.DeleteTagPermissionParams{
+		Tag:     req.Tag,
+		UserID:  req.UserId,
+		GroupID: req.GroupId,
+	})
+	if err != nil {
+		if errors.Is(err, dahua.ErrInvalidPermissionSubject) {
+			return nil, twirp.InvalidArgumentError("userId", "Either user or group must be set.")
+		}
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// ---------- Maintenance
+
+func (a *Admin) ListMaintenanceWindows(ctx context.Context, _ *emptypb.Empty) (*rpc.ListMaintenanceWindowsResp, error) {
+	v, err := dahua.ListMaintenanceWindows(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	items := make([]*rpc.ListMaintenanceWindowsResp_Item, 0, len(v))
+	for _, v := range v {
+		items = append(items, &rpc.ListMaintenanceWindowsResp_Item{
+			Id:            v.ID,
+			DeviceId:      v.DeviceID.Int64,
+			Tag:           v.Tag.String,
+			UserId:        v.UserID.Int64,
+			Reason:        v.Reason,
+			StartTime:     timestamppb.New(v.StartTime.Time),
+			EndTime:       timestamppb.New(v.EndTime.Time),
+			Active:        dahua.MaintenanceWindowActive(v, now),
+			CreatedAtTime: timestamppb.New(v.CreatedAt.Time),
+		})
+	}
+
+	return &rpc.ListMaintenanceWindowsResp{
+		Items: items,
+	}, nil
+}
+
+func (a *Admin) CreateMaintenanceWindow(ctx context.Context, req *rpc.CreateMaintenanceWindowReq) (*rpc.CreateMaintenanceWindowResp, error) {
+	id, err := dahua.CreateMaintenanceWindow(ctx, dahua.CreateMaintenanceWindowParams{
+		DeviceID: req.DeviceId,
+		Tag:      req.Tag,
+		Reason:   req.Reason,
+		Start:    req.StartTime.AsTime(),
+		End:      req.EndTime.AsTime(),
+	})
+	if err != nil {
+		if errs, ok := core.AsFieldErrors(err); ok {
+			return nil, newInvalidArgument(errs,
+				keymap("deviceId", "DeviceID"),
+				keymap("tag", "Tag"),
+				keymap("reason", "Reason"),
+				keymap("endTime", "End"),
+			)
+		}
+		return nil, err
+	}
+
+	return &rpc.CreateMaintenanceWindowResp{
+		Id: id,
+	}, nil
+}
+
+func (a *Admin) DeleteMaintenanceWindows(ctx context.Context, req *rpc.DeleteMaintenanceWindowsReq) (*emptypb.Empty, error) {
+	for _, id := range req.Ids {
+		if err := dahua.DeleteMaintenanceWindow(ctx, id); err != nil {
+			if core.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+	}
+	return &emptypb.Empty{}, nil
+}
+
 // ---------- User
 
 func (a *Admin) GetAdminUsersPage(ctx context.Context, req *rpc.GetAdminUsersPageReq) (*rpc.GetAdminUsersPageResp, error) {
@@ -407,6 +1019,73 @@ func (a *Admin) ResetUserPassword(ctx context.Context, req *rpc.ResetUserPasswor
 	return &emptypb.Empty{}, nil
 }
 
+func (a *Admin) ListUserTokens(ctx context.Context, req *rpc.ListUserTokensReq) (*rpc.ListUserTokensResp, error) {
+	v, err := auth.ListUserTokens(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*rpc.Token, 0, len(v))
+	for _, v := range v {
+		items = append(items, encodeToken(v))
+	}
+
+	return &rpc.ListUserTokensResp{
+		Items: items,
+	}, nil
+}
+
+func (a *Admin) RevokeUserToken(ctx context.Context, req *rpc.RevokeUserTokenReq) (*emptypb.Empty, error) {
+	if err := auth.DeleteUserToken(ctx, req.Id, req.TokenId); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (a *Admin) ResetUserTwoFactor(ctx context.Context, req *rpc.ResetUserTwoFactorReq) (*emptypb.Empty, error) {
+	if err := auth.ResetTwoFactor(ctx, req.Id); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (a *Admin) ListLoginLockouts(ctx context.Context, _ *emptypb.Empty) (*rpc.ListLoginLockoutsResp, error) {
+	v, err := auth.ListLoginLockouts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	items := make([]*rpc.ListLoginLockoutsResp_Lockout, 0, len(v))
+	for _, v := range v {
+		items = append(items, &rpc.ListLoginLockoutsResp_Lockout{
+			Id:               v.ID,
+			Kind:             v.Kind,
+			Value:            v.Value,
+			Failures:         v.Failures,
+			Locked:           v.LockedUntil.After(now),
+			LastFailedAtTime: timestamppb.New(v.LastFailedAt.Time),
+			LockedUntilTime:  timestamppb.New(v.LockedUntil.Time),
+		})
+	}
+
+	return &rpc.ListLoginLockoutsResp{
+		Items: items,
+	}, nil
+}
+
+func (a *Admin) ClearLoginLockouts(ctx context.Context, req *rpc.ClearLoginLockoutsReq) (*emptypb.Empty, error) {
+	for _, id := range req.Ids {
+		if err := auth.DeleteLoginLockout(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
 // ---------- Group
 
 func (a *Admin) GetAdminGroupsPage(ctx context.Context, req *rpc.GetAdminGroupsPageReq) (*rpc.GetAdminGroupsPageResp, error) {
@@ -525,9 +1204,10 @@ func (a *Admin) GetGroup(ctx context.Context, req *rpc.GetGroupReq) (*rpc.GetGro
 		return nil, err
 	}
 	return &rpc.GetGroupResp{
-		Id:          v.ID,
-		Name:        v.Name,
-		Description: v.Description,
+		Id:               v.ID,
+		Name:             v.Name,
+		Description:      v.Description,
+		RequireTwoFactor: v.RequireTwoFactor,
 	}, nil
 }
 
@@ -568,14 +1248,64 @@ func (a *Admin) DeleteGroup(ctx context.Context, req *rpc.DeleteGroupReq) (*empt
 	return &emptypb.Empty{}, nil
 }
 
-func (a *Admin) GetAdminEventsPage(ctx context.Context, _ *emptypb.Empty) (*rpc.GetAdminEventsPageResp, error) {
+func (a *Admin) GetAdminEventsPage(ctx context.Context, req *rpc.GetAdminEventsPageReq) (*rpc.GetAdminEventsPageResp, error) {
+	page := decodePagePagination(req.Page)
+	sort := decodeSort(req.Sort).defaultOrder(rpc.Order_DESC)
+
 	eventCount, err := dahua.CountEvents(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	filter := system.EventFilter{
+		FilterActions: req.FilterActions,
+		FilterUserIDs: req.FilterUserIDs,
+		FilterTarget:  req.FilterTarget,
+	}
+	if req.FilterStartTime != nil {
+		filter.FilterStart = req.FilterStartTime.AsTime()
+	}
+	if req.FilterEndTime != nil {
+		filter.FilterEnd = req.FilterEndTime.AsTime()
+	}
+
+	v, err := system.ListEvents(ctx, system.ListEventsParams{
+		Page:        page,
+		Ascending:   sort.Order == rpc.Order_ASC,
+		EventFilter: filter,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	actions, err := system.ListEventActions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*rpc.GetAdminEventsPageResp_Event, 0, len(v.Items))
+	for _, v := range v.Items {
+		events = append(events, &rpc.GetAdminEventsPageResp_Event{
+			Id:            v.ID,
+			Action:        v.Action,
+			Actor:         string(v.Actor),
+			UserId:        v.UserID.Int64,
+			Username:      v.Username,
+			Ip:            v.Ip,
+			UserAgent:     v.UserAgent,
+			Target:        v.Target,
+			Data:          string(v.Data.RawMessage),
+			Diff:          string(v.Diff.RawMessage),
+			CreatedAtTime: timestamppb.New(v.CreatedAt.Time),
+		})
+	}
+
 	return &rpc.GetAdminEventsPageResp{
 		EventCount: eventCount,
+		Events:     events,
+		PageResult: encodePagePaginationResult(v.PageResult),
+		Sort:       sort.encode(),
+		Actions:    actions,
 	}, nil
 }
 
@@ -589,17 +1319,28 @@ func (a *Admin) SetGroupDisable(ctx context.Context, req *rpc.SetGroupDisableReq
 	return &emptypb.Empty{}, nil
 }
 
+func (a *Admin) SetGroupRequireTwoFactor(ctx context.Context, req *rpc.SetGroupRequireTwoFactorReq) (*emptypb.Empty, error) {
+	if err := auth.UpdateGroupRequireTwoFactor(ctx, req.Id, req.Require); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
 func (a *Admin) CreateEventRule(ctx context.Context, req *rpc.CreateEventRuleReq) (*rpc.CreateEventRuleResp, error) {
 	id, err := dahua.CreateEventRule(ctx, repo.DahuaCreateEventRuleParams{
-		Code:       req.Code,
-		IgnoreDb:   req.IgnoreDb,
-		IgnoreLive: req.IgnoreLive,
-		IgnoreMqtt: req.IgnoreMqtt,
+		Code:             req.Code,
+		IgnoreDb:         req.IgnoreDb,
+		IgnoreLive:       req.IgnoreLive,
+		IgnoreMqtt:       req.IgnoreMqtt,
+		SnapshotCount:    req.SnapshotCount,
+		PreSnapshotCount: req.PreSnapshotCount,
 	})
 	if err != nil {
 		if errs, ok := core.AsFieldErrors(err); ok {
 			return nil, newInvalidArgument(errs,
 				keymap("code", "Code"),
+				keymap("snapshotCount", "SnapshotCount"),
+				keymap("preSnapshotCount", "PreSnapshotCount"),
 			)
 		}
 		return nil, err
@@ -613,11 +1354,13 @@ func (a *Admin) CreateEventRule(ctx context.Context, req *rpc.CreateEventRuleReq
 func (a *Admin) UpdateEventRule(ctx context.Context, req *rpc.UpdateEventRuleReq) (*emptypb.Empty, error) {
 	for _, v := range req.Items {
 		err := dahua.UpdateEventRule(ctx, repo.DahuaUpdateEventRuleParams{
-			Code:       v.Code,
-			IgnoreDb:   v.IgnoreDb,
-			IgnoreLive: v.IgnoreLive,
-			IgnoreMqtt: v.IgnoreMqtt,
-			ID:         v.Id,
+			Code:             v.Code,
+			IgnoreDb:         v.IgnoreDb,
+			IgnoreLive:       v.IgnoreLive,
+			IgnoreMqtt:       v.IgnoreMqtt,
+			SnapshotCount:    v.SnapshotCount,
+			PreSnapshotCount: v.PreSnapshotCount,
+			ID:               v.Id,
 		})
 		if err != nil {
 			if core.IsNotFound(err) {
@@ -639,11 +1382,13 @@ func (a *Admin) ListEventRules(ctx context.Context, _ *emptypb.Empty) (*rpc.List
 	items := make([]*rpc.ListEventRulesResp_Item, 0, len(v))
 	for _, v := range v {
 		items = append(items, &rpc.ListEventRulesResp_Item{
-			Id:         v.ID,
-			Code:       v.Code,
-			IgnoreDb:   v.IgnoreDb,
-			IgnoreLive: v.IgnoreLive,
-			IgnoreMqtt: v.IgnoreMqtt,
+			Id:               v.ID,
+			Code:             v.Code,
+			IgnoreDb:         v.IgnoreDb,
+			IgnoreLive:       v.IgnoreLive,
+			IgnoreMqtt:       v.IgnoreMqtt,
+			SnapshotCount:    v.SnapshotCount,
+			PreSnapshotCount: v.PreSnapshotCount,
 		})
 	}
 
@@ -665,6 +1410,117 @@ func (a *Admin) DeleteEventRules(ctx context.Context, req *rpc.DeleteEventRulesR
 	return &emptypb.Empty{}, nil
 }
 
+// ---------- Snapshot
+
+func (a *Admin) CreateSnapshotSchedule(ctx context.Context, req *rpc.CreateSnapshotScheduleReq) (*rpc.CreateSnapshotScheduleResp, error) {
+	id, err := dahua.CreateSnapshotSchedule(ctx, dahua.CreateSnapshotScheduleParams{
+		DeviceID: req.DeviceId,
+		Channel:  req.Channel,
+		Interval: time.Duration(req.IntervalSeconds) * time.Second,
+		Disabled: req.Disabled,
+	})
+	if err != nil {
+		if errs, ok := core.AsFieldErrors(err); ok {
+			return nil, newInvalidArgument(errs,
+				keymap("channel", "Channel"),
+				keymap("intervalSeconds", "Interval"),
+			)
+		}
+		return nil, err
+	}
+
+	return &rpc.CreateSnapshotScheduleResp{
+		Id: id,
+	}, nil
+}
+
+func (a *Admin) UpdateSnapshotSchedule(ctx context.Context, req *rpc.UpdateSnapshotScheduleReq) (*emptypb.Empty, error) {
+	err := dahua.UpdateSnapshotSchedule(ctx, dahua.UpdateSnapshotScheduleParams{
+		ID:       req.Id,
+		Channel:  req.Channel,
+		Interval: time.Duration(req.IntervalSeconds) * time.Second,
+	})
+	if err != nil {
+		if errs, ok := core.AsFieldErrors(err); ok {
+			return nil, newInvalidArgument(errs,
+				keymap("channel", "Channel"),
+				keymap("intervalSeconds", "Interval"),
+			)
+		}
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (a *Admin) SetSnapshotScheduleDisable(ctx context.Context, req *rpc.SetSnapshotScheduleDisableReq) (*emptypb.Empty, error) {
+	for _, v := range req.Items {
+		err := dahua.UpdateSnapshotScheduleDisabled(ctx, v.Id, v.Disable)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (a *Admin) DeleteSnapshotSchedules(ctx context.Context, req *rpc.DeleteSnapshotSchedulesReq) (*emptypb.Empty, error) {
+	for _, id := range req.Ids {
+		if err := dahua.DeleteSnapshotSchedule(ctx, id); err != nil {
+			if core.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (a *Admin) ListSnapshotSchedules(ctx context.Context, _ *emptypb.Empty) (*rpc.ListSnapshotSchedulesResp, error) {
+	v, err := dahua.ListSnapshotSchedules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*rpc.ListSnapshotSchedulesResp_Item, 0, len(v))
+	for _, v := range v {
+		items = append(items, &rpc.ListSnapshotSchedulesResp_Item{
+			Id:              v.ID,
+			DeviceId:        v.DeviceID,
+			Channel:         v.Channel,
+			IntervalSeconds: v.Interval,
+			Disabled:        v.DisabledAt.Valid,
+			CreatedAtTime:   timestamppb.New(v.CreatedAt.Time),
+			UpdatedAtTime:   timestamppb.New(v.UpdatedAt.Time),
+		})
+	}
+
+	return &rpc.ListSnapshotSchedulesResp{
+		Items: items,
+	}, nil
+}
+
+func (a *Admin) CreateTimelapse(ctx context.Context, req *rpc.CreateTimelapseReq) (*rpc.CreateTimelapseResp, error) {
+	taskID, err := dahuatasks.EnqueueTimelapse(ctx, dahuatasks.TimelapsePayload{
+		DeviceID:  req.DeviceId,
+		Channel:   req.Channel,
+		Start:     req.StartTime.AsTime(),
+		End:       req.EndTime.AsTime(),
+		Framerate: int(req.Framerate),
+	})
+	if err != nil {
+		if errs, ok := core.AsFieldErrors(err); ok {
+			return nil, newInvalidArgument(errs,
+				keymap("endTime", "End"),
+			)
+		}
+		return nil, err
+	}
+
+	return &rpc.CreateTimelapseResp{
+		TaskId: taskID,
+	}, nil
+}
+
 func (*Admin) ListLocations(context.Context, *emptypb.Empty) (*rpc.ListLocationsResp, error) {
 	return &rpc.ListLocationsResp{
 		Locations: core.Locations,
@@ -689,10 +1545,24 @@ func (*Admin) ListDeviceFeatures(context.Context, *emptypb.Empty) (*rpc.ListDevi
 	return listDeviceFeaturesResp, nil
 }
 
-func (a *Admin) UpdateConfig(cfg context.Context, req *rpc.UpdateConfigReq) (*emptypb.Empty, error) {
-	err := system.UpdateConfig(system.UpdateConfigParams{
-		SiteName:     req.SiteName,
-		EnableSignUp: req.EnableSignUp,
+func (a *Admin) GetAdminConfig(ctx context.Context, _ *emptypb.Empty) (*rpc.GetAdminConfigResp, error) {
+	cfg, err := system.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.GetAdminConfigResp{
+		SiteName:                  cfg.SiteName,
+		EnableSignUp:              cfg.EnableSignUp,
+		RequireTwoFactorForAdmins: cfg.RequireTwoFactorForAdmins,
+	}, nil
+}
+
+func (a *Admin) UpdateConfig(ctx context.Context, req *rpc.UpdateConfigReq) (*emptypb.Empty, error) {
+	err := system.UpdateConfig(ctx, system.UpdateConfigParams{
+		SiteName:                  req.SiteName,
+		EnableSignUp:              req.EnableSignUp,
+		RequireTwoFactorForAdmins: req.RequireTwoFactorForAdmins,
 	})
 	if err != nil {
 		return nil, err
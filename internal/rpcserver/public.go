@@ -2,11 +2,13 @@ package rpcserver
 
 import (
 	"context"
+	"errors"
 
 	"github.com/ItsNotGoodName/ipcmanview/internal/auth"
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
 	"github.com/ItsNotGoodName/ipcmanview/internal/system"
 	"github.com/ItsNotGoodName/ipcmanview/rpc"
+	"github.com/twitchtv/twirp"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
@@ -24,8 +26,10 @@ func (p *Public) GetConfig(context.Context, *emptypb.Empty) (*rpc.GetConfigResp,
 	}
 
 	return &rpc.GetConfigResp{
-		SiteName:     cfg.SiteName,
-		EnableSignUp: cfg.EnableSignUp,
+		SiteName:             cfg.SiteName,
+		EnableSignUp:         cfg.EnableSignUp && !cfg.OIDC.PasswordLoginDisabled(),
+		EnableOidc:           cfg.OIDC.Enable,
+		DisablePasswordLogin: cfg.OIDC.PasswordLoginDisabled(),
 	}, nil
 }
 
@@ -59,6 +63,36 @@ func (p *Public) SignUp(ctx context.Context, req *rpc.SignUpReq) (*emptypb.Empty
 	return &emptypb.Empty{}, nil
 }
 
-func (*Public) ForgotPassword(context.Context, *rpc.ForgotPasswordReq) (*emptypb.Empty, error) {
-	return nil, errNotImplemented
+func (*Public) ForgotPassword(ctx context.Context, req *rpc.ForgotPasswordReq) (*emptypb.Empty, error) {
+	cfg, err := system.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := auth.ForgotPassword(ctx, cfg, req.Email); err != nil {
+		if errors.Is(err, auth.ErrPasswordResetDisabled) {
+			return nil, twirp.FailedPrecondition.Error("Password reset is disabled.")
+		}
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (*Public) ResetPassword(ctx context.Context, req *rpc.ResetPasswordReq) (*emptypb.Empty, error) {
+	err := auth.ResetPassword(ctx, auth.ResetPasswordParams{
+		Token:       req.Token,
+		NewPassword: req.NewPassword,
+	})
+	if err != nil {
+		if errs, ok := core.AsFieldErrors(err); ok {
+			return nil, newInvalidArgument(errs, keymap("newPassword", "Password"))
+		}
+		if errors.Is(err, auth.ErrPasswordResetInvalid) {
+			return nil, twirp.FailedPrecondition.Error("Password reset link is invalid or has expired.")
+		}
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
 }
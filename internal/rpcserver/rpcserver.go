@@ -3,9 +3,11 @@ package rpcserver
 import (
 	"context"
 	"net/http"
+	"strings"
 
 	"github.com/ItsNotGoodName/ipcmanview/internal/auth"
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/models"
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog/log"
 	"github.com/twitchtv/twirp"
@@ -61,6 +63,12 @@ func RequireAuthSession() twirp.ServerOption {
 			}
 			return ctx, nil
 		},
+		RequestRouted: func(ctx context.Context) (context.Context, error) {
+			if err := requireTwoFactorSession(ctx); err != nil {
+				return ctx, err
+			}
+			return requireWritableSession(ctx)
+		},
 	})
 }
 
@@ -78,11 +86,59 @@ func RequireAdminAuthSession() twirp.ServerOption {
 			if !session.Admin {
 				return ctx, twirp.PermissionDenied.Error("You are not an admin.")
 			}
+			if session.Scope != nil && session.Scope.Level != models.DahuaPermissionLevel_Admin {
+				return ctx, twirp.PermissionDenied.Error("Token does not have the admin level.")
+			}
+			if session.TwoFactorRequired {
+				return ctx, errTwoFactorRequired
+			}
 			return ctx, nil
 		},
+		RequestRouted: requireWritableSession,
 	})
 }
 
+var errTwoFactorRequired = twirp.PermissionDenied.Error("Two-factor authentication must be enabled.")
+
+// twoFactorEnrollMethods can be called before the required two-factor authentication is enabled.
+var twoFactorEnrollMethods = map[string]bool{
+	"GetProfilePage":    true,
+	"GetMyTwoFactor":    true,
+	"EnrollMyTwoFactor": true,
+	"VerifyMyTwoFactor": true,
+}
+
+// requireTwoFactorSession denies sessions that must enable two-factor authentication from everything but enrolling.
+func requireTwoFactorSession(ctx context.Context) error {
+	session, ok := auth.UseSession(ctx)
+	if !ok || !session.TwoFactorRequired {
+		return nil
+	}
+
+	method, _ := twirp.MethodName(ctx)
+	if twoFactorEnrollMethods[method] {
+		return nil
+	}
+
+	return errTwoFactorRequired
+}
+
+// requireWritableSession denies read-only tokens from calling methods that make changes.
+// Methods that only read are prefixed with Get or List.
+func requireWritableSession(ctx context.Context) (context.Context, error) {
+	session, ok := auth.UseSession(ctx)
+	if !ok || session.Scope == nil || !session.Scope.ReadOnly {
+		return ctx, nil
+	}
+
+	method, _ := twirp.MethodName(ctx)
+	if strings.HasPrefix(method, "Get") || strings.HasPrefix(method, "List") {
+		return ctx, nil
+	}
+
+	return ctx, twirp.PermissionDenied.Error("Token is read-only.")
+}
+
 func useAuthSession(ctx context.Context) auth.Session {
 	u, ok := auth.UseSession(ctx)
 	if !ok {
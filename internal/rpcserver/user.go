@@ -2,6 +2,7 @@ package rpcserver
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/ItsNotGoodName/ipcmanview/internal/api"
@@ -9,25 +10,30 @@ import (
 	"github.com/ItsNotGoodName/ipcmanview/internal/build"
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
 	"github.com/ItsNotGoodName/ipcmanview/internal/dahua"
+	"github.com/ItsNotGoodName/ipcmanview/internal/dahuatasks"
 	"github.com/ItsNotGoodName/ipcmanview/internal/mediamtx"
 	"github.com/ItsNotGoodName/ipcmanview/internal/models"
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
 	"github.com/ItsNotGoodName/ipcmanview/rpc"
+	"github.com/twitchtv/twirp"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-func NewUser(mediamtxConfig mediamtx.Config) *User {
+func NewUser(mediamtxConfig mediamtx.Config, embeddedStream bool) *User {
 	return &User{
 		mediamtxConfig: mediamtxConfig,
+		embeddedStream: embeddedStream,
 	}
 }
 
 type User struct {
 	mediamtxConfig mediamtx.Config
+	embeddedStream bool
 }
 
 func (u *User) GetHomePage(ctx context.Context, _ *emptypb.Empty) (*rpc.GetHomePageResp, error) {
-	dbDevices, err := dahua.ListDevices(ctx)
+	dbDevices, err := dahua.ListDevices(ctx, dahua.DeviceFilter{})
 	if err != nil {
 		return nil, err
 	}
@@ -91,7 +97,19 @@ func (u *User) GetHomePage(ctx context.Context, _ *emptypb.Empty) (*rpc.GetHomeP
 }
 
 func (u *User) GetDevicesPage(ctx context.Context, req *rpc.GetDevicesPageReq) (*rpc.GetDevicesPageResp, error) {
-	dbDevices, err := dahua.ListDevices(ctx)
+	dbDevices, err := dahua.ListDevices(ctx, dahua.DeviceFilter{
+		FilterTags: req.FilterTags,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deviceTags, err := dahua.ListDeviceTagsMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := dahua.ListTags(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -105,11 +123,13 @@ func (u *User) GetDevicesPage(ctx context.Context, req *rpc.GetDevicesPageReq) (
 			Username:      v.Username,
 			CreatedAtTime: timestamppb.New(v.CreatedAt.Time),
 			Disabled:      v.DisabledAt.Valid,
+			Tags:          deviceTags[v.ID],
 		})
 	}
 
 	return &rpc.GetDevicesPageResp{
 		Devices: devices,
+		Tags:    tags,
 	}, nil
 }
 
@@ -265,12 +285,37 @@ func (u *User) GetEventsPage(ctx context.Context, req *rpc.GetEventsPageReq) (*r
 			FilterDeviceIDs: req.FilterDeviceIDs,
 			FilterCodes:     req.FilterCodes,
 			FilterActions:   req.FilterActions,
+			FilterTags:      req.FilterTags,
 		},
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	eventIDs := make([]int64, 0, len(v.Items))
+	for _, v := range v.Items {
+		eventIDs = append(eventIDs, v.ID)
+	}
+
+	dbSnapshots, err := dahua.ListEventSnapshots(ctx, eventIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make(map[int64][]*rpc.GetEventsPageResp_Event_Snapshot)
+	for _, v := range dbSnapshots {
+		var thumbnailURL string
+		if v.ThumbnailName.Valid {
+			thumbnailURL = api.DahuaAferoFileURI(v.ThumbnailName.String)
+		}
+
+		snapshots[v.EventID] = append(snapshots[v.EventID], &rpc.GetEventsPageResp_Event_Snapshot{
+			Id:           v.ID,
+			Url:          api.DahuaAferoFileURI(v.Name),
+			ThumbnailUrl: thumbnailURL,
+		})
+	}
+
 	var events []*rpc.GetEventsPageResp_Event
 	for _, v := range v.Items {
 		events = append(events, &rpc.GetEventsPageResp_Event{
@@ -282,6 +327,8 @@ func (u *User) GetEventsPage(ctx context.Context, req *rpc.GetEventsPageReq) (*r
 			Index:         v.Index,
 			Data:          string(v.Data.RawMessage),
 			CreatedAtTime: timestamppb.New(v.CreatedAt.Time),
+			Snapshots:     snapshots[v.ID],
+			Maintenance:   v.Maintenance,
 		})
 	}
 
@@ -382,6 +429,139 @@ func (u *User) RevokeAllMySessions(ctx context.Context, rCreateUpdateGroupeq *em
 	return &emptypb.Empty{}, nil
 }
 
+func (u *User) ListMyTokens(ctx context.Context, _ *emptypb.Empty) (*rpc.ListMyTokensResp, error) {
+	session := useAuthSession(ctx)
+
+	v, err := auth.ListUserTokens(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*rpc.Token, 0, len(v))
+	for _, v := range v {
+		items = append(items, encodeToken(v))
+	}
+
+	return &rpc.ListMyTokensResp{
+		Items: items,
+	}, nil
+}
+
+func (u *User) CreateMyToken(ctx context.Context, req *rpc.CreateMyTokenReq) (*rpc.CreateMyTokenResp, error) {
+	level, err := models.ParseDahuaPermissionLevel(req.Level)
+	if err != nil {
+		return nil, twirp.InvalidArgumentError("level", "Invalid level.")
+	}
+
+	var expiredAt time.Time
+	if req.ExpiredAtTime != nil {
+		expiredAt = req.ExpiredAtTime.AsTime()
+	}
+
+	id, token, err := auth.CreateUserToken(ctx, auth.CreateUserTokenParams{
+		Name:      req.Name,
+		Level:     level,
+		ReadOnly:  req.ReadOnly,
+		ExpiredAt: expiredAt,
+	})
+	if err != nil {
+		if errs, ok := core.AsFieldErrors(err); ok {
+			return nil, newInvalidArgument(errs,
+				keymap("name", "Name"),
+				keymap("level", "Level"),
+				keymap("expiredAtTime", "ExpiredAt"),
+			)
+		}
+		return nil, err
+	}
+
+	return &rpc.CreateMyTokenResp{
+		Id:    id,
+		Token: token,
+	}, nil
+}
+
+func (u *User) RevokeMyToken(ctx context.Context, req *rpc.RevokeMyTokenReq) (*emptypb.Empty, error) {
+	session := useAuthSession(ctx)
+
+	if err := auth.DeleteUserToken(ctx, session.UserID, req.TokenId); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (u *User) GetMyTwoFactor(ctx context.Context, _ *emptypb.Empty) (*rpc.GetMyTwoFactorResp, error) {
+	session := useAuthSession(ctx)
+
+	cfg, err := system.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := auth.GetTwoFactorStatus(ctx, cfg, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.GetMyTwoFactorResp{
+		Enabled:                v.Enabled,
+		Required:               v.Required,
+		RecoveryCodesRemaining: v.RecoveryCodes,
+	}, nil
+}
+
+func (u *User) EnrollMyTwoFactor(ctx context.Context, _ *emptypb.Empty) (*rpc.EnrollMyTwoFactorResp, error) {
+	cfg, err := system.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := auth.EnrollTwoFactor(ctx, cfg)
+	if err != nil {
+		if errors.Is(err, auth.ErrTwoFactorEnabled) {
+			return nil, twirp.FailedPrecondition.Error("Two-factor authentication is already enabled.")
+		}
+		return nil, err
+	}
+
+	return &rpc.EnrollMyTwoFactorResp{
+		Secret: v.Secret,
+		Url:    v.URL,
+	}, nil
+}
+
+func (u *User) VerifyMyTwoFactor(ctx context.Context, req *rpc.VerifyMyTwoFactorReq) (*rpc.VerifyMyTwoFactorResp, error) {
+	codes, err := auth.VerifyTwoFactor(ctx, req.Code)
+	if err != nil {
+		if errs, ok := core.AsFieldErrors(err); ok {
+			return nil, newInvalidArgument(errs, keymap("code", "Code"))
+		}
+		if errors.Is(err, auth.ErrTwoFactorEnabled) || errors.Is(err, auth.ErrTwoFactorNotEnabled) {
+			return nil, twirp.FailedPrecondition.Error(err.Error())
+		}
+		return nil, err
+	}
+
+	return &rpc.VerifyMyTwoFactorResp{
+		RecoveryCodes: codes,
+	}, nil
+}
+
+func (u *User) DisableMyTwoFactor(ctx context.Context, req *rpc.DisableMyTwoFactorReq) (*emptypb.Empty, error) {
+	if err := auth.DisableTwoFactor(ctx, req.Code); err != nil {
+		if errs, ok := core.AsFieldErrors(err); ok {
+			return nil, newInvalidArgument(errs, keymap("code", "Code"))
+		}
+		if errors.Is(err, auth.ErrTwoFactorNotEnabled) {
+			return nil, twirp.FailedPrecondition.Error(err.Error())
+		}
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
 func (u *User) RevokeMySession(ctx context.Context, req *rpc.RevokeMySessionReq) (*emptypb.Empty, error) {
 	session := useAuthSession(ctx)
 
@@ -393,7 +573,7 @@ func (u *User) RevokeMySession(ctx context.Context, req *rpc.RevokeMySessionReq)
 }
 
 func (u *User) ListDevices(ctx context.Context, _ *emptypb.Empty) (*rpc.ListDevicesResp, error) {
-	dbDevices, err := dahua.ListDevices(ctx)
+	dbDevices, err := dahua.ListDevices(ctx, dahua.DeviceFilter{})
 	if err != nil {
 		return nil, err
 	}
@@ -556,9 +736,14 @@ func (u *User) ListDeviceStreams(ctx context.Context, req *rpc.ListDeviceStreams
 
 	items := make([]*rpc.ListDeviceStreamsResp_Stream, 0, len(res))
 	for _, v := range res {
+		embedURL := api.MediamtxURI(u.mediamtxConfig.DahuaEmbedPath(v))
+		if u.embeddedStream {
+			embedURL = api.DahuaStreamHLSURI(v.ID)
+		}
+
 		items = append(items, &rpc.ListDeviceStreamsResp_Stream{
 			Name:     v.Name,
-			EmbedUrl: api.MediamtxURI(u.mediamtxConfig.DahuaEmbedPath(v)),
+			EmbedUrl: embedURL,
 		})
 	}
 
@@ -567,6 +752,168 @@ func (u *User) ListDeviceStreams(ctx context.Context, req *rpc.ListDeviceStreams
 	}, nil
 }
 
+func (u *User) ListDeviceTimelapses(ctx context.Context, req *rpc.ListDeviceTimelapsesReq) (*rpc.ListDeviceTimelapsesResp, error) {
+	v, err := dahua.ListTimelapses(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*rpc.ListDeviceTimelapsesResp_Timelapse, 0, len(v))
+	for _, v := range v {
+		items = append(items, &rpc.ListDeviceTimelapsesResp_Timelapse{
+			Id:            v.DahuaTimelapse.ID,
+			Channel:       v.DahuaTimelapse.Channel,
+			StartTime:     timestamppb.New(v.DahuaTimelapse.StartTime.Time),
+			EndTime:       timestamppb.New(v.DahuaTimelapse.EndTime.Time),
+			FrameCount:    v.DahuaTimelapse.FrameCount,
+			Url:           api.DahuaAferoFileURI(v.DahuaAferoFile.Name),
+			Size:          v.DahuaAferoFile.Size,
+			CreatedAtTime: timestamppb.New(v.DahuaTimelapse.CreatedAt.Time),
+		})
+	}
+
+	return &rpc.ListDeviceTimelapsesResp{
+		Items: items,
+	}, nil
+}
+
+func (u *User) ListDeviceExports(ctx context.Context, req *rpc.ListDeviceExportsReq) (*rpc.ListDeviceExportsResp, error) {
+	v, err := dahua.ListExports(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*rpc.ListDeviceExportsResp_Export, 0, len(v))
+	for _, v := range v {
+		var url string
+		if v.AferoFileName.Valid {
+			url = api.DahuaAferoFileURI(v.AferoFileName.String)
+		}
+
+		items = append(items, &rpc.ListDeviceExportsResp_Export{
+			Id:            v.ID,
+			Channel:       v.Channel,
+			StartTime:     timestamppb.New(v.StartTime.Time),
+			EndTime:       timestamppb.New(v.EndTime.Time),
+			Url:           url,
+			Error:         v.Error,
+			Completed:     v.CompletedAt.Valid,
+			CreatedAtTime: timestamppb.New(v.CreatedAt.Time),
+		})
+	}
+
+	return &rpc.ListDeviceExportsResp{
+		Items: items,
+	}, nil
+}
+
+func (u *User) CreateDeviceExport(ctx context.Context, req *rpc.CreateDeviceExportReq) (*rpc.CreateDeviceExportResp, error) {
+	id, taskID, err := dahuatasks.EnqueueExport(ctx, dahua.CreateExportParams{
+		DeviceID: req.DeviceId,
+		Channel:  req.Channel,
+		Start:    req.StartTime.AsTime(),
+		End:      req.EndTime.AsTime(),
+	})
+	if err != nil {
+		if errs, ok := core.AsFieldErrors(err); ok {
+			return nil, newInvalidArgument(errs,
+				keymap("endTime", "End"),
+			)
+		}
+		return nil, err
+	}
+
+	return &rpc.CreateDeviceExportResp{
+		Id:     id,
+		TaskId: taskID,
+	}, nil
+}
+
+func (u *User) ListDeviceGuestLinks(ctx context.Context, req *rpc.ListDeviceGuestLinksReq) (*rpc.ListDeviceGuestLinksResp, error) {
+	v, err := dahua.ListGuestLinks(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*rpc.ListDeviceGuestLinksResp_GuestLink, 0, len(v))
+	for _, v := range v {
+		item := &rpc.ListDeviceGuestLinksResp_GuestLink{
+			Id:            v.ID,
+			Name:          v.Name,
+			Username:      v.Username,
+			Channel:       v.Channel,
+			Live:          v.Live,
+			FileCount:     v.FileCount,
+			MaxViews:      v.MaxViews,
+			Views:         v.Views,
+			CreatedAtTime: timestamppb.New(v.CreatedAt.Time),
+			ExpiredAtTime: timestamppb.New(v.ExpiredAt.Time),
+			Revoked:       v.RevokedAt.Valid,
+		}
+		if v.StartTime.Valid && v.EndTime.Valid {
+			item.StartTime = timestamppb.New(v.StartTime.Time.Time)
+			item.EndTime = timestamppb.New(v.EndTime.Time.Time)
+		}
+		if v.LastViewedAt.Valid {
+			item.LastViewedAtTime = timestamppb.New(v.LastViewedAt.Time.Time)
+		}
+		items = append(items, item)
+	}
+
+	return &rpc.ListDeviceGuestLinksResp{
+		Items: items,
+	}, nil
+}
+
+func (u *User) CreateDeviceGuestLink(ctx context.Context, req *rpc.CreateDeviceGuestLinkReq) (*rpc.CreateDeviceGuestLinkResp, error) {
+	arg := dahua.CreateGuestLinkParams{
+		DeviceID: req.DeviceId,
+		Name:     req.Name,
+		Channel:  req.Channel,
+		Live:     req.Live,
+		FileIDs:  req.FileIds,
+		MaxViews: req.MaxViews,
+	}
+	if req.StartTime != nil {
+		arg.Start = req.StartTime.AsTime()
+	}
+	if req.EndTime != nil {
+		arg.End = req.EndTime.AsTime()
+	}
+	if req.ExpiredAtTime != nil {
+		arg.ExpiredAt = req.ExpiredAtTime.AsTime()
+	}
+
+	id, token, err := dahua.CreateGuestLink(ctx, arg)
+	if err != nil {
+		if errs, ok := core.AsFieldErrors(err); ok {
+			return nil, newInvalidArgument(errs,
+				keymap("name", "Name"),
+				keymap("channel", "Channel"),
+				keymap("live", "Live"),
+				keymap("fileIds", "FileIDs"),
+				keymap("endTime", "End"),
+				keymap("maxViews", "MaxViews"),
+				keymap("expiredAtTime", "ExpiredAt"),
+			)
+		}
+		return nil, err
+	}
+
+	return &rpc.CreateDeviceGuestLinkResp{
+		Id:  id,
+		Url: api.GuestURI(token),
+	}, nil
+}
+
+func (u *User) RevokeDeviceGuestLink(ctx context.Context, req *rpc.RevokeDeviceGuestLinkReq) (*emptypb.Empty, error) {
+	if err := dahua.RevokeGuestLink(ctx, req.Id); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
 func (u *User) ListEmailAlarmEvents(ctx context.Context, _ *emptypb.Empty) (*rpc.ListEmailAlarmEventsResp, error) {
 	alarmEvents, err := dahua.ListEmailAlarmEvents(ctx)
 	if err != nil {
@@ -589,9 +936,15 @@ func (u *User) ListEventFilters(ctx context.Context, _ *emptypb.Empty) (*rpc.Lis
 		return nil, err
 	}
 
+	tags, err := dahua.ListTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	return &rpc.ListEventFiltersResp{
 		Codes:   codes,
 		Actions: actions,
+		Tags:    tags,
 	}, nil
 }
 
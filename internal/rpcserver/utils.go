@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
 	"github.com/ItsNotGoodName/ipcmanview/pkg/pagination"
 	"github.com/ItsNotGoodName/ipcmanview/rpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // ---------- Sort
@@ -101,3 +103,26 @@ func encodePagePaginationResult(v pagination.PageResult) *rpc.PagePaginationResu
 		NextPage:     int32(v.Next()),
 	}
 }
+
+// ---------- Token
+
+func encodeToken(v repo.UserToken) *rpc.Token {
+	var lastUsedAtTime, expiredAtTime *timestamppb.Timestamp
+	if v.LastUsedAt.Valid {
+		lastUsedAtTime = timestamppb.New(v.LastUsedAt.Time.Time)
+	}
+	if v.ExpiredAt.Valid {
+		expiredAtTime = timestamppb.New(v.ExpiredAt.Time.Time)
+	}
+
+	return &rpc.Token{
+		Id:             v.ID,
+		Name:           v.Name,
+		Level:          v.Level.String(),
+		ReadOnly:       v.ReadOnly,
+		LastIp:         v.LastIp,
+		LastUsedAtTime: lastUsedAtTime,
+		CreatedAtTime:  timestamppb.New(v.CreatedAt.Time),
+		ExpiredAtTime:  expiredAtTime,
+	}
+}
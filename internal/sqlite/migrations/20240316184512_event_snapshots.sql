@@ -0,0 +1,55 @@
+-- +goose Up
+-- add column "snapshot_count" to table: "dahua_event_rules"
+ALTER TABLE `dahua_event_rules` ADD COLUMN `snapshot_count` integer NOT NULL DEFAULT 0;
+-- add column "snapshot_count" to table: "dahua_event_device_rules"
+ALTER TABLE `dahua_event_device_rules` ADD COLUMN `snapshot_count` integer NOT NULL DEFAULT 0;
+-- disable the enforcement of foreign-keys constraints
+PRAGMA foreign_keys = off;
+-- create "new_dahua_thumbnails" table
+CREATE TABLE `new_dahua_thumbnails` (`id` integer NOT NULL PRIMARY KEY AUTOINCREMENT, `file_id` integer NULL, `email_attachment_id` integer NULL, `snapshot_id` integer NULL, `width` integer NOT NULL, `height` integer NOT NULL, CONSTRAINT `0` FOREIGN KEY (`snapshot_id`) REFERENCES `dahua_snapshots` (`id`) ON UPDATE CASCADE ON DELETE CASCADE, CONSTRAINT `1` FOREIGN KEY (`email_attachment_id`) REFERENCES `dahua_email_attachments` (`id`) ON UPDATE CASCADE ON DELETE CASCADE, CONSTRAINT `2` FOREIGN KEY (`file_id`) REFERENCES `dahua_files` (`id`) ON UPDATE CASCADE ON DELETE CASCADE);
+-- copy rows from old table "dahua_thumbnails" to new temporary table "new_dahua_thumbnails"
+INSERT INTO `new_dahua_thumbnails` (`id`, `file_id`, `email_attachment_id`, `width`, `height`) SELECT `id`, `file_id`, `email_attachment_id`, `width`, `height` FROM `dahua_thumbnails`;
+-- drop "dahua_thumbnails" table after copying rows
+DROP TABLE `dahua_thumbnails`;
+-- rename temporary table "new_dahua_thumbnails" to "dahua_thumbnails"
+ALTER TABLE `new_dahua_thumbnails` RENAME TO `dahua_thumbnails`;
+-- create index "dahua_thumbnails_file_id_width_height" to table: "dahua_thumbnails"
+CREATE UNIQUE INDEX `dahua_thumbnails_file_id_width_height` ON `dahua_thumbnails` (`file_id`, `width`, `height`);
+-- create index "dahua_thumbnails_email_attachment_id_width_height" to table: "dahua_thumbnails"
+CREATE UNIQUE INDEX `dahua_thumbnails_email_attachment_id_width_height` ON `dahua_thumbnails` (`email_attachment_id`, `width`, `height`);
+-- create index "dahua_thumbnails_snapshot_id_width_height" to table: "dahua_thumbnails"
+CREATE UNIQUE INDEX `dahua_thumbnails_snapshot_id_width_height` ON `dahua_thumbnails` (`snapshot_id`, `width`, `height`);
+-- create "new_dahua_snapshots" table
+CREATE TABLE `new_dahua_snapshots` (`id` integer NOT NULL PRIMARY KEY AUTOINCREMENT, `device_id` integer NOT NULL, `channel` integer NOT NULL, `event_id` integer NULL, `created_at` datetime NOT NULL, CONSTRAINT `0` FOREIGN KEY (`event_id`) REFERENCES `dahua_events` (`id`) ON UPDATE CASCADE ON DELETE CASCADE, CONSTRAINT `1` FOREIGN KEY (`device_id`) REFERENCES `dahua_devices` (`id`) ON UPDATE CASCADE ON DELETE CASCADE);
+-- copy rows from old table "dahua_snapshots" to new temporary table "new_dahua_snapshots"
+INSERT INTO `new_dahua_snapshots` (`id`, `device_id`, `channel`, `created_at`) SELECT `id`, `device_id`, `channel`, `created_at` FROM `dahua_snapshots`;
+-- drop "dahua_snapshots" table after copying rows
+DROP TABLE `dahua_snapshots`;
+-- rename temporary table "new_dahua_snapshots" to "dahua_snapshots"
+ALTER TABLE `new_dahua_snapshots` RENAME TO `dahua_snapshots`;
+-- create index "dahua_snapshots_device_id_channel_created_at_idx" to table: "dahua_snapshots"
+CREATE INDEX `dahua_snapshots_device_id_channel_created_at_idx` ON `dahua_snapshots` (`device_id`, `channel`, `created_at`);
+-- create index "dahua_snapshots_event_id_idx" to table: "dahua_snapshots"
+CREATE INDEX `dahua_snapshots_event_id_idx` ON `dahua_snapshots` (`event_id`);
+-- enable back the enforcement of foreign-keys constraints
+PRAGMA foreign_keys = on;
+
+-- +goose Down
+-- reverse: create index "dahua_snapshots_event_id_idx" to table: "dahua_snapshots"
+DROP INDEX `dahua_snapshots_event_id_idx`;
+-- reverse: create index "dahua_snapshots_device_id_channel_created_at_idx" to table: "dahua_snapshots"
+DROP INDEX `dahua_snapshots_device_id_channel_created_at_idx`;
+-- reverse: create "new_dahua_snapshots" table
+DROP TABLE `new_dahua_snapshots`;
+-- reverse: create index "dahua_thumbnails_snapshot_id_width_height" to table: "dahua_thumbnails"
+DROP INDEX `dahua_thumbnails_snapshot_id_width_height`;
+-- reverse: create index "dahua_thumbnails_email_attachment_id_width_height" to table: "dahua_thumbnails"
+DROP INDEX `dahua_thumbnails_email_attachment_id_width_height`;
+-- reverse: create index "dahua_thumbnails_file_id_width_height" to table: "dahua_thumbnails"
+DROP INDEX `dahua_thumbnails_file_id_width_height`;
+-- reverse: create "new_dahua_thumbnails" table
+DROP TABLE `new_dahua_thumbnails`;
+-- reverse: add column "snapshot_count" to table: "dahua_event_device_rules"
+ALTER TABLE `dahua_event_device_rules` DROP COLUMN `snapshot_count`;
+-- reverse: add column "snapshot_count" to table: "dahua_event_rules"
+ALTER TABLE `dahua_event_rules` DROP COLUMN `snapshot_count`;
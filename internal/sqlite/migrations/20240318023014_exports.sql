@@ -0,0 +1,49 @@
+-- +goose Up
+-- create "dahua_exports" table
+CREATE TABLE `dahua_exports` (`id` integer NOT NULL PRIMARY KEY AUTOINCREMENT, `device_id` integer NOT NULL, `channel` integer NOT NULL, `start_time` datetime NOT NULL, `end_time` datetime NOT NULL, `error` text NOT NULL DEFAULT '', `created_at` datetime NOT NULL, `completed_at` datetime NULL, CONSTRAINT `0` FOREIGN KEY (`device_id`) REFERENCES `dahua_devices` (`id`) ON UPDATE CASCADE ON DELETE CASCADE);
+-- disable the enforcement of foreign-keys constraints
+PRAGMA foreign_keys = off;
+-- create "new_dahua_afero_files" table
+CREATE TABLE `new_dahua_afero_files` (`id` integer NOT NULL, `file_id` integer NULL, `thumbnail_id` integer NULL, `email_attachment_id` integer NULL, `snapshot_id` integer NULL, `timelapse_id` integer NULL, `export_id` integer NULL, `name` text NOT NULL, `ready` boolean NOT NULL DEFAULT false, `size` integer NOT NULL DEFAULT 0, `created_at` datetime NOT NULL, PRIMARY KEY (`id`), CONSTRAINT `0` FOREIGN KEY (`export_id`) REFERENCES `dahua_exports` (`id`) ON UPDATE CASCADE ON DELETE SET NULL, CONSTRAINT `1` FOREIGN KEY (`timelapse_id`) REFERENCES `dahua_timelapses` (`id`) ON UPDATE CASCADE ON DELETE SET NULL, CONSTRAINT `2` FOREIGN KEY (`snapshot_id`) REFERENCES `dahua_snapshots` (`id`) ON UPDATE CASCADE ON DELETE SET NULL, CONSTRAINT `3` FOREIGN KEY (`email_attachment_id`) REFERENCES `dahua_email_attachments` (`id`) ON UPDATE CASCADE ON DELETE SET NULL, CONSTRAINT `4` FOREIGN KEY (`thumbnail_id`) REFERENCES `dahua_thumbnails` (`id`) ON UPDATE CASCADE ON DELETE SET NULL, CONSTRAINT `5` FOREIGN KEY (`file_id`) REFERENCES `dahua_files` (`id`) ON UPDATE CASCADE ON DELETE SET NULL);
+-- copy rows from old table "dahua_afero_files" to new temporary table "new_dahua_afero_files"
+INSERT INTO `new_dahua_afero_files` (`id`, `file_id`, `thumbnail_id`, `email_attachment_id`, `snapshot_id`, `timelapse_id`, `name`, `ready`, `size`, `created_at`) SELECT `id`, `file_id`, `thumbnail_id`, `email_attachment_id`, `snapshot_id`, `timelapse_id`, `name`, `ready`, `size`, `created_at` FROM `dahua_afero_files`;
+-- drop "dahua_afero_files" table after copying rows
+DROP TABLE `dahua_afero_files`;
+-- rename temporary table "new_dahua_afero_files" to "dahua_afero_files"
+ALTER TABLE `new_dahua_afero_files` RENAME TO `dahua_afero_files`;
+-- create index "dahua_afero_files_file_id" to table: "dahua_afero_files"
+CREATE UNIQUE INDEX `dahua_afero_files_file_id` ON `dahua_afero_files` (`file_id`);
+-- create index "dahua_afero_files_thumbnail_id" to table: "dahua_afero_files"
+CREATE UNIQUE INDEX `dahua_afero_files_thumbnail_id` ON `dahua_afero_files` (`thumbnail_id`);
+-- create index "dahua_afero_files_email_attachment_id" to table: "dahua_afero_files"
+CREATE UNIQUE INDEX `dahua_afero_files_email_attachment_id` ON `dahua_afero_files` (`email_attachment_id`);
+-- create index "dahua_afero_files_snapshot_id" to table: "dahua_afero_files"
+CREATE UNIQUE INDEX `dahua_afero_files_snapshot_id` ON `dahua_afero_files` (`snapshot_id`);
+-- create index "dahua_afero_files_timelapse_id" to table: "dahua_afero_files"
+CREATE UNIQUE INDEX `dahua_afero_files_timelapse_id` ON `dahua_afero_files` (`timelapse_id`);
+-- create index "dahua_afero_files_export_id" to table: "dahua_afero_files"
+CREATE UNIQUE INDEX `dahua_afero_files_export_id` ON `dahua_afero_files` (`export_id`);
+-- create index "dahua_afero_files_name" to table: "dahua_afero_files"
+CREATE UNIQUE INDEX `dahua_afero_files_name` ON `dahua_afero_files` (`name`);
+-- enable back the enforcement of foreign-keys constraints
+PRAGMA foreign_keys = on;
+
+-- +goose Down
+-- reverse: create index "dahua_afero_files_name" to table: "dahua_afero_files"
+DROP INDEX `dahua_afero_files_name`;
+-- reverse: create index "dahua_afero_files_export_id" to table: "dahua_afero_files"
+DROP INDEX `dahua_afero_files_export_id`;
+-- reverse: create index "dahua_afero_files_timelapse_id" to table: "dahua_afero_files"
+DROP INDEX `dahua_afero_files_timelapse_id`;
+-- reverse: create index "dahua_afero_files_snapshot_id" to table: "dahua_afero_files"
+DROP INDEX `dahua_afero_files_snapshot_id`;
+-- reverse: create index "dahua_afero_files_email_attachment_id" to table: "dahua_afero_files"
+DROP INDEX `dahua_afero_files_email_attachment_id`;
+-- reverse: create index "dahua_afero_files_thumbnail_id" to table: "dahua_afero_files"
+DROP INDEX `dahua_afero_files_thumbnail_id`;
+-- reverse: create index "dahua_afero_files_file_id" to table: "dahua_afero_files"
+DROP INDEX `dahua_afero_files_file_id`;
+-- reverse: create "new_dahua_afero_files" table
+DROP TABLE `new_dahua_afero_files`;
+-- reverse: create "dahua_exports" table
+DROP TABLE `dahua_exports`;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- create "user_tokens" table
+CREATE TABLE `user_tokens` (`id` integer NOT NULL PRIMARY KEY AUTOINCREMENT, `user_id` integer NOT NULL, `name` text NOT NULL, `token_hash` text NOT NULL, `level` integer NOT NULL, `read_only` boolean NOT NULL, `last_ip` text NOT NULL DEFAULT '', `last_used_at` datetime NULL, `created_at` datetime NOT NULL, `expired_at` datetime NULL, CONSTRAINT `0` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON UPDATE CASCADE ON DELETE CASCADE);
+-- create index "user_tokens_token_hash" to table: "user_tokens"
+CREATE UNIQUE INDEX `user_tokens_token_hash` ON `user_tokens` (`token_hash`);
+
+-- +goose Down
+-- reverse: create index "user_tokens_token_hash" to table: "user_tokens"
+DROP INDEX `user_tokens_token_hash`;
+-- reverse: create "user_tokens" table
+DROP TABLE `user_tokens`;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- create "user_oidc_identities" table
+CREATE TABLE `user_oidc_identities` (`user_id` integer NOT NULL, `issuer` text NOT NULL, `subject` text NOT NULL, `created_at` datetime NOT NULL, CONSTRAINT `0` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON UPDATE CASCADE ON DELETE CASCADE);
+-- create index "user_oidc_identities_issuer_subject" to table: "user_oidc_identities"
+CREATE UNIQUE INDEX `user_oidc_identities_issuer_subject` ON `user_oidc_identities` (`issuer`, `subject`);
+
+-- +goose Down
+-- reverse: create index "user_oidc_identities_issuer_subject" to table: "user_oidc_identities"
+DROP INDEX `user_oidc_identities_issuer_subject`;
+-- reverse: create "user_oidc_identities" table
+DROP TABLE `user_oidc_identities`;
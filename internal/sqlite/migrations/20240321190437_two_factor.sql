@@ -0,0 +1,15 @@
+-- +goose Up
+-- create "user_totps" table
+CREATE TABLE `user_totps` (`user_id` integer NOT NULL, `secret` text NOT NULL, `last_step` integer NOT NULL DEFAULT 0, `created_at` datetime NOT NULL, `enabled_at` datetime NULL, PRIMARY KEY (`user_id`), CONSTRAINT `0` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON UPDATE CASCADE ON DELETE CASCADE);
+-- create "user_recovery_codes" table
+CREATE TABLE `user_recovery_codes` (`id` integer NOT NULL PRIMARY KEY AUTOINCREMENT, `user_id` integer NOT NULL, `code_hash` text NOT NULL, `used_at` datetime NULL, CONSTRAINT `0` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON UPDATE CASCADE ON DELETE CASCADE);
+-- add column "require_two_factor" to table: "groups"
+ALTER TABLE `groups` ADD COLUMN `require_two_factor` boolean NOT NULL DEFAULT false;
+
+-- +goose Down
+-- reverse: add column "require_two_factor" to table: "groups"
+ALTER TABLE `groups` DROP COLUMN `require_two_factor`;
+-- reverse: create "user_recovery_codes" table
+DROP TABLE `user_recovery_codes`;
+-- reverse: create "user_totps" table
+DROP TABLE `user_totps`;
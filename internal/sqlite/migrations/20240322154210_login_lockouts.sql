@@ -0,0 +1,11 @@
+-- +goose Up
+-- create "login_lockouts" table
+CREATE TABLE `login_lockouts` (`id` integer NOT NULL PRIMARY KEY AUTOINCREMENT, `kind` text NOT NULL, `value` text NOT NULL, `failures` integer NOT NULL, `last_failed_at` datetime NOT NULL, `locked_until` datetime NOT NULL);
+-- create index "login_lockouts_kind_value" to table: "login_lockouts"
+CREATE UNIQUE INDEX `login_lockouts_kind_value` ON `login_lockouts` (`kind`, `value`);
+
+-- +goose Down
+-- reverse: create index "login_lockouts_kind_value" to table: "login_lockouts"
+DROP INDEX `login_lockouts_kind_value`;
+-- reverse: create "login_lockouts" table
+DROP TABLE `login_lockouts`;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- create "user_password_resets" table
+CREATE TABLE `user_password_resets` (`id` integer NOT NULL PRIMARY KEY AUTOINCREMENT, `user_id` integer NOT NULL, `token_hash` text NOT NULL, `created_at` datetime NOT NULL, `expired_at` datetime NOT NULL, `used_at` datetime NULL, CONSTRAINT `0` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON UPDATE CASCADE ON DELETE CASCADE);
+-- create index "user_password_resets_token_hash" to table: "user_password_resets"
+CREATE UNIQUE INDEX `user_password_resets_token_hash` ON `user_password_resets` (`token_hash`);
+
+-- +goose Down
+-- reverse: create index "user_password_resets_token_hash" to table: "user_password_resets"
+DROP INDEX `user_password_resets_token_hash`;
+-- reverse: create "user_password_resets" table
+DROP TABLE `user_password_resets`;
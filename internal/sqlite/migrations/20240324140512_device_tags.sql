@@ -0,0 +1,23 @@
+-- +goose Up
+-- create "dahua_device_tags" table
+CREATE TABLE `dahua_device_tags` (`device_id` integer NOT NULL, `tag` text NOT NULL, CONSTRAINT `0` FOREIGN KEY (`device_id`) REFERENCES `dahua_devices` (`id`) ON UPDATE CASCADE ON DELETE CASCADE);
+-- create index "dahua_device_tags_device_id_tag" to table: "dahua_device_tags"
+CREATE UNIQUE INDEX `dahua_device_tags_device_id_tag` ON `dahua_device_tags` (`device_id`, `tag`);
+-- create "dahua_tag_permissions" table
+CREATE TABLE `dahua_tag_permissions` (`user_id` integer NULL, `group_id` integer NULL, `tag` text NOT NULL, `level` integer NOT NULL, CONSTRAINT `0` FOREIGN KEY (`group_id`) REFERENCES `groups` (`id`) ON UPDATE CASCADE ON DELETE CASCADE, CONSTRAINT `1` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON UPDATE CASCADE ON DELETE CASCADE);
+-- create index "dahua_tag_permissions_user_id_tag" to table: "dahua_tag_permissions"
+CREATE UNIQUE INDEX `dahua_tag_permissions_user_id_tag` ON `dahua_tag_permissions` (`user_id`, `tag`);
+-- create index "dahua_tag_permissions_group_id_tag" to table: "dahua_tag_permissions"
+CREATE UNIQUE INDEX `dahua_tag_permissions_group_id_tag` ON `dahua_tag_permissions` (`group_id`, `tag`);
+
+-- +goose Down
+-- reverse: create index "dahua_tag_permissions_group_id_tag" to table: "dahua_tag_permissions"
+DROP INDEX `dahua_tag_permissions_group_id_tag`;
+-- reverse: create index "dahua_tag_permissions_user_id_tag" to table: "dahua_tag_permissions"
+DROP INDEX `dahua_tag_permissions_user_id_tag`;
+-- reverse: create "dahua_tag_permissions" table
+DROP TABLE `dahua_tag_permissions`;
+-- reverse: create index "dahua_device_tags_device_id_tag" to table: "dahua_device_tags"
+DROP INDEX `dahua_device_tags_device_id_tag`;
+-- reverse: create "dahua_device_tags" table
+DROP TABLE `dahua_device_tags`;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- add column "ip" to table: "events"
+ALTER TABLE `events` ADD COLUMN `ip` text NOT NULL DEFAULT '';
+-- add column "user_agent" to table: "events"
+ALTER TABLE `events` ADD COLUMN `user_agent` text NOT NULL DEFAULT '';
+-- add column "target" to table: "events"
+ALTER TABLE `events` ADD COLUMN `target` text NOT NULL DEFAULT '';
+-- add column "diff" to table: "events"
+ALTER TABLE `events` ADD COLUMN `diff` json NOT NULL DEFAULT '{}';
+-- create index "events_action_idx" to table: "events"
+CREATE INDEX `events_action_idx` ON `events` (`action`);
+
+-- +goose Down
+-- reverse: create index "events_action_idx" to table: "events"
+DROP INDEX `events_action_idx`;
+-- reverse: add column "diff" to table: "events"
+ALTER TABLE `events` DROP COLUMN `diff`;
+-- reverse: add column "target" to table: "events"
+ALTER TABLE `events` DROP COLUMN `target`;
+-- reverse: add column "user_agent" to table: "events"
+ALTER TABLE `events` DROP COLUMN `user_agent`;
+-- reverse: add column "ip" to table: "events"
+ALTER TABLE `events` DROP COLUMN `ip`;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- create "dahua_guest_links" table
+CREATE TABLE `dahua_guest_links` (`id` integer NOT NULL PRIMARY KEY AUTOINCREMENT, `device_id` integer NOT NULL, `user_id` integer NULL, `name` text NOT NULL, `token_hash` text NOT NULL, `channel` integer NOT NULL, `live` boolean NOT NULL, `start_time` datetime NULL, `end_time` datetime NULL, `max_views` integer NOT NULL DEFAULT 0, `views` integer NOT NULL DEFAULT 0, `last_viewed_at` datetime NULL, `created_at` datetime NOT NULL, `expired_at` datetime NOT NULL, `revoked_at` datetime NULL, CONSTRAINT `0` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON UPDATE CASCADE ON DELETE SET NULL, CONSTRAINT `1` FOREIGN KEY (`device_id`) REFERENCES `dahua_devices` (`id`) ON UPDATE CASCADE ON DELETE CASCADE);
+-- create index "dahua_guest_links_token_hash" to table: "dahua_guest_links"
+CREATE UNIQUE INDEX `dahua_guest_links_token_hash` ON `dahua_guest_links` (`token_hash`);
+-- create "dahua_guest_link_files" table
+CREATE TABLE `dahua_guest_link_files` (`guest_link_id` integer NOT NULL, `file_id` integer NOT NULL, PRIMARY KEY (`guest_link_id`, `file_id`), CONSTRAINT `0` FOREIGN KEY (`file_id`) REFERENCES `dahua_files` (`id`) ON UPDATE CASCADE ON DELETE CASCADE, CONSTRAINT `1` FOREIGN KEY (`guest_link_id`) REFERENCES `dahua_guest_links` (`id`) ON UPDATE CASCADE ON DELETE CASCADE);
+
+-- +goose Down
+-- reverse: create "dahua_guest_link_files" table
+DROP TABLE `dahua_guest_link_files`;
+-- reverse: create index "dahua_guest_links_token_hash" to table: "dahua_guest_links"
+DROP INDEX `dahua_guest_links_token_hash`;
+-- reverse: create "dahua_guest_links" table
+DROP TABLE `dahua_guest_links`;
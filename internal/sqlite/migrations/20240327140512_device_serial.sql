@@ -0,0 +1,11 @@
+-- +goose Up
+-- add column "serial" to table: "dahua_devices"
+ALTER TABLE `dahua_devices` ADD COLUMN `serial` text NULL;
+-- create index "dahua_devices_serial" to table: "dahua_devices"
+CREATE UNIQUE INDEX `dahua_devices_serial` ON `dahua_devices` (`serial`);
+
+-- +goose Down
+-- reverse: create index "dahua_devices_serial" to table: "dahua_devices"
+DROP INDEX `dahua_devices_serial`;
+-- reverse: add column "serial" to table: "dahua_devices"
+ALTER TABLE `dahua_devices` DROP COLUMN `serial`;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- add column "tls_mode" to table: "dahua_devices"
+ALTER TABLE `dahua_devices` ADD COLUMN `tls_mode` text NOT NULL DEFAULT 'verify';
+-- add column "tls_ca" to table: "dahua_devices"
+ALTER TABLE `dahua_devices` ADD COLUMN `tls_ca` text NULL;
+-- add column "tls_fingerprint" to table: "dahua_devices"
+ALTER TABLE `dahua_devices` ADD COLUMN `tls_fingerprint` text NULL;
+
+-- +goose Down
+-- reverse: add column "tls_fingerprint" to table: "dahua_devices"
+ALTER TABLE `dahua_devices` DROP COLUMN `tls_fingerprint`;
+-- reverse: add column "tls_ca" to table: "dahua_devices"
+ALTER TABLE `dahua_devices` DROP COLUMN `tls_ca`;
+-- reverse: add column "tls_mode" to table: "dahua_devices"
+ALTER TABLE `dahua_devices` DROP COLUMN `tls_mode`;
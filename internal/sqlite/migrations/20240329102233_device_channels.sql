@@ -0,0 +1,11 @@
+-- +goose Up
+-- create "dahua_channels" table
+CREATE TABLE `dahua_channels` (`id` integer NOT NULL PRIMARY KEY AUTOINCREMENT, `device_id` integer NOT NULL, `channel` integer NOT NULL, `name` text NOT NULL, `enabled` boolean NOT NULL DEFAULT true, CONSTRAINT `0` FOREIGN KEY (`device_id`) REFERENCES `dahua_devices` (`id`) ON UPDATE CASCADE ON DELETE CASCADE);
+-- create index "dahua_channels_device_id_channel" to table: "dahua_channels"
+CREATE UNIQUE INDEX `dahua_channels_device_id_channel` ON `dahua_channels` (`device_id`, `channel`);
+
+-- +goose Down
+-- reverse: create index "dahua_channels_device_id_channel" to table: "dahua_channels"
+DROP INDEX `dahua_channels_device_id_channel`;
+-- reverse: create "dahua_channels" table
+DROP TABLE `dahua_channels`;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- create "dahua_capabilities" table
+CREATE TABLE `dahua_capabilities` (`device_id` integer NOT NULL, `methods` json NOT NULL, `ptz` boolean NOT NULL, `coaxial` boolean NOT NULL, `audio_input` boolean NOT NULL, `audio_output` boolean NOT NULL, `storage` boolean NOT NULL, `smart_event` boolean NOT NULL, `probed_at` datetime NOT NULL, CONSTRAINT `0` FOREIGN KEY (`device_id`) REFERENCES `dahua_devices` (`id`) ON UPDATE CASCADE ON DELETE CASCADE);
+-- create index "dahua_capabilities_device_id" to table: "dahua_capabilities"
+CREATE UNIQUE INDEX `dahua_capabilities_device_id` ON `dahua_capabilities` (`device_id`);
+
+-- +goose Down
+-- reverse: create index "dahua_capabilities_device_id" to table: "dahua_capabilities"
+DROP INDEX `dahua_capabilities_device_id`;
+-- reverse: create "dahua_capabilities" table
+DROP TABLE `dahua_capabilities`;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- add column "maintenance" to table: "dahua_events"
+ALTER TABLE `dahua_events` ADD COLUMN `maintenance` boolean NOT NULL DEFAULT false;
+-- create "dahua_maintenance_windows" table
+CREATE TABLE `dahua_maintenance_windows` (`id` integer NOT NULL PRIMARY KEY AUTOINCREMENT, `device_id` integer NULL, `tag` text NULL, `user_id` integer NULL, `reason` text NOT NULL, `start_time` datetime NOT NULL, `end_time` datetime NOT NULL, `created_at` datetime NOT NULL, CONSTRAINT `0` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON UPDATE CASCADE ON DELETE SET NULL, CONSTRAINT `1` FOREIGN KEY (`device_id`) REFERENCES `dahua_devices` (`id`) ON UPDATE CASCADE ON DELETE CASCADE);
+
+-- +goose Down
+-- reverse: create "dahua_maintenance_windows" table
+DROP TABLE `dahua_maintenance_windows`;
+-- reverse: add column "maintenance" to table: "dahua_events"
+ALTER TABLE `dahua_events` DROP COLUMN `maintenance`;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- add column "pre_snapshot_count" to table: "dahua_event_rules"
+ALTER TABLE `dahua_event_rules` ADD COLUMN `pre_snapshot_count` integer NOT NULL DEFAULT 0;
+-- add column "pre_snapshot_count" to table: "dahua_event_device_rules"
+ALTER TABLE `dahua_event_device_rules` ADD COLUMN `pre_snapshot_count` integer NOT NULL DEFAULT 0;
+
+-- +goose Down
+-- reverse: add column "pre_snapshot_count" to table: "dahua_event_device_rules"
+ALTER TABLE `dahua_event_device_rules` DROP COLUMN `pre_snapshot_count`;
+-- reverse: add column "pre_snapshot_count" to table: "dahua_event_rules"
+ALTER TABLE `dahua_event_rules` DROP COLUMN `pre_snapshot_count`;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- create "dahua_channel_capabilities" table
+CREATE TABLE `dahua_channel_capabilities` (`device_id` integer NOT NULL, `channel` integer NOT NULL, `coaxial` boolean NOT NULL, CONSTRAINT `0` FOREIGN KEY (`device_id`) REFERENCES `dahua_devices` (`id`) ON UPDATE CASCADE ON DELETE CASCADE);
+-- create index "dahua_channel_capabilities_device_id_channel" to table: "dahua_channel_capabilities"
+CREATE UNIQUE INDEX `dahua_channel_capabilities_device_id_channel` ON `dahua_channel_capabilities` (`device_id`, `channel`);
+-- probe capabilities again to store them for each channel
+DELETE FROM `dahua_capabilities`;
+
+-- +goose Down
+-- reverse: create index "dahua_channel_capabilities_device_id_channel" to table: "dahua_channel_capabilities"
+DROP INDEX `dahua_channel_capabilities_device_id_channel`;
+-- reverse: create "dahua_channel_capabilities" table
+DROP TABLE `dahua_channel_capabilities`;
@@ -5,9 +5,15 @@ CREATE TABLE events (
   actor TEXT NOT NULL,
   user_id INTEGER,
   created_at DATETIME NOT NULL,
+  ip TEXT NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  target TEXT NOT NULL DEFAULT '',
+  diff JSON NOT NULL DEFAULT '{}',
   FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE SET NULL
 );
 
+CREATE INDEX events_action_idx ON events (action);
+
 CREATE TABLE squeuel (
   id TEXT PRIMARY KEY,
   task_id TEXT UNIQUE,
@@ -48,6 +54,66 @@ CREATE TABLE user_sessions (
   FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
 );
 
+CREATE TABLE user_tokens (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  name TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  level INTEGER NOT NULL,
+  read_only BOOLEAN NOT NULL,
+  last_ip TEXT NOT NULL DEFAULT '',
+  last_used_at DATETIME,
+  created_at DATETIME NOT NULL,
+  expired_at DATETIME,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE user_totps (
+  user_id INTEGER NOT NULL PRIMARY KEY,
+  secret TEXT NOT NULL,
+  last_step INTEGER NOT NULL DEFAULT 0,
+  created_at DATETIME NOT NULL,
+  enabled_at DATETIME,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE user_recovery_codes (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  code_hash TEXT NOT NULL,
+  used_at DATETIME,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE user_oidc_identities (
+  user_id INTEGER NOT NULL,
+  issuer TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  created_at DATETIME NOT NULL,
+  UNIQUE (issuer, subject),
+  FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE user_password_resets (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  created_at DATETIME NOT NULL,
+  expired_at DATETIME NOT NULL,
+  used_at DATETIME,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE login_lockouts (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  kind TEXT NOT NULL,
+  value TEXT NOT NULL,
+  failures INTEGER NOT NULL,
+  last_failed_at DATETIME NOT NULL,
+  locked_until DATETIME NOT NULL,
+  UNIQUE (kind, value)
+);
+
 CREATE TABLE admins (
   user_id INTEGER NOT NULL,
   created_at DATETIME NOT NULL,
@@ -60,7 +126,8 @@ CREATE TABLE groups (
   description TEXT NOT NULL,
   created_at DATETIME NOT NULL,
   updated_at DATETIME NOT NULL,
-  disabled_at DATETIME
+  disabled_at DATETIME,
+  require_two_factor BOOLEAN NOT NULL DEFAULT false
 );
 
 CREATE TABLE group_users (
@@ -87,7 +154,11 @@ CREATE TABLE dahua_devices (
   email TEXT UNIQUE,
   created_at DATETIME NOT NULL,
   updated_at DATETIME NOT NULL,
-  disabled_at DATETIME
+  disabled_at DATETIME,
+  serial TEXT UNIQUE,
+  tls_mode TEXT NOT NULL DEFAULT 'verify',
+  tls_ca TEXT,
+  tls_fingerprint TEXT
 );
 
 CREATE TABLE dahua_permissions (
@@ -102,6 +173,24 @@ CREATE TABLE dahua_permissions (
   FOREIGN KEY (device_id) REFERENCES dahua_devices (id) ON UPDATE CASCADE ON DELETE CASCADE
 );
 
+CREATE TABLE dahua_device_tags (
+  device_id INTEGER NOT NULL,
+  tag TEXT NOT NULL,
+  UNIQUE (device_id, tag),
+  FOREIGN KEY (device_id) REFERENCES dahua_devices (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE dahua_tag_permissions (
+  user_id INTEGER,
+  group_id INTEGER,
+  tag TEXT NOT NULL,
+  level INTEGER NOT NULL,
+  UNIQUE (user_id, tag),
+  UNIQUE (group_id, tag),
+  FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  FOREIGN KEY (group_id) REFERENCES groups (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
 CREATE TABLE dahua_seeds (
   seed INTEGER NOT NULL PRIMARY KEY,
   device_id INTEGER UNIQUE,
@@ -116,6 +205,7 @@ CREATE TABLE dahua_events (
   `index` INTEGER NOT NULL,
   data JSON NOT NULL,
   created_at DATETIME NOT NULL,
+  maintenance BOOLEAN NOT NULL DEFAULT false,
   FOREIGN KEY (device_id) REFERENCES dahua_devices (id) ON UPDATE CASCADE ON DELETE CASCADE
 );
 
@@ -124,7 +214,9 @@ CREATE TABLE dahua_event_rules (
   code TEXT NOT NULL UNIQUE,
   ignore_db BOOLEAN NOT NULL DEFAULT false,
   ignore_live BOOLEAN NOT NULL DEFAULT false,
-  ignore_mqtt BOOLEAN NOT NULL DEFAULT false
+  ignore_mqtt BOOLEAN NOT NULL DEFAULT false,
+  snapshot_count INTEGER NOT NULL DEFAULT 0,
+  pre_snapshot_count INTEGER NOT NULL DEFAULT 0
 );
 
 -- TODO: remove this if I decide not to add per device event rules
@@ -134,6 +226,8 @@ CREATE TABLE dahua_event_device_rules (
   ignore_db BOOLEAN NOT NULL DEFAULT false,
   ignore_live BOOLEAN NOT NULL DEFAULT false,
   ignore_mqtt BOOLEAN NOT NULL DEFAULT false,
+  snapshot_count INTEGER NOT NULL DEFAULT 0,
+  pre_snapshot_count INTEGER NOT NULL DEFAULT 0,
   UNIQUE (device_id, code),
   FOREIGN KEY (device_id) REFERENCES dahua_devices (id) ON UPDATE CASCADE ON DELETE CASCADE
 );
@@ -154,6 +248,9 @@ CREATE TABLE dahua_afero_files (
   file_id INTEGER UNIQUE,
   thumbnail_id INTEGER UNIQUE,
   email_attachment_id INTEGER UNIQUE,
+  snapshot_id INTEGER UNIQUE,
+  timelapse_id INTEGER UNIQUE,
+  export_id INTEGER UNIQUE,
   name TEXT NOT NULL UNIQUE,
   --
   ready BOOLEAN NOT NULL DEFAULT false,
@@ -162,7 +259,10 @@ CREATE TABLE dahua_afero_files (
   --
   FOREIGN KEY (file_id) REFERENCES dahua_files (id) ON UPDATE CASCADE ON DELETE SET NULL,
   FOREIGN KEY (thumbnail_id) REFERENCES dahua_thumbnails (id) ON UPDATE CASCADE ON DELETE SET NULL,
-  FOREIGN KEY (email_attachment_id) REFERENCES dahua_email_attachments (id) ON UPDATE CASCADE ON DELETE SET NULL
+  FOREIGN KEY (email_attachment_id) REFERENCES dahua_email_attachments (id) ON UPDATE CASCADE ON DELETE SET NULL,
+  FOREIGN KEY (snapshot_id) REFERENCES dahua_snapshots (id) ON UPDATE CASCADE ON DELETE SET NULL,
+  FOREIGN KEY (timelapse_id) REFERENCES dahua_timelapses (id) ON UPDATE CASCADE ON DELETE SET NULL,
+  FOREIGN KEY (export_id) REFERENCES dahua_exports (id) ON UPDATE CASCADE ON DELETE SET NULL
 );
 
 CREATE TABLE dahua_files (
@@ -200,12 +300,15 @@ CREATE TABLE dahua_thumbnails (
   id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
   file_id INTEGER,
   email_attachment_id INTEGER,
+  snapshot_id INTEGER,
   width INTEGER NOT NULL,
   height INTEGER NOT NULL,
   UNIQUE (file_id, width, height),
   UNIQUE (email_attachment_id, width, height),
+  UNIQUE (snapshot_id, width, height),
   FOREIGN KEY (file_id) REFERENCES dahua_files (id) ON UPDATE CASCADE ON DELETE CASCADE,
-  FOREIGN KEY (email_attachment_id) REFERENCES dahua_email_attachments (id) ON UPDATE CASCADE ON DELETE CASCADE
+  FOREIGN KEY (email_attachment_id) REFERENCES dahua_email_attachments (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  FOREIGN KEY (snapshot_id) REFERENCES dahua_snapshots (id) ON UPDATE CASCADE ON DELETE CASCADE
 );
 
 CREATE TABLE dahua_file_cursors (
@@ -231,6 +334,37 @@ CREATE TABLE dahua_storage_destinations (
   remote_directory TEXT NOT NULL
 );
 
+CREATE TABLE dahua_channels (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  device_id INTEGER NOT NULL,
+  channel INTEGER NOT NULL,
+  name TEXT NOT NULL,
+  enabled BOOLEAN NOT NULL DEFAULT true,
+  UNIQUE (device_id, channel),
+  FOREIGN KEY (device_id) REFERENCES dahua_devices (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE dahua_capabilities (
+  device_id INTEGER NOT NULL UNIQUE,
+  methods JSON NOT NULL,
+  ptz BOOLEAN NOT NULL,
+  coaxial BOOLEAN NOT NULL,
+  audio_input BOOLEAN NOT NULL,
+  audio_output BOOLEAN NOT NULL,
+  storage BOOLEAN NOT NULL,
+  smart_event BOOLEAN NOT NULL,
+  probed_at DATETIME NOT NULL,
+  FOREIGN KEY (device_id) REFERENCES dahua_devices (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE dahua_channel_capabilities (
+  device_id INTEGER NOT NULL,
+  channel INTEGER NOT NULL,
+  coaxial BOOLEAN NOT NULL,
+  UNIQUE (device_id, channel),
+  FOREIGN KEY (device_id) REFERENCES dahua_devices (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
 CREATE TABLE dahua_streams (
   id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
   internal BOOLEAN NOT NULL,
@@ -266,3 +400,93 @@ CREATE TABLE dahua_email_attachments (
   file_name TEXT NOT NULL,
   FOREIGN KEY (message_id) REFERENCES dahua_email_messages (id) ON UPDATE CASCADE ON DELETE CASCADE
 );
+
+CREATE TABLE dahua_snapshot_schedules (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  device_id INTEGER NOT NULL,
+  channel INTEGER NOT NULL,
+  interval INTEGER NOT NULL, -- seconds
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL,
+  disabled_at DATETIME,
+  UNIQUE (device_id, channel),
+  FOREIGN KEY (device_id) REFERENCES dahua_devices (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE dahua_snapshots (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  device_id INTEGER NOT NULL,
+  channel INTEGER NOT NULL,
+  event_id INTEGER,
+  created_at DATETIME NOT NULL,
+  FOREIGN KEY (device_id) REFERENCES dahua_devices (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  FOREIGN KEY (event_id) REFERENCES dahua_events (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX dahua_snapshots_event_id_idx ON dahua_snapshots (event_id);
+
+CREATE INDEX dahua_snapshots_device_id_channel_created_at_idx ON dahua_snapshots (device_id, channel, created_at);
+
+CREATE TABLE dahua_timelapses (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  device_id INTEGER NOT NULL,
+  channel INTEGER NOT NULL,
+  start_time DATETIME NOT NULL,
+  end_time DATETIME NOT NULL,
+  frame_count INTEGER NOT NULL,
+  created_at DATETIME NOT NULL,
+  FOREIGN KEY (device_id) REFERENCES dahua_devices (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE dahua_exports (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  device_id INTEGER NOT NULL,
+  channel INTEGER NOT NULL,
+  start_time DATETIME NOT NULL,
+  end_time DATETIME NOT NULL,
+  error TEXT NOT NULL DEFAULT '',
+  created_at DATETIME NOT NULL,
+  completed_at DATETIME,
+  FOREIGN KEY (device_id) REFERENCES dahua_devices (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE dahua_guest_links (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  device_id INTEGER NOT NULL,
+  user_id INTEGER,
+  name TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  channel INTEGER NOT NULL,
+  live BOOLEAN NOT NULL,
+  start_time DATETIME,
+  end_time DATETIME,
+  max_views INTEGER NOT NULL DEFAULT 0,
+  views INTEGER NOT NULL DEFAULT 0,
+  last_viewed_at DATETIME,
+  created_at DATETIME NOT NULL,
+  expired_at DATETIME NOT NULL,
+  revoked_at DATETIME,
+  FOREIGN KEY (device_id) REFERENCES dahua_devices (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE TABLE dahua_guest_link_files (
+  guest_link_id INTEGER NOT NULL,
+  file_id INTEGER NOT NULL,
+  PRIMARY KEY (guest_link_id, file_id),
+  FOREIGN KEY (guest_link_id) REFERENCES dahua_guest_links (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  FOREIGN KEY (file_id) REFERENCES dahua_files (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE dahua_maintenance_windows (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  device_id INTEGER,
+  tag TEXT,
+  user_id INTEGER,
+  reason TEXT NOT NULL,
+  start_time DATETIME NOT NULL,
+  end_time DATETIME NOT NULL,
+  created_at DATETIME NOT NULL,
+  FOREIGN KEY (device_id) REFERENCES dahua_devices (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE SET NULL
+);
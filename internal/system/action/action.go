@@ -1,10 +1,150 @@
 package action
 
-import "github.com/ItsNotGoodName/ipcmanview/internal/system"
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/system"
+)
 
 var (
-	DahuaDeviceCreated = system.NewEventBuilder[int64]("dahua-device:created")
-	DahuaDeviceUpdated = system.NewEventBuilder[int64]("dahua-device:updated")
-	DahuaDeviceDeleted = system.NewEventBuilder[int64]("dahua-device:deleted")
-	DahuaEmailCreated  = system.NewEventBuilder[int64]("dahua-email:created")
+	DahuaDeviceCreated        = system.NewEventBuilder[int64]("dahua-device:created")
+	DahuaDeviceUpdated        = system.NewEventBuilder[int64]("dahua-device:updated")
+	DahuaDeviceDeleted        = system.NewEventBuilder[int64]("dahua-device:deleted")
+	DahuaDevicePTZ            = system.NewEventBuilder[DahuaPTZ]("dahua-device:ptz")
+	DahuaDeviceRPC            = system.NewEventBuilder[DahuaRPC]("dahua-device:rpc")
+	DahuaDeviceAccount        = system.NewEventBuilder[DahuaAccount]("dahua-device:account")
+	DahuaChannelUpdated       = system.NewEventBuilder[DahuaChannel]("dahua-channel:updated")
+	DahuaEmailCreated         = system.NewEventBuilder[int64]("dahua-email:created")
+	DahuaGuestLinkCreated     = system.NewEventBuilder[int64]("dahua-guest-link:created")
+	DahuaGuestLinkRevoked     = system.NewEventBuilder[int64]("dahua-guest-link:revoked")
+	DahuaGuestLinkAccessed    = system.NewEventBuilder[DahuaGuestAccess]("dahua-guest-link:accessed")
+	DahuaMaintenanceCreated   = system.NewEventBuilder[int64]("dahua-maintenance:created")
+	DahuaMaintenanceDeleted   = system.NewEventBuilder[int64]("dahua-maintenance:deleted")
+	DahuaPermissionUpdated    = system.NewEventBuilder[int64]("dahua-permission:updated")
+	DahuaTagPermissionUpdated = system.NewEventBuilder[string]("dahua-tag-permission:updated")
+	AuthLoginFailed           = system.NewEventBuilder[LoginFailed]("auth:login-failed")
+	UserCreated               = system.NewEventBuilder[int64]("user:created")
+	UserUpdated               = system.NewEventBuilder[int64]("user:updated")
+	UserDeleted               = system.NewEventBuilder[int64]("user:deleted")
+	UserPasswordUpdated       = system.NewEventBuilder[int64]("user:password-updated")
+	UserSessionDeleted        = system.NewEventBuilder[UserSession]("user:session-deleted")
+	GroupCreated              = system.NewEventBuilder[int64]("group:created")
+	GroupUpdated              = system.NewEventBuilder[int64]("group:updated")
+	GroupDeleted              = system.NewEventBuilder[int64]("group:deleted")
 )
+
+type LoginFailed struct {
+	UserID          int64  `json:"user_id,omitempty"`
+	UsernameOrEmail string `json:"username_or_email"`
+	IP              string `json:"ip"`
+}
+
+type DahuaPTZ struct {
+	DeviceID int64  `json:"device_id"`
+	Channel  int    `json:"channel"`
+	Code     string `json:"code"`
+	Arg1     int    `json:"arg1"`
+}
+
+func (v DahuaPTZ) EventTarget() string {
+	return strconv.FormatInt(v.DeviceID, 10)
+}
+
+type DahuaRPC struct {
+	DeviceID int64           `json:"device_id"`
+	Method   string          `json:"method"`
+	Params   json.RawMessage `json:"params,omitempty"`
+	Object   int64           `json:"object,omitempty"`
+	// Denied is true when the RPC policy blocked the request.
+	Denied   bool            `json:"denied,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+func (v DahuaRPC) EventTarget() string {
+	return strconv.FormatInt(v.DeviceID, 10)
+}
+
+// DahuaAccount is a change to a user account on the device.
+type DahuaAccount struct {
+	DeviceID  int64  `json:"device_id"`
+	Operation string `json:"operation"`
+	Name      string `json:"name"`
+	NewName   string `json:"new_name,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (v DahuaAccount) EventTarget() string {
+	return strconv.FormatInt(v.DeviceID, 10)
+}
+
+type DahuaChannel struct {
+	DeviceID int64 `json:"device_id"`
+	Channel  int   `json:"channel"`
+}
+
+func (v DahuaChannel) EventTarget() string {
+	return strconv.FormatInt(v.DeviceID, 10)
+}
+
+type DahuaChannelState struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+type DahuaGuestAccess struct {
+	LinkID   int64  `json:"link_id"`
+	DeviceID int64  `json:"device_id"`
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	// Denied is true when the request was outside of what the link shares.
+	Denied bool `json:"denied,omitempty"`
+}
+
+func (v DahuaGuestAccess) EventTarget() string {
+	return strconv.FormatInt(v.LinkID, 10)
+}
+
+type UserSession struct {
+	UserID int64 `json:"user_id"`
+	// SessionID is 0 when every other session of the user was deleted.
+	SessionID int64 `json:"session_id,omitempty"`
+}
+
+func (v UserSession) EventTarget() string {
+	return strconv.FormatInt(v.UserID, 10)
+}
+
+// User is the state of a user recorded in diffs.
+type User struct {
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Admin    bool   `json:"admin"`
+	Disabled bool   `json:"disabled"`
+}
+
+// Group is the state of a group recorded in diffs.
+type Group struct {
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	Disabled         bool   `json:"disabled"`
+	RequireTwoFactor bool   `json:"require_two_factor"`
+}
+
+// DahuaDevice is the state of a device recorded in diffs.
+type DahuaDevice struct {
+	Name           string   `json:"name"`
+	URL            string   `json:"url"`
+	IP             string   `json:"ip"`
+	Username       string   `json:"username"`
+	Password       string   `json:"password"`
+	Location       string   `json:"location"`
+	Features       []string `json:"features"`
+	Email          string   `json:"email"`
+	Disabled       bool     `json:"disabled"`
+	Tags           []string `json:"tags"`
+	TLSMode        string   `json:"tls_mode"`
+	TLSCA          string   `json:"tls_ca"`
+	TLSFingerprint string   `json:"tls_fingerprint"`
+}
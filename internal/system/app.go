@@ -1,8 +1,11 @@
 package system
 
+import "github.com/ItsNotGoodName/ipcmanview/internal/sqlite"
+
 var app App
 
 type App struct {
+	DB sqlite.DB
 	CP ConfigProvider
 }
 
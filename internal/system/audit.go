@@ -0,0 +1,184 @@
+package system
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+	"github.com/ItsNotGoodName/ipcmanview/internal/repo"
+	"github.com/ItsNotGoodName/ipcmanview/internal/types"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/pagination"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/ssq"
+	sq "github.com/Masterminds/squirrel"
+)
+
+type EventFilter struct {
+	FilterActions []string
+	FilterUserIDs []int64
+	FilterTarget  string
+	// FilterStart and FilterEnd are ignored when they are zero.
+	FilterStart time.Time
+	FilterEnd   time.Time
+}
+
+func (arg EventFilter) where() sq.And {
+	where := sq.And{}
+	if len(arg.FilterActions) != 0 {
+		where = append(where, sq.Eq{"events.action": arg.FilterActions})
+	}
+	if len(arg.FilterUserIDs) != 0 {
+		where = append(where, sq.Eq{"events.user_id": arg.FilterUserIDs})
+	}
+	if arg.FilterTarget != "" {
+		where = append(where, sq.Eq{"events.target": arg.FilterTarget})
+	}
+	if !arg.FilterStart.IsZero() {
+		where = append(where, sq.GtOrEq{"events.created_at": types.NewTime(arg.FilterStart)})
+	}
+	if !arg.FilterEnd.IsZero() {
+		where = append(where, sq.Lt{"events.created_at": types.NewTime(arg.FilterEnd)})
+	}
+	return where
+}
+
+type ListEventsParams struct {
+	pagination.Page
+	Ascending bool
+	EventFilter
+}
+
+type ListEventsResult struct {
+	pagination.PageResult
+	Items []ListEventsResultItem
+}
+
+type ListEventsResultItem struct {
+	repo.Event
+	Username string
+}
+
+func eventsSelect(arg EventFilter, ascending bool) sq.SelectBuilder {
+	order := "events.id"
+	if ascending {
+		order += " ASC"
+	} else {
+		order += " DESC"
+	}
+
+	return sq.
+		Select(
+			"events.*",
+			"COALESCE(users.username, '') AS username",
+		).
+		From("events").
+		LeftJoin("users ON users.id = events.user_id").
+		Where(arg.where()).
+		OrderBy(order)
+}
+
+// ListEvents returns the audit log.
+func ListEvents(ctx context.Context, arg ListEventsParams) (ListEventsResult, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return ListEventsResult{}, err
+	}
+
+	sb := eventsSelect(arg.EventFilter, arg.Ascending).
+		Offset(uint64(arg.Offset())).
+		Limit(uint64(arg.Limit()))
+
+	var items []ListEventsResultItem
+	if err := ssq.Query(ctx, app.DB, &items, sb); err != nil {
+		return ListEventsResult{}, err
+	}
+
+	sb = sq.
+		Select("COUNT(*) AS count").
+		From("events").
+		Where(arg.where())
+
+	var res struct{ Count int64 }
+	if err := ssq.QueryOne(ctx, app.DB, &res, sb); err != nil {
+		return ListEventsResult{}, err
+	}
+
+	return ListEventsResult{
+		PageResult: arg.Result(int(res.Count)),
+		Items:      items,
+	}, nil
+}
+
+// ListEventActions returns the actions that are in the audit log.
+func ListEventActions(ctx context.Context) ([]string, error) {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	return app.DB.C().ListEventActions(ctx)
+}
+
+// WriteEventsCSV writes every event in the audit log that matches the filter as CSV.
+func WriteEventsCSV(ctx context.Context, w io.Writer, arg EventFilter) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	rows, scanner, err := ssq.QueryRows(ctx, app.DB, eventsSelect(arg, true))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"id", "created_at", "action", "actor", "user_id", "username", "ip", "user_agent", "target", "data", "diff"}); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var row ListEventsResultItem
+		if err := scanner.Scan(&row); err != nil {
+			return err
+		}
+
+		var userID string
+		if row.UserID.Valid {
+			userID = strconv.FormatInt(row.UserID.Int64, 10)
+		}
+
+		if err := cw.Write(csvRecord(
+			strconv.FormatInt(row.ID, 10),
+			row.CreatedAt.Format(time.RFC3339),
+			row.Action,
+			string(row.Actor),
+			userID,
+			row.Username,
+			row.Ip,
+			row.UserAgent,
+			row.Target,
+			string(row.Data.RawMessage),
+			string(row.Diff.RawMessage),
+		)); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvRecord prefixes cells that spreadsheets would run as formulas with a single quote.
+// Usernames, user agents, and targets come from users so they can't be trusted.
+func csvRecord(cells ...string) []string {
+	for i, cell := range cells {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			cells[i] = "'" + cell
+		}
+	}
+	return cells
+}
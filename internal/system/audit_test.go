@@ -0,0 +1,14 @@
+package system
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVRecord(t *testing.T) {
+	assert.Equal(t,
+		[]string{"1", "'=HYPERLINK(\"http://example.com\")", "'+1", "'-1", "'@SUM(A1)", "'\tcell", "", "admin", "{}"},
+		csvRecord("1", "=HYPERLINK(\"http://example.com\")", "+1", "-1", "@SUM(A1)", "\tcell", "", "admin", "{}"),
+	)
+}
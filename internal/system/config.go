@@ -16,6 +16,48 @@ type Config struct {
 	Location     types.Location
 	Coordinates  models.Coordinate
 	EnableSignUp bool
+	// RequireTwoFactorForAdmins forces admins to enable two-factor authentication.
+	RequireTwoFactorForAdmins bool
+	OIDC                      OIDCConfig
+	RPC                       RPCConfig
+}
+
+// OIDCConfig configures OpenID Connect single sign-on.
+type OIDCConfig struct {
+	Enable       bool
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL must point to /v1/oidc/callback on this server.
+	RedirectURL string
+	Scopes      []string
+	// GroupsClaim is the claim containing group names that are mapped onto existing groups.
+	// Group membership is not synced when it is empty.
+	GroupsClaim          string
+	DisablePasswordLogin bool
+	// TrustProviderTwoFactor skips asking users with two-factor authentication for a code because the provider already does.
+	TrustProviderTwoFactor bool
+}
+
+func (c OIDCConfig) PasswordLoginDisabled() bool {
+	return c.Enable && c.DisablePasswordLogin
+}
+
+// RPCConfig restricts the raw RPC passthrough to devices.
+// Methods are matched case-insensitively with glob patterns (e.g. "magicBox.get*").
+type RPCConfig struct {
+	// User, Operator, and Admin are the methods allowed for each device permission level.
+	// Each level is also allowed the methods of the levels below it.
+	// Admin allows every method when it is not set.
+	User     []string
+	Operator []string
+	Admin    []string
+	// ReadOnly blocks methods in WriteMethods for everyone.
+	ReadOnly bool
+	// WriteMethods are the methods that make changes.
+	// Defaults to "*.set*", "*.modify*", "*.delete*", "magicBox.reboot", "magicBox.shutdown", "magicBox.resetSystem",
+	// and "configManager.restore*" when it is not set.
+	WriteMethods []string
 }
 
 var defaultConfig = Config{
@@ -4,6 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ItsNotGoodName/ipcmanview/internal/core"
@@ -24,25 +27,180 @@ type EventBuilder[T any] struct {
 	data   T
 }
 
+// EventTarget is implemented by event data that is not an ID.
+type EventTarget interface {
+	EventTarget() string
+}
+
 func (e EventBuilder[T]) Create(data T) Event {
 	b, err := json.Marshal(data)
 	if err != nil {
 		log.Err(err).Msg("This should not have happend")
 	}
 
+	var target string
+	switch data := any(data).(type) {
+	case int64:
+		target = strconv.FormatInt(data, 10)
+	case string:
+		target = data
+	case EventTarget:
+		target = data.EventTarget()
+	}
+
 	return Event{
 		Action: e.action,
 		Data:   b,
+		Target: target,
 	}
 }
 
 type Event struct {
 	Action string
 	Data   []byte
+	// Target is the ID of the resource the action was done on.
+	Target string
+	// Diff contains the fields that changed.
+	Diff []byte
+}
+
+// WithDiff sets the diff between the before and after state of the target.
+// Either state can be nil when the target was created or deleted.
+func (e Event) WithDiff(before, after any) Event {
+	b, err := json.Marshal(NewDiff(before, after))
+	if err != nil {
+		log.Err(err).Msg("This should not have happend")
+	}
+	e.Diff = b
+	return e
+}
+
+// DiffRedacted replaces values of sensitive fields in a diff.
+const DiffRedacted = "[redacted]"
+
+// DiffChange is the before and after value of a field.
+type DiffChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// NewDiff returns the fields that changed between the JSON representations of before and after.
+// Nested objects are diffed recursively and values of fields that look like secrets are redacted.
+func NewDiff(before, after any) map[string]any {
+	return diffMaps(toDiffMap(before), toDiffMap(after))
+}
+
+func toDiffMap(v any) map[string]any {
+	if v == nil {
+		return map[string]any{}
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return map[string]any{}
+	}
+
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil || m == nil {
+		return map[string]any{}
+	}
+
+	return m
+}
+
+func diffMaps(before, after map[string]any) map[string]any {
+	keys := make(map[string]struct{}, len(after))
+	for key := range before {
+		keys[key] = struct{}{}
+	}
+	for key := range after {
+		keys[key] = struct{}{}
+	}
+
+	diff := make(map[string]any)
+	for key := range keys {
+		b, a := before[key], after[key]
+		if reflect.DeepEqual(b, a) {
+			continue
+		}
+
+		if diffSensitive(key) {
+			diff[key] = DiffChange{Before: DiffRedacted, After: DiffRedacted}
+			continue
+		}
+
+		bm, bok := b.(map[string]any)
+		am, aok := a.(map[string]any)
+		if bok || aok {
+			if bm == nil {
+				bm = map[string]any{}
+			}
+			if am == nil {
+				am = map[string]any{}
+			}
+			diff[key] = diffMaps(bm, am)
+			continue
+		}
+
+		diff[key] = DiffChange{Before: b, After: a}
+	}
+
+	return diff
+}
+
+// diffSensitive returns true if the field looks like a secret.
+// Devices call passwords "pwd" (e.g. userManager.modifyPassword).
+func diffSensitive(key string) bool {
+	key = strings.ToLower(key)
+	return strings.Contains(key, "password") || strings.Contains(key, "pwd") || strings.Contains(key, "secret") || strings.Contains(key, "token")
+}
+
+// RedactJSON replaces values of fields that look like secrets in the JSON with DiffRedacted, the same fields that are redacted in diffs.
+// Invalid JSON is replaced entirely.
+func RedactJSON(b json.RawMessage) json.RawMessage {
+	if len(b) == 0 {
+		return b
+	}
+
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		redacted, _ := json.Marshal(DiffRedacted)
+		return redacted
+	}
+
+	redacted, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if diffSensitive(key) {
+				v[key] = DiffRedacted
+			} else {
+				v[key] = redactValue(value)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+	return v
 }
 
 func CreateEvent(ctx context.Context, db sqlite.DBTx, event Event) error {
 	actor := core.UseActor(ctx)
+	info := core.UseRequestInfo(ctx)
+
+	diff := event.Diff
+	if len(diff) == 0 {
+		diff = []byte("{}")
+	}
 
 	_, err := db.CreateEvent(ctx, repo.CreateEventParams{
 		Action: event.Action,
@@ -53,6 +211,10 @@ func CreateEvent(ctx context.Context, db sqlite.DBTx, event Event) error {
 		},
 		Actor:     actor.Type,
 		CreatedAt: types.NewTime(time.Now()),
+		Ip:        info.IP,
+		UserAgent: info.UserAgent,
+		Target:    event.Target,
+		Diff:      types.NewJSON(diff),
 	})
 	return err
 }
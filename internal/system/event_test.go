@@ -0,0 +1,101 @@
+package system
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDiff(t *testing.T) {
+	type nested struct {
+		ClientSecret string
+		Enable       bool
+	}
+	type state struct {
+		Name     string
+		Password string
+		Tags     []string
+		Nested   nested
+	}
+
+	tests := []struct {
+		name   string
+		before any
+		after  any
+		want   map[string]any
+	}{
+		{
+			name:   "unchanged",
+			before: state{Name: "a", Tags: []string{"x"}},
+			after:  state{Name: "a", Tags: []string{"x"}},
+			want:   map[string]any{},
+		},
+		{
+			name:   "changed",
+			before: state{Name: "a", Password: "1", Nested: nested{ClientSecret: "1"}},
+			after:  state{Name: "b", Password: "2", Nested: nested{ClientSecret: "2", Enable: true}},
+			want: map[string]any{
+				"Name":     DiffChange{Before: "a", After: "b"},
+				"Password": DiffChange{Before: DiffRedacted, After: DiffRedacted},
+				"Nested": map[string]any{
+					"ClientSecret": DiffChange{Before: DiffRedacted, After: DiffRedacted},
+					"Enable":       DiffChange{Before: false, After: true},
+				},
+			},
+		},
+		{
+			name:   "created",
+			before: nil,
+			after:  map[string]any{"name": "a"},
+			want: map[string]any{
+				"name": DiffChange{Before: nil, After: "a"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewDiff(tt.before, tt.after)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "nested",
+			in:   `{"name":"admin","pwd":"1","pwdOld":"2","info":{"Password":"3","Enable":true}}`,
+			want: `{"info":{"Enable":true,"Password":"[redacted]"},"name":"admin","pwd":"[redacted]","pwdOld":"[redacted]"}`,
+		},
+		{
+			name: "multicall",
+			in:   `[{"method":"userManager.modifyPassword","params":{"name":"admin","pwd":"1"}}]`,
+			want: `[{"method":"userManager.modifyPassword","params":{"name":"admin","pwd":"[redacted]"}}]`,
+		},
+		{
+			name: "object",
+			in:   `{"table":{"ClientSecret":{"a":1},"Token":["a"]}}`,
+			want: `{"table":{"ClientSecret":"[redacted]","Token":"[redacted]"}}`,
+		},
+		{
+			name: "invalid",
+			in:   `{"pwd":`,
+			want: `"[redacted]"`,
+		},
+		{
+			name: "empty",
+			in:   ``,
+			want: ``,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(RedactJSON(json.RawMessage(tt.in))))
+		})
+	}
+}
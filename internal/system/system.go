@@ -1,19 +1,42 @@
 package system
 
+import (
+	"context"
+
+	"github.com/ItsNotGoodName/ipcmanview/internal/core"
+)
+
+var configUpdated = NewEventBuilder[struct{}]("config:updated")
+
 func GetConfig() (Config, error) {
 	return app.CP.GetConfig()
 }
 
 type UpdateConfigParams struct {
-	SiteName     string
-	EnableSignUp bool
+	SiteName                  string
+	EnableSignUp              bool
+	RequireTwoFactorForAdmins bool
 }
 
-func UpdateConfig(arg UpdateConfigParams) error {
-	return app.CP.UpdateConfig(func(cfg Config) (Config, error) {
+func UpdateConfig(ctx context.Context, arg UpdateConfigParams) error {
+	if _, err := core.AssertAdmin(ctx); err != nil {
+		return err
+	}
+
+	var before, after Config
+	err := app.CP.UpdateConfig(func(cfg Config) (Config, error) {
+		before = cfg
+
 		cfg.SiteName = arg.SiteName
 		cfg.EnableSignUp = arg.EnableSignUp
+		cfg.RequireTwoFactorForAdmins = arg.RequireTwoFactorForAdmins
 
+		after = cfg
 		return cfg, nil
 	})
+	if err != nil {
+		return err
+	}
+
+	return CreateEvent(ctx, app.DB.C(), configUpdated.Create(struct{}{}).WithDiff(before, after))
 }
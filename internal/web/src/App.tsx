@@ -11,7 +11,7 @@ import { lastSession } from "~/providers/session";
 import { Root } from "~/Root";
 import loadRoot from "~/Root.data";
 import { NotFound } from '~/pages/404'
-import { SignIn, SignUp, Forgot } from "~/pages/Public";
+import { SignIn, SignUp, Forgot, Reset } from "~/pages/Public";
 
 const Debug = lazy(() => import("./pages/debug"));
 const Home = lazy(() => import("~/pages/Home"));
@@ -72,29 +72,35 @@ function App() {
           <Route path="/signup" component={SignUp} />
         </Show>
         <Route path="/forgot" component={Forgot} />
+        <Route path="/reset" component={Reset} />
         <Route path="*404" component={SignIn} />
       </>}>
-        <Route path="/" component={Home} load={loadHome} />
-        <Route path="/profile" component={Profile} load={loadProfile} />
-        <Route path="/live" component={Live} />
-        <Route path="/devices" component={Devices} load={loadDevices} />
-        <Route path="/emails" component={Emails} load={loadEmails} />
-        <Route path="/emails/:id" component={EmailsID} load={loadEmailsID} />
-        <Route path="/events" component={Events} load={loadEvents} />
-        <Route path="/events/live" component={EventsLive} load={loadEventsLive} />
-        <Route path="/files" component={Files} load={loadFiles} />
-        <Show when={isAdmin()} fallback={<Route path="/admin/*" component={NavigateHome} />}>
-          <Route path="/admin" component={AdminHome} load={loadAdminHome} />
-          <Route path="/admin/settings" component={AdminSettings} load={loadAdminSettings} />
-          <Route path="/admin/users" component={AdminUsers} load={loadAdminUsers} />
-          <Route path="/admin/groups" component={AdminGroups} load={loadAdminGroups} />
-          <Route path="/admin/groups/:id" component={AdminGroupsID} load={loadAdminGroupsID} />
-          <Route path="/admin/devices" component={AdminDevices} load={loadAdminDevices} />
-          <Route path="/admin/devices/:id" component={AdminDevicesID} load={loadAdminDevicesID} />
-          <Route path="/admin/events" component={AdminEvents} load={loadAdminEvents} />
+        <Show when={!lastSession.two_factor_required} fallback={<>
+          <Route path="/profile" component={Profile} load={loadProfile} />
+          <Route path="*404" component={() => <Navigate href="/profile" />} />
+        </>}>
+          <Route path="/" component={Home} load={loadHome} />
+          <Route path="/profile" component={Profile} load={loadProfile} />
+          <Route path="/live" component={Live} />
+          <Route path="/devices" component={Devices} load={loadDevices} />
+          <Route path="/emails" component={Emails} load={loadEmails} />
+          <Route path="/emails/:id" component={EmailsID} load={loadEmailsID} />
+          <Route path="/events" component={Events} load={loadEvents} />
+          <Route path="/events/live" component={EventsLive} load={loadEventsLive} />
+          <Route path="/files" component={Files} load={loadFiles} />
+          <Show when={isAdmin()} fallback={<Route path="/admin/*" component={NavigateHome} />}>
+            <Route path="/admin" component={AdminHome} load={loadAdminHome} />
+            <Route path="/admin/settings" component={AdminSettings} load={loadAdminSettings} />
+            <Route path="/admin/users" component={AdminUsers} load={loadAdminUsers} />
+            <Route path="/admin/groups" component={AdminGroups} load={loadAdminGroups} />
+            <Route path="/admin/groups/:id" component={AdminGroupsID} load={loadAdminGroupsID} />
+            <Route path="/admin/devices" component={AdminDevices} load={loadAdminDevices} />
+            <Route path="/admin/devices/:id" component={AdminDevicesID} load={loadAdminDevicesID} />
+            <Route path="/admin/events" component={AdminEvents} load={loadAdminEvents} />
+          </Show>
+          <Route path={["/signin", "/signup", "/forgot", "/reset"]} component={NavigateHome} />
+          <Route path="*404" component={NotFound} />
         </Show>
-        <Route path={["/signin", "/signup", "/forgot"]} component={NavigateHome} />
-        <Route path="*404" component={NotFound} />
       </Show>
     </Router>
   )
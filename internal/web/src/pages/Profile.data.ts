@@ -3,6 +3,9 @@ import { useClient } from "~/providers/client";
 
 export const getProfilePage = cache(() => useClient().user.getProfilePage({}).then((req) => req.response), "getProfilePage")
 
+export const getMyTwoFactor = cache(() => useClient().user.getMyTwoFactor({}).then((req) => req.response), "getMyTwoFactor")
+
 export default function() {
   void getProfilePage()
+  void getMyTwoFactor()
 }
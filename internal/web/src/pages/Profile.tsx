@@ -5,7 +5,7 @@ import { ErrorBoundary, For, ParentProps, Show, Suspense, createSignal, } from "
 import { createForm, required, reset } from "@modular-forms/solid"
 import { formatDate, parseDate, catchAsToast, throwAsFormError, createModal, validationState } from "~/lib/utils"
 import { CardRoot, } from "~/ui/Card"
-import { getProfilePage } from "./Profile.data"
+import { getMyTwoFactor, getProfilePage } from "./Profile.data"
 import { Button } from "~/ui/Button"
 import { TableBody, TableCaption, TableCell, TableHead, TableHeader, TableRoot, TableRow } from "~/ui/Table"
 import { useClient } from "~/providers/client"
@@ -17,7 +17,10 @@ import { PageError } from "~/ui/Page"
 import { LayoutNormal } from "~/ui/Layout"
 import { AlertDialogAction, AlertDialogCancel, AlertDialogModal, AlertDialogFooter, AlertDialogHeader, AlertDialogRoot, AlertDialogTitle } from "~/ui/AlertDialog"
 import { Shared } from "~/components/Shared"
+import { linkVariants } from "~/ui/Link"
 import { TextFieldErrorMessage, TextFieldInput, TextFieldLabel, TextFieldRoot } from "~/ui/TextField"
+import { AlertDescription, AlertRoot, AlertTitle } from "~/ui/Alert"
+import { EnrollMyTwoFactorResp } from "~/twirp/rpc"
 
 function Center(props: ParentProps) {
   return (
@@ -124,6 +127,9 @@ export function Profile() {
         <Shared.Title>Change password</Shared.Title>
         <ChangePasswordForm />
 
+        <Shared.Title>Two-factor authentication</Shared.Title>
+        <TwoFactor />
+
         <Shared.Title>Sessions</Shared.Title>
         <div class="flex flex-col gap-2">
           <div class="flex">
@@ -203,6 +209,159 @@ export function Profile() {
   )
 }
 
+function TwoFactor() {
+  const status = createAsync(() => getMyTwoFactor())
+  const [enrollment, setEnrollment] = createSignal<EnrollMyTwoFactorResp>()
+  const [recoveryCodes, setRecoveryCodes] = createSignal<string[]>([])
+
+  const enroll = () => useClient()
+    .user.enrollMyTwoFactor({})
+    .then((res) => setEnrollment(res.response))
+    .catch(catchAsToast)
+
+  // The session is revalidated after the recovery codes are shown because it can change the routes
+  const done = () => {
+    setRecoveryCodes([])
+    return revalidate(getSession.key)
+  }
+
+  return (
+    <Center>
+      <div class="flex w-full max-w-sm flex-col gap-4">
+        <Suspense fallback={<Skeleton class="h-32" />}>
+          <Show when={recoveryCodes().length == 0} fallback={
+            <>
+              <AlertRoot>
+                <AlertTitle>Recovery codes</AlertTitle>
+                <AlertDescription>
+                  Save these codes somewhere safe. Each code can be used once to sign in without your authenticator app.
+                </AlertDescription>
+              </AlertRoot>
+              <pre class="bg-muted rounded-md p-4 text-center font-mono">{recoveryCodes().join("\n")}</pre>
+              <Button onClick={done}>Done</Button>
+            </>
+          }>
+            <Show when={!status()?.enabled} fallback={
+              <>
+                <div>Enabled with {status()?.recoveryCodesRemaining} recovery codes remaining.</div>
+                <DisableTwoFactorForm />
+              </>
+            }>
+              <Show when={status()?.required}>
+                <AlertRoot variant="destructive">
+                  <AlertTitle>Two-factor authentication required</AlertTitle>
+                  <AlertDescription>
+                    You must enable two-factor authentication before you can continue.
+                  </AlertDescription>
+                </AlertRoot>
+              </Show>
+              <Show when={enrollment()} fallback={<Button onClick={enroll}>Enable two-factor authentication</Button>}>
+                {(enrollment) => (
+                  <>
+                    <div class="flex flex-col gap-2">
+                      <div>Add this account to your authenticator app with the link or the secret, then enter a code to finish.</div>
+                      <a href={enrollment().url} class={linkVariants()}>Open in authenticator app</a>
+                      <code class="bg-muted break-all rounded-md p-2 text-center">{enrollment().secret}</code>
+                    </div>
+                    <VerifyTwoFactorForm onVerify={(codes) => {
+                      setEnrollment(undefined)
+                      setRecoveryCodes(codes)
+                    }} />
+                  </>
+                )}
+              </Show>
+            </Show>
+          </Show>
+        </Suspense>
+      </div>
+    </Center>
+  )
+}
+
+type TwoFactorCodeForm = {
+  code: string
+}
+
+function VerifyTwoFactorForm(props: { onVerify: (recoveryCodes: string[]) => void }) {
+  const [form, { Field, Form }] = createForm<TwoFactorCodeForm>({
+    initialValues: {
+      code: ""
+    }
+  });
+  const submitForm = (input: TwoFactorCodeForm) => useClient()
+    .user.verifyMyTwoFactor(input)
+    .then((res) => {
+      props.onVerify(res.response.recoveryCodes)
+      return revalidate(getMyTwoFactor.key)
+    })
+    .catch(throwAsFormError)
+
+  return (
+    <Form onSubmit={submitForm} class="flex flex-col gap-4">
+      <Field name="code" validate={required("Please enter a code.")}>
+        {(field, props) => (
+          <TextFieldRoot
+            validationState={validationState(field.error)}
+            value={field.value}
+            class="space-y-2"
+          >
+            <TextFieldLabel>Code</TextFieldLabel>
+            <TextFieldInput
+              {...props}
+              autocomplete="one-time-code"
+              placeholder="Code"
+            />
+            <TextFieldErrorMessage>{field.error}</TextFieldErrorMessage>
+          </TextFieldRoot>
+        )}
+      </Field>
+      <Button type="submit" disabled={form.submitting}>
+        <Show when={!form.submitting} fallback="Verifying">Verify</Show>
+      </Button>
+      <FormMessage form={form} />
+    </Form>
+  )
+}
+
+function DisableTwoFactorForm() {
+  const [form, { Field, Form }] = createForm<TwoFactorCodeForm>({
+    initialValues: {
+      code: ""
+    }
+  });
+  const submitForm = (input: TwoFactorCodeForm) => useClient()
+    .user.disableMyTwoFactor(input)
+    .then(() => revalidate([getMyTwoFactor.key, getSession.key]))
+    .then(() => reset(form))
+    .catch(throwAsFormError)
+
+  return (
+    <Form onSubmit={submitForm} class="flex flex-col gap-4">
+      <Field name="code" validate={required("Please enter a code.")}>
+        {(field, props) => (
+          <TextFieldRoot
+            validationState={validationState(field.error)}
+            value={field.value}
+            class="space-y-2"
+          >
+            <TextFieldLabel>Code</TextFieldLabel>
+            <TextFieldInput
+              {...props}
+              autocomplete="one-time-code"
+              placeholder="Authenticator or recovery code"
+            />
+            <TextFieldErrorMessage>{field.error}</TextFieldErrorMessage>
+          </TextFieldRoot>
+        )}
+      </Field>
+      <Button type="submit" variant="destructive" disabled={form.submitting}>
+        <Show when={!form.submitting} fallback="Disabling two-factor authentication">Disable two-factor authentication</Show>
+      </Button>
+      <FormMessage form={form} />
+    </Form>
+  )
+}
+
 type ChangeUsernameForm = {
   newUsername: string
 }
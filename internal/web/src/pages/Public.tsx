@@ -1,8 +1,8 @@
 import { createForm, required, reset } from "@modular-forms/solid";
-import { A, createAsync, revalidate, useNavigate } from "@solidjs/router";
-import { ParentProps, Show, } from "solid-js";
+import { A, createAsync, revalidate, useNavigate, useSearchParams } from "@solidjs/router";
+import { ParentProps, Show, createSignal, } from "solid-js";
 import { useClient } from "~/providers/client";
-import { Button } from "~/ui/Button";
+import { Button, buttonVariants } from "~/ui/Button";
 import { CardRoot } from "~/ui/Card";
 import { FormMessage, } from "~/ui/Form";
 import { linkVariants } from "~/ui/Link";
@@ -67,12 +67,26 @@ type SignInForm = {
   rememberMe: boolean
 }
 
+type SessionPOSTResp = {
+  two_factor: boolean
+  challenge: string
+}
+
 export function SignIn() {
   const navigate = useNavigate()
 
   const config = createAsync(() => getConfig())
   const session = createAsync(() => getSession())
 
+  // OIDC logins that need a code redirect here with the challenge in the fragment
+  const [challenge, setChallenge] = createSignal(new URLSearchParams(window.location.hash.slice(1)).get("challenge") ?? "")
+  if (window.location.hash) {
+    history.replaceState(history.state, "", window.location.pathname)
+  }
+
+  const signedIn = () => revalidate(getSession.key)
+    .then(() => navigate('/', { replace: true }))
+
   const [form, { Field, Form }] = createForm<SignInForm>({
     initialValues: {
       usernameOrEmail: "",
@@ -87,13 +101,18 @@ export function SignIn() {
       method: "POST",
       body: JSON.stringify(input),
     }).then(async (resp) => {
+      const json = await resp.json()
       if (!resp.ok) {
-        const json = await resp.json()
         throw new Error(json.message)
       }
 
-      await revalidate(getSession.key)
-      navigate('/', { replace: true })
+      const data: SessionPOSTResp = json
+      if (data.two_factor) {
+        setChallenge(data.challenge)
+        return
+      }
+
+      await signedIn()
     }).catch(throwAsFormError)
 
   return (
@@ -108,67 +127,81 @@ export function SignIn() {
         </AlertRoot>
       </Show>
       <CardRoot class="flex flex-col gap-4 p-4">
-        <CardHeader>Sign in</CardHeader>
-        <Form onSubmit={submitForm} class="flex flex-col gap-4">
-          <Field name="usernameOrEmail" validate={required("Please enter your username or email.")}>
-            {(field, props) => (
-              <TextFieldRoot
-                validationState={validationState(field.error)}
-                value={field.value}
-                class="space-y-2"
-              >
-                <TextFieldLabel>Username or email</TextFieldLabel>
-                <TextFieldInput
-                  {...props}
-                  placeholder="Username or email"
-                  autocomplete="username"
-                />
-                <TextFieldErrorMessage>{field.error}</TextFieldErrorMessage>
-              </TextFieldRoot>
-            )}
-          </Field>
-          <Field name="password">
-            {(field, props) => (
-              <TextFieldRoot
-                validationState={validationState(field.error)}
-                value={field.value}
-                class="space-y-2"
-              >
-                <div class="flex items-center justify-between gap-2">
-                  <TextFieldLabel>Password</TextFieldLabel>
-                  <A href="/forgot" class={linkVariants()}>Forgot password?</A>
-                </div>
-                <TextFieldInput
-                  {...props}
-                  autocomplete="current-password"
-                  placeholder="Password"
-                  type="password"
-                />
-                <TextFieldErrorMessage>{field.error}</TextFieldErrorMessage>
-              </TextFieldRoot>
-            )}
-          </Field>
-          <Field name="rememberMe" type="boolean">
-            {(field) => (
-              <CheckboxRoot
-                validationState={validationState(field.error)}
-                checked={field.value}
-                onChange={setFormValue(form, field)}
-                class="space-y-2"
-              >
-                <div class="flex items-center gap-2">
-                  <CheckboxControl />
-                  <CheckboxLabel>Remember me</CheckboxLabel>
-                </div>
-                <CheckboxErrorMessage>{field.error}</CheckboxErrorMessage>
-              </CheckboxRoot>
-            )}
-          </Field>
-          <Button type="submit" disabled={form.submitting}>
-            <Show when={!form.submitting} fallback="Signing in">Sign in</Show>
-          </Button>
-          <FormMessage form={form} />
-        </Form>
+        <Show when={!challenge()} fallback={
+          <>
+            <CardHeader>Two-factor authentication</CardHeader>
+            <TwoFactorForm challenge={challenge()} onSuccess={signedIn} onCancel={() => setChallenge("")} />
+          </>
+        }>
+          <CardHeader>Sign in</CardHeader>
+          <Show when={!config()?.disablePasswordLogin}>
+            <Form onSubmit={submitForm} class="flex flex-col gap-4">
+              <Field name="usernameOrEmail" validate={required("Please enter your username or email.")}>
+                {(field, props) => (
+                  <TextFieldRoot
+                    validationState={validationState(field.error)}
+                    value={field.value}
+                    class="space-y-2"
+                  >
+                    <TextFieldLabel>Username or email</TextFieldLabel>
+                    <TextFieldInput
+                      {...props}
+                      placeholder="Username or email"
+                      autocomplete="username"
+                    />
+                    <TextFieldErrorMessage>{field.error}</TextFieldErrorMessage>
+                  </TextFieldRoot>
+                )}
+              </Field>
+              <Field name="password">
+                {(field, props) => (
+                  <TextFieldRoot
+                    validationState={validationState(field.error)}
+                    value={field.value}
+                    class="space-y-2"
+                  >
+                    <div class="flex items-center justify-between gap-2">
+                      <TextFieldLabel>Password</TextFieldLabel>
+                      <A href="/forgot" class={linkVariants()}>Forgot password?</A>
+                    </div>
+                    <TextFieldInput
+                      {...props}
+                      autocomplete="current-password"
+                      placeholder="Password"
+                      type="password"
+                    />
+                    <TextFieldErrorMessage>{field.error}</TextFieldErrorMessage>
+                  </TextFieldRoot>
+                )}
+              </Field>
+              <Field name="rememberMe" type="boolean">
+                {(field) => (
+                  <CheckboxRoot
+                    validationState={validationState(field.error)}
+                    checked={field.value}
+                    onChange={setFormValue(form, field)}
+                    class="space-y-2"
+                  >
+                    <div class="flex items-center gap-2">
+                      <CheckboxControl />
+                      <CheckboxLabel>Remember me</CheckboxLabel>
+                    </div>
+                    <CheckboxErrorMessage>{field.error}</CheckboxErrorMessage>
+                  </CheckboxRoot>
+                )}
+              </Field>
+              <Button type="submit" disabled={form.submitting}>
+                <Show when={!form.submitting} fallback="Signing in">Sign in</Show>
+              </Button>
+              <FormMessage form={form} />
+            </Form>
+          </Show>
+          <Show when={config()?.enableOidc}>
+            <a href="/v1/oidc/login" class={buttonVariants({ variant: config()?.disablePasswordLogin ? "default" : "outline" })}>
+              Sign in with SSO
+            </a>
+          </Show>
+        </Show>
       </CardRoot>
       <Show when={config()?.enableSignUp}>
         <Footer>
@@ -179,6 +212,59 @@ export function SignIn() {
   )
 }
 
+type TwoFactorForm = {
+  code: string
+}
+
+function TwoFactorForm(props: { challenge: string, onSuccess: () => Promise<void>, onCancel: () => void }) {
+  const [form, { Field, Form }] = createForm<TwoFactorForm>({
+    initialValues: {
+      code: "",
+    }
+  });
+  const submitForm = (input: TwoFactorForm) =>
+    fetch("/v1/session/two-factor", {
+      credentials: "include",
+      headers: [['Content-Type', 'application/json'], ['Accept', 'application/json']],
+      method: "POST",
+      body: JSON.stringify({ challenge: props.challenge, code: input.code }),
+    }).then(async (resp) => {
+      if (!resp.ok) {
+        const json = await resp.json()
+        throw new Error(json.message)
+      }
+
+      await props.onSuccess()
+    }).catch(throwAsFormError)
+
+  return (
+    <Form onSubmit={submitForm} class="flex flex-col gap-4">
+      <Field name="code" validate={required("Please enter a code.")}>
+        {(field, props) => (
+          <TextFieldRoot
+            validationState={validationState(field.error)}
+            value={field.value}
+            class="space-y-2"
+          >
+            <TextFieldLabel>Code</TextFieldLabel>
+            <TextFieldInput
+              {...props}
+              autocomplete="one-time-code"
+              placeholder="Authenticator or recovery code"
+            />
+            <TextFieldErrorMessage>{field.error}</TextFieldErrorMessage>
+          </TextFieldRoot>
+        )}
+      </Field>
+      <Button type="submit" disabled={form.submitting}>
+        <Show when={!form.submitting} fallback="Verifying">Verify</Show>
+      </Button>
+      <Button type="button" variant="ghost" onClick={props.onCancel}>Back</Button>
+      <FormMessage form={form} />
+    </Form>
+  )
+}
+
 type SignUpForm = {
   email: string
   username: string
@@ -361,3 +447,91 @@ export function Forgot() {
   )
 }
 
+
+type ResetForm = {
+  newPassword: string
+  confirmPassword: string
+}
+
+export function Reset() {
+  const navigate = useNavigate()
+  const [searchParams] = useSearchParams()
+
+  const config = createAsync(() => getConfig())
+
+  const [form, { Field, Form }] = createForm<ResetForm>({
+    initialValues: {
+      newPassword: "",
+      confirmPassword: "",
+    },
+    validate: (input) => {
+      if (input.newPassword != input.confirmPassword) {
+        return {
+          confirmPassword: "Password does not match."
+        }
+      }
+      return {}
+    }
+  });
+  const submitForm = (input: ResetForm) => useClient()
+    .public.resetPassword({ token: searchParams.token ?? "", newPassword: input.newPassword })
+    .then(() => {
+      toast.success("Reset password.")
+      navigate("/signin")
+    })
+    .catch(throwAsFormError)
+
+  return (
+    <Layout>
+      <Header>{config()?.siteName}</Header>
+      <CardRoot class="flex flex-col gap-4 p-4">
+        <CardHeader>Reset password</CardHeader>
+        <Form onSubmit={submitForm} class="flex flex-col gap-4">
+          <Field name="newPassword" validate={required('Please enter a new password.')}>
+            {(field, props) => (
+              <TextFieldRoot
+                validationState={validationState(field.error)}
+                value={field.value}
+                class="space-y-2"
+              >
+                <TextFieldLabel>New password</TextFieldLabel>
+                <TextFieldInput
+                  {...props}
+                  autocomplete="new-password"
+                  placeholder="New password"
+                  type="password"
+                />
+                <TextFieldErrorMessage>{field.error}</TextFieldErrorMessage>
+              </TextFieldRoot>
+            )}
+          </Field>
+          <Field name="confirmPassword" validate={required('Please confirm your password.')}>
+            {(field, props) => (
+              <TextFieldRoot
+                validationState={validationState(field.error)}
+                value={field.value}
+                class="space-y-2"
+              >
+                <TextFieldLabel>Confirm password</TextFieldLabel>
+                <TextFieldInput
+                  {...props}
+                  autocomplete="new-password"
+                  placeholder="Confirm password"
+                  type="password"
+                />
+                <TextFieldErrorMessage>{field.error}</TextFieldErrorMessage>
+              </TextFieldRoot>
+            )}
+          </Field>
+          <Button type="submit" disabled={form.submitting}>
+            <Show when={!form.submitting} fallback="Resetting password">Reset password</Show>
+          </Button>
+          <FormMessage form={form} />
+        </Form>
+      </CardRoot>
+      <Footer>
+        <A href="/signin" class={linkVariants()}>Sign in</A>
+      </Footer>
+    </Layout>
+  )
+}
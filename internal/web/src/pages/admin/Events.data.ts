@@ -1,10 +1,28 @@
 import { useClient } from "~/providers/client";
 import { getListEventRules } from "./data";
 import { cache } from "@solidjs/router";
+import { GetAdminEventsPageReq } from "~/twirp/rpc";
+import { parseOrder } from "~/lib/utils";
 
-export const getAdminEventsPage = cache(() => useClient().admin.getAdminEventsPage({}).then((req) => req.response), "getAdminEventsPage")
+export const getAdminEventsPage = cache((input: GetAdminEventsPageReq) => useClient().admin.getAdminEventsPage(input).then((req) => req.response), "getAdminEventsPage")
 
-export default function() {
-  void getAdminEventsPage()
+export function adminEventsPageInput(params: any): GetAdminEventsPageReq {
+  return {
+    page: {
+      page: Number(params.page) || 0,
+      perPage: Number(params.perPage) || 0
+    },
+    sort: {
+      field: params.sort || "",
+      order: parseOrder(params.order)
+    },
+    filterActions: params.action ? JSON.parse(params.action) : [],
+    filterUserIDs: [],
+    filterTarget: params.target || "",
+  }
+}
+
+export default function({ params }: any) {
+  void getAdminEventsPage(adminEventsPageInput(params))
   void getListEventRules()
 }
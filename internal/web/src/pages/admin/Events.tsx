@@ -2,24 +2,27 @@ import Humanize from "humanize-plus"
 import { createForm, reset } from "@modular-forms/solid";
 import { ErrorBoundary, For, Show, Suspense, batch, createSignal, } from "solid-js";
 import { Shared } from "~/components/Shared";
-import { Button } from "~/ui/Button";
+import { Button, buttonVariants } from "~/ui/Button";
 import { FormMessage } from "~/ui/Form";
 import { LayoutNormal } from "~/ui/Layout";
 import { useClient } from "~/providers/client";
-import { action, createAsync, revalidate, useAction, useSubmission } from "@solidjs/router";
+import { action, createAsync, revalidate, useAction, useSearchParams, useSubmission } from "@solidjs/router";
 import { ListEventRulesResp_Item, UpdateEventRuleReq_Item } from "~/twirp/rpc";
 import { Skeleton } from "~/ui/Skeleton";
-import { catchAsToast, createModal, createRowSelection, setFormValue, throwAsFormError, validationState } from "~/lib/utils";
+import { catchAsToast, createModal, createPagePagination, createRowSelection, createToggleSortField, formatDate, parseDate, setFormValue, throwAsFormError, validationState } from "~/lib/utils";
 import { PageError } from "~/ui/Page";
-import { TableBody, TableCell, TableHead, TableHeader, TableRoot, TableRow } from "~/ui/Table";
+import { TableBody, TableCaption, TableCell, TableHead, TableHeader, TableRoot, TableRow } from "~/ui/Table";
 import { CheckboxControl, CheckboxErrorMessage, CheckboxLabel, CheckboxRoot } from "~/ui/Checkbox";
 import { getListEventRules } from "./data";
 import { DialogContent, DialogHeader, DialogOverflow, DialogOverlay, DialogPortal, DialogRoot, DialogTitle } from "~/ui/Dialog";
-import { RiDeviceSaveLine, RiSystemAddLine, RiSystemDeleteBinLine, RiSystemRefreshLine } from "solid-icons/ri";
+import { RiDeviceSaveLine, RiSystemAddLine, RiSystemDeleteBinLine, RiSystemFilterLine, RiSystemRefreshLine } from "solid-icons/ri";
 import { AlertDialogAction, AlertDialogCancel, AlertDialogDescription, AlertDialogFooter, AlertDialogHeader, AlertDialogModal, AlertDialogRoot, AlertDialogTitle } from "~/ui/AlertDialog";
 import { createStore } from "solid-js/store";
 import { TextFieldDescription, TextFieldErrorMessage, TextFieldInput, TextFieldLabel, TextFieldRoot } from "~/ui/TextField";
-import { getAdminEventsPage } from "./Events.data";
+import { adminEventsPageInput, getAdminEventsPage } from "./Events.data";
+import { Crud } from "~/components/Crud";
+import { ComboboxContent, ComboboxControl, ComboboxIcon, ComboboxInput, ComboboxItem, ComboboxItemLabel, ComboboxListbox, ComboboxReset, ComboboxRoot, ComboboxState, ComboboxTrigger } from "~/ui/Combobox";
+import { JSONTableRow } from "../Events";
 
 const actionDeleteEvents = action(() => useClient()
   .admin.deleteEvents({})
@@ -27,7 +30,9 @@ const actionDeleteEvents = action(() => useClient()
   .catch(catchAsToast))
 
 export function AdminEvents() {
-  const data = createAsync(() => getAdminEventsPage())
+  const [searchParams, setSearchParams] = useSearchParams()
+
+  const data = createAsync(() => getAdminEventsPage(adminEventsPageInput(searchParams)))
   const eventRules = createAsync(() => getListEventRules())
   const refetchEventRules = () => revalidate(getListEventRules.key)
 
@@ -69,11 +74,115 @@ export function AdminEvents() {
             <EventRulesTable eventRules={eventRules()!} refetchEventRules={refetchEventRules} />
           </Show>
         </Suspense>
+        <Shared.Title>Audit log</Shared.Title>
+        <Suspense fallback={<Skeleton class="h-32" />}>
+          <AuditLogTable data={data()} searchParams={searchParams} setSearchParams={setSearchParams} />
+        </Suspense>
       </ErrorBoundary>
     </LayoutNormal>
   )
 }
 
+function AuditLogTable(props: {
+  data: Awaited<ReturnType<typeof getAdminEventsPage>> | undefined,
+  searchParams: ReturnType<typeof useSearchParams>[0],
+  setSearchParams: ReturnType<typeof useSearchParams>[1]
+}) {
+  const filterActions = () => props.searchParams.action ? JSON.parse(props.searchParams.action) as string[] : []
+
+  const toggleSort = createToggleSortField(() => props.data?.sort)
+  const pagination = createPagePagination(() => props.data?.pageResult)
+
+  const csvURL = () => {
+    const query = new URLSearchParams()
+    filterActions().forEach(v => query.append("action", v))
+    if (props.searchParams.target) query.set("target", props.searchParams.target)
+    return `/v1/events/csv?${query.toString()}`
+  }
+
+  return (
+    <div class="flex flex-col gap-2">
+      <div class="flex flex-wrap gap-2">
+        <Crud.PerPageSelect
+          perPage={props.data?.pageResult?.perPage}
+          onChange={(perPage) => props.setSearchParams({ perPage })}
+          class="w-20"
+        />
+        <ComboboxRoot<string>
+          multiple
+          options={props.data?.actions || []}
+          placeholder="Action"
+          value={props.data?.actions.filter(v => filterActions().includes(v))}
+          onChange={(value) => props.setSearchParams({ action: value.length != 0 ? JSON.stringify(value) : "", page: "" })}
+          itemComponent={props => (
+            <ComboboxItem item={props.item}>
+              <ComboboxItemLabel>{props.item.rawValue}</ComboboxItemLabel>
+            </ComboboxItem>
+          )}
+        >
+          <ComboboxControl<string> aria-label="Action">
+            {state => (
+              <ComboboxTrigger>
+                <ComboboxIcon as={RiSystemFilterLine} class="size-4" />
+                Action
+                <ComboboxState state={state} />
+                <ComboboxReset state={state} class="size-4" />
+              </ComboboxTrigger>
+            )}
+          </ComboboxControl>
+          <ComboboxContent>
+            <ComboboxInput />
+            <ComboboxListbox />
+          </ComboboxContent>
+        </ComboboxRoot>
+        <a class={buttonVariants({ variant: "link" })} href={csvURL()} download>Export CSV</a>
+        <Crud.PageButtons
+          previousPageDisabled={pagination.previousPageDisabled()}
+          previousPage={pagination.previousPage}
+          nextPageDisabled={pagination.nextPageDisabled()}
+          nextPage={pagination.nextPage}
+          class="flex-1 justify-end"
+        />
+      </div>
+
+      <TableRoot>
+        <TableHeader>
+          <TableRow>
+            <TableHead>
+              <Crud.SortButton onClick={toggleSort} sort={props.data?.sort}>
+                Created At
+              </Crud.SortButton>
+            </TableHead>
+            <TableHead>Actor</TableHead>
+            <TableHead>Action</TableHead>
+            <TableHead>Target</TableHead>
+            <TableHead>IP</TableHead>
+          </TableRow>
+        </TableHeader>
+        <TableBody>
+          <For each={props.data?.events}>
+            {v => (
+              <>
+                <TableRow class="border-b-0">
+                  <TableCell>{formatDate(parseDate(v.createdAtTime))}</TableCell>
+                  <TableCell>{v.username || v.actor}</TableCell>
+                  <TableCell>{v.action}</TableCell>
+                  <TableCell>{v.target}</TableCell>
+                  <TableCell title={v.userAgent}>{v.ip}</TableCell>
+                </TableRow>
+                <JSONTableRow colspan={5} expanded={v.diff != "{}"} data={v.diff != "{}" ? v.diff : v.data} />
+              </>
+            )}
+          </For>
+        </TableBody>
+        <TableCaption>
+          <Crud.PageMetadata pageResult={props.data?.pageResult} />
+        </TableCaption>
+      </TableRoot>
+    </div>
+  )
+}
+
 const actionDeleteEventRule = action((ids: string[]) => useClient()
   .admin.deleteEventRules({ ids })
   .then(() => true)
@@ -0,0 +1,14 @@
+// Player for the built-in HLS streamer, loaded by the page served at `.../hls`.
+// Browsers without native HLS support fall back to hls.js.
+import Hls from "hls.js";
+
+const video = document.getElementById("video") as HTMLVideoElement;
+const src = video.dataset.src!;
+
+if (video.canPlayType("application/vnd.apple.mpegurl")) {
+  video.src = src;
+} else if (Hls.isSupported()) {
+  const hls = new Hls({ liveSyncDurationCount: 2 });
+  hls.loadSource(src);
+  hls.attachMedia(video);
+}
@@ -8,10 +8,11 @@ export type Session = {
   admin: boolean
   user_id: number
   disabled: boolean
+  two_factor_required: boolean
 }
 
 // HACK: this allows App.tsx to switch routes
-export const [lastSession, setLastSession] = makePersisted(createStore<Session>({ valid: false, username: "", admin: false, user_id: 0, disabled: false }), { name: "session" })
+export const [lastSession, setLastSession] = makePersisted(createStore<Session>({ valid: false, username: "", admin: false, user_id: 0, disabled: false, two_factor_required: false }), { name: "session" })
 
 export const getSession = cache(() =>
   fetch("/v1/session", {
@@ -9,6 +9,18 @@ export default defineConfig({
       "~": path.resolve(__dirname, "./src"),
     },
   },
+  build: {
+    rollupOptions: {
+      input: {
+        index: path.resolve(__dirname, "index.html"),
+        // Loaded by the HLS player page served by the API, so it needs a stable name
+        player: path.resolve(__dirname, "src/player.ts"),
+      },
+      output: {
+        entryFileNames: (chunk) => chunk.name == "player" ? "assets/player.js" : "assets/[name]-[hash].js",
+      },
+    },
+  },
   server: {
     port: 5173,
     strictPort: true
@@ -19,6 +19,8 @@ var dist embed.FS
 const (
 	Route       = "/"
 	RouteAssets = "/assets"
+	// RoutePlayer is the HLS player script, see src/player.ts.
+	RoutePlayer = RouteAssets + "/player.js"
 )
 
 func FS(skipPrefix ...string) echo.MiddlewareFunc {
@@ -0,0 +1,17 @@
+package dahuacgi
+
+import (
+	"context"
+)
+
+func MagicBoxGetDeviceType(ctx context.Context, c Conn) (string, error) {
+	req := New("magicBox.cgi").
+		QueryString("action", "getDeviceType")
+
+	table, err := OKTable(c.Do(ctx, req))
+	if err != nil {
+		return "", err
+	}
+
+	return table.Get("type"), nil
+}
@@ -2,6 +2,7 @@ package dahuarpc
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -20,6 +21,7 @@ const clientKeepAliveTimeout = 60 * time.Second
 type Config struct {
 	ctx     context.Context
 	onError func(err error)
+	err     error
 }
 
 type ConfigFunc func(c *Config)
@@ -36,6 +38,13 @@ func WithOnError(fn func(err error)) ConfigFunc {
 	}
 }
 
+// WithError starts the client in the error state so it never logs in.
+func WithError(err error) ConfigFunc {
+	return func(c *Config) {
+		c.err = err
+	}
+}
+
 func clientLogError(address string) func(err error) {
 	return func(err error) {
 		slog.Error("", slog.String("address", address), slog.String("package", "dahuarpc"), slog.String("error", err.Error()))
@@ -131,6 +140,7 @@ func NewClient(httpClient *http.Client, u *url.URL, username, password string, c
 		rpcURL:      URL(u),
 		rpcLoginURL: LoginURL(u),
 		onError:     cfg.onError,
+		err:         cfg.err,
 		doneC:       make(chan struct{}),
 		rpcCC:       make(chan chan clientRPC),
 		stateC:      make(chan ClientState),
@@ -150,6 +160,7 @@ type Client struct {
 	rpcURL      string
 	rpcLoginURL string
 	onError     func(err error)
+	err         error
 
 	doneC chan struct{}
 
@@ -188,12 +199,17 @@ func (c Client) serve(ctx context.Context) {
 		LastLogin: time.Time{},
 		Ticker:    time.NewTicker(clientKeepAliveTimeout),
 	}
+	if c.err != nil {
+		state.To(StateError, c.err)
+	}
 
 	login := func() {
 		err := Login(ctx, c.clientLogin(&state), c.username, c.password)
 		if err != nil {
 			var e *LoginError
-			if errors.As(err, &e) {
+			var certErr *tls.CertificateVerificationError
+			if errors.As(err, &e) || errors.As(err, &certErr) {
+				// Retrying will not help until the client is recreated with different credentials or TLS settings
 				state.To(StateError, err)
 			} else {
 				c.checkError(err)
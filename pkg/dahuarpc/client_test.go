@@ -0,0 +1,27 @@
+package dahuarpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientWithError(t *testing.T) {
+	ctx := context.Background()
+	u, _ := url.Parse("http://127.0.0.1:1")
+	err := errors.New("bad password")
+
+	c := NewClient(http.DefaultClient, u, "admin", "", WithError(err))
+	defer c.Close(ctx)
+
+	state := c.State(ctx)
+	assert.Equal(t, StateError, state.State)
+	assert.ErrorIs(t, state.Error, err)
+
+	_, doErr := c.Do(ctx, New("magicBox.getSerialNo"))
+	assert.ErrorIs(t, doErr, err)
+}
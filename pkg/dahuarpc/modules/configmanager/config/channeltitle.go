@@ -0,0 +1,26 @@
+package config
+
+import (
+	"context"
+
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc"
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc/modules/configmanager"
+)
+
+func GetChannelTitle(ctx context.Context, c dahuarpc.Conn) (configmanager.Config[ChannelTitle], error) {
+	return configmanager.GetConfig[ChannelTitle](ctx, c, "ChannelTitle", true)
+}
+
+type ChannelTitle struct {
+	Name string `json:"Name"`
+}
+
+func (c ChannelTitle) Merge(js string) (string, error) {
+	return configmanager.Merge(js, []configmanager.MergeValues{
+		{Path: "Name", Value: c.Name},
+	})
+}
+
+func (c ChannelTitle) Validate() error {
+	return nil
+}
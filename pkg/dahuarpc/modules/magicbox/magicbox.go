@@ -142,3 +142,17 @@ func ListMethod(ctx context.Context, c dahuarpc.Conn) ([]string, error) {
 	}](ctx, c, dahuarpc.New("magicBox.listMethod"))
 	return res.Params.Method, err
 }
+
+// GetProductDefinition returns a value from the device's product definition (e.g. "MaxRemoteInputChannels" on NVRs).
+func GetProductDefinition[T any](ctx context.Context, c dahuarpc.Conn, name string) (T, error) {
+	res, err := dahuarpc.Send[struct {
+		Definition T `json:"definition"`
+	}](ctx, c, dahuarpc.
+		New("magicBox.getProductDefinition").
+		Params(struct {
+			Name string `json:"name"`
+		}{
+			Name: name,
+		}))
+	return res.Params.Definition, err
+}
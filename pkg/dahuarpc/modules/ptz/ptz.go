@@ -39,7 +39,13 @@ type Client struct {
 
 func (c Client) Instance(ctx context.Context, channel int) (dahuarpc.Response[json.RawMessage], error) {
 	c.client.Lock()
-	res, err := c.client.Cache.Send(ctx, c.conn, strconv.Itoa(channel), dahuarpc.New("ptz.factory.instance"))
+	res, err := c.client.Cache.Send(ctx, c.conn, strconv.Itoa(channel), dahuarpc.
+		New("ptz.factory.instance").
+		Params(struct {
+			Channel int `json:"channel"`
+		}{
+			Channel: channel,
+		}))
 	c.client.Unlock()
 
 	return res, err
@@ -2,6 +2,7 @@ package usermanager
 
 import (
 	"context"
+	"errors"
 
 	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc"
 )
@@ -79,3 +80,78 @@ func GetGroupInfoAll(ctx context.Context, c dahuarpc.Conn) ([]GroupInfo, error)
 
 	return res.Params, nil
 }
+
+// ErrNotConfirmed is returned when the device responds without an error but does not confirm the change.
+var ErrNotConfirmed = errors.New("device did not confirm the change")
+
+// UserParams is a user to add or modify.
+type UserParams struct {
+	Name string `json:"Name"`
+	// Password is only used when adding a user, see ModifyPassword.
+	Password      string   `json:"Password,omitempty"`
+	Group         string   `json:"Group"`
+	AuthorityList []string `json:"AuthorityList"`
+	Memo          string   `json:"Memo"`
+	Reserved      bool     `json:"Reserved"`
+	Sharable      bool     `json:"Sharable"`
+}
+
+func send(ctx context.Context, c dahuarpc.Conn, rb dahuarpc.RequestBuilder) error {
+	res, err := dahuarpc.Send[any](ctx, c, rb)
+	if err != nil {
+		return err
+	}
+	if !res.Result.Bool() {
+		return ErrNotConfirmed
+	}
+	return nil
+}
+
+func AddUser(ctx context.Context, c dahuarpc.Conn, user UserParams) error {
+	return send(ctx, c, dahuarpc.
+		New("userManager.addUser").
+		Params(struct {
+			User UserParams `json:"user"`
+		}{
+			User: user,
+		}))
+}
+
+// ModifyUser modifies the user with the name, which can also rename the user.
+func ModifyUser(ctx context.Context, c dahuarpc.Conn, name string, user UserParams) error {
+	user.Password = ""
+	return send(ctx, c, dahuarpc.
+		New("userManager.modifyUser").
+		Params(struct {
+			Name string     `json:"name"`
+			User UserParams `json:"user"`
+		}{
+			Name: name,
+			User: user,
+		}))
+}
+
+func DeleteUser(ctx context.Context, c dahuarpc.Conn, name string) error {
+	return send(ctx, c, dahuarpc.
+		New("userManager.deleteUser").
+		Params(struct {
+			Name string `json:"name"`
+		}{
+			Name: name,
+		}))
+}
+
+// ModifyPassword changes the password of the user, which requires the old password.
+func ModifyPassword(ctx context.Context, c dahuarpc.Conn, name, oldPassword, newPassword string) error {
+	return send(ctx, c, dahuarpc.
+		New("userManager.modifyPassword").
+		Params(struct {
+			Name   string `json:"name"`
+			Pwd    string `json:"pwd"`
+			PwdOld string `json:"pwdOld"`
+		}{
+			Name:   name,
+			Pwd:    newPassword,
+			PwdOld: oldPassword,
+		}))
+}
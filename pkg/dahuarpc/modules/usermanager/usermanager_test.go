@@ -0,0 +1,51 @@
+package usermanager
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ItsNotGoodName/ipcmanview/pkg/dahuarpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConn struct {
+	response string
+	requests []string
+}
+
+func (c *testConn) Do(ctx context.Context, rb dahuarpc.RequestBuilder) (io.ReadCloser, error) {
+	b, err := json.Marshal(rb.Request)
+	if err != nil {
+		return nil, err
+	}
+	c.requests = append(c.requests, string(b))
+	return io.NopCloser(strings.NewReader(c.response)), nil
+}
+
+func TestModifyPassword(t *testing.T) {
+	c := &testConn{response: `{"id":0,"result":true,"params":null}`}
+
+	require.NoError(t, ModifyPassword(context.Background(), c, "admin", "old", "new"))
+	assert.JSONEq(t, `{"id":0,"method":"userManager.modifyPassword","params":{"name":"admin","pwd":"new","pwdOld":"old"}}`, c.requests[0])
+}
+
+func TestModifyUser(t *testing.T) {
+	c := &testConn{response: `{"id":0,"result":true,"params":null}`}
+
+	require.NoError(t, ModifyUser(context.Background(), c, "viewer", UserParams{Name: "viewer2", Password: "ignored", Group: "user", AuthorityList: []string{"Monitor_01"}}))
+	assert.JSONEq(t, `{"id":0,"method":"userManager.modifyUser","params":{"name":"viewer","user":{"Name":"viewer2","Group":"user","AuthorityList":["Monitor_01"],"Memo":"","Reserved":false,"Sharable":false}}}`, c.requests[0])
+}
+
+func TestNotConfirmed(t *testing.T) {
+	c := &testConn{response: `{"id":0,"result":false,"params":null}`}
+	assert.ErrorIs(t, DeleteUser(context.Background(), c, "viewer"), ErrNotConfirmed)
+
+	c = &testConn{response: `{"id":0,"result":false,"error":{"code":268632064,"message":"Interface not found"}}`}
+	err := DeleteUser(context.Background(), c, "viewer")
+	var resErr *dahuarpc.ResponseError
+	assert.ErrorAs(t, err, &resErr)
+}
@@ -0,0 +1,97 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+)
+
+// DHIPAddress is the multicast address Dahua devices listen on for discovery.
+const DHIPAddress = "239.255.255.251:37810"
+
+const dhipHeaderLength = 32
+
+var dhipMagic = []byte("DHIP")
+
+// DHIP discovers Dahua devices by sending a DHIP discovery request to the address.
+func DHIP(ctx context.Context, address string) ([]Device, error) {
+	return probe(ctx, address, NewDHIPRequest(), func(_ *net.UDPAddr, b []byte) (Device, bool) {
+		return ParseDHIPReply(b)
+	})
+}
+
+// NewDHIPRequest returns a DHIP packet containing a discovery request.
+func NewDHIPRequest() []byte {
+	body, _ := json.Marshal(map[string]any{
+		"method": "DHDiscover.search",
+		"params": map[string]any{
+			"mac": "",
+			"uni": 1,
+		},
+	})
+	return newDHIPPacket(body)
+}
+
+func newDHIPPacket(body []byte) []byte {
+	b := make([]byte, dhipHeaderLength, dhipHeaderLength+len(body))
+	binary.LittleEndian.PutUint32(b[0:4], dhipHeaderLength)
+	copy(b[4:8], dhipMagic)
+	binary.LittleEndian.PutUint32(b[16:20], uint32(len(body)))
+	binary.LittleEndian.PutUint32(b[24:28], uint32(len(body)))
+	return append(b, body...)
+}
+
+type dhipReply struct {
+	Method string `json:"method"`
+	Params struct {
+		DeviceInfo struct {
+			DeviceType  string `json:"DeviceType"`
+			DeviceClass string `json:"DeviceClass"`
+			SerialNo    string `json:"SerialNo"`
+			Version     string `json:"Version"`
+			Mac         string `json:"Mac"`
+			MachineName string `json:"MachineName"`
+			Vendor      string `json:"Vendor"`
+			HTTPPort    int    `json:"HttpPort"`
+			IPv4Address struct {
+				IPAddress string `json:"IPAddress"`
+			} `json:"IPv4Address"`
+		} `json:"deviceInfo"`
+	} `json:"params"`
+}
+
+// ParseDHIPReply parses the device information from a DHIP discovery reply.
+func ParseDHIPReply(b []byte) (Device, bool) {
+	if len(b) < dhipHeaderLength || !bytes.Equal(b[4:8], dhipMagic) {
+		return Device{}, false
+	}
+
+	body := b[dhipHeaderLength:]
+	if length := binary.LittleEndian.Uint32(b[16:20]); int(length) < len(body) {
+		body = body[:length]
+	}
+	body = bytes.TrimRight(body, "\x00")
+
+	var reply dhipReply
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return Device{}, false
+	}
+	if reply.Method != "client.notifyDevInfo" {
+		return Device{}, false
+	}
+
+	info := reply.Params.DeviceInfo
+	return Device{
+		Protocol: ProtocolDHIP,
+		Serial:   info.SerialNo,
+		Model:    info.DeviceType,
+		MAC:      info.Mac,
+		IP:       info.IPv4Address.IPAddress,
+		HTTPPort: info.HTTPPort,
+		Firmware: info.Version,
+		Name:     info.MachineName,
+		Vendor:   info.Vendor,
+	}, true
+}
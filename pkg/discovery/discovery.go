@@ -0,0 +1,121 @@
+// Package discovery finds cameras on the local network with Dahua's DHIP discovery and ONVIF WS-Discovery.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const DefaultTimeout = 3 * time.Second
+
+const (
+	ProtocolDHIP        = "dhip"
+	ProtocolWSDiscovery = "ws-discovery"
+)
+
+// Device is a reply to a discovery probe.
+// Fields the protocol does not report are empty.
+type Device struct {
+	Protocol string
+	Serial   string
+	Model    string
+	MAC      string
+	IP       string
+	HTTPPort int
+	Firmware string
+	Name     string
+	Vendor   string
+}
+
+// NormalizeMAC lowercases the MAC address and separates it with colons.
+func NormalizeMAC(mac string) string {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return strings.ToLower(mac)
+	}
+	return hw.String()
+}
+
+// Merge fills the empty fields of the device with the fields of the other device.
+func (d Device) Merge(other Device) Device {
+	if d.Serial == "" {
+		d.Serial = other.Serial
+	}
+	if d.Model == "" {
+		d.Model = other.Model
+	}
+	if d.MAC == "" {
+		d.MAC = other.MAC
+	}
+	if d.IP == "" {
+		d.IP = other.IP
+	}
+	if d.HTTPPort == 0 {
+		d.HTTPPort = other.HTTPPort
+	}
+	if d.Firmware == "" {
+		d.Firmware = other.Firmware
+	}
+	if d.Name == "" {
+		d.Name = other.Name
+	}
+	if d.Vendor == "" {
+		d.Vendor = other.Vendor
+	}
+	return d
+}
+
+// probe sends the request to the address and parses replies until the context is done.
+// Replies that cannot be parsed are ignored.
+func probe(ctx context.Context, address string, req []byte, parse func(from *net.UDPAddr, b []byte) (Device, bool)) ([]Device, error) {
+	raddr, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultTimeout)
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	if _, err := conn.WriteToUDP(req, raddr); err != nil {
+		return nil, err
+	}
+
+	var devices []Device
+	buf := make([]byte, 64*1024)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return devices, nil
+			}
+			return devices, err
+		}
+
+		device, ok := parse(from, buf[:n])
+		if !ok {
+			continue
+		}
+		if device.IP == "" {
+			device.IP = from.IP.String()
+		}
+		devices = append(devices, device)
+	}
+}
@@ -0,0 +1,117 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// responder is a stand-in for devices on the network that replies to every probe with the replies.
+func responder(t *testing.T, replies ...[]byte) (string, <-chan []byte) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	probes := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			select {
+			case probes <- bytes.Clone(buf[:n]):
+			default:
+			}
+			for _, reply := range replies {
+				conn.WriteToUDP(reply, from)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String(), probes
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestDHIP(t *testing.T) {
+	reply := newDHIPPacket([]byte(`{"mac":"3c:ef:8c:00:00:01","method":"client.notifyDevInfo","params":{"deviceInfo":{"DeviceClass":"IPC","DeviceType":"IPC-HDW3441T-ZAS","HttpPort":80,"IPv4Address":{"DefaultGateway":"192.168.1.1","IPAddress":"192.168.1.108","SubnetMask":"255.255.255.0"},"MachineName":"Front","Mac":"3c:ef:8c:00:00:01","SerialNo":"7L0000000000000","Vendor":"Dahua","Version":"2.840.0000000.3.R"}}}` + "\x00"))
+
+	address, probes := responder(t, []byte("garbage"), reply)
+
+	devices, err := DHIP(testContext(t), address)
+	require.NoError(t, err)
+
+	probe := <-probes
+	assert.Equal(t, []byte("DHIP"), probe[4:8])
+	assert.Contains(t, string(probe[dhipHeaderLength:]), "DHDiscover.search")
+
+	assert.Equal(t, []Device{{
+		Protocol: ProtocolDHIP,
+		Serial:   "7L0000000000000",
+		Model:    "IPC-HDW3441T-ZAS",
+		MAC:      "3c:ef:8c:00:00:01",
+		IP:       "192.168.1.108",
+		HTTPPort: 80,
+		Firmware: "2.840.0000000.3.R",
+		Name:     "Front",
+		Vendor:   "Dahua",
+	}}, devices)
+}
+
+func TestWSDiscovery(t *testing.T) {
+	reply := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://www.w3.org/2003/05/soap-envelope" xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery">
+<SOAP-ENV:Body>
+<d:ProbeMatches>
+<d:ProbeMatch>
+<wsa:EndpointReference><wsa:Address>uuid:d6b3b6a0-0000-0000-0000-3cef8c000002</wsa:Address></wsa:EndpointReference>
+<d:Types>dn:NetworkVideoTransmitter</d:Types>
+<d:Scopes>onvif://www.onvif.org/location/country/china onvif://www.onvif.org/name/Back%20Yard onvif://www.onvif.org/hardware/IPC-HFW2431S onvif://www.onvif.org/MAC/3c:ef:8c:00:00:02</d:Scopes>
+<d:XAddrs>http://[fe80::1]/onvif/device_service http://192.168.1.109:8080/onvif/device_service</d:XAddrs>
+<d:MetadataVersion>1</d:MetadataVersion>
+</d:ProbeMatch>
+</d:ProbeMatches>
+</SOAP-ENV:Body>
+</SOAP-ENV:Envelope>`)
+
+	address, probes := responder(t, reply)
+
+	devices, err := WSDiscovery(testContext(t), address)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(<-probes), "dn:NetworkVideoTransmitter")
+
+	assert.Equal(t, []Device{{
+		Protocol: ProtocolWSDiscovery,
+		Model:    "IPC-HFW2431S",
+		MAC:      "3c:ef:8c:00:00:02",
+		IP:       "192.168.1.109",
+		HTTPPort: 8080,
+		Name:     "Back Yard",
+	}}, devices)
+}
+
+func TestDeviceMerge(t *testing.T) {
+	dhip := Device{Protocol: ProtocolDHIP, MAC: "3C-EF-8C-00-00-01", Serial: "7L0000000000000"}
+	onvif := Device{Protocol: ProtocolWSDiscovery, MAC: "3c:ef:8c:00:00:01", Model: "IPC-HDW3441T-ZAS", HTTPPort: 80}
+
+	assert.Equal(t, NormalizeMAC(dhip.MAC), NormalizeMAC(onvif.MAC))
+	assert.Equal(t, Device{
+		Protocol: ProtocolDHIP,
+		MAC:      "3C-EF-8C-00-00-01",
+		Serial:   "7L0000000000000",
+		Model:    "IPC-HDW3441T-ZAS",
+		HTTPPort: 80,
+	}, dhip.Merge(onvif))
+}
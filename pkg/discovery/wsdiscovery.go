@@ -0,0 +1,105 @@
+package discovery
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// WSDiscoveryAddress is the multicast address ONVIF devices listen on for discovery.
+const WSDiscoveryAddress = "239.255.255.250:3702"
+
+// WSDiscovery discovers ONVIF devices by sending a WS-Discovery probe to the address.
+func WSDiscovery(ctx context.Context, address string) ([]Device, error) {
+	return probe(ctx, address, NewWSDiscoveryProbe(uuid.NewString()), func(_ *net.UDPAddr, b []byte) (Device, bool) {
+		return ParseWSDiscoveryReply(b)
+	})
+}
+
+// NewWSDiscoveryProbe returns a WS-Discovery probe for ONVIF network video transmitters.
+func NewWSDiscoveryProbe(messageID string) []byte {
+	return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<e:Envelope xmlns:e="http://www.w3.org/2003/05/soap-envelope" xmlns:w="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dn="http://www.onvif.org/ver10/network/wsdl">
+<e:Header>
+<w:MessageID>uuid:%s</w:MessageID>
+<w:To e:mustUnderstand="true">urn:schemas-xmlsoap-org:ws:2005:04:discovery</w:To>
+<w:Action e:mustUnderstand="true">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</w:Action>
+</e:Header>
+<e:Body>
+<d:Probe>
+<d:Types>dn:NetworkVideoTransmitter</d:Types>
+</d:Probe>
+</e:Body>
+</e:Envelope>`, messageID))
+}
+
+type wsDiscoveryReply struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Matches []struct {
+		Scopes string `xml:"Scopes"`
+		XAddrs string `xml:"XAddrs"`
+	} `xml:"Body>ProbeMatches>ProbeMatch"`
+}
+
+// ParseWSDiscoveryReply parses the device information from a WS-Discovery probe match.
+// WS-Discovery does not report the firmware, and the serial and MAC are only known when the device puts them in its scopes.
+func ParseWSDiscoveryReply(b []byte) (Device, bool) {
+	var reply wsDiscoveryReply
+	if err := xml.Unmarshal(b, &reply); err != nil || len(reply.Matches) == 0 {
+		return Device{}, false
+	}
+	match := reply.Matches[0]
+
+	device := Device{Protocol: ProtocolWSDiscovery}
+
+	for _, scope := range strings.Fields(match.Scopes) {
+		rest, ok := strings.CutPrefix(scope, "onvif://www.onvif.org/")
+		if !ok {
+			continue
+		}
+		key, value, ok := strings.Cut(rest, "/")
+		if !ok {
+			continue
+		}
+		value, err := url.PathUnescape(value)
+		if err != nil {
+			continue
+		}
+
+		switch strings.ToLower(key) {
+		case "hardware":
+			device.Model = value
+		case "name":
+			device.Name = value
+		case "mac":
+			device.MAC = value
+		case "serial":
+			device.Serial = value
+		}
+	}
+
+	for _, xaddr := range strings.Fields(match.XAddrs) {
+		u, err := url.Parse(xaddr)
+		if err != nil || u.Hostname() == "" || net.ParseIP(u.Hostname()).To4() == nil {
+			continue
+		}
+
+		device.IP = u.Hostname()
+		device.HTTPPort = 80
+		if u.Scheme == "https" {
+			device.HTTPPort = 443
+		}
+		if port, err := strconv.Atoi(u.Port()); err == nil {
+			device.HTTPPort = port
+		}
+		break
+	}
+
+	return device, true
+}
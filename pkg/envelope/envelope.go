@@ -0,0 +1,254 @@
+// Package envelope encrypts short secrets with envelope encryption.
+//
+// Every value is encrypted with its own random data key, and the data key is encrypted with the key encryption key.
+// Rotating the key encryption key only needs the data keys to be rewrapped.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the size of keys in bytes.
+const KeySize = 32
+
+// prefix marks encrypted values, the format is "enc:v1:<key id>:<wrapped data key>:<ciphertext>".
+const prefix = "enc:v1:"
+
+var encoding = base64.RawURLEncoding
+
+var (
+	ErrInvalidKey   = errors.New("invalid key")
+	ErrInvalidValue = errors.New("invalid encrypted value")
+)
+
+// KeyMismatchError is returned when a value was encrypted with a different key.
+type KeyMismatchError struct {
+	KeyID      string
+	ValueKeyID string
+}
+
+func (e KeyMismatchError) Error() string {
+	return fmt.Sprintf("value was encrypted with key %s but the key is %s", e.ValueKeyID, e.KeyID)
+}
+
+// Key is a key encryption key.
+type Key struct {
+	b []byte
+}
+
+// NewKey returns a random key.
+func NewKey() (Key, error) {
+	b := make([]byte, KeySize)
+	if _, err := rand.Read(b); err != nil {
+		return Key{}, err
+	}
+	return Key{b: b}, nil
+}
+
+// ParseKey parses a base64 encoded key.
+func ParseKey(s string) (Key, error) {
+	s = strings.TrimSpace(s)
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		b, err = encoding.DecodeString(strings.TrimRight(s, "="))
+		if err != nil {
+			return Key{}, ErrInvalidKey
+		}
+	}
+	if len(b) != KeySize {
+		return Key{}, ErrInvalidKey
+	}
+	return Key{b: b}, nil
+}
+
+// String returns the base64 encoded key.
+func (k Key) String() string {
+	return base64.StdEncoding.EncodeToString(k.b)
+}
+
+// Valid returns true if the key is not the zero value.
+func (k Key) Valid() bool {
+	return len(k.b) == KeySize
+}
+
+// ID returns a short fingerprint of the key that is safe to store and show.
+func (k Key) ID() string {
+	sum := sha256.Sum256(k.b)
+	return hex.EncodeToString(sum[:4])
+}
+
+// IsEncrypted returns true if the value was encrypted by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID returns the ID of the key the value was encrypted with.
+func KeyID(value string) (string, bool) {
+	keyID, _, _, err := split(value)
+	return keyID, err == nil
+}
+
+// Encrypt encrypts the plaintext.
+// An empty plaintext is returned as is because there is nothing to hide.
+func (k Key) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	if !k.Valid() {
+		return "", ErrInvalidKey
+	}
+
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	wrappedKey, err := seal(k.b, dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return join(k.ID(), wrappedKey, ciphertext), nil
+}
+
+// Decrypt decrypts a value returned by Encrypt.
+// Values that were never encrypted are returned as is.
+func (k Key) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	dataKey, ciphertext, err := k.unwrap(value)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(dataKey, ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// Rewrap encrypts the data key of the value with the new key without decrypting the value.
+// Values that were never encrypted are encrypted with the new key.
+func (k Key) Rewrap(value string, newKey Key) (string, error) {
+	if !IsEncrypted(value) {
+		return newKey.Encrypt(value)
+	}
+	if !newKey.Valid() {
+		return "", ErrInvalidKey
+	}
+
+	dataKey, ciphertext, err := k.unwrap(value)
+	if err != nil {
+		return "", err
+	}
+
+	wrappedKey, err := seal(newKey.b, dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return join(newKey.ID(), wrappedKey, ciphertext), nil
+}
+
+func (k Key) unwrap(value string) ([]byte, []byte, error) {
+	if !k.Valid() {
+		return nil, nil, ErrInvalidKey
+	}
+
+	keyID, wrappedKey, ciphertext, err := split(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	if keyID != k.ID() {
+		return nil, nil, KeyMismatchError{KeyID: k.ID(), ValueKeyID: keyID}
+	}
+
+	dataKey, err := open(k.b, wrappedKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dataKey, ciphertext, nil
+}
+
+func join(keyID string, wrappedKey, ciphertext []byte) string {
+	return prefix + keyID + ":" + encoding.EncodeToString(wrappedKey) + ":" + encoding.EncodeToString(ciphertext)
+}
+
+func split(value string) (string, []byte, []byte, error) {
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return "", nil, nil, ErrInvalidValue
+	}
+	parts := strings.Split(rest, ":")
+	if len(parts) != 3 {
+		return "", nil, nil, ErrInvalidValue
+	}
+	wrappedKey, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, ErrInvalidValue
+	}
+	ciphertext, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, ErrInvalidValue
+	}
+	return parts[0], wrappedKey, ciphertext, nil
+}
+
+// seal encrypts with AES-256-GCM and prepends the nonce.
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key, b []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) < gcm.NonceSize() {
+		return nil, ErrInvalidValue
+	}
+
+	plaintext, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrInvalidValue
+	}
+
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,98 @@
+package envelope
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, err := NewKey()
+	require.NoError(t, err)
+
+	value, err := key.Encrypt("hunter2")
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(value))
+	assert.NotContains(t, value, "hunter2")
+
+	keyID, ok := KeyID(value)
+	assert.True(t, ok)
+	assert.Equal(t, key.ID(), keyID)
+
+	plaintext, err := key.Decrypt(value)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", plaintext)
+
+	other, err := key.Encrypt("hunter2")
+	require.NoError(t, err)
+	assert.NotEqual(t, value, other)
+
+	empty, err := key.Encrypt("")
+	require.NoError(t, err)
+	assert.Equal(t, "", empty)
+
+	plaintext, err = key.Decrypt("not encrypted")
+	require.NoError(t, err)
+	assert.Equal(t, "not encrypted", plaintext)
+}
+
+func TestDecryptWrongKey(t *testing.T) {
+	key, err := NewKey()
+	require.NoError(t, err)
+	wrongKey, err := NewKey()
+	require.NoError(t, err)
+
+	value, err := key.Encrypt("hunter2")
+	require.NoError(t, err)
+
+	_, err = wrongKey.Decrypt(value)
+	assert.ErrorAs(t, err, &KeyMismatchError{})
+
+	keyID, wrappedKey, ciphertext, err := split(value)
+	require.NoError(t, err)
+	ciphertext[len(ciphertext)-1] ^= 1
+	tampered := join(keyID, wrappedKey, ciphertext)
+	_, err = key.Decrypt(tampered)
+	assert.ErrorIs(t, err, ErrInvalidValue)
+}
+
+func TestRewrap(t *testing.T) {
+	oldKey, err := NewKey()
+	require.NoError(t, err)
+	newKey, err := NewKey()
+	require.NoError(t, err)
+
+	value, err := oldKey.Encrypt("hunter2")
+	require.NoError(t, err)
+
+	rewrapped, err := oldKey.Rewrap(value, newKey)
+	require.NoError(t, err)
+	assert.Equal(t, value[strings.LastIndex(value, ":"):], rewrapped[strings.LastIndex(rewrapped, ":"):])
+
+	plaintext, err := newKey.Decrypt(rewrapped)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", plaintext)
+
+	_, err = oldKey.Decrypt(rewrapped)
+	assert.Error(t, err)
+
+	encrypted, err := oldKey.Rewrap("plain", newKey)
+	require.NoError(t, err)
+	plaintext, err = newKey.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "plain", plaintext)
+}
+
+func TestParseKey(t *testing.T) {
+	key, err := NewKey()
+	require.NoError(t, err)
+
+	parsed, err := ParseKey(key.String() + "\n")
+	require.NoError(t, err)
+	assert.Equal(t, key.ID(), parsed.ID())
+
+	_, err = ParseKey("dG9vIHNob3J0")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
@@ -0,0 +1,468 @@
+// Package oidc is a minimal OpenID Connect relying party for the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+// Provider is the subset of the provider's discovery document that is needed for login.
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Discover fetches the provider's discovery document.
+func Discover(ctx context.Context, client *http.Client, issuer string) (Provider, error) {
+	wellKnown := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return Provider{}, err
+	}
+
+	var provider Provider
+	if err := doJSON(client, req, &provider); err != nil {
+		return Provider{}, err
+	}
+
+	if strings.TrimSuffix(provider.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return Provider{}, fmt.Errorf("issuer mismatch: expected %s, got %s", issuer, provider.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return Provider{}, fmt.Errorf("provider is missing endpoints")
+	}
+
+	return provider, nil
+}
+
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Flow is the per-login state that must be kept by the client until the callback.
+type Flow struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// NewFlow generates the random values for a login.
+func NewFlow() (Flow, error) {
+	state, err := randomString()
+	if err != nil {
+		return Flow{}, err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return Flow{}, err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return Flow{}, err
+	}
+	return Flow{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+	}, nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func codeChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// AuthCodeURL returns the URL the user is redirected to for login.
+func AuthCodeURL(provider Provider, cfg Config, flow Flow) string {
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", cfg.ClientID)
+	query.Set("redirect_uri", cfg.RedirectURL)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", flow.State)
+	query.Set("nonce", flow.Nonce)
+	query.Set("code_challenge", codeChallenge(flow.Verifier))
+	query.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return provider.AuthorizationEndpoint + sep + query.Encode()
+}
+
+// Claims are the claims of the ID token merged with the userinfo response.
+type Claims map[string]any
+
+func (c Claims) String(key string) string {
+	v, _ := c[key].(string)
+	return v
+}
+
+func (c Claims) Bool(key string) bool {
+	switch v := c[key].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// Strings returns the claim as a list, a single string is treated as a list of one.
+func (c Claims) Strings(key string) []string {
+	switch v := c[key].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var s []string
+		for _, v := range v {
+			if v, ok := v.(string); ok {
+				s = append(s, v)
+			}
+		}
+		return s
+	}
+	return nil
+}
+
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+}
+
+// Exchange trades the authorization code for tokens and returns the user's claims.
+// The ID token's signature is checked with the provider's JWKS.
+func Exchange(ctx context.Context, client *http.Client, provider Provider, cfg Config, flow Flow, code string) (Claims, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", cfg.RedirectURL)
+	form.Set("client_id", cfg.ClientID)
+	form.Set("code_verifier", flow.Verifier)
+	if cfg.ClientSecret != "" {
+		form.Set("client_secret", cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token tokenResponse
+	if err := doJSON(client, req, &token); err != nil {
+		return nil, err
+	}
+
+	keys, err := FetchKeys(ctx, client, provider)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyIDToken(token.IDToken, keys); err != nil {
+		return nil, err
+	}
+
+	claims, err := parseIDToken(token.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateIDToken(claims, provider, cfg, flow, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if provider.UserinfoEndpoint == "" || token.AccessToken == "" {
+		return claims, nil
+	}
+
+	userinfo, err := UserInfo(ctx, client, provider, token.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	if userinfo.Subject() != claims.Subject() {
+		return nil, fmt.Errorf("userinfo subject mismatch")
+	}
+	for k, v := range userinfo {
+		if _, ok := claims[k]; !ok {
+			claims[k] = v
+		}
+	}
+
+	return claims, nil
+}
+
+// UserInfo fetches the claims from the userinfo endpoint.
+func UserInfo(ctx context.Context, client *http.Client, provider Provider, accessToken string) (Claims, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	var claims Claims
+	if err := doJSON(client, req, &claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func parseIDToken(idToken string) (Claims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIDToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, errors.Join(ErrInvalidIDToken, err)
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.Join(ErrInvalidIDToken, err)
+	}
+
+	return claims, nil
+}
+
+// JWK is a public key from the provider's JWKS, only RSA and EC keys are supported.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// FetchKeys fetches the keys used to sign ID tokens.
+func FetchKeys(ctx context.Context, client *http.Client, provider Provider) ([]JWK, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := doJSON(client, req, &set); err != nil {
+		return nil, err
+	}
+
+	return set.Keys, nil
+}
+
+func (k JWK) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+	}
+}
+
+// verifyIDToken checks the ID token's signature against the keys.
+// Only asymmetric algorithms are allowed.
+func verifyIDToken(idToken string, keys []JWK) error {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return ErrInvalidIDToken
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return errors.Join(ErrInvalidIDToken, err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(b, &header); err != nil {
+		return errors.Join(ErrInvalidIDToken, err)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errors.Join(ErrInvalidIDToken, err)
+	}
+
+	var hash crypto.Hash
+	switch header.Alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidIDToken, header.Alg)
+	}
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	digest := h.Sum(nil)
+
+	for _, key := range keys {
+		if header.Kid != "" && key.Kid != header.Kid {
+			continue
+		}
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		pub, err := key.publicKey()
+		if err != nil {
+			continue
+		}
+
+		switch pub := pub.(type) {
+		case *rsa.PublicKey:
+			switch header.Alg[:2] {
+			case "RS":
+				if rsa.VerifyPKCS1v15(pub, hash, digest, sig) == nil {
+					return nil
+				}
+			case "PS":
+				if rsa.VerifyPSS(pub, hash, digest, sig, nil) == nil {
+					return nil
+				}
+			}
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			if header.Alg[:2] == "ES" && len(sig) == 2*size {
+				r := new(big.Int).SetBytes(sig[:size])
+				s := new(big.Int).SetBytes(sig[size:])
+				if ecdsa.Verify(pub, digest, r, s) {
+					return nil
+				}
+			}
+		}
+	}
+
+	return fmt.Errorf("%w: signature not verified", ErrInvalidIDToken)
+}
+
+func validateIDToken(claims Claims, provider Provider, cfg Config, flow Flow, now time.Time) error {
+	if claims.String("iss") != provider.Issuer {
+		return fmt.Errorf("%w: issuer mismatch", ErrInvalidIDToken)
+	}
+	if !slices.Contains(claims.Strings("aud"), cfg.ClientID) {
+		return fmt.Errorf("%w: audience mismatch", ErrInvalidIDToken)
+	}
+	if claims.String("nonce") != flow.Nonce {
+		return fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if claims.Subject() == "" {
+		return fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0)) {
+		return fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	}
+	return nil
+}
+
+func doJSON(client *http.Client, req *http.Request, v any) error {
+	req.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s: %s: %s", req.URL, res.Status, strings.TrimSpace(string(body)))
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
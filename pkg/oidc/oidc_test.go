@@ -0,0 +1,227 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockProvider is a local OpenID Connect provider that issues a single code.
+type mockProvider struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	clientID  string
+	code      string
+	challenge string
+	nonce     string
+}
+
+func newMockProvider(t *testing.T, clientID string) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	m := &mockProvider{key: key, clientID: clientID, code: "test-code"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Provider{
+			Issuer:                m.URL,
+			AuthorizationEndpoint: m.URL + "/authorize",
+			TokenEndpoint:         m.URL + "/token",
+			UserinfoEndpoint:      m.URL + "/userinfo",
+			JWKSURI:               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []JWK{rsaJWK("key-1", &m.key.PublicKey)},
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		m.challenge = query.Get("code_challenge")
+		m.nonce = query.Get("nonce")
+		http.Redirect(w, r, query.Get("redirect_uri")+"?"+url.Values{
+			"code":  {m.code},
+			"state": {query.Get("state")},
+		}.Encode(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("code") != m.code || codeChallenge(r.PostForm.Get("code_verifier")) != m.challenge {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+
+		payload, _ := json.Marshal(map[string]any{
+			"iss":   m.URL,
+			"aud":   m.clientID,
+			"sub":   "user-1",
+			"nonce": m.nonce,
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"email": "user@example.com",
+		})
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access-token",
+			"id_token":     signRS256(t, m.key, "key-1", payload),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"sub":                "user-1",
+			"preferred_username": "user",
+			"groups":             []string{"admins", "viewers"},
+		})
+	})
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, payload []byte) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid})
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestExchange(t *testing.T) {
+	ctx := context.Background()
+	m := newMockProvider(t, "client")
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	provider, err := Discover(ctx, client, m.URL)
+	require.NoError(t, err)
+
+	cfg := Config{
+		ClientID:    "client",
+		RedirectURL: "http://localhost/callback",
+	}
+	flow, err := NewFlow()
+	require.NoError(t, err)
+
+	res, err := client.Get(AuthCodeURL(provider, cfg, flow))
+	require.NoError(t, err)
+	res.Body.Close()
+	location, err := res.Location()
+	require.NoError(t, err)
+	assert.Equal(t, flow.State, location.Query().Get("state"))
+
+	claims, err := Exchange(ctx, client, provider, cfg, flow, location.Query().Get("code"))
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject())
+	assert.Equal(t, "user@example.com", claims.String("email"))
+	assert.Equal(t, "user", claims.String("preferred_username"))
+	assert.Equal(t, []string{"admins", "viewers"}, claims.Strings("groups"))
+
+	// Wrong verifier
+	flow.Verifier = "wrong"
+	_, err = Exchange(ctx, client, provider, cfg, flow, location.Query().Get("code"))
+	assert.Error(t, err)
+}
+
+func TestValidateIDToken(t *testing.T) {
+	now := time.Now()
+	provider := Provider{Issuer: "https://issuer"}
+	cfg := Config{ClientID: "client"}
+	flow := Flow{Nonce: "nonce"}
+	valid := func() Claims {
+		return Claims{
+			"iss":   "https://issuer",
+			"aud":   []any{"other", "client"},
+			"sub":   "user",
+			"nonce": "nonce",
+			"exp":   float64(now.Add(time.Minute).Unix()),
+		}
+	}
+
+	assert.NoError(t, validateIDToken(valid(), provider, cfg, flow, now))
+
+	for _, key := range []string{"iss", "aud", "sub", "nonce", "exp"} {
+		claims := valid()
+		delete(claims, key)
+		assert.ErrorIs(t, validateIDToken(claims, provider, cfg, flow, now), ErrInvalidIDToken, key)
+	}
+
+	assert.ErrorIs(t, validateIDToken(valid(), provider, cfg, flow, now.Add(time.Hour)), ErrInvalidIDToken)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	keys := []JWK{
+		rsaJWK("key-1", &key.PublicKey),
+		{
+			Kty: "EC",
+			Kid: "key-2",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))),
+			Y:   base64.RawURLEncoding.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32))),
+		},
+	}
+	payload := []byte(`{"sub":"user"}`)
+
+	assert.NoError(t, verifyIDToken(signRS256(t, key, "key-1", payload), keys))
+	assert.NoError(t, verifyIDToken(signRS256(t, key, "", payload), keys), "missing kid tries every key")
+
+	// ES256
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","kid":"key-2"}`))
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+	require.NoError(t, err)
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	assert.NoError(t, verifyIDToken(signed+"."+base64.RawURLEncoding.EncodeToString(sig), keys))
+
+	// Wrong key
+	assert.ErrorIs(t, verifyIDToken(signRS256(t, otherKey, "key-1", payload), keys), ErrInvalidIDToken)
+
+	// Changed payload
+	token := signRS256(t, key, "key-1", payload)
+	parts := strings.Split(token, ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`))
+	assert.ErrorIs(t, verifyIDToken(strings.Join(parts, "."), keys), ErrInvalidIDToken)
+
+	// Unsigned
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+	assert.ErrorIs(t, verifyIDToken(none, keys), ErrInvalidIDToken)
+}
@@ -0,0 +1,54 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test vectors from RFC 6238 Appendix B truncated to 6 digits.
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, tt.code, code, tt.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	code, err := Code(secret, Step(now))
+	assert.NoError(t, err)
+
+	step, ok := Validate(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now), step)
+
+	_, ok = Validate(secret, code, now.Add(Period*time.Second))
+	assert.True(t, ok, "previous period is accepted")
+
+	_, ok = Validate(secret, code, now.Add(3*Period*time.Second))
+	assert.False(t, ok, "old code is rejected")
+
+	_, ok = Validate(secret, "12345", now)
+	assert.False(t, ok)
+}